@@ -15,12 +15,14 @@ package main
 
 import (
 	"flag"
+	"net/http"
 
 	"google.golang.org/grpc"
 
 	"github.com/cortexproject/cortex/pkg/alertmanager"
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/validation"
 	"github.com/weaveworks/common/middleware"
 	"github.com/weaveworks/common/server"
 	"github.com/weaveworks/common/tracing"
@@ -35,18 +37,25 @@ func main() {
 			},
 		}
 		alertmanagerConfig alertmanager.MultitenantAlertmanagerConfig
+		limits             validation.Limits
 	)
 
 	// Setting the environment variable JAEGER_AGENT_HOST enables tracing
 	trace := tracing.NewFromEnv("ingester")
 	defer trace.Close()
 
-	flagext.RegisterFlags(&serverConfig, &alertmanagerConfig)
+	// Replicas proxy requests to each other over HTTP, so that's the port to
+	// advertise in the ring.
+	alertmanagerConfig.ShardingRing.ListenPort = &serverConfig.HTTPListenPort
+	flagext.RegisterFlags(&serverConfig, &alertmanagerConfig, &limits)
 	flag.Parse()
 
 	util.InitLogger(&serverConfig)
 
-	multiAM, err := alertmanager.NewMultitenantAlertmanager(&alertmanagerConfig)
+	overrides, err := validation.NewOverrides(limits)
+	util.CheckFatal("initializing overrides", err)
+
+	multiAM, err := alertmanager.NewMultitenantAlertmanager(&alertmanagerConfig, overrides)
 	util.CheckFatal("initializing MultitenantAlertmanager", err)
 	go multiAM.Run()
 	defer multiAM.Stop()
@@ -57,5 +66,10 @@ func main() {
 
 	server.HTTP.PathPrefix("/status").Handler(multiAM.GetStatusHandler())
 	server.HTTP.PathPrefix("/api/prom").Handler(middleware.AuthenticateUser.Wrap(multiAM))
+	if alertmanagerConfig.Store.Type != "" {
+		server.HTTP.Path("/api/v1/alerts").Methods("GET").Handler(middleware.AuthenticateUser.Wrap(http.HandlerFunc(multiAM.GetUserConfig)))
+		server.HTTP.Path("/api/v1/alerts").Methods("POST").Handler(middleware.AuthenticateUser.Wrap(http.HandlerFunc(multiAM.SetUserConfig)))
+		server.HTTP.Path("/api/v1/alerts").Methods("DELETE").Handler(middleware.AuthenticateUser.Wrap(http.HandlerFunc(multiAM.DeleteUserConfig)))
+	}
 	server.Run()
 }
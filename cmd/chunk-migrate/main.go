@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/weaveworks/common/server"
+
+	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/chunk/migrate"
+	"github.com/cortexproject/cortex/pkg/chunk/storage"
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+func main() {
+	var (
+		serverConfig     server.Config
+		chunkStoreConfig chunk.StoreConfig
+		schemaConfig     chunk.SchemaConfig
+		storageConfig    storage.Config
+		limits           validation.Limits
+		migrateConfig    migrate.Config
+	)
+	flagext.RegisterFlags(&serverConfig, &chunkStoreConfig, &schemaConfig, &storageConfig, &limits, &migrateConfig)
+	flag.Parse()
+
+	util.InitLogger(&serverConfig)
+
+	err := schemaConfig.Load()
+	util.CheckFatal("loading schema config", err)
+	overrides, err := validation.NewOverrides(limits)
+	util.CheckFatal("initializing overrides", err)
+	chunkStore, err := storage.NewStore(storageConfig, chunkStoreConfig, schemaConfig, overrides)
+	util.CheckFatal("initializing chunk store", err)
+	defer chunkStore.Stop()
+
+	walker, err := storage.NewIndexWalker(storageConfig, schemaConfig, migrateConfig.RateLimit)
+	util.CheckFatal("initializing index walker", err)
+
+	migrator, err := migrate.New(migrateConfig, walker, chunkStore)
+	util.CheckFatal("initializing migrator", err)
+
+	if err := migrator.Run(context.Background()); err != nil {
+		level.Error(util.Logger).Log("msg", "migration failed", "err", err)
+		os.Exit(1)
+	}
+	level.Info(util.Logger).Log("msg", "migration complete")
+}
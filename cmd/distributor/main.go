@@ -62,7 +62,7 @@ func main() {
 	trace := tracing.NewFromEnv("distributor")
 	defer trace.Close()
 
-	r, err := ring.New(ringConfig)
+	r, err := ring.New(ringConfig, ring.ConsulKey)
 	util.CheckFatal("initializing ring", err)
 	prometheus.MustRegister(r)
 	defer r.Stop()
@@ -79,7 +79,7 @@ func main() {
 	defer server.Shutdown()
 
 	// Administrator functions
-	server.HTTP.Handle("/ring", r)
+	r.RegisterRoutes(server.HTTP, "/ring")
 	server.HTTP.HandleFunc("/all_user_stats", dist.AllUserStatsHandler)
 
 	operationNameFunc := nethttp.OperationNameFunc(func(r *http.Request) string {
@@ -14,6 +14,8 @@ import (
 	"google.golang.org/grpc"
 
 	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/chunk/aws"
+	"github.com/cortexproject/cortex/pkg/chunk/rollup"
 	"github.com/cortexproject/cortex/pkg/chunk/storage"
 	"github.com/cortexproject/cortex/pkg/distributor"
 	"github.com/cortexproject/cortex/pkg/ingester"
@@ -23,6 +25,7 @@ import (
 	"github.com/cortexproject/cortex/pkg/ruler"
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/stats"
 	"github.com/cortexproject/cortex/pkg/util/validation"
 	"github.com/weaveworks/common/middleware"
 	"github.com/weaveworks/common/server"
@@ -68,7 +71,7 @@ func main() {
 	util.CheckFatal("", err)
 	defer chunkStore.Stop()
 
-	r, err := ring.New(ingesterConfig.LifecyclerConfig.RingConfig)
+	r, err := ring.New(ingesterConfig.LifecyclerConfig.RingConfig, ring.ConsulKey)
 	util.CheckFatal("initializing ring", err)
 	prometheus.MustRegister(r)
 	defer r.Stop()
@@ -86,12 +89,26 @@ func main() {
 	tableClient, err := storage.NewTableClient(storeName, storageConfig)
 	util.CheckFatal("initializing table client", err)
 
+	util.CheckFatal("validating retention periods", chunk.ValidateRetentionPeriods(tbmConfig, overrides))
 	tableManager, err := chunk.NewTableManager(tbmConfig, schemaConfig, ingesterConfig.MaxChunkAge, tableClient)
 	util.CheckFatal("initializing table manager", err)
 	tableManager.Start()
 	defer tableManager.Stop()
 
+	if tbmConfig.RetentionDeletesEnabled && tbmConfig.ChunkSweepPeriod > 0 {
+		sweeper, err := storage.NewRetentionSweeper(storageConfig, tbmConfig, schemaConfig, overrides)
+		util.CheckFatal("initializing retention sweeper", err)
+		sweeper.Start()
+		defer sweeper.Stop()
+	}
+
 	queryable, engine := querier.New(querierConfig, dist, chunkStore)
+	if querierConfig.RollupSchemaConfigFile != "" {
+		rollupStore, err := rollup.NewStore(querierConfig.RollupSchemaConfigFile, storageConfig, chunkStoreConfig, overrides)
+		util.CheckFatal("initializing rollup store", err)
+		defer rollupStore.Stop()
+		queryable = querier.NewRollupQueryable(querierConfig, rollupStore, queryable)
+	}
 
 	if configStoreConfig.ConfigsAPIURL.String() != "" || configStoreConfig.DBConfig.URI != "" {
 		rulesAPI, err := ruler.NewRulesAPI(configStoreConfig)
@@ -105,6 +122,11 @@ func main() {
 		defer rulerServer.Stop()
 	}
 
+	// Rules are evaluated for one user at a time, so only the APIs federate.
+	if querierConfig.TenantFederation {
+		queryable = querier.NewFederatedQueryable(queryable, overrides)
+	}
+
 	api := v1.NewAPI(
 		engine,
 		queryable,
@@ -122,6 +144,13 @@ func main() {
 	)
 	promRouter := route.New().WithPrefix("/api/prom/api/v1")
 	api.Register(promRouter)
+	promHandler := querier.QueryLogMiddleware(querierConfig, util.Logger).Wrap(promRouter)
+	if querierConfig.QueryStatsEnabled {
+		promHandler = stats.Middleware.Wrap(promHandler)
+	}
+	if querierConfig.RollupSchemaConfigFile != "" {
+		promHandler = querier.RollupMiddleware.Wrap(promHandler)
+	}
 
 	activeMiddleware := middleware.AuthenticateUser
 	if unauthenticated {
@@ -143,15 +172,16 @@ func main() {
 	}
 
 	subrouter := server.HTTP.PathPrefix("/api/prom").Subrouter()
-	subrouter.PathPrefix("/api/v1").Handler(activeMiddleware.Wrap(promRouter))
-	subrouter.Path("/read").Handler(activeMiddleware.Wrap(querier.RemoteReadHandler(queryable)))
+	subrouter.PathPrefix("/api/v1").Handler(activeMiddleware.Wrap(promHandler))
+	subrouter.Path("/read").Handler(activeMiddleware.Wrap(querier.RemoteReadHandler(queryable, querierConfig.MaxStreamedReadBytes)))
 	subrouter.Path("/validate_expr").Handler(activeMiddleware.Wrap(http.HandlerFunc(dist.ValidateExprHandler)))
 	subrouter.Path("/user_stats").Handler(activeMiddleware.Wrap(http.HandlerFunc(dist.UserStatsHandler)))
 
 	client.RegisterIngesterServer(server.GRPC, ingester)
 	server.HTTP.Handle("/ready", http.HandlerFunc(ingester.ReadinessHandler))
 	server.HTTP.Handle("/flush", http.HandlerFunc(ingester.FlushHandler))
-	server.HTTP.Handle("/ring", r)
+	r.RegisterRoutes(server.HTTP, "/ring")
+	aws.DefaultUsageReports.RegisterRoutes(server.HTTP)
 	operationNameFunc := nethttp.OperationNameFunc(func(r *http.Request) string {
 		return r.URL.RequestURI()
 	})
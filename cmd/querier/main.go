@@ -13,6 +13,7 @@ import (
 	v1 "github.com/prometheus/prometheus/web/api/v1"
 
 	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/chunk/rollup"
 	"github.com/cortexproject/cortex/pkg/chunk/storage"
 	chunk_util "github.com/cortexproject/cortex/pkg/chunk/util"
 	"github.com/cortexproject/cortex/pkg/distributor"
@@ -22,6 +23,7 @@ import (
 	"github.com/cortexproject/cortex/pkg/ring"
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/stats"
 	"github.com/cortexproject/cortex/pkg/util/validation"
 	httpgrpc_server "github.com/weaveworks/common/httpgrpc/server"
 	"github.com/weaveworks/common/middleware"
@@ -60,7 +62,7 @@ func main() {
 
 	util.InitLogger(&serverConfig)
 
-	r, err := ring.New(ringConfig)
+	r, err := ring.New(ringConfig, ring.ConsulKey)
 	util.CheckFatal("initializing ring", err)
 	prometheus.MustRegister(r)
 	defer r.Stop()
@@ -75,7 +77,7 @@ func main() {
 	server, err := server.New(serverConfig)
 	util.CheckFatal("initializing server", err)
 	defer server.Shutdown()
-	server.HTTP.Handle("/ring", r)
+	r.RegisterRoutes(server.HTTP, "/ring")
 
 	chunkStore, err := storage.NewStore(storageConfig, chunkStoreConfig, schemaConfig, overrides)
 	util.CheckFatal("initializing storage client", err)
@@ -86,6 +88,16 @@ func main() {
 	defer worker.Stop()
 
 	queryable, engine := querier.New(querierConfig, dist, chunkStore)
+	if querierConfig.RollupSchemaConfigFile != "" {
+		rollupStore, err := rollup.NewStore(querierConfig.RollupSchemaConfigFile, storageConfig, chunkStoreConfig, overrides)
+		util.CheckFatal("initializing rollup store", err)
+		defer rollupStore.Stop()
+		queryable = querier.NewRollupQueryable(querierConfig, rollupStore, queryable)
+	}
+	if querierConfig.TenantFederation {
+		queryable = querier.NewFederatedQueryable(queryable, overrides)
+	}
+
 	api := v1.NewAPI(
 		engine,
 		queryable,
@@ -103,10 +115,17 @@ func main() {
 	)
 	promRouter := route.New().WithPrefix("/api/prom/api/v1")
 	api.Register(promRouter)
+	promHandler := querier.QueryLogMiddleware(querierConfig, util.Logger).Wrap(promRouter)
+	if querierConfig.QueryStatsEnabled {
+		promHandler = stats.Middleware.Wrap(promHandler)
+	}
+	if querierConfig.RollupSchemaConfigFile != "" {
+		promHandler = querier.RollupMiddleware.Wrap(promHandler)
+	}
 
 	subrouter := server.HTTP.PathPrefix("/api/prom").Subrouter()
-	subrouter.PathPrefix("/api/v1").Handler(middleware.AuthenticateUser.Wrap(promRouter))
-	subrouter.Path("/read").Handler(middleware.AuthenticateUser.Wrap(querier.RemoteReadHandler(queryable)))
+	subrouter.PathPrefix("/api/v1").Handler(middleware.AuthenticateUser.Wrap(promHandler))
+	subrouter.Path("/read").Handler(middleware.AuthenticateUser.Wrap(querier.RemoteReadHandler(queryable, querierConfig.MaxStreamedReadBytes)))
 	subrouter.Path("/validate_expr").Handler(middleware.AuthenticateUser.Wrap(http.HandlerFunc(dist.ValidateExprHandler)))
 	subrouter.Path("/user_stats").Handler(middleware.AuthenticateUser.Wrap(http.HandlerFunc(dist.UserStatsHandler)))
 	subrouter.Path("/chunks").Handler(middleware.AuthenticateUser.Wrap(querier.ChunksHandler(queryable)))
@@ -55,6 +55,7 @@ func main() {
 	defer f.Close()
 
 	frontend.RegisterFrontendServer(server.GRPC, f)
+	f.RegisterRoutes(server.HTTP)
 	server.HTTP.PathPrefix("/api/prom").Handler(middleware.AuthenticateUser.Wrap(f.Handler()))
 	server.Run()
 }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/weaveworks/common/server"
+
+	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/chunk/rollup"
+	"github.com/cortexproject/cortex/pkg/chunk/storage"
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+func main() {
+	var (
+		serverConfig     server.Config
+		chunkStoreConfig chunk.StoreConfig
+		schemaConfig     chunk.SchemaConfig
+		storageConfig    storage.Config
+		limits           validation.Limits
+		rollupConfig     rollup.Config
+	)
+	flagext.RegisterFlags(&serverConfig, &chunkStoreConfig, &schemaConfig, &storageConfig, &limits, &rollupConfig)
+	flag.Parse()
+
+	util.InitLogger(&serverConfig)
+
+	err := schemaConfig.Load()
+	util.CheckFatal("loading schema config", err)
+	overrides, err := validation.NewOverrides(limits)
+	util.CheckFatal("initializing overrides", err)
+
+	walker, err := storage.NewIndexWalker(storageConfig, schemaConfig, rollupConfig.RateLimit)
+	util.CheckFatal("initializing index walker", err)
+
+	rollupStore, err := rollup.NewStore(rollupConfig.SchemaConfigFile, storageConfig, chunkStoreConfig, overrides)
+	util.CheckFatal("initializing rollup store", err)
+	defer rollupStore.Stop()
+
+	roller, err := rollup.New(rollupConfig, walker, rollupStore)
+	util.CheckFatal("initializing roller", err)
+
+	if err := roller.Run(context.Background()); err != nil {
+		level.Error(util.Logger).Log("msg", "rollup failed", "err", err)
+		os.Exit(1)
+	}
+	level.Info(util.Logger).Log("msg", "rollup complete")
+}
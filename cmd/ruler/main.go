@@ -59,7 +59,7 @@ func main() {
 	util.CheckFatal("", err)
 	defer chunkStore.Stop()
 
-	r, err := ring.New(ringConfig)
+	r, err := ring.New(ringConfig, ring.ConsulKey)
 	util.CheckFatal("initializing ring", err)
 	prometheus.MustRegister(r)
 	defer r.Stop()
@@ -95,6 +95,6 @@ func main() {
 		a.RegisterRoutes(server.HTTP)
 	}
 
-	server.HTTP.Handle("/ring", r)
+	r.RegisterRoutes(server.HTTP, "/ring")
 	server.Run()
 }
@@ -8,10 +8,12 @@ import (
 	"google.golang.org/grpc"
 
 	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/chunk/aws"
 	"github.com/cortexproject/cortex/pkg/chunk/storage"
 	"github.com/cortexproject/cortex/pkg/ingester"
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/validation"
 	"github.com/weaveworks/common/middleware"
 	"github.com/weaveworks/common/server"
 	"github.com/weaveworks/common/tracing"
@@ -30,13 +32,14 @@ func main() {
 		storageConfig  storage.Config
 		schemaConfig   chunk.SchemaConfig
 		tbmConfig      chunk.TableManagerConfig
+		limitsConfig   validation.Limits
 	)
 
 	// Setting the environment variable JAEGER_AGENT_HOST enables tracing
 	trace := tracing.NewFromEnv("ingester")
 	defer trace.Close()
 
-	flagext.RegisterFlags(&ingesterConfig, &serverConfig, &storageConfig, &schemaConfig, &tbmConfig)
+	flagext.RegisterFlags(&ingesterConfig, &serverConfig, &storageConfig, &schemaConfig, &tbmConfig, &limitsConfig)
 	flag.Parse()
 
 	util.InitLogger(&serverConfig)
@@ -54,7 +57,7 @@ func main() {
 		tbmConfig.IndexTables.ReadScale.Enabled ||
 		tbmConfig.ChunkTables.InactiveReadScale.Enabled ||
 		tbmConfig.IndexTables.InactiveReadScale.Enabled) &&
-		(storageConfig.AWSStorageConfig.ApplicationAutoScaling.URL == nil && storageConfig.AWSStorageConfig.Metrics.URL == "") {
+		(storageConfig.AWSStorageConfig.ApplicationAutoScaling.URL == nil && storageConfig.AWSStorageConfig.Metrics.URL == "" && !storageConfig.AWSStorageConfig.Metrics.InProcess) {
 		level.Error(util.Logger).Log("msg", "WriteScale is enabled but no ApplicationAutoScaling or Metrics URL has been provided")
 		os.Exit(1)
 	}
@@ -62,14 +65,30 @@ func main() {
 	tableClient, err := storage.NewTableClient(lastConfig.IndexType, storageConfig)
 	util.CheckFatal("initializing table client", err)
 
+	var overrides *validation.Overrides
+	if tbmConfig.RetentionDeletesEnabled {
+		overrides, err = validation.NewOverrides(limitsConfig)
+		util.CheckFatal("initializing overrides", err)
+		defer overrides.Stop()
+		util.CheckFatal("validating retention periods", chunk.ValidateRetentionPeriods(tbmConfig, overrides))
+	}
+
 	tableManager, err := chunk.NewTableManager(tbmConfig, schemaConfig, ingesterConfig.MaxChunkAge, tableClient)
 	util.CheckFatal("initializing table manager", err)
 	tableManager.Start()
 	defer tableManager.Stop()
 
+	if tbmConfig.RetentionDeletesEnabled && tbmConfig.ChunkSweepPeriod > 0 {
+		sweeper, err := storage.NewRetentionSweeper(storageConfig, tbmConfig, schemaConfig, overrides)
+		util.CheckFatal("initializing retention sweeper", err)
+		sweeper.Start()
+		defer sweeper.Stop()
+	}
+
 	server, err := server.New(serverConfig)
 	util.CheckFatal("initializing server", err)
 	defer server.Shutdown()
 
+	aws.DefaultUsageReports.RegisterRoutes(server.HTTP)
 	server.Run()
 }
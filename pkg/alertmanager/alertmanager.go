@@ -25,6 +25,9 @@ import (
 	"github.com/prometheus/common/route"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/weaveworks/mesh"
+	"golang.org/x/time/rate"
+
+	"github.com/cortexproject/cortex/pkg/util/validation"
 )
 
 const notificationLogMaintenancePeriod = 15 * time.Minute
@@ -38,6 +41,8 @@ type Config struct {
 	MeshRouter  gossipRouter
 	Retention   time.Duration
 	ExternalURL *url.URL
+	// Per-user limits on notifications; nil for no limits.
+	Limits *validation.Overrides
 }
 
 // An Alertmanager manages the alerts for one user.
@@ -54,14 +59,19 @@ type Alertmanager struct {
 	stop       chan struct{}
 	wg         sync.WaitGroup
 	router     *route.Router
+
+	// Notification rate limiters, by integration type.
+	limitersMtx sync.Mutex
+	limiters    map[string]*rate.Limiter
 }
 
 // New creates a new Alertmanager.
 func New(cfg *Config) (*Alertmanager, error) {
 	am := &Alertmanager{
-		cfg:    cfg,
-		logger: log.With(cfg.Logger, "user", cfg.UserID),
-		stop:   make(chan struct{}),
+		cfg:      cfg,
+		logger:   log.With(cfg.Logger, "user", cfg.UserID),
+		stop:     make(chan struct{}),
+		limiters: map[string]*rate.Limiter{},
 	}
 
 	am.wg.Add(1)
@@ -186,7 +196,7 @@ func (am *Alertmanager) ApplyConfig(userID string, conf *config.Config) error {
 		return d + waitFunc()
 	}
 
-	pipeline = notify.BuildPipeline(
+	pipeline = am.buildPipeline(
 		conf.Receivers,
 		tmpl,
 		waitFunc,
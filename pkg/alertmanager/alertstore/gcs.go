@@ -0,0 +1,96 @@
+package alertstore
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+	"gopkg.in/yaml.v2"
+)
+
+// GCSConfig is the config for a GCS-backed AlertStore.
+type GCSConfig struct {
+	BucketName string
+}
+
+type gcsAlertStore struct {
+	bucket *storage.BucketHandle
+}
+
+// NewGCSAlertStore makes an AlertStore which keeps each user's configuration
+// in an object in a GCS bucket.
+func NewGCSAlertStore(ctx context.Context, cfg GCSConfig) (AlertStore, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &gcsAlertStore{
+		bucket: client.Bucket(cfg.BucketName),
+	}, nil
+}
+
+func (s *gcsAlertStore) ListAlertConfigs(ctx context.Context) (map[string]AlertConfig, error) {
+	cfgs := map[string]AlertConfig{}
+	it := s.bucket.Objects(ctx, &storage.Query{Prefix: configKey("")})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		userID := strings.TrimPrefix(attrs.Name, configKey(""))
+		cfg, err := s.GetAlertConfig(ctx, userID)
+		if err == ErrNotFound {
+			// Deleted since we listed the bucket.
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		cfgs[userID] = cfg
+	}
+	return cfgs, nil
+}
+
+func (s *gcsAlertStore) GetAlertConfig(ctx context.Context, userID string) (AlertConfig, error) {
+	var cfg AlertConfig
+	reader, err := s.bucket.Object(configKey(userID)).NewReader(ctx)
+	if err == storage.ErrObjectNotExist {
+		return cfg, ErrNotFound
+	} else if err != nil {
+		return cfg, err
+	}
+	defer reader.Close()
+
+	buf, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return cfg, err
+	}
+	err = yaml.Unmarshal(buf, &cfg)
+	return cfg, err
+}
+
+func (s *gcsAlertStore) SetAlertConfig(ctx context.Context, userID string, cfg AlertConfig) error {
+	buf, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	writer := s.bucket.Object(configKey(userID)).NewWriter(ctx)
+	if _, err := writer.Write(buf); err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
+
+func (s *gcsAlertStore) DeleteAlertConfig(ctx context.Context, userID string) error {
+	err := s.bucket.Object(configKey(userID)).Delete(ctx)
+	if err == storage.ErrObjectNotExist {
+		return nil
+	}
+	return err
+}
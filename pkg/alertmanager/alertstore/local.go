@@ -0,0 +1,109 @@
+package alertstore
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const localConfigSuffix = ".yaml"
+
+// LocalConfig is the config for a local AlertStore.
+type LocalConfig struct {
+	Directory string
+}
+
+type localAlertStore struct {
+	cfg LocalConfig
+}
+
+// NewLocalAlertStore makes an AlertStore which keeps each user's
+// configuration in a YAML file in a local directory.
+func NewLocalAlertStore(cfg LocalConfig) (AlertStore, error) {
+	if err := os.MkdirAll(cfg.Directory, 0755); err != nil {
+		return nil, err
+	}
+	return &localAlertStore{cfg: cfg}, nil
+}
+
+func (s *localAlertStore) filename(userID string) string {
+	// User IDs may contain characters, such as '/', which aren't allowed in filenames.
+	return filepath.Join(s.cfg.Directory, url.PathEscape(userID)+localConfigSuffix)
+}
+
+func (s *localAlertStore) ListAlertConfigs(ctx context.Context) (map[string]AlertConfig, error) {
+	files, err := ioutil.ReadDir(s.cfg.Directory)
+	if err != nil {
+		return nil, err
+	}
+
+	cfgs := map[string]AlertConfig{}
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, localConfigSuffix) {
+			continue
+		}
+		userID, err := url.PathUnescape(strings.TrimSuffix(name, localConfigSuffix))
+		if err != nil {
+			continue
+		}
+		cfg, err := s.GetAlertConfig(ctx, userID)
+		if err == ErrNotFound {
+			// Deleted since we listed the directory.
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		cfgs[userID] = cfg
+	}
+	return cfgs, nil
+}
+
+func (s *localAlertStore) GetAlertConfig(_ context.Context, userID string) (AlertConfig, error) {
+	var cfg AlertConfig
+	buf, err := ioutil.ReadFile(s.filename(userID))
+	if os.IsNotExist(err) {
+		return cfg, ErrNotFound
+	} else if err != nil {
+		return cfg, err
+	}
+	err = yaml.Unmarshal(buf, &cfg)
+	return cfg, err
+}
+
+func (s *localAlertStore) SetAlertConfig(_ context.Context, userID string, cfg AlertConfig) error {
+	buf, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it, so a concurrent reader never
+	// sees a partially written config.
+	tmp, err := ioutil.TempFile(s.cfg.Directory, ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.filename(userID))
+}
+
+func (s *localAlertStore) DeleteAlertConfig(_ context.Context, userID string) error {
+	err := os.Remove(s.filename(userID))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,48 @@
+package alertstore
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalAlertStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alertstore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	store, err := NewLocalAlertStore(LocalConfig{Directory: dir})
+	require.NoError(t, err)
+
+	_, err = store.GetAlertConfig(ctx, "user/1")
+	require.Equal(t, ErrNotFound, err)
+
+	cfg := AlertConfig{
+		TemplateFiles:      map[string]string{"foo.tmpl": "{{ define \"foo\" }}foo{{ end }}"},
+		AlertmanagerConfig: "route:\n  receiver: dummy\nreceivers:\n- name: dummy\n",
+	}
+	require.NoError(t, store.SetAlertConfig(ctx, "user/1", cfg))
+	other := AlertConfig{AlertmanagerConfig: cfg.AlertmanagerConfig}
+	require.NoError(t, store.SetAlertConfig(ctx, "user2", other))
+
+	got, err := store.GetAlertConfig(ctx, "user/1")
+	require.NoError(t, err)
+	require.Equal(t, cfg, got)
+
+	all, err := store.ListAlertConfigs(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]AlertConfig{
+		"user/1": cfg,
+		"user2":  other,
+	}, all)
+
+	require.NoError(t, store.DeleteAlertConfig(ctx, "user/1"))
+	require.NoError(t, store.DeleteAlertConfig(ctx, "user/1"))
+	all, err = store.ListAlertConfigs(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]AlertConfig{"user2": other}, all)
+}
@@ -0,0 +1,118 @@
+package alertstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"gopkg.in/yaml.v2"
+
+	"github.com/cortexproject/cortex/pkg/util/flagext"
+	awscommon "github.com/weaveworks/common/aws"
+)
+
+// S3Config is the config for an S3-backed AlertStore.
+type S3Config struct {
+	URL flagext.URLValue
+}
+
+type s3AlertStore struct {
+	bucketName string
+	S3         s3iface.S3API
+}
+
+// NewS3AlertStore makes an AlertStore which keeps each user's configuration
+// in an object in an S3 bucket.
+func NewS3AlertStore(cfg S3Config) (AlertStore, error) {
+	if cfg.URL.URL == nil {
+		return nil, fmt.Errorf("no URL specified for S3")
+	}
+	s3Config, err := awscommon.ConfigFromURL(cfg.URL.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3AlertStore{
+		S3:         s3.New(session.New(s3Config)),
+		bucketName: strings.TrimPrefix(cfg.URL.Path, "/"),
+	}, nil
+}
+
+func (s *s3AlertStore) ListAlertConfigs(ctx context.Context) (map[string]AlertConfig, error) {
+	var userIDs []string
+	err := s.S3.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucketName),
+		Prefix: aws.String(configKey("")),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			userIDs = append(userIDs, strings.TrimPrefix(*object.Key, configKey("")))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cfgs := make(map[string]AlertConfig, len(userIDs))
+	for _, userID := range userIDs {
+		cfg, err := s.GetAlertConfig(ctx, userID)
+		if err == ErrNotFound {
+			// Deleted since we listed the bucket.
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		cfgs[userID] = cfg
+	}
+	return cfgs, nil
+}
+
+func (s *s3AlertStore) GetAlertConfig(ctx context.Context, userID string) (AlertConfig, error) {
+	var cfg AlertConfig
+	resp, err := s.S3.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(configKey(userID)),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return cfg, ErrNotFound
+	} else if err != nil {
+		return cfg, err
+	}
+	defer resp.Body.Close()
+
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return cfg, err
+	}
+	err = yaml.Unmarshal(buf, &cfg)
+	return cfg, err
+}
+
+func (s *s3AlertStore) SetAlertConfig(ctx context.Context, userID string, cfg AlertConfig) error {
+	buf, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.S3.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Body:   bytes.NewReader(buf),
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(configKey(userID)),
+	})
+	return err
+}
+
+func (s *s3AlertStore) DeleteAlertConfig(ctx context.Context, userID string) error {
+	_, err := s.S3.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(configKey(userID)),
+	})
+	return err
+}
@@ -0,0 +1,66 @@
+package alertstore
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+)
+
+// ErrNotFound is returned when a user has no Alertmanager configuration.
+var ErrNotFound = errors.New("alertmanager configuration not found")
+
+// AlertConfig is the Alertmanager configuration of a single user, along with
+// the templates it references.
+type AlertConfig struct {
+	TemplateFiles      map[string]string `yaml:"template_files,omitempty"`
+	AlertmanagerConfig string            `yaml:"alertmanager_config"`
+}
+
+// AlertStore stores the Alertmanager configurations of all users.
+type AlertStore interface {
+	ListAlertConfigs(ctx context.Context) (map[string]AlertConfig, error)
+	GetAlertConfig(ctx context.Context, userID string) (AlertConfig, error)
+	SetAlertConfig(ctx context.Context, userID string, cfg AlertConfig) error
+	DeleteAlertConfig(ctx context.Context, userID string) error
+}
+
+// Config says where the Alertmanager configurations are stored.
+type Config struct {
+	Type string
+
+	Local LocalConfig
+	GCS   GCSConfig
+	S3    S3Config
+}
+
+// RegisterFlags adds the flags required to config this to the given FlagSet.
+func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
+	f.StringVar(&cfg.Type, "alertmanager.config-store.type", "", "Where to store Alertmanager configurations served by the alertmanager's own API (local, gcs, s3). Empty to use the configs service.")
+	f.StringVar(&cfg.Local.Directory, "alertmanager.config-store.local.path", "", "Directory to store Alertmanager configurations in.")
+	f.StringVar(&cfg.GCS.BucketName, "alertmanager.config-store.gcs.bucketname", "", "Name of GCS bucket to store Alertmanager configurations in.")
+	f.Var(&cfg.S3.URL, "alertmanager.config-store.s3.url", "S3 endpoint URL with escaped Key and Secret encoded. The bucket is taken from the path.")
+}
+
+// New makes a new AlertStore of the configured type. It returns nil if no
+// type is configured, in which case configurations come from the configs
+// service.
+func New(ctx context.Context, cfg Config) (AlertStore, error) {
+	switch cfg.Type {
+	case "":
+		return nil, nil
+	case "local":
+		return NewLocalAlertStore(cfg.Local)
+	case "gcs":
+		return NewGCSAlertStore(ctx, cfg.GCS)
+	case "s3":
+		return NewS3AlertStore(cfg.S3)
+	default:
+		return nil, fmt.Errorf("unrecognized alertmanager config store type %q, choices are: local, gcs, s3", cfg.Type)
+	}
+}
+
+// configKey is the name of the object holding userID's configuration.
+func configKey(userID string) string {
+	return "alerts/" + userID
+}
@@ -0,0 +1,143 @@
+package alertmanager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/go-kit/kit/log/level"
+	amconfig "github.com/prometheus/alertmanager/config"
+	"gopkg.in/yaml.v2"
+
+	"github.com/cortexproject/cortex/pkg/alertmanager/alertstore"
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/weaveworks/common/user"
+)
+
+// GetUserConfig returns the Alertmanager configuration of the requesting
+// user from the config store, as YAML.
+func (am *MultitenantAlertmanager) GetUserConfig(w http.ResponseWriter, r *http.Request) {
+	userID, _, err := user.ExtractOrgIDFromHTTPRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	logger := util.WithContext(r.Context(), util.Logger)
+
+	cfg, err := am.store.GetAlertConfig(r.Context(), userID)
+	if err == alertstore.ErrNotFound {
+		http.Error(w, "No configuration", http.StatusNotFound)
+		return
+	} else if err != nil {
+		level.Error(logger).Log("msg", "error getting config", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	buf, err := yaml.Marshal(cfg)
+	if err != nil {
+		level.Error(logger).Log("msg", "error encoding config", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(buf)
+}
+
+// SetUserConfig validates and stores the Alertmanager configuration of the
+// requesting user, and applies it straight away.
+func (am *MultitenantAlertmanager) SetUserConfig(w http.ResponseWriter, r *http.Request) {
+	userID, _, err := user.ExtractOrgIDFromHTTPRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if am.shouldProxyConfigRequest(r, userID) {
+		am.proxyToOwner(w, r, userID)
+		return
+	}
+	logger := util.WithContext(r.Context(), util.Logger)
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		level.Error(logger).Log("msg", "error reading request body", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var cfg alertstore.AlertConfig
+	if err := yaml.Unmarshal(body, &cfg); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid config: %v", err), http.StatusBadRequest)
+		return
+	}
+	amConfig, err := amconfig.Load(cfg.AlertmanagerConfig)
+	if err != nil {
+		level.Error(logger).Log("msg", "invalid Alertmanager config", "err", err)
+		http.Error(w, fmt.Sprintf("Invalid Alertmanager config: %v", err), http.StatusBadRequest)
+		return
+	}
+	if _, err := am.transformConfig(userID, amConfig); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid Alertmanager config: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := am.store.SetAlertConfig(r.Context(), userID, cfg); err != nil {
+		level.Error(logger).Log("msg", "error storing config", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Apply the config now rather than waiting for the next poll.
+	am.configsMtx.Lock()
+	config := configFromAlertConfig(cfg)
+	if am.ring != nil {
+		am.knownCfgs[userID] = config
+	}
+	if am.isUserOwned(userID) {
+		err = am.setConfig(userID, config)
+	}
+	totalConfigs.Set(float64(len(am.cfgs)))
+	am.configsMtx.Unlock()
+	if err != nil {
+		level.Error(logger).Log("msg", "error applying config", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteUserConfig deletes the Alertmanager configuration of the requesting
+// user, and stops their Alertmanager.
+func (am *MultitenantAlertmanager) DeleteUserConfig(w http.ResponseWriter, r *http.Request) {
+	userID, _, err := user.ExtractOrgIDFromHTTPRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if am.shouldProxyConfigRequest(r, userID) {
+		am.proxyToOwner(w, r, userID)
+		return
+	}
+	logger := util.WithContext(r.Context(), util.Logger)
+
+	if err := am.store.DeleteAlertConfig(r.Context(), userID); err != nil {
+		level.Error(logger).Log("msg", "error deleting config", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	am.configsMtx.Lock()
+	delete(am.knownCfgs, userID)
+	am.deleteUser(userID)
+	totalConfigs.Set(float64(len(am.cfgs)))
+	am.configsMtx.Unlock()
+
+	level.Info(logger).Log("msg", "config deleted", "userID", userID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// shouldProxyConfigRequest returns whether a config change for userID should
+// be handled by the replica owning it, so that it is applied straight away.
+func (am *MultitenantAlertmanager) shouldProxyConfigRequest(r *http.Request, userID string) bool {
+	return am.ring != nil && r.Header.Get(proxiedHeader) == "" && !am.isUserOwned(userID)
+}
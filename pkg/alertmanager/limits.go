@@ -0,0 +1,216 @@
+package alertmanager
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/nflog"
+	"github.com/prometheus/alertmanager/nflog/nflogpb"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/silence"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+// Reasons for suppressing a notification.
+const (
+	reasonRateLimited       = "rate_limited"
+	reasonIntegrationDenied = "integration_denied"
+	reasonHostDenied        = "host_denied"
+)
+
+var suppressedNotifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "cortex",
+	Name:      "alertmanager_notifications_suppressed_total",
+	Help:      "Number of notifications not sent because of per-user limits.",
+}, []string{"user", "integration", "reason"})
+
+func init() {
+	prometheus.MustRegister(suppressedNotifications)
+}
+
+// integration identifies one notifier of a receiver, as named in the
+// notification log.
+type integration struct {
+	name string
+	idx  int
+	// The URL notifications are sent to, for integrations restricted by host.
+	url string
+}
+
+// receiverIntegrations lists the integrations of a receiver, in the same
+// order as notify.BuildReceiverIntegrations builds them.
+func receiverIntegrations(rc *config.Receiver) []integration {
+	var is []integration
+	for i, c := range rc.WebhookConfigs {
+		is = append(is, integration{name: "webhook", idx: i, url: c.URL})
+	}
+	for i := range rc.EmailConfigs {
+		is = append(is, integration{name: "email", idx: i})
+	}
+	for i := range rc.PagerdutyConfigs {
+		is = append(is, integration{name: "pagerduty", idx: i})
+	}
+	for i := range rc.OpsGenieConfigs {
+		is = append(is, integration{name: "opsgenie", idx: i})
+	}
+	for i := range rc.WechatConfigs {
+		is = append(is, integration{name: "wechat", idx: i})
+	}
+	for i := range rc.SlackConfigs {
+		is = append(is, integration{name: "slack", idx: i})
+	}
+	for i := range rc.HipchatConfigs {
+		is = append(is, integration{name: "hipchat", idx: i})
+	}
+	for i := range rc.VictorOpsConfigs {
+		is = append(is, integration{name: "victorops", idx: i})
+	}
+	for i := range rc.PushoverConfigs {
+		is = append(is, integration{name: "pushover", idx: i})
+	}
+	return is
+}
+
+// checkIntegration returns an error, and the reason to report it under, if
+// userID's limits forbid the integration.
+func checkIntegration(limits *validation.Overrides, userID string, i integration) (string, error) {
+	if allowed := limits.AllowedIntegrations(userID); len(allowed) > 0 && !contains(allowed, i.name) {
+		return reasonIntegrationDenied, fmt.Errorf("%s integration is not allowed", i.name)
+	}
+	if contains(limits.DeniedIntegrations(userID), i.name) {
+		return reasonIntegrationDenied, fmt.Errorf("%s integration is not allowed", i.name)
+	}
+	if allowed := limits.AllowedWebhookHosts(userID); i.name == "webhook" && len(allowed) > 0 {
+		u, err := url.Parse(i.url)
+		if err != nil {
+			return reasonHostDenied, err
+		}
+		if !contains(allowed, u.Hostname()) {
+			return reasonHostDenied, fmt.Errorf("webhook host %q is not allowed", u.Hostname())
+		}
+	}
+	return "", nil
+}
+
+// validateConfigLimits checks every receiver in amConfig against userID's
+// limits.
+func validateConfigLimits(limits *validation.Overrides, userID string, amConfig *config.Config) error {
+	if limits == nil {
+		return nil
+	}
+	for _, rc := range amConfig.Receivers {
+		for _, i := range receiverIntegrations(rc) {
+			if _, err := checkIntegration(limits, userID, i); err != nil {
+				return fmt.Errorf("receiver %q: %v", rc.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// buildPipeline is notify.BuildPipeline, with a stage enforcing the user's
+// limits before each integration sends its notification.
+func (am *Alertmanager) buildPipeline(
+	confs []*config.Receiver,
+	tmpl *template.Template,
+	wait func() time.Duration,
+	muter types.Muter,
+	silences *silence.Silences,
+	notificationLog nflog.Log,
+	marker types.Marker,
+	logger log.Logger,
+) notify.RoutingStage {
+	rs := notify.RoutingStage{}
+
+	is := notify.NewInhibitStage(muter)
+	ss := notify.NewSilenceStage(silences, marker)
+
+	for _, rc := range confs {
+		var fs notify.FanoutStage
+		integrations := receiverIntegrations(rc)
+		for k, n := range notify.BuildReceiverIntegrations(rc, tmpl, logger) {
+			i := integrations[k]
+			recv := &nflogpb.Receiver{
+				GroupName:   rc.Name,
+				Integration: i.name,
+				Idx:         uint32(i.idx),
+			}
+			fs = append(fs, notify.MultiStage{
+				notify.NewWaitStage(wait),
+				notify.NewDedupStage(notificationLog, recv),
+				&limitStage{am: am, integration: i},
+				notify.NewRetryStage(n),
+				notify.NewSetNotifiesStage(notificationLog, recv),
+			})
+		}
+		rs[rc.Name] = notify.MultiStage{is, ss, fs}
+	}
+	return rs
+}
+
+// limitStage drops notifications which the user's limits don't allow. As
+// they never reach the notification log, they are retried on the next flush
+// of their group.
+type limitStage struct {
+	am          *Alertmanager
+	integration integration
+}
+
+// Exec implements notify.Stage.
+func (s *limitStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	limits, userID := s.am.cfg.Limits, s.am.cfg.UserID
+	if limits == nil {
+		return ctx, alerts, nil
+	}
+
+	if reason, err := checkIntegration(limits, userID, s.integration); err != nil {
+		suppressedNotifications.WithLabelValues(userID, s.integration.name, reason).Inc()
+		level.Warn(l).Log("msg", "notification suppressed", "integration", s.integration.name, "err", err)
+		return ctx, nil, nil
+	}
+
+	if !s.am.notificationLimiter(s.integration.name).Allow() {
+		suppressedNotifications.WithLabelValues(userID, s.integration.name, reasonRateLimited).Inc()
+		level.Warn(l).Log("msg", "notification rate limit exceeded", "integration", s.integration.name)
+		return ctx, nil, nil
+	}
+	return ctx, alerts, nil
+}
+
+// notificationLimiter returns the rate limiter for notifications via the
+// given integration type, updating it if the user's limit has changed.
+func (am *Alertmanager) notificationLimiter(integration string) *rate.Limiter {
+	perMinute := am.cfg.Limits.NotificationRateLimit(am.cfg.UserID)
+	limit := rate.Inf
+	if perMinute > 0 {
+		limit = rate.Every(time.Minute / time.Duration(perMinute))
+	}
+
+	am.limitersMtx.Lock()
+	defer am.limitersMtx.Unlock()
+	limiter, ok := am.limiters[integration]
+	if !ok || limiter.Limit() != limit || limiter.Burst() != perMinute {
+		limiter = rate.NewLimiter(limit, perMinute)
+		am.limiters[integration] = limiter
+	}
+	return limiter
+}
@@ -0,0 +1,173 @@
+package alertmanager
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/types"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+
+	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+const testConfig = `
+route:
+  receiver: team
+receivers:
+- name: team
+  webhook_configs:
+  - url: http://hooks.example.com/alerts
+- name: ops
+  email_configs:
+  - to: ops@example.com
+    from: alertmanager@example.com
+    smarthost: smtp.example.com:25
+`
+
+func newTestOverrides(t *testing.T, set func(*validation.Limits)) *validation.Overrides {
+	var limits validation.Limits
+	flagext.DefaultValues(&limits)
+	set(&limits)
+	overrides, err := validation.NewOverrides(limits)
+	require.NoError(t, err)
+	return overrides
+}
+
+func suppressed(t *testing.T, userID, integration, reason string) float64 {
+	var m dto.Metric
+	require.NoError(t, suppressedNotifications.WithLabelValues(userID, integration, reason).Write(&m))
+	return m.GetCounter().GetValue()
+}
+
+func TestCheckIntegration(t *testing.T) {
+	webhook := integration{name: "webhook", url: "http://hooks.example.com/alerts"}
+	otherHost := integration{name: "webhook", url: "http://hooks.example.org/alerts"}
+	email := integration{name: "email"}
+
+	for _, tc := range []struct {
+		name        string
+		limits      func(*validation.Limits)
+		integration integration
+		reason      string
+	}{
+		{"no limits", func(*validation.Limits) {}, email, ""},
+		{"allowed", func(l *validation.Limits) { l.AllowedIntegrations = []string{"webhook"} }, webhook, ""},
+		{"not allowed", func(l *validation.Limits) { l.AllowedIntegrations = []string{"webhook"} }, email, reasonIntegrationDenied},
+		{"denied", func(l *validation.Limits) { l.DeniedIntegrations = []string{"email"} }, email, reasonIntegrationDenied},
+		{"not denied", func(l *validation.Limits) { l.DeniedIntegrations = []string{"email"} }, webhook, ""},
+		{"allowed host", func(l *validation.Limits) { l.AllowedWebhookHosts = []string{"hooks.example.com"} }, webhook, ""},
+		{"disallowed host", func(l *validation.Limits) { l.AllowedWebhookHosts = []string{"hooks.example.com"} }, otherHost, reasonHostDenied},
+		{"hosts only restrict webhooks", func(l *validation.Limits) { l.AllowedWebhookHosts = []string{"hooks.example.com"} }, email, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			reason, err := checkIntegration(newTestOverrides(t, tc.limits), "user", tc.integration)
+			require.Equal(t, tc.reason, reason)
+			require.Equal(t, tc.reason != "", err != nil)
+		})
+	}
+}
+
+func TestValidateConfigLimits(t *testing.T) {
+	amConfig, err := config.Load(testConfig)
+	require.NoError(t, err)
+
+	require.NoError(t, validateConfigLimits(nil, "user", amConfig))
+	require.NoError(t, validateConfigLimits(newTestOverrides(t, func(*validation.Limits) {}), "user", amConfig))
+
+	err = validateConfigLimits(newTestOverrides(t, func(l *validation.Limits) {
+		l.DeniedIntegrations = []string{"email"}
+	}), "user", amConfig)
+	require.EqualError(t, err, `receiver "ops": email integration is not allowed`)
+
+	err = validateConfigLimits(newTestOverrides(t, func(l *validation.Limits) {
+		l.AllowedWebhookHosts = []string{"hooks.example.org"}
+	}), "user", amConfig)
+	require.EqualError(t, err, `receiver "team": webhook host "hooks.example.com" is not allowed`)
+}
+
+func TestNotificationLimiter(t *testing.T) {
+	am := &Alertmanager{
+		cfg: &Config{
+			UserID: "user",
+			Limits: newTestOverrides(t, func(l *validation.Limits) { l.NotificationRateLimit = 2 }),
+		},
+		limiters: map[string]*rate.Limiter{},
+	}
+
+	limiter := am.notificationLimiter("webhook")
+	require.True(t, limiter.Allow())
+	require.True(t, limiter.Allow())
+	require.False(t, limiter.Allow())
+
+	// Limiters are per integration type, and kept until the limit changes.
+	require.True(t, am.notificationLimiter("email").Allow())
+	require.Equal(t, limiter, am.notificationLimiter("webhook"))
+
+	am.cfg.Limits = newTestOverrides(t, func(l *validation.Limits) { l.NotificationRateLimit = 3 })
+	limiter = am.notificationLimiter("webhook")
+	require.Equal(t, 3, limiter.Burst())
+	require.True(t, limiter.Allow())
+
+	am.cfg.Limits = newTestOverrides(t, func(*validation.Limits) {})
+	require.Equal(t, rate.Inf, am.notificationLimiter("webhook").Limit())
+}
+
+func TestLimitStage(t *testing.T) {
+	alerts := []*types.Alert{{Alert: model.Alert{Labels: model.LabelSet{"alertname": "foo"}}}}
+	newStage := func(userID string, i integration, set func(*validation.Limits)) *limitStage {
+		return &limitStage{
+			am: &Alertmanager{
+				cfg:      &Config{UserID: userID, Limits: newTestOverrides(t, set)},
+				limiters: map[string]*rate.Limiter{},
+			},
+			integration: i,
+		}
+	}
+
+	t.Run("no limits", func(t *testing.T) {
+		s := &limitStage{am: &Alertmanager{cfg: &Config{UserID: "user"}}, integration: integration{name: "email"}}
+		_, sent, err := s.Exec(context.Background(), log.NewNopLogger(), alerts...)
+		require.NoError(t, err)
+		require.Equal(t, alerts, sent)
+	})
+
+	t.Run("denied integration", func(t *testing.T) {
+		s := newStage("denied", integration{name: "email"}, func(l *validation.Limits) {
+			l.DeniedIntegrations = []string{"email"}
+		})
+		_, sent, err := s.Exec(context.Background(), log.NewNopLogger(), alerts...)
+		require.NoError(t, err)
+		require.Empty(t, sent)
+		require.Equal(t, float64(1), suppressed(t, "denied", "email", reasonIntegrationDenied))
+	})
+
+	t.Run("disallowed webhook host", func(t *testing.T) {
+		s := newStage("host", integration{name: "webhook", url: "http://hooks.example.org/alerts"}, func(l *validation.Limits) {
+			l.AllowedWebhookHosts = []string{"hooks.example.com"}
+		})
+		_, sent, err := s.Exec(context.Background(), log.NewNopLogger(), alerts...)
+		require.NoError(t, err)
+		require.Empty(t, sent)
+		require.Equal(t, float64(1), suppressed(t, "host", "webhook", reasonHostDenied))
+	})
+
+	t.Run("rate limited", func(t *testing.T) {
+		s := newStage("limited", integration{name: "webhook", url: "http://hooks.example.com/alerts"}, func(l *validation.Limits) {
+			l.NotificationRateLimit = 1
+		})
+		_, sent, err := s.Exec(context.Background(), log.NewNopLogger(), alerts...)
+		require.NoError(t, err)
+		require.Equal(t, alerts, sent)
+
+		_, sent, err = s.Exec(context.Background(), log.NewNopLogger(), alerts...)
+		require.NoError(t, err)
+		require.Empty(t, sent)
+		require.Equal(t, float64(1), suppressed(t, "limited", "webhook", reasonRateLimited))
+	})
+}
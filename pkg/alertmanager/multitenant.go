@@ -1,6 +1,7 @@
 package alertmanager
 
 import (
+	"bytes"
 	"context"
 	"flag"
 	"fmt"
@@ -8,6 +9,8 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httputil"
+	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
@@ -20,10 +23,13 @@ import (
 	amconfig "github.com/prometheus/alertmanager/config"
 	"github.com/prometheus/client_golang/prometheus"
 
+	"github.com/cortexproject/cortex/pkg/alertmanager/alertstore"
 	"github.com/cortexproject/cortex/pkg/configs"
 	configs_client "github.com/cortexproject/cortex/pkg/configs/client"
+	"github.com/cortexproject/cortex/pkg/ring"
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/validation"
 	"github.com/weaveworks/common/instrument"
 	"github.com/weaveworks/common/user"
 	"github.com/weaveworks/mesh"
@@ -44,6 +50,13 @@ const (
 	// a URL derived from Config.AutoSlackRoot
 	autoSlackURL = "internal://monitor"
 
+	// RingKey is the key under which we store the alertmanagers ring in consul.
+	RingKey = "alertmanager"
+
+	// proxiedHeader is set on requests forwarded to the replica owning a tenant,
+	// so they are never forwarded again.
+	proxiedHeader = "X-Cortex-Alertmanager-Proxied"
+
 	statusPage = `
 <!doctype html>
 <html>
@@ -107,6 +120,11 @@ var (
 		Name:      "mesh_peers",
 		Help:      "Number of peers the multitenant alertmanager knows about",
 	})
+	proxiedRequests = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "cortex",
+		Name:      "alertmanager_proxied_requests_total",
+		Help:      "Number of requests proxied to the alertmanager owning the tenant.",
+	})
 	statusTemplate      *template.Template
 	allConnectionStates = []string{"established", "pending", "retrying", "failed", "connecting"}
 )
@@ -115,6 +133,7 @@ func init() {
 	configsRequestDuration.Register()
 	prometheus.MustRegister(totalConfigs)
 	prometheus.MustRegister(totalPeers)
+	prometheus.MustRegister(proxiedRequests)
 	statusTemplate = template.Must(template.New("statusPage").Funcs(map[string]interface{}{
 		"state": func(enabled bool) string {
 			if enabled {
@@ -195,6 +214,15 @@ type MultitenantAlertmanagerConfig struct {
 	FallbackConfigFile string
 	AutoWebhookRoot    string
 	AutoSlackRoot      string
+
+	// When sharding is enabled, each replica only runs the Alertmanagers of
+	// the tenants the ring assigns to it.
+	ShardingEnabled bool
+	ShardingRing    ring.LifecyclerConfig
+
+	// When a store is configured, configurations are managed through the
+	// alertmanager's own API instead of the configs service.
+	Store alertstore.Config
 }
 
 // RegisterFlags adds the flags required to config this to the given FlagSet.
@@ -219,23 +247,40 @@ func (cfg *MultitenantAlertmanagerConfig) RegisterFlags(f *flag.FlagSet) {
 	flag.StringVar(&cfg.MeshPeerService, "alertmanager.mesh.peer.service", "mesh", "SRV service used to discover peers.")
 	flag.StringVar(&cfg.MeshPeerHost, "alertmanager.mesh.peer.host", "", "Hostname for mesh peers.")
 	flag.DurationVar(&cfg.MeshPeerRefreshInterval, "alertmanager.mesh.peer.refresh-interval", 1*time.Minute, "Period with which to poll DNS for mesh peers.")
+
+	f.BoolVar(&cfg.ShardingEnabled, "alertmanager.sharding-enabled", false, "Shard tenants across alertmanager replicas using the alertmanager ring.")
+	cfg.ShardingRing.RegisterFlagsWithPrefix("alertmanager.", f)
+	cfg.Store.RegisterFlags(f)
 }
 
 // A MultitenantAlertmanager manages Alertmanager instances for multiple
 // organizations.
 type MultitenantAlertmanager struct {
-	cfg *MultitenantAlertmanagerConfig
+	cfg    *MultitenantAlertmanagerConfig
+	limits *validation.Overrides
 
 	configsAPI configs_client.AlertManagerConfigsAPI
+	store      alertstore.AlertStore
 
 	// The fallback config is stored as a string and parsed every time it's needed
 	// because we mutate the parsed results and don't want those changes to take
 	// effect here.
 	fallbackConfig string
 
+	// Serialises applying configurations, which happens both when polling and
+	// from the config API.
+	configsMtx sync.Mutex
+
 	// All the organization configurations that we have. Only used for instrumentation.
 	cfgs map[string]configs.Config
 
+	// All the organization configurations we have polled, whether or not
+	// this replica owns them. Only used when sharding is enabled.
+	knownCfgs map[string]configs.Config
+
+	ring       *ring.Ring
+	lifecycler *ring.Lifecycler
+
 	alertmanagersMtx sync.Mutex
 	alertmanagers    map[string]*Alertmanager
 
@@ -250,7 +295,7 @@ type MultitenantAlertmanager struct {
 }
 
 // NewMultitenantAlertmanager creates a new MultitenantAlertmanager.
-func NewMultitenantAlertmanager(cfg *MultitenantAlertmanagerConfig) (*MultitenantAlertmanager, error) {
+func NewMultitenantAlertmanager(cfg *MultitenantAlertmanagerConfig, limits *validation.Overrides) (*MultitenantAlertmanager, error) {
 	err := os.MkdirAll(cfg.DataDir, 0777)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create Alertmanager data directory %q: %s", cfg.DataDir, err)
@@ -277,18 +322,38 @@ func NewMultitenantAlertmanager(cfg *MultitenantAlertmanagerConfig) (*Multitenan
 		}
 	}
 
+	store, err := alertstore.New(context.Background(), cfg.Store)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create Alertmanager config store: %s", err)
+	}
+
 	gf := newGossipFactory(mrouter)
 	am := &MultitenantAlertmanager{
 		cfg:            cfg,
+		limits:         limits,
 		configsAPI:     configsAPI,
+		store:          store,
 		fallbackConfig: string(fallbackConfig),
 		cfgs:           map[string]configs.Config{},
+		knownCfgs:      map[string]configs.Config{},
 		alertmanagers:  map[string]*Alertmanager{},
 		meshRouter:     &gf,
 		srvDiscovery:   newSRVDiscovery(cfg.MeshPeerService, cfg.MeshPeerHost, cfg.MeshPeerRefreshInterval),
 		stop:           make(chan struct{}),
 		done:           make(chan struct{}),
 	}
+
+	if cfg.ShardingEnabled {
+		am.ring, err = ring.New(cfg.ShardingRing.RingConfig, RingKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create alertmanager ring: %s", err)
+		}
+		am.lifecycler, err = ring.NewLifecycler(cfg.ShardingRing, am, RingKey)
+		if err != nil {
+			am.ring.Stop()
+			return nil, fmt.Errorf("unable to join alertmanager ring: %s", err)
+		}
+	}
 	return am, nil
 }
 
@@ -327,6 +392,10 @@ func (am *MultitenantAlertmanager) Run() {
 
 // Stop stops the MultitenantAlertmanager.
 func (am *MultitenantAlertmanager) Stop() {
+	if am.lifecycler != nil {
+		am.lifecycler.Shutdown()
+		am.ring.Stop()
+	}
 	am.srvDiscovery.Stop()
 	close(am.stop)
 	<-am.done
@@ -358,11 +427,16 @@ func (am *MultitenantAlertmanager) updateConfigs(now time.Time) error {
 		return err
 	}
 	am.addNewConfigs(cfgs)
+	am.syncOwnedConfigs()
 	return nil
 }
 
 // poll the configuration server. Not re-entrant.
 func (am *MultitenantAlertmanager) poll() (map[string]configs.View, error) {
+	if am.store != nil {
+		return am.pollStore()
+	}
+
 	configID := am.latestConfig
 	var cfgs *configs_client.ConfigsResponse
 	err := instrument.CollectedRequest(context.Background(), "Configs.GetOrgConfigs", configsRequestDuration, instrument.ErrorCode, func(_ context.Context) error {
@@ -380,10 +454,52 @@ func (am *MultitenantAlertmanager) poll() (map[string]configs.View, error) {
 	return cfgs.Configs, nil
 }
 
+// pollStore lists every configuration in the config store. Unlike the configs
+// service, the store returns all configurations rather than only those which
+// changed.
+func (am *MultitenantAlertmanager) pollStore() (map[string]configs.View, error) {
+	var alertCfgs map[string]alertstore.AlertConfig
+	err := instrument.CollectedRequest(context.Background(), "AlertStore.ListAlertConfigs", configsRequestDuration, instrument.ErrorCode, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, am.cfg.ClientTimeout)
+		defer cancel()
+		var err error
+		alertCfgs, err = am.store.ListAlertConfigs(ctx)
+		return err
+	})
+	if err != nil {
+		level.Warn(util.Logger).Log("msg", "MultitenantAlertmanager: config store poll failed", "err", err)
+		return nil, err
+	}
+
+	cfgs := make(map[string]configs.View, len(alertCfgs))
+	for userID, alertCfg := range alertCfgs {
+		cfgs[userID] = configs.View{Config: configFromAlertConfig(alertCfg)}
+	}
+	return cfgs, nil
+}
+
+func configFromAlertConfig(cfg alertstore.AlertConfig) configs.Config {
+	return configs.Config{
+		TemplateFiles:      cfg.TemplateFiles,
+		AlertmanagerConfig: cfg.AlertmanagerConfig,
+	}
+}
+
 func (am *MultitenantAlertmanager) addNewConfigs(cfgs map[string]configs.View) {
+	am.configsMtx.Lock()
+	defer am.configsMtx.Unlock()
+
 	// TODO: instrument how many configs we have, both valid & invalid.
 	level.Debug(util.Logger).Log("msg", "adding configurations", "num_configs", len(cfgs))
 	for userID, config := range cfgs {
+		if am.ring != nil {
+			// Remember every config, as the poll only returns changed ones and
+			// we may come to own this tenant later on.
+			am.knownCfgs[userID] = config.Config
+			if !am.isUserOwned(userID) {
+				continue
+			}
+		}
 
 		err := am.setConfig(userID, config.Config)
 		if err != nil {
@@ -392,9 +508,91 @@ func (am *MultitenantAlertmanager) addNewConfigs(cfgs map[string]configs.View) {
 		}
 
 	}
+
+	// The config store always returns every configuration, so any user
+	// missing from it has had their configuration deleted.
+	if am.store != nil {
+		for userID := range am.knownCfgs {
+			if _, ok := cfgs[userID]; !ok {
+				delete(am.knownCfgs, userID)
+			}
+		}
+		for userID := range am.cfgs {
+			if _, ok := cfgs[userID]; !ok {
+				level.Info(util.Logger).Log("msg", "MultitenantAlertmanager: stopping alertmanager for user with deleted config", "user_id", userID)
+				am.deleteUser(userID)
+			}
+		}
+	}
+	totalConfigs.Set(float64(len(am.cfgs)))
+}
+
+// syncOwnedConfigs starts the Alertmanagers for tenants this replica has come
+// to own since the last poll and stops those for tenants it no longer owns.
+// It is a no-op when sharding is disabled.
+func (am *MultitenantAlertmanager) syncOwnedConfigs() {
+	if am.ring == nil {
+		return
+	}
+
+	am.configsMtx.Lock()
+	defer am.configsMtx.Unlock()
+
+	for userID, config := range am.knownCfgs {
+		owned := am.isUserOwned(userID)
+		am.alertmanagersMtx.Lock()
+		_, running := am.alertmanagers[userID]
+		am.alertmanagersMtx.Unlock()
+
+		switch {
+		case owned && !running:
+			level.Info(util.Logger).Log("msg", "MultitenantAlertmanager: starting alertmanager for newly owned user", "user_id", userID)
+			if err := am.setConfig(userID, config); err != nil {
+				level.Warn(util.Logger).Log("msg", "MultitenantAlertmanager: error applying config", "err", err)
+			}
+		case !owned && running:
+			level.Info(util.Logger).Log("msg", "MultitenantAlertmanager: stopping alertmanager for user no longer owned", "user_id", userID)
+			am.deleteUser(userID)
+		}
+	}
 	totalConfigs.Set(float64(len(am.cfgs)))
 }
 
+// deleteUser stops and forgets the Alertmanager for userID, if there is one.
+// Must be called with configsMtx held.
+func (am *MultitenantAlertmanager) deleteUser(userID string) {
+	am.alertmanagersMtx.Lock()
+	userAM, ok := am.alertmanagers[userID]
+	delete(am.alertmanagers, userID)
+	am.alertmanagersMtx.Unlock()
+	delete(am.cfgs, userID)
+	if ok {
+		userAM.Stop()
+	}
+}
+
+// isUserOwned returns whether this replica should run the Alertmanager for
+// userID. If the ring cannot tell (it is empty, or has too few healthy
+// replicas), we err on the side of running it: duplicate Alertmanagers are
+// deduplicated via the mesh, whereas missing ones lose notifications.
+func (am *MultitenantAlertmanager) isUserOwned(userID string) bool {
+	if am.ring == nil {
+		return true
+	}
+
+	rs, err := am.ring.Get(ring.ShardByUser(userID), ring.Read)
+	if err != nil {
+		level.Warn(util.Logger).Log("msg", "MultitenantAlertmanager: unable to find owners of user, assuming ownership", "user_id", userID, "err", err)
+		return true
+	}
+	for _, ing := range rs.Ingesters {
+		if ing.Addr == am.lifecycler.Addr() {
+			return true
+		}
+	}
+	return false
+}
+
 func (am *MultitenantAlertmanager) transformConfig(userID string, amConfig *amconfig.Config) (*amconfig.Config, error) {
 	if amConfig == nil { // shouldn't happen, but check just in case
 		return nil, fmt.Errorf("no usable Cortex configuration for %v", userID)
@@ -419,6 +617,9 @@ func (am *MultitenantAlertmanager) transformConfig(userID string, amConfig *amco
 		}
 	}
 
+	if err := validateConfigLimits(am.limits, userID, amConfig); err != nil {
+		return nil, fmt.Errorf("configuration for %v exceeds limits: %v", userID, err)
+	}
 	return amConfig, nil
 }
 
@@ -514,6 +715,7 @@ func (am *MultitenantAlertmanager) newAlertmanager(userID string, amConfig *amco
 		MeshRouter:  am.meshRouter,
 		Retention:   am.cfg.Retention,
 		ExternalURL: am.cfg.ExternalURL.URL,
+		Limits:      am.limits,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("unable to start Alertmanager for user %v: %v", userID, err)
@@ -536,12 +738,78 @@ func (am *MultitenantAlertmanager) ServeHTTP(w http.ResponseWriter, req *http.Re
 	userAM, ok := am.alertmanagers[userID]
 	am.alertmanagersMtx.Unlock()
 	if !ok {
+		if am.ring != nil && req.Header.Get(proxiedHeader) == "" {
+			am.proxyToOwner(w, req, userID)
+			return
+		}
 		http.Error(w, fmt.Sprintf("no Alertmanager for this user ID"), http.StatusNotFound)
 		return
 	}
 	userAM.router.ServeHTTP(w, req)
 }
 
+// proxyToOwner forwards a request for a tenant this replica doesn't run to a
+// replica which does, trying each of the tenant's replicas in turn until one
+// of them answers.
+func (am *MultitenantAlertmanager) proxyToOwner(w http.ResponseWriter, req *http.Request, userID string) {
+	rs, err := am.ring.Get(ring.ShardByUser(userID), ring.Read)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to find Alertmanager for this user ID: %v", err), http.StatusServiceUnavailable)
+		return
+	}
+
+	// The body has to be replayed for every replica we try.
+	var body []byte
+	if req.Body != nil {
+		body, err = ioutil.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	req.Header.Set(proxiedHeader, am.lifecycler.Addr())
+
+	var lastErr error
+	for _, ing := range rs.Ingesters {
+		if ing.Addr == am.lifecycler.Addr() {
+			continue
+		}
+
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		proxy := httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: ing.Addr})
+		failed := false
+		proxy.ErrorHandler = func(_ http.ResponseWriter, _ *http.Request, err error) {
+			// Nothing has been written to w yet, so we can still try another replica.
+			failed, lastErr = true, err
+		}
+		proxiedRequests.Inc()
+		proxy.ServeHTTP(w, req)
+		if !failed {
+			return
+		}
+		level.Warn(util.Logger).Log("msg", "failed to proxy request to Alertmanager", "user", userID, "addr", ing.Addr, "err", lastErr)
+	}
+
+	if lastErr != nil {
+		http.Error(w, fmt.Sprintf("unable to reach any Alertmanager for this user ID: %v", lastErr), http.StatusBadGateway)
+		return
+	}
+	http.Error(w, fmt.Sprintf("no Alertmanager for this user ID"), http.StatusNotFound)
+}
+
+// StopIncomingRequests implements ring.FlushTransferer. Requests for tenants
+// are proxied to other replicas once we leave the ring.
+func (am *MultitenantAlertmanager) StopIncomingRequests() {}
+
+// Flush implements ring.FlushTransferer. Silences and notification logs are
+// gossiped to the other replicas, so there is nothing to flush.
+func (am *MultitenantAlertmanager) Flush() {}
+
+// TransferOut implements ring.FlushTransferer.
+func (am *MultitenantAlertmanager) TransferOut(ctx context.Context) error {
+	return nil
+}
+
 // GetStatusHandler returns the status handler for this multi-tenant
 // alertmanager.
 func (am *MultitenantAlertmanager) GetStatusHandler() StatusHandler {
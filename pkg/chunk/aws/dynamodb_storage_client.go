@@ -95,6 +95,7 @@ type DynamoDBConfig struct {
 	APILimit               float64
 	ApplicationAutoScaling flagext.URLValue
 	Metrics                MetricsAutoScalingConfig
+	UsageReport            UsageReportConfig
 	ChunkGangSize          int
 	ChunkGetMaxParallelism int
 	backoffConfig          util.BackoffConfig
@@ -112,6 +113,7 @@ func (cfg *DynamoDBConfig) RegisterFlags(f *flag.FlagSet) {
 	f.DurationVar(&cfg.backoffConfig.MaxBackoff, "dynamodb.max-backoff", 50*time.Second, "Maximum backoff time")
 	f.IntVar(&cfg.backoffConfig.MaxRetries, "dynamodb.max-retries", 20, "Maximum number of times to retry an operation")
 	cfg.Metrics.RegisterFlags(f)
+	cfg.UsageReport.RegisterFlags(f)
 }
 
 // StorageConfig specifies config for storing data on AWS.
@@ -158,6 +160,10 @@ func newDynamoDBStorageClient(cfg DynamoDBConfig, schemaCfg chunk.SchemaConfig)
 		return nil, err
 	}
 
+	if cfg.UsageReport.URL != "" {
+		startUsageReporter(cfg.UsageReport)
+	}
+
 	client := &dynamoDBStorageClient{
 		cfg:       cfg,
 		schemaCfg: schemaCfg,
@@ -182,7 +188,12 @@ func logRetry(ctx context.Context, unprocessed dynamoDBWriteBatch) {
 	userID, _ := user.ExtractOrgID(ctx)
 	for table, reqs := range unprocessed {
 		for _, req := range reqs {
-			item := req.PutRequest.Item
+			var item map[string]*dynamodb.AttributeValue
+			if req.PutRequest != nil {
+				item = req.PutRequest.Item
+			} else if req.DeleteRequest != nil {
+				item = req.DeleteRequest.Key
+			}
 			var hash, rnge string
 			if hashAttr, ok := item[hashKey]; ok {
 				if hashAttr.S != nil {
@@ -270,6 +281,39 @@ func (a dynamoDBStorageClient) BatchWrite(ctx context.Context, input chunk.Write
 	return backoff.Err()
 }
 
+// ScanTable implements chunk.IndexScanner.
+func (a dynamoDBStorageClient) ScanTable(ctx context.Context, tableName string, callback func(hashValue string, rangeValue []byte) error) error {
+	var processingErr error
+	err := instrument.CollectedRequest(ctx, "DynamoDB.Scan", dynamoRequestDuration, instrument.ErrorCode, func(ctx context.Context) error {
+		return a.DynamoDB.ScanPagesWithContext(ctx, &dynamodb.ScanInput{
+			TableName:            aws.String(tableName),
+			ProjectionExpression: aws.String(hashKey + ", " + rangeKey),
+		}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+			for _, item := range page.Items {
+				hashAttr, ok := item[hashKey]
+				if !ok || hashAttr.S == nil {
+					continue
+				}
+				var rangeValue []byte
+				if rangeAttr, ok := item[rangeKey]; ok {
+					rangeValue = rangeAttr.B
+				}
+				if processingErr = callback(*hashAttr.S, rangeValue); processingErr != nil {
+					return false
+				}
+			}
+			return true
+		})
+	})
+	if processingErr != nil {
+		return processingErr
+	}
+	if err != nil {
+		recordDynamoError(tableName, err, "DynamoDB.Scan")
+	}
+	return err
+}
+
 // QueryPages implements chunk.IndexClient.
 func (a dynamoDBStorageClient) QueryPages(ctx context.Context, queries []chunk.IndexQuery, callback func(chunk.IndexQuery, chunk.ReadBatch) bool) error {
 	return chunk_util.DoParallelQueries(ctx, a.query, queries, callback)
@@ -640,6 +684,29 @@ func (a dynamoDBStorageClient) PutChunks(ctx context.Context, chunks []chunk.Chu
 	return a.BatchWrite(ctx, dynamoDBWrites)
 }
 
+// DeleteChunk implements chunk.ObjectClient.
+func (a dynamoDBStorageClient) DeleteChunk(ctx context.Context, chunkID string) error {
+	c, err := chunk.ParseObjectKey(chunkID)
+	if err != nil {
+		return err
+	}
+	table, err := a.schemaCfg.ChunkTableFor(c.From)
+	if err != nil {
+		return err
+	}
+
+	return instrument.CollectedRequest(ctx, "DynamoDB.DeleteItem", dynamoRequestDuration, instrument.ErrorCode, func(ctx context.Context) error {
+		_, err := a.DynamoDB.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(table),
+			Key: map[string]*dynamodb.AttributeValue{
+				hashKey:  {S: aws.String(chunkID)},
+				rangeKey: {B: placeholder},
+			},
+		})
+		return err
+	})
+}
+
 // Slice of values returned; map key is attribute name
 type dynamoDBReadResponse struct {
 	items []map[string]*dynamodb.AttributeValue
@@ -718,6 +785,17 @@ func (b dynamoDBWriteBatch) Add(tableName, hashValue string, rangeValue []byte,
 	})
 }
 
+func (b dynamoDBWriteBatch) Delete(tableName, hashValue string, rangeValue []byte) {
+	b[tableName] = append(b[tableName], &dynamodb.WriteRequest{
+		DeleteRequest: &dynamodb.DeleteRequest{
+			Key: map[string]*dynamodb.AttributeValue{
+				hashKey:  {S: aws.String(hashValue)},
+				rangeKey: {B: rangeValue},
+			},
+		},
+	})
+}
+
 // Fill 'b' with WriteRequests from 'from' until 'b' has at most max requests. Remove those requests from 'from'.
 func (b dynamoDBWriteBatch) TakeReqs(from dynamoDBWriteBatch, max int) {
 	outLen, inLen := b.Len(), from.Len()
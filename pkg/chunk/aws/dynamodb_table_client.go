@@ -55,7 +55,7 @@ func NewDynamoDBTableClient(cfg DynamoDBConfig) (chunk.TableClient, error) {
 		}
 	}
 
-	if cfg.Metrics.URL != "" {
+	if cfg.Metrics.URL != "" || cfg.Metrics.InProcess {
 		autoscale, err = newMetrics(cfg)
 		if err != nil {
 			return nil, err
@@ -230,6 +230,9 @@ func (d dynamoTableClient) DescribeTable(ctx context.Context, name string) (desc
 				if out.Table.TableStatus != nil {
 					isActive = (*out.Table.TableStatus == dynamodb.TableStatusActive)
 				}
+				if out.Table.TableSizeBytes != nil {
+					desc.SizeBytes = *out.Table.TableSizeBytes
+				}
 				if out.Table.BillingModeSummary != nil {
 					desc.UseOnDemandIOMode = *out.Table.BillingModeSummary.BillingMode == dynamodb.BillingModePayPerRequest
 				}
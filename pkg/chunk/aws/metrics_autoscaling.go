@@ -42,6 +42,7 @@ const (
 // MetricsAutoScalingConfig holds parameters to configure how it works
 type MetricsAutoScalingConfig struct {
 	URL              string  // URL to contact Prometheus store on
+	InProcess        bool    // Use usage reported by ingesters and queriers instead of Prometheus
 	TargetQueueLen   int64   // Queue length above which we will scale up capacity
 	ScaleUpFactor    float64 // Scale up capacity by this multiple
 	QueueLengthQuery string  // Promql query to fetch ingester queue length
@@ -54,6 +55,7 @@ type MetricsAutoScalingConfig struct {
 // RegisterFlags adds the flags required to config this to the given FlagSet
 func (cfg *MetricsAutoScalingConfig) RegisterFlags(f *flag.FlagSet) {
 	f.StringVar(&cfg.URL, "metrics.url", "", "Use metrics-based autoscaling, via this query URL")
+	f.BoolVar(&cfg.InProcess, "metrics.in-process", false, "Use metrics-based autoscaling, from the usage ingesters and queriers report with -dynamodb.usage-report.url, instead of querying Prometheus.")
 	f.Int64Var(&cfg.TargetQueueLen, "metrics.target-queue-length", 100000, "Queue length above which we will scale up capacity")
 	f.Float64Var(&cfg.ScaleUpFactor, "metrics.scale-up-factor", 1.3, "Scale up capacity by this multiple")
 	f.StringVar(&cfg.QueueLengthQuery, "metrics.queue-length-query", defaultQueueLenQuery, "query to fetch ingester queue length")
@@ -66,6 +68,7 @@ func (cfg *MetricsAutoScalingConfig) RegisterFlags(f *flag.FlagSet) {
 type metricsData struct {
 	cfg                  MetricsAutoScalingConfig
 	promAPI              promV1.API
+	reports              *UsageReports
 	promLastQuery        time.Time
 	tableLastUpdated     map[string]time.Time
 	tableReadLastUpdated map[string]time.Time
@@ -77,6 +80,15 @@ type metricsData struct {
 }
 
 func newMetrics(cfg DynamoDBConfig) (*metricsData, error) {
+	if cfg.Metrics.InProcess {
+		return &metricsData{
+			reports:              DefaultUsageReports,
+			cfg:                  cfg.Metrics,
+			tableLastUpdated:     make(map[string]time.Time),
+			tableReadLastUpdated: make(map[string]time.Time),
+		}, nil
+	}
+
 	client, err := promApi.NewClient(promApi.Config{Address: cfg.Metrics.URL})
 	if err != nil {
 		return nil, err
@@ -283,6 +295,10 @@ func (m *metricsData) update(ctx context.Context) error {
 	}
 
 	m.promLastQuery = mtime.Now()
+	if m.reports != nil {
+		return m.reports.update(ctx, m)
+	}
+
 	qlMatrix, err := promQuery(ctx, m.promAPI, m.cfg.QueueLengthQuery, queueObservationPeriod, queueObservationPeriod/2)
 	if err != nil {
 		return err
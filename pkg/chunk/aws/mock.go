@@ -97,6 +97,19 @@ func (m *mockDynamoDBClient) batchWriteItemRequest(_ context.Context, input *dyn
 				continue
 			}
 
+			if writeRequest.DeleteRequest != nil {
+				hashValue := *writeRequest.DeleteRequest.Key[hashKey].S
+				rangeValue := writeRequest.DeleteRequest.Key[rangeKey].B
+				items := table.items[hashValue]
+				for i := range items {
+					if bytes.Equal(items[i][rangeKey].B, rangeValue) {
+						table.items[hashValue] = append(items[:i], items[i+1:]...)
+						break
+					}
+				}
+				continue
+			}
+
 			hashValue := *writeRequest.PutRequest.Item[hashKey].S
 			rangeValue := writeRequest.PutRequest.Item[rangeKey].B
 
@@ -123,6 +136,27 @@ func (m *mockDynamoDBClient) batchWriteItemRequest(_ context.Context, input *dyn
 	return &dynamoDBMockRequest{result: resp}
 }
 
+func (m *mockDynamoDBClient) DeleteItemWithContext(_ aws.Context, input *dynamodb.DeleteItemInput, _ ...request.Option) (*dynamodb.DeleteItemOutput, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	table, ok := m.tables[*input.TableName]
+	if !ok {
+		return nil, fmt.Errorf("table not found: %s", *input.TableName)
+	}
+
+	hashValue := *input.Key[hashKey].S
+	rangeValue := input.Key[rangeKey].B
+	items := table.items[hashValue]
+	for i := range items {
+		if bytes.Equal(items[i][rangeKey].B, rangeValue) {
+			table.items[hashValue] = append(items[:i], items[i+1:]...)
+			break
+		}
+	}
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
 func (m *mockDynamoDBClient) batchGetItemRequest(_ context.Context, input *dynamodb.BatchGetItemInput) dynamoDBRequest {
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
@@ -192,6 +226,27 @@ func (m *mockDynamoDBClient) batchGetItemRequest(_ context.Context, input *dynam
 	}
 }
 
+func (m *mockDynamoDBClient) ScanPagesWithContext(_ aws.Context, input *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool, _ ...request.Option) error {
+	m.mtx.RLock()
+	table, ok := m.tables[*input.TableName]
+	if !ok {
+		m.mtx.RUnlock()
+		return fmt.Errorf("table not found: %s", *input.TableName)
+	}
+
+	output := &dynamodb.ScanOutput{}
+	for _, items := range table.items {
+		for _, item := range items {
+			output.Items = append(output.Items, item)
+		}
+	}
+	m.mtx.RUnlock()
+
+	// Like DynamoDB, callers can write to the table while scanning it.
+	fn(output, true)
+	return nil
+}
+
 func (m *mockDynamoDBClient) queryRequest(_ context.Context, input *dynamodb.QueryInput) dynamoDBRequest {
 	result := &dynamodb.QueryOutput{
 		Items: []map[string]*dynamodb.AttributeValue{},
@@ -428,3 +483,28 @@ func (m *mockS3) GetObjectWithContext(_ aws.Context, req *s3.GetObjectInput, _ .
 		Body: ioutil.NopCloser(bytes.NewReader(buf)),
 	}, nil
 }
+
+func (m *mockS3) DeleteObjectWithContext(_ aws.Context, req *s3.DeleteObjectInput, _ ...request.Option) (*s3.DeleteObjectOutput, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.objects, *req.Key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (m *mockS3) ListObjectsV2PagesWithContext(_ aws.Context, _ *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, _ ...request.Option) error {
+	m.RLock()
+	keys := make([]string, 0, len(m.objects))
+	for key := range m.objects {
+		keys = append(keys, key)
+	}
+	m.RUnlock()
+
+	sort.Strings(keys)
+	output := &s3.ListObjectsV2Output{}
+	for _, key := range keys {
+		output.Contents = append(output.Contents, &s3.Object{Key: aws.String(key)})
+	}
+	fn(output, true)
+	return nil
+}
@@ -132,3 +132,33 @@ func (a s3ObjectClient) putS3Chunk(ctx context.Context, key string, buf []byte)
 		return err
 	})
 }
+
+func (a s3ObjectClient) DeleteChunk(ctx context.Context, chunkID string) error {
+	return instrument.CollectedRequest(ctx, "S3.DeleteObject", s3RequestDuration, instrument.ErrorCode, func(ctx context.Context) error {
+		_, err := a.S3.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(a.bucketName),
+			Key:    aws.String(chunkID),
+		})
+		return err
+	})
+}
+
+func (a s3ObjectClient) ListChunks(ctx context.Context, callback func(chunkIDs []string) error) error {
+	var callbackErr error
+	err := instrument.CollectedRequest(ctx, "S3.ListObjectsV2Pages", s3RequestDuration, instrument.ErrorCode, func(ctx context.Context) error {
+		return a.S3.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+			Bucket: aws.String(a.bucketName),
+		}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+			chunkIDs := make([]string, 0, len(page.Contents))
+			for _, object := range page.Contents {
+				chunkIDs = append(chunkIDs, aws.StringValue(object.Key))
+			}
+			callbackErr = callback(chunkIDs)
+			return callbackErr == nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return callbackErr
+}
@@ -0,0 +1,325 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/weaveworks/common/mtime"
+
+	"github.com/cortexproject/cortex/pkg/util"
+)
+
+const (
+	// UsageReportPath is where the table manager receives usage reports.
+	UsageReportPath = "/api/v1/dynamodb/usage"
+
+	// Reports are kept for the longest window rates are calculated over.
+	usageReportRetention = time.Hour + time.Minute
+
+	throttledError = "ProvisionedThroughputExceededException"
+	writeOperation = "DynamoDB.BatchWriteItem"
+	readOperation  = "DynamoDB.QueryPages"
+)
+
+// UsageReportConfig configures reporting DynamoDB usage to the table manager,
+// for it to autoscale tables without an external Prometheus.
+type UsageReportConfig struct {
+	URL      string
+	Interval time.Duration
+}
+
+// RegisterFlags adds the flags required to config this to the given FlagSet
+func (cfg *UsageReportConfig) RegisterFlags(f *flag.FlagSet) {
+	f.StringVar(&cfg.URL, "dynamodb.usage-report.url", "", "Report DynamoDB usage, and the ingester flush queue length, to the table manager at this URL, e.g. http://table-manager"+UsageReportPath+", for -metrics.in-process autoscaling.")
+	f.DurationVar(&cfg.Interval, "dynamodb.usage-report.interval", 15*time.Second, "How often to report DynamoDB usage to the table manager.")
+}
+
+// UsageReport is the DynamoDB usage of an ingester or querier.  Values are
+// cumulative, as their Prometheus counters are.
+type UsageReport struct {
+	Instance         string                `json:"instance"`
+	FlushQueueLength float64               `json:"flush_queue_length"`
+	Tables           map[string]TableUsage `json:"tables"`
+}
+
+// TableUsage is the capacity consumed on, and the requests throttled by, a
+// table.
+type TableUsage struct {
+	WriteCapacity  float64 `json:"write_capacity"`
+	WriteThrottled float64 `json:"write_throttled"`
+	ReadCapacity   float64 `json:"read_capacity"`
+	ReadThrottled  float64 `json:"read_throttled"`
+}
+
+var startUsageReporterOnce sync.Once
+
+// startUsageReporter reports this process' usage, once however many clients
+// are created.
+func startUsageReporter(cfg UsageReportConfig) {
+	startUsageReporterOnce.Do(func() {
+		instance, err := os.Hostname()
+		if err != nil {
+			instance = fmt.Sprintf("pid-%d", os.Getpid())
+		}
+		go reportUsage(cfg, instance)
+	})
+}
+
+func reportUsage(cfg UsageReportConfig, instance string) {
+	client := &http.Client{Timeout: cfg.Interval}
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := sendUsageReport(client, cfg.URL, prometheus.DefaultGatherer, instance); err != nil {
+			level.Warn(util.Logger).Log("msg", "error reporting DynamoDB usage", "err", err)
+		}
+	}
+}
+
+func sendUsageReport(client *http.Client, url string, gatherer prometheus.Gatherer, instance string) error {
+	report, err := gatherUsage(gatherer, instance)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// gatherUsage builds a report from the metrics the DynamoDB clients and
+// ingester record.
+func gatherUsage(gatherer prometheus.Gatherer, instance string) (UsageReport, error) {
+	report := UsageReport{
+		Instance: instance,
+		Tables:   map[string]TableUsage{},
+	}
+	families, err := gatherer.Gather()
+	if err != nil {
+		return report, err
+	}
+
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, pair := range metric.GetLabel() {
+				labels[pair.GetName()] = pair.GetValue()
+			}
+			usage := report.Tables[labels[tableNameLabel]]
+
+			switch family.GetName() {
+			case "cortex_ingester_flush_queue_length":
+				report.FlushQueueLength += metric.GetGauge().GetValue()
+				continue
+
+			case "cortex_dynamo_consumed_capacity_total":
+				switch labels["operation"] {
+				case writeOperation:
+					usage.WriteCapacity += metric.GetCounter().GetValue()
+				case readOperation:
+					usage.ReadCapacity += metric.GetCounter().GetValue()
+				default:
+					continue
+				}
+
+			case "cortex_dynamo_failures_total":
+				if labels[errorReasonLabel] != throttledError {
+					continue
+				}
+				switch {
+				case strings.Contains(labels["operation"], "Write"):
+					usage.WriteThrottled += metric.GetCounter().GetValue()
+				case labels["operation"] == readOperation:
+					usage.ReadThrottled += metric.GetCounter().GetValue()
+				default:
+					continue
+				}
+
+			default:
+				continue
+			}
+			report.Tables[labels[tableNameLabel]] = usage
+		}
+	}
+	return report, nil
+}
+
+type usageSnapshot struct {
+	time time.Time
+	UsageReport
+}
+
+// UsageReports collects the usage reported by ingesters and queriers, and
+// calculates what metricsData would otherwise query Prometheus for.
+type UsageReports struct {
+	mtx       sync.Mutex
+	instances map[string][]usageSnapshot
+}
+
+// DefaultUsageReports are the reports -metrics.in-process autoscaling uses.
+var DefaultUsageReports = NewUsageReports()
+
+// NewUsageReports makes a new UsageReports.
+func NewUsageReports() *UsageReports {
+	return &UsageReports{
+		instances: map[string][]usageSnapshot{},
+	}
+}
+
+// RegisterRoutes registers the endpoint usage is reported to.
+func (r *UsageReports) RegisterRoutes(router *mux.Router) {
+	router.Path(UsageReportPath).Methods("POST").Handler(r)
+}
+
+// ServeHTTP receives a UsageReport.
+func (r *UsageReports) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var report UsageReport
+	if err := json.NewDecoder(req.Body).Decode(&report); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if report.Instance == "" {
+		http.Error(w, "no instance", http.StatusBadRequest)
+		return
+	}
+	r.add(report)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (r *UsageReports) add(report UsageReport) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	now := mtime.Now()
+	r.instances[report.Instance] = append(r.instances[report.Instance], usageSnapshot{now, report})
+
+	// Forget reports, and instances, which are too old to be used.
+	for instance, snapshots := range r.instances {
+		i := 0
+		for i < len(snapshots) && now.Sub(snapshots[i].time) > usageReportRetention {
+			i++
+		}
+		if i == len(snapshots) {
+			delete(r.instances, instance)
+		} else {
+			r.instances[instance] = snapshots[i:]
+		}
+	}
+}
+
+// queueLengths returns the total flush queue length averaged over
+// queueObservationPeriod, at three points queueObservationPeriod/2 apart,
+// as defaultQueueLenQuery does.
+func (r *UsageReports) queueLengths(now time.Time) ([]float64, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	result := make([]float64, 3)
+	reported := false
+	for i := range result {
+		end := now.Add(-time.Duration(len(result)-1-i) * queueObservationPeriod / 2)
+		for _, snapshots := range r.instances {
+			total, count := 0.0, 0
+			for _, snapshot := range snapshots {
+				if snapshot.time.After(end.Add(-queueObservationPeriod)) && !snapshot.time.After(end) {
+					total += snapshot.FlushQueueLength
+					count++
+				}
+			}
+			if count > 0 {
+				result[i] += total / float64(count)
+				if i == len(result)-1 {
+					reported = true
+				}
+			}
+		}
+	}
+	if !reported {
+		return nil, fmt.Errorf("no usage reported in the last %s", queueObservationPeriod)
+	}
+	return result, nil
+}
+
+// increases returns the increase in value over window per table, summed over
+// instances, per second if perSecond; tables with no increase are omitted,
+// as the queries metricsData makes omit them.
+func (r *UsageReports) increases(now time.Time, window time.Duration, perSecond bool, value func(TableUsage) float64) map[string]float64 {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	result := map[string]float64{}
+	for _, snapshots := range r.instances {
+		first, last := -1, -1
+		for i, snapshot := range snapshots {
+			if snapshot.time.Before(now.Add(-window)) || snapshot.time.After(now) {
+				continue
+			}
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+		if first < 0 || first == last {
+			continue
+		}
+
+		seconds := snapshots[last].time.Sub(snapshots[first].time).Seconds()
+		for table := range snapshots[last].Tables {
+			// Sum the increases between reports, so counters being reset by the
+			// instance restarting are accounted for, as Prometheus' rate does.
+			increase, previous := 0.0, value(snapshots[first].Tables[table])
+			for _, snapshot := range snapshots[first+1 : last+1] {
+				current := value(snapshot.Tables[table])
+				if current < previous {
+					increase += current
+				} else {
+					increase += current - previous
+				}
+				previous = current
+			}
+			if perSecond {
+				increase /= seconds
+			}
+			if increase > 0 {
+				result[table] += increase
+			}
+		}
+	}
+	return result
+}
+
+// update sets m's data from the reports, rather than querying Prometheus.
+func (r *UsageReports) update(ctx context.Context, m *metricsData) error {
+	now := mtime.Now()
+	queueLengths, err := r.queueLengths(now)
+	if err != nil {
+		return err
+	}
+	m.queueLengths = queueLengths
+	m.errorRates = r.increases(now, time.Minute, true, func(u TableUsage) float64 { return u.WriteThrottled })
+	m.usageRates = r.increases(now, 15*time.Minute, true, func(u TableUsage) float64 { return u.WriteCapacity })
+	m.usageReadRates = r.increases(now, time.Hour, true, func(u TableUsage) float64 { return u.ReadCapacity })
+	m.readErrorRates = r.increases(now, time.Minute, false, func(u TableUsage) float64 { return u.ReadThrottled })
+	return nil
+}
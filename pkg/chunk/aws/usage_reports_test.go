@@ -0,0 +1,106 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/mtime"
+)
+
+func TestGatherUsage(t *testing.T) {
+	capacity := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cortex_dynamo_consumed_capacity_total",
+	}, []string{"operation", tableNameLabel})
+	failures := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cortex_dynamo_failures_total",
+	}, []string{tableNameLabel, errorReasonLabel, "operation"})
+	queueLength := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cortex_ingester_flush_queue_length",
+	})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(capacity, failures, queueLength)
+
+	capacity.WithLabelValues(writeOperation, "index").Add(10)
+	capacity.WithLabelValues(readOperation, "index").Add(20)
+	capacity.WithLabelValues("DynamoDB.BatchGetItemPages", "chunks").Add(30)
+	failures.WithLabelValues("index", throttledError, writeOperation).Add(1)
+	failures.WithLabelValues("index", throttledError, readOperation).Add(2)
+	failures.WithLabelValues("chunks", "ValidationException", writeOperation).Add(3)
+	queueLength.Set(100)
+
+	report, err := gatherUsage(registry, "ingester-1")
+	require.NoError(t, err)
+	require.Equal(t, UsageReport{
+		Instance:         "ingester-1",
+		FlushQueueLength: 100,
+		Tables: map[string]TableUsage{
+			"index": {WriteCapacity: 10, WriteThrottled: 1, ReadCapacity: 20, ReadThrottled: 2},
+		},
+	}, report)
+}
+
+func TestUsageReports(t *testing.T) {
+	start := time.Unix(0, 0).Add(24 * time.Hour)
+	defer mtime.NowReset()
+
+	reports := NewUsageReports()
+	router := mux.NewRouter()
+	reports.RegisterRoutes(router)
+	send := func(at time.Duration, report UsageReport) {
+		mtime.NowForce(start.Add(at))
+		body, err := json.Marshal(report)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("POST", UsageReportPath, bytes.NewReader(body)))
+		require.Equal(t, http.StatusNoContent, recorder.Code)
+	}
+
+	m := &metricsData{reports: reports}
+	mtime.NowForce(start)
+	require.Error(t, m.update(context.Background()))
+
+	// Two ingesters report every 15s, one of which restarts after a minute.
+	for i := 0; i <= 8; i++ {
+		at := time.Duration(i) * 15 * time.Second
+		send(at, UsageReport{
+			Instance:         "ingester-1",
+			FlushQueueLength: 100,
+			Tables: map[string]TableUsage{
+				"index": {WriteCapacity: float64(i) * 150, WriteThrottled: float64(i) * 15, ReadCapacity: float64(i) * 15},
+			},
+		})
+		restarted := i
+		if i > 4 {
+			restarted = i - 4
+		}
+		send(at, UsageReport{
+			Instance:         "ingester-2",
+			FlushQueueLength: 200,
+			Tables: map[string]TableUsage{
+				"index":  {WriteCapacity: float64(restarted) * 150},
+				"chunks": {ReadThrottled: float64(restarted) * 3},
+			},
+		})
+	}
+
+	mtime.NowForce(start.Add(2 * time.Minute))
+	require.NoError(t, m.update(context.Background()))
+	require.Equal(t, []float64{300, 300, 300}, m.queueLengths)
+	require.Equal(t, map[string]float64{"index": 1}, m.errorRates)
+	// ingester-2's counter reset by its restart is accounted for.
+	require.Equal(t, map[string]float64{"index": 20}, m.usageRates)
+	require.Equal(t, map[string]float64{"index": 1}, m.usageReadRates)
+	require.Equal(t, map[string]float64{"chunks": 12}, m.readErrorRates)
+
+	// Reports older than the longest window are forgotten.
+	send(2*time.Hour, UsageReport{Instance: "querier-1"})
+	require.Len(t, reports.instances, 1)
+}
@@ -29,6 +29,9 @@ type Config struct {
 	// This is to name the cache metrics properly.
 	Prefix string `yaml:"prefix,omitempty"`
 
+	// Generations, if set, are mixed into the keys of each user's entries.
+	Generations *Generations `yaml:"-"`
+
 	// For tests to inject specific implementations.
 	Cache Cache
 }
@@ -51,7 +54,7 @@ func (cfg *Config) RegisterFlagsWithPrefix(prefix string, description string, f
 // New creates a new Cache using Config.
 func New(cfg Config) (Cache, error) {
 	if cfg.Cache != nil {
-		return cfg.Cache, nil
+		return generational(cfg.Cache, cfg.Generations), nil
 	}
 
 	caches := []Cache{}
@@ -91,5 +94,12 @@ func New(cfg Config) (Cache, error) {
 	if len(caches) > 1 {
 		cache = Instrument(cfg.Prefix+"tiered", cache)
 	}
-	return cache, nil
+	return generational(cache, cfg.Generations), nil
+}
+
+func generational(cache Cache, generations *Generations) Cache {
+	if generations == nil {
+		return cache
+	}
+	return NewGenerational(cache, generations)
 }
@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/weaveworks/common/user"
+)
+
+type generationalCache struct {
+	next        Cache
+	generations *Generations
+}
+
+// NewGenerational makes a new cache wrapper which prefixes keys with the
+// generation of the user in the context, so bumping it invalidates all their
+// entries.
+func NewGenerational(next Cache, generations *Generations) Cache {
+	return &generationalCache{
+		next:        next,
+		generations: generations,
+	}
+}
+
+// prefix returns the prefix for the keys of the user in ctx, empty if they
+// have no generation.
+func (g *generationalCache) prefix(ctx context.Context) string {
+	userID, err := user.ExtractOrgID(ctx)
+	if err != nil {
+		return ""
+	}
+	if generation := g.generations.Get(userID); generation > 0 {
+		return fmt.Sprintf("%d:", generation)
+	}
+	return ""
+}
+
+func (g *generationalCache) Store(ctx context.Context, keys []string, bufs [][]byte) {
+	prefix := g.prefix(ctx)
+	if prefix == "" {
+		g.next.Store(ctx, keys, bufs)
+		return
+	}
+	g.next.Store(ctx, addPrefix(prefix, keys), bufs)
+}
+
+func (g *generationalCache) Fetch(ctx context.Context, keys []string) ([]string, [][]byte, []string) {
+	prefix := g.prefix(ctx)
+	if prefix == "" {
+		return g.next.Fetch(ctx, keys)
+	}
+	found, bufs, missing := g.next.Fetch(ctx, addPrefix(prefix, keys))
+	return trimPrefix(prefix, found), bufs, trimPrefix(prefix, missing)
+}
+
+func (g *generationalCache) Stop() error {
+	return g.next.Stop()
+}
+
+func addPrefix(prefix string, keys []string) []string {
+	result := make([]string, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, prefix+key)
+	}
+	return result
+}
+
+func trimPrefix(prefix string, keys []string) []string {
+	result := make([]string, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, key[len(prefix):])
+	}
+	return result
+}
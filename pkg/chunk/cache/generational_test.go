@@ -0,0 +1,91 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/chunk/cache"
+	"github.com/cortexproject/cortex/pkg/ring"
+)
+
+func TestGenerational(t *testing.T) {
+	generations, err := cache.NewGenerations(cache.GenerationsConfig{
+		Mock: ring.NewInMemoryKVClientWithCodec(cache.GenerationsCodec{}),
+	})
+	require.NoError(t, err)
+	defer generations.Stop()
+
+	c := cache.NewGenerational(cache.NewMockCache(), generations)
+	ctx1 := user.InjectOrgID(context.Background(), "1")
+	ctx2 := user.InjectOrgID(context.Background(), "2")
+
+	c.Store(ctx1, []string{"a", "b"}, [][]byte{[]byte("1a"), []byte("1b")})
+	c.Store(ctx2, []string{"c"}, [][]byte{[]byte("2c")})
+
+	found, bufs, missing := c.Fetch(ctx1, []string{"a", "b", "d"})
+	require.Equal(t, []string{"a", "b"}, found)
+	require.Equal(t, [][]byte{[]byte("1a"), []byte("1b")}, bufs)
+	require.Equal(t, []string{"d"}, missing)
+
+	// Bumping user 1's generation invalidates only their entries.
+	generation, err := generations.Bump(ctx1, "1")
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), generation)
+	require.Equal(t, uint64(1), generations.Get("1"))
+	require.Equal(t, uint64(0), generations.Get("2"))
+
+	found, _, missing = c.Fetch(ctx1, []string{"a", "b"})
+	require.Empty(t, found)
+	require.Equal(t, []string{"a", "b"}, missing)
+
+	found, bufs, _ = c.Fetch(ctx2, []string{"c"})
+	require.Equal(t, []string{"c"}, found)
+	require.Equal(t, [][]byte{[]byte("2c")}, bufs)
+
+	// New entries are stored for the new generation.
+	c.Store(ctx1, []string{"a"}, [][]byte{[]byte("1a'")})
+	found, bufs, missing = c.Fetch(ctx1, []string{"a", "b"})
+	require.Equal(t, []string{"a"}, found)
+	require.Equal(t, [][]byte{[]byte("1a'")}, bufs)
+	require.Equal(t, []string{"b"}, missing)
+}
+
+func TestGenerationsWatch(t *testing.T) {
+	kv := ring.NewInMemoryKVClientWithCodec(cache.GenerationsCodec{})
+	g1, err := cache.NewGenerations(cache.GenerationsConfig{Mock: kv})
+	require.NoError(t, err)
+	defer g1.Stop()
+	g2, err := cache.NewGenerations(cache.GenerationsConfig{Mock: kv})
+	require.NoError(t, err)
+	defer g2.Stop()
+
+	_, err = g1.Bump(context.Background(), "1")
+	require.NoError(t, err)
+	_, err = g1.Bump(context.Background(), "1")
+	require.NoError(t, err)
+
+	// Bumps are seen by everyone sharing the store.
+	deadline := time.Now().Add(5 * time.Second)
+	for g2.Get("1") != 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Equal(t, uint64(2), g2.Get("1"))
+}
+
+func TestGenerationsDisabled(t *testing.T) {
+	generations, err := cache.NewGenerations(cache.GenerationsConfig{})
+	require.NoError(t, err)
+	require.Nil(t, generations)
+	require.Equal(t, uint64(0), generations.Get("1"))
+
+	c, err := cache.New(cache.Config{Cache: cache.NewMockCache(), Generations: generations})
+	require.NoError(t, err)
+	ctx := user.InjectOrgID(context.Background(), "1")
+	c.Store(ctx, []string{"a"}, [][]byte{[]byte("1a")})
+	found, _, _ := c.Fetch(context.Background(), []string{"a"})
+	require.Equal(t, []string{"a"}, found)
+}
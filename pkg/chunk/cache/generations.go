@@ -0,0 +1,200 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/gorilla/mux"
+
+	"github.com/cortexproject/cortex/pkg/ring"
+	"github.com/cortexproject/cortex/pkg/util"
+)
+
+// generationsKey is the key the cache generations are stored under.
+const generationsKey = "cache-generations"
+
+var (
+	inmemoryGenerationsInit sync.Once
+	inmemoryGenerations     ring.KVClient
+)
+
+// GenerationsConfig configures where the cache generations are stored.
+type GenerationsConfig struct {
+	Store  string            `yaml:"store,omitempty"`
+	Consul ring.ConsulConfig `yaml:"consul,omitempty"`
+
+	// For tests to inject specific implementations.
+	Mock ring.KVClient
+}
+
+// RegisterFlags adds the flags required to config this to the given FlagSet.
+func (cfg *GenerationsConfig) RegisterFlags(f *flag.FlagSet) {
+	f.StringVar(&cfg.Store, "cache-generations.store", "", "Backend storage for per-user cache generations (consul, inmemory), empty to disable them.")
+	cfg.Consul.RegisterFlagsWithPrefix("cache-generations.", f)
+}
+
+// Generations are a number per user, mixed into the keys of their cache
+// entries, so all of a user's entries can be invalidated at once by bumping
+// it.  They are stored in a KV store, and watched for changes.
+type Generations struct {
+	kv     ring.KVClient
+	cancel context.CancelFunc
+
+	mtx         sync.RWMutex
+	generations map[string]uint64
+}
+
+// NewGenerations makes Generations from cfg, or returns nil if they're
+// disabled.
+func NewGenerations(cfg GenerationsConfig) (*Generations, error) {
+	var kv ring.KVClient
+	switch {
+	case cfg.Mock != nil:
+		kv = cfg.Mock
+	case cfg.Store == "":
+		return nil, nil
+	case cfg.Store == "consul":
+		var err error
+		kv, err = ring.NewConsulClient(cfg.Consul, GenerationsCodec{})
+		if err != nil {
+			return nil, err
+		}
+	case cfg.Store == "inmemory":
+		// Everyone in the same process gets the same instance.
+		inmemoryGenerationsInit.Do(func() {
+			inmemoryGenerations = ring.NewInMemoryKVClientWithCodec(GenerationsCodec{})
+		})
+		kv = inmemoryGenerations
+	default:
+		return nil, fmt.Errorf("invalid cache generations store: %s", cfg.Store)
+	}
+
+	// Create the key if it doesn't exist, so it can be watched.
+	ctx, cancel := context.WithCancel(context.Background())
+	var generations map[string]uint64
+	err := kv.CAS(ctx, generationsKey, func(in interface{}) (out interface{}, retry bool, err error) {
+		generations = map[string]uint64{}
+		if in != nil {
+			generations = in.(map[string]uint64)
+		}
+		return generations, true, nil
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	g := &Generations{
+		kv:          kv,
+		cancel:      cancel,
+		generations: generations,
+	}
+	go kv.WatchKey(ctx, generationsKey, func(in interface{}) bool {
+		g.mtx.Lock()
+		defer g.mtx.Unlock()
+		g.generations = in.(map[string]uint64)
+		return true
+	})
+	return g, nil
+}
+
+// Stop watching for changes.
+func (g *Generations) Stop() {
+	if g != nil {
+		g.cancel()
+	}
+}
+
+// Get returns a user's generation, 0 if they've never had one.
+func (g *Generations) Get(userID string) uint64 {
+	if g == nil {
+		return 0
+	}
+	g.mtx.RLock()
+	defer g.mtx.RUnlock()
+	return g.generations[userID]
+}
+
+// Bump increments a user's generation, invalidating their cache entries, and
+// returns the new one.
+func (g *Generations) Bump(ctx context.Context, userID string) (uint64, error) {
+	var generation uint64
+	err := g.kv.CAS(ctx, generationsKey, func(in interface{}) (out interface{}, retry bool, err error) {
+		generations := map[string]uint64{}
+		if in != nil {
+			for u, gen := range in.(map[string]uint64) {
+				generations[u] = gen
+			}
+		}
+		generations[userID]++
+		generation = generations[userID]
+		return generations, true, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	if g.generations[userID] < generation {
+		updated := make(map[string]uint64, len(g.generations)+1)
+		for u, gen := range g.generations {
+			updated[u] = gen
+		}
+		updated[userID] = generation
+		g.generations = updated
+	}
+	return generation, nil
+}
+
+// RegisterRoutes registers the cache generations API: GET /cache-generations
+// lists them, and POST /cache-generations/{user} bumps a user's.
+func (g *Generations) RegisterRoutes(router *mux.Router) {
+	router.Path("/cache-generations").Methods("GET").HandlerFunc(g.list)
+	router.Path("/cache-generations/{user}").Methods("POST").HandlerFunc(g.bump)
+}
+
+func (g *Generations) list(w http.ResponseWriter, r *http.Request) {
+	g.mtx.RLock()
+	defer g.mtx.RUnlock()
+	util.WriteJSONResponse(w, g.generations)
+}
+
+func (g *Generations) bump(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user"]
+	generation, err := g.Bump(r.Context(), userID)
+	if err != nil {
+		level.Error(util.Logger).Log("msg", "error bumping cache generation", "user", userID, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	level.Info(util.Logger).Log("msg", "bumped cache generation", "user", userID, "generation", generation)
+	util.WriteJSONResponse(w, struct {
+		User       string `json:"user"`
+		Generation uint64 `json:"generation"`
+	}{userID, generation})
+}
+
+// GenerationsCodec stores the generations as JSON, so they're easy to read
+// and edit in the KV store.
+type GenerationsCodec struct{}
+
+// Decode implements ring.Codec.
+func (GenerationsCodec) Decode(buf []byte) (interface{}, error) {
+	generations := map[string]uint64{}
+	if err := json.Unmarshal(buf, &generations); err != nil {
+		return nil, err
+	}
+	return generations, nil
+}
+
+// Encode implements ring.Codec.
+func (GenerationsCodec) Encode(in interface{}) ([]byte, error) {
+	return json.Marshal(in)
+}
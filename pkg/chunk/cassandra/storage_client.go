@@ -4,6 +4,8 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -24,7 +26,13 @@ type Config struct {
 	port                     int
 	keyspace                 string
 	consistency              string
+	readConsistency          string
+	writeConsistency         string
+	replicationStrategy      string
 	replicationFactor        int
+	replicationDCs           string
+	compactionStrategy       string
+	compactionWindow         time.Duration
 	disableInitialHostLookup bool
 	ssl                      bool
 	hostVerification         bool
@@ -41,7 +49,13 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&cfg.port, "cassandra.port", 9042, "Port that Cassandra is running on")
 	f.StringVar(&cfg.keyspace, "cassandra.keyspace", "", "Keyspace to use in Cassandra.")
 	f.StringVar(&cfg.consistency, "cassandra.consistency", "QUORUM", "Consistency level for Cassandra.")
-	f.IntVar(&cfg.replicationFactor, "cassandra.replication-factor", 1, "Replication factor to use in Cassandra.")
+	f.StringVar(&cfg.readConsistency, "cassandra.read-consistency", "", "Consistency level for reads from Cassandra, if not -cassandra.consistency.")
+	f.StringVar(&cfg.writeConsistency, "cassandra.write-consistency", "", "Consistency level for writes to Cassandra, if not -cassandra.consistency.")
+	f.StringVar(&cfg.replicationStrategy, "cassandra.replication-strategy", "SimpleStrategy", "Replication strategy of the keyspace when it is created: SimpleStrategy or NetworkTopologyStrategy.")
+	f.IntVar(&cfg.replicationFactor, "cassandra.replication-factor", 1, "Replication factor to use in Cassandra, with SimpleStrategy.")
+	f.StringVar(&cfg.replicationDCs, "cassandra.replication-dcs", "", "Comma-separated datacenter:replication-factor pairs to use in Cassandra, with NetworkTopologyStrategy, e.g. dc1:3,dc2:3.")
+	f.StringVar(&cfg.compactionStrategy, "cassandra.compaction-strategy", "", "Compaction strategy of tables, e.g. TimeWindowCompactionStrategy. Empty to use Cassandra's default.")
+	f.DurationVar(&cfg.compactionWindow, "cassandra.compaction-window", 24*time.Hour, "Window size with TimeWindowCompactionStrategy. Rounded down to whole minutes, and set in days or hours if it is a whole number of them.")
 	f.BoolVar(&cfg.disableInitialHostLookup, "cassandra.disable-initial-host-lookup", false, "Instruct the cassandra driver to not attempt to get host info from the system.peers table.")
 	f.BoolVar(&cfg.ssl, "cassandra.ssl", false, "Use SSL when connecting to cassandra instances.")
 	f.BoolVar(&cfg.hostVerification, "cassandra.host-verification", true, "Require SSL certificate validation.")
@@ -107,21 +121,72 @@ func (cfg *Config) createKeyspace() error {
 	}
 	defer session.Close()
 
+	replication, err := cfg.keyspaceReplication()
+	if err != nil {
+		return err
+	}
+
 	err = session.Query(fmt.Sprintf(
 		`CREATE KEYSPACE IF NOT EXISTS %s
-		 WITH replication = {
-			 'class' : 'SimpleStrategy',
-			 'replication_factor' : %d
-		 }`,
-		cfg.keyspace, cfg.replicationFactor)).Exec()
+		 WITH replication = %s`,
+		cfg.keyspace, replication)).Exec()
 	return errors.WithStack(err)
 }
 
+// keyspaceReplication returns the replication map to create the keyspace with.
+func (cfg *Config) keyspaceReplication() (string, error) {
+	switch cfg.replicationStrategy {
+	case "", "SimpleStrategy":
+		return fmt.Sprintf("{'class': 'SimpleStrategy', 'replication_factor': %d}", cfg.replicationFactor), nil
+
+	case "NetworkTopologyStrategy":
+		if cfg.replicationDCs == "" {
+			return "", fmt.Errorf("NetworkTopologyStrategy requires -cassandra.replication-dcs")
+		}
+		dcs := strings.Split(cfg.replicationDCs, ",")
+		sort.Strings(dcs)
+		options := []string{"'class': 'NetworkTopologyStrategy'"}
+		for _, dc := range dcs {
+			parts := strings.SplitN(dc, ":", 2)
+			if len(parts) != 2 {
+				return "", fmt.Errorf("invalid datacenter replication %q, expected datacenter:replication-factor", dc)
+			}
+			factor, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return "", fmt.Errorf("invalid datacenter replication %q: %v", dc, err)
+			}
+			options = append(options, fmt.Sprintf("'%s': %d", parts[0], factor))
+		}
+		return "{" + strings.Join(options, ", ") + "}", nil
+
+	default:
+		return "", fmt.Errorf("unknown replication strategy %q", cfg.replicationStrategy)
+	}
+}
+
+// readWriteConsistency returns the consistency levels for reads and writes.
+func (cfg *Config) readWriteConsistency() (read, write gocql.Consistency, err error) {
+	parse := func(consistency string) (gocql.Consistency, error) {
+		if consistency == "" {
+			consistency = cfg.consistency
+		}
+		c, err := gocql.ParseConsistencyWrapper(consistency)
+		return c, errors.WithStack(err)
+	}
+	if read, err = parse(cfg.readConsistency); err != nil {
+		return
+	}
+	write, err = parse(cfg.writeConsistency)
+	return
+}
+
 // StorageClient implements chunk.IndexClient and chunk.ObjectClient for Cassandra.
 type StorageClient struct {
 	cfg       Config
 	schemaCfg chunk.SchemaConfig
 	session   *gocql.Session
+
+	readConsistency, writeConsistency gocql.Consistency
 }
 
 // NewStorageClient returns a new StorageClient.
@@ -130,11 +195,17 @@ func NewStorageClient(cfg Config, schemaCfg chunk.SchemaConfig) (*StorageClient,
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
+	readConsistency, writeConsistency, err := cfg.readWriteConsistency()
+	if err != nil {
+		return nil, err
+	}
 
 	client := &StorageClient{
-		cfg:       cfg,
-		schemaCfg: schemaCfg,
-		session:   session,
+		cfg:              cfg,
+		schemaCfg:        schemaCfg,
+		session:          session,
+		readConsistency:  readConsistency,
+		writeConsistency: writeConsistency,
 	}
 	return client, nil
 }
@@ -148,6 +219,7 @@ func (s *StorageClient) Stop() {
 // atomic writes.  Therefore we just do a bunch of writes in parallel.
 type writeBatch struct {
 	entries []chunk.IndexEntry
+	deletes []chunk.IndexEntry
 }
 
 // NewWriteBatch implement chunk.IndexClient.
@@ -164,13 +236,29 @@ func (b *writeBatch) Add(tableName, hashValue string, rangeValue []byte, value [
 	})
 }
 
+func (b *writeBatch) Delete(tableName, hashValue string, rangeValue []byte) {
+	b.deletes = append(b.deletes, chunk.IndexEntry{
+		TableName:  tableName,
+		HashValue:  hashValue,
+		RangeValue: rangeValue,
+	})
+}
+
 // BatchWrite implement chunk.IndexClient.
 func (s *StorageClient) BatchWrite(ctx context.Context, batch chunk.WriteBatch) error {
 	b := batch.(*writeBatch)
 
 	for _, entry := range b.entries {
 		err := s.session.Query(fmt.Sprintf("INSERT INTO %s (hash, range, value) VALUES (?, ?, ?)",
-			entry.TableName), entry.HashValue, entry.RangeValue, entry.Value).WithContext(ctx).Exec()
+			entry.TableName), entry.HashValue, entry.RangeValue, entry.Value).Consistency(s.writeConsistency).WithContext(ctx).Exec()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	for _, entry := range b.deletes {
+		err := s.session.Query(fmt.Sprintf("DELETE FROM %s WHERE hash = ? AND range = ?",
+			entry.TableName), entry.HashValue, entry.RangeValue).Consistency(s.writeConsistency).WithContext(ctx).Exec()
 		if err != nil {
 			return errors.WithStack(err)
 		}
@@ -179,6 +267,26 @@ func (s *StorageClient) BatchWrite(ctx context.Context, batch chunk.WriteBatch)
 	return nil
 }
 
+// ScanTable implements chunk.IndexScanner.
+func (s *StorageClient) ScanTable(ctx context.Context, tableName string, callback func(hashValue string, rangeValue []byte) error) error {
+	iter := s.session.Query(fmt.Sprintf("SELECT hash, range FROM %s", tableName)).Consistency(s.readConsistency).WithContext(ctx).Iter()
+	defer iter.Close()
+	scanner := iter.Scanner()
+	for scanner.Next() {
+		var (
+			hashValue  string
+			rangeValue []byte
+		)
+		if err := scanner.Scan(&hashValue, &rangeValue); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := callback(hashValue, rangeValue); err != nil {
+			return err
+		}
+	}
+	return errors.WithStack(scanner.Err())
+}
+
 // QueryPages implement chunk.IndexClient.
 func (s *StorageClient) QueryPages(ctx context.Context, queries []chunk.IndexQuery, callback func(chunk.IndexQuery, chunk.ReadBatch) bool) error {
 	return util.DoParallelQueries(ctx, s.query, queries, callback)
@@ -213,7 +321,7 @@ func (s *StorageClient) query(ctx context.Context, query chunk.IndexQuery, callb
 			query.TableName), query.HashValue, query.ValueEqual)
 	}
 
-	iter := q.WithContext(ctx).Iter()
+	iter := q.Consistency(s.readConsistency).WithContext(ctx).Iter()
 	defer iter.Close()
 	scanner := iter.Scanner()
 	for scanner.Next() {
@@ -278,7 +386,7 @@ func (s *StorageClient) PutChunks(ctx context.Context, chunks []chunk.Chunk) err
 		// Must provide a range key, even though its not useds - hence 0x00.
 		q := s.session.Query(fmt.Sprintf("INSERT INTO %s (hash, range, value) VALUES (?, 0x00, ?)",
 			tableName), key, buf)
-		if err := q.WithContext(ctx).Exec(); err != nil {
+		if err := q.Consistency(s.writeConsistency).WithContext(ctx).Exec(); err != nil {
 			return errors.WithStack(err)
 		}
 	}
@@ -299,9 +407,25 @@ func (s *StorageClient) getChunk(ctx context.Context, decodeContext *chunk.Decod
 
 	var buf []byte
 	if err := s.session.Query(fmt.Sprintf("SELECT value FROM %s WHERE hash = ?", tableName), input.ExternalKey()).
-		WithContext(ctx).Scan(&buf); err != nil {
+		Consistency(s.readConsistency).WithContext(ctx).Scan(&buf); err != nil {
 		return input, errors.WithStack(err)
 	}
 	err = input.Decode(decodeContext, buf)
 	return input, err
 }
+
+// DeleteChunk implements chunk.ObjectClient.
+func (s *StorageClient) DeleteChunk(ctx context.Context, chunkID string) error {
+	c, err := chunk.ParseObjectKey(chunkID)
+	if err != nil {
+		return err
+	}
+	tableName, err := s.schemaCfg.ChunkTableFor(c.From)
+	if err != nil {
+		return err
+	}
+
+	err = s.session.Query(fmt.Sprintf("DELETE FROM %s WHERE hash = ? AND range = 0x00", tableName), chunkID).
+		Consistency(s.writeConsistency).WithContext(ctx).Exec()
+	return errors.WithStack(err)
+}
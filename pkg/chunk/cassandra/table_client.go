@@ -3,11 +3,16 @@ package cassandra
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/go-kit/kit/log/level"
 	"github.com/gocql/gocql"
 	"github.com/pkg/errors"
 
 	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/util"
 )
 
 type tableClient struct {
@@ -40,16 +45,54 @@ func (c *tableClient) ListTables(ctx context.Context) ([]string, error) {
 }
 
 func (c *tableClient) CreateTable(ctx context.Context, desc chunk.TableDesc) error {
-	err := c.session.Query(fmt.Sprintf(`
+	query := fmt.Sprintf(`
 		CREATE TABLE IF NOT EXISTS %s (
 			hash text,
 			range blob,
 			value blob,
 			PRIMARY KEY (hash, range)
-		)`, desc.Name)).WithContext(ctx).Exec()
+		)`, desc.Name)
+	if options := c.cfg.tableOptions(desc, true); len(options) > 0 {
+		query += " WITH " + strings.Join(options, " AND ")
+	}
+	err := c.session.Query(query).WithContext(ctx).Exec()
 	return errors.WithStack(err)
 }
 
+// tableOptions returns the options to create or alter a table with: its
+// default TTL, matching its max age, and its compaction strategy.
+func (cfg *Config) tableOptions(desc chunk.TableDesc, compaction bool) []string {
+	options := []string{
+		fmt.Sprintf("default_time_to_live = %d", int64(desc.MaxAge/time.Second)),
+	}
+	if compaction && cfg.compactionStrategy != "" {
+		options = append(options, "compaction = "+cfg.compaction())
+	}
+	return options
+}
+
+// compaction returns the compaction options for tables.
+func (cfg *Config) compaction() string {
+	if cfg.compactionStrategy != "TimeWindowCompactionStrategy" {
+		return fmt.Sprintf("{'class': '%s'}", cfg.compactionStrategy)
+	}
+	unit, size := cfg.compactionWindowOptions()
+	return fmt.Sprintf("{'class': 'TimeWindowCompactionStrategy', 'compaction_window_unit': '%s', 'compaction_window_size': %d}", unit, size)
+}
+
+// compactionWindowOptions returns the unit and size of the compaction window,
+// in the largest unit it is a whole number of.
+func (cfg *Config) compactionWindowOptions() (string, int64) {
+	switch {
+	case cfg.compactionWindow%(24*time.Hour) == 0:
+		return "DAYS", int64(cfg.compactionWindow / (24 * time.Hour))
+	case cfg.compactionWindow%time.Hour == 0:
+		return "HOURS", int64(cfg.compactionWindow / time.Hour)
+	default:
+		return "MINUTES", int64(cfg.compactionWindow / time.Minute)
+	}
+}
+
 func (c *tableClient) DeleteTable(ctx context.Context, name string) error {
 	err := c.session.Query(fmt.Sprintf(`
 		DROP TABLE IF EXISTS %s;`, name)).WithContext(ctx).Exec()
@@ -57,11 +100,71 @@ func (c *tableClient) DeleteTable(ctx context.Context, name string) error {
 }
 
 func (c *tableClient) DescribeTable(ctx context.Context, name string) (desc chunk.TableDesc, isActive bool, err error) {
-	return chunk.TableDesc{
-		Name: name,
-	}, true, nil
+	desc.Name = name
+	ttl, _, err := c.tableSchema(ctx, name)
+	if err != nil {
+		return desc, false, err
+	}
+	desc.MaxAge = time.Duration(ttl) * time.Second
+	return desc, true, nil
+}
+
+// tableSchema returns a table's default TTL in seconds, and its compaction
+// options.
+func (c *tableClient) tableSchema(ctx context.Context, name string) (ttl int, compaction map[string]string, err error) {
+	err = c.session.Query(`
+		SELECT default_time_to_live, compaction FROM system_schema.tables
+		WHERE keyspace_name = ? AND table_name = ?`, c.cfg.keyspace, name).
+		WithContext(ctx).Scan(&ttl, &compaction)
+	return ttl, compaction, errors.WithStack(err)
+}
+
+// NeedsUpdate implements chunk.TableSettingsClient: tables need updating if
+// their compaction isn't as configured.
+func (c *tableClient) NeedsUpdate(ctx context.Context, name string) (bool, error) {
+	_, compaction, err := c.tableSchema(ctx, name)
+	if err != nil {
+		return false, err
+	}
+	return !c.cfg.compactionMatches(compaction), nil
+}
+
+// compactionMatches returns whether a table's compaction options are as
+// configured, or whether none are configured.
+func (cfg *Config) compactionMatches(compaction map[string]string) bool {
+	if cfg.compactionStrategy == "" {
+		return true
+	}
+	// Cassandra reports the fully qualified class name.
+	if !strings.HasSuffix(compaction["class"], "."+cfg.compactionStrategy) && compaction["class"] != cfg.compactionStrategy {
+		return false
+	}
+	if cfg.compactionStrategy != "TimeWindowCompactionStrategy" {
+		return true
+	}
+	unit, size := cfg.compactionWindowOptions()
+	return strings.EqualFold(compaction["compaction_window_unit"], unit) && compaction["compaction_window_size"] == strconv.FormatInt(size, 10)
 }
 
 func (c *tableClient) UpdateTable(ctx context.Context, current, expected chunk.TableDesc) error {
-	return nil
+	_, compaction, err := c.tableSchema(ctx, expected.Name)
+	if err != nil {
+		return err
+	}
+
+	updateCompaction := !c.cfg.compactionMatches(compaction)
+	if current.MaxAge == expected.MaxAge && !updateCompaction {
+		return nil
+	}
+
+	level.Info(util.Logger).Log("msg", "updating table", "table", expected.Name, "max_age", expected.MaxAge, "compaction", c.cfg.compactionStrategy)
+	err = c.session.Query(fmt.Sprintf("ALTER TABLE %s WITH %s",
+		expected.Name, strings.Join(c.cfg.tableOptions(expected, updateCompaction), " AND "))).WithContext(ctx).Exec()
+	return errors.WithStack(err)
+}
+
+// SupportsMaxAge implements chunk.MaxAgeTableClient: tables' max age is their
+// default TTL.
+func (c *tableClient) SupportsMaxAge() bool {
+	return true
 }
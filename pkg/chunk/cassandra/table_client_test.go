@@ -0,0 +1,104 @@
+package cassandra
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cortexproject/cortex/pkg/chunk"
+)
+
+func TestKeyspaceReplication(t *testing.T) {
+	for _, tc := range []struct {
+		cfg      Config
+		expected string
+		err      bool
+	}{
+		{
+			cfg:      Config{replicationFactor: 3},
+			expected: "{'class': 'SimpleStrategy', 'replication_factor': 3}",
+		},
+		{
+			cfg:      Config{replicationStrategy: "NetworkTopologyStrategy", replicationDCs: "dc2:2,dc1:3"},
+			expected: "{'class': 'NetworkTopologyStrategy', 'dc1': 3, 'dc2': 2}",
+		},
+		{
+			cfg: Config{replicationStrategy: "NetworkTopologyStrategy"},
+			err: true,
+		},
+		{
+			cfg: Config{replicationStrategy: "NetworkTopologyStrategy", replicationDCs: "dc1"},
+			err: true,
+		},
+		{
+			cfg: Config{replicationStrategy: "OldNetworkTopologyStrategy"},
+			err: true,
+		},
+	} {
+		replication, err := tc.cfg.keyspaceReplication()
+		if tc.err {
+			assert.Error(t, err)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, replication)
+	}
+}
+
+func TestTableOptions(t *testing.T) {
+	desc := chunk.TableDesc{Name: "table", MaxAge: 7 * 24 * time.Hour}
+
+	cfg := Config{}
+	assert.Equal(t, []string{"default_time_to_live = 604800"}, cfg.tableOptions(desc, true))
+
+	cfg = Config{compactionStrategy: "LeveledCompactionStrategy"}
+	assert.Equal(t, []string{
+		"default_time_to_live = 604800",
+		"compaction = {'class': 'LeveledCompactionStrategy'}",
+	}, cfg.tableOptions(desc, true))
+	assert.Equal(t, []string{"default_time_to_live = 604800"}, cfg.tableOptions(desc, false))
+
+	for window, expected := range map[time.Duration]string{
+		48 * time.Hour:   "'compaction_window_unit': 'DAYS', 'compaction_window_size': 2",
+		6 * time.Hour:    "'compaction_window_unit': 'HOURS', 'compaction_window_size': 6",
+		90 * time.Minute: "'compaction_window_unit': 'MINUTES', 'compaction_window_size': 90",
+	} {
+		cfg = Config{compactionStrategy: "TimeWindowCompactionStrategy", compactionWindow: window}
+		assert.Equal(t, "{'class': 'TimeWindowCompactionStrategy', "+expected+"}", cfg.compaction())
+	}
+}
+
+func TestCompactionMatches(t *testing.T) {
+	twcs := map[string]string{
+		"class":                  "org.apache.cassandra.db.compaction.TimeWindowCompactionStrategy",
+		"compaction_window_unit": "DAYS",
+		"compaction_window_size": "1",
+	}
+
+	cfg := Config{}
+	assert.True(t, cfg.compactionMatches(twcs))
+
+	cfg = Config{compactionStrategy: "TimeWindowCompactionStrategy", compactionWindow: 24 * time.Hour}
+	assert.True(t, cfg.compactionMatches(twcs))
+	cfg.compactionWindow = 6 * time.Hour
+	assert.False(t, cfg.compactionMatches(twcs))
+
+	cfg = Config{compactionStrategy: "LeveledCompactionStrategy"}
+	assert.False(t, cfg.compactionMatches(twcs))
+	assert.True(t, cfg.compactionMatches(map[string]string{"class": "org.apache.cassandra.db.compaction.LeveledCompactionStrategy"}))
+}
+
+func TestReadWriteConsistency(t *testing.T) {
+	cfg := Config{consistency: "QUORUM", readConsistency: "ONE"}
+	read, write, err := cfg.readWriteConsistency()
+	require.NoError(t, err)
+	assert.Equal(t, gocql.One, read)
+	assert.Equal(t, gocql.Quorum, write)
+
+	cfg.writeConsistency = "SOMETIMES"
+	_, _, err = cfg.readWriteConsistency()
+	assert.Error(t, err)
+}
@@ -108,6 +108,20 @@ func ParseExternalKey(userID, externalKey string) (Chunk, error) {
 	return chunk, nil
 }
 
+// ParseObjectKey constructs a partially-populated chunk from the key it is
+// stored under in an ObjectClient, as returned by ExternalKey: these always
+// start with `<user id>/`, whatever the format of the rest.
+func ParseObjectKey(key string) (Chunk, error) {
+	parts := strings.SplitN(key, "/", 2)
+	if len(parts) != 2 {
+		return Chunk{}, errInvalidChunkID(key)
+	}
+	if strings.Count(parts[1], ":") == 2 {
+		return parseLegacyChunkID(parts[0], parts[1])
+	}
+	return parseNewExternalKey(key)
+}
+
 func parseLegacyChunkID(userID, key string) (Chunk, error) {
 	parts := strings.Split(key, ":")
 	if len(parts) != 3 {
@@ -137,6 +137,39 @@ func (c *store) PutOne(ctx context.Context, from, through model.Time, chunk Chun
 	return c.index.BatchWrite(ctx, writeReqs)
 }
 
+// DeleteChunk implements Store.  It deletes the chunk's index entries between
+// from and through, then the chunk itself.
+func (c *store) DeleteChunk(ctx context.Context, from, through model.Time, chunk Chunk) error {
+	metricName, err := extract.MetricNameFromMetric(chunk.Metric)
+	if err != nil {
+		return err
+	}
+
+	entries, err := c.schema.GetWriteEntries(from, through, chunk.UserID, metricName, chunk.Metric, chunk.ExternalKey())
+	if err != nil {
+		return err
+	}
+
+	if err := deleteIndexEntries(ctx, c.index, entries); err != nil {
+		return err
+	}
+	return c.storage.DeleteChunk(ctx, chunk.ExternalKey())
+}
+
+// deleteIndexEntries deletes each of the given index entries once.
+func deleteIndexEntries(ctx context.Context, index IndexClient, entries []IndexEntry) error {
+	seenIndexEntries := map[string]struct{}{}
+	batch := index.NewWriteBatch()
+	for _, entry := range entries {
+		key := fmt.Sprintf("%s:%s:%x", entry.TableName, entry.HashValue, entry.RangeValue)
+		if _, ok := seenIndexEntries[key]; !ok {
+			seenIndexEntries[key] = struct{}{}
+			batch.Delete(entry.TableName, entry.HashValue, entry.RangeValue)
+		}
+	}
+	return index.BatchWrite(ctx, batch)
+}
+
 // calculateIndexEntries creates a set of batched WriteRequests for all the chunks it is given.
 func (c *store) calculateIndexEntries(userID string, from, through model.Time, chunk Chunk) (WriteBatch, error) {
 	seenIndexEntries := map[string]struct{}{}
@@ -172,7 +205,7 @@ func (c *store) Get(ctx context.Context, from, through model.Time, allMatchers .
 	level.Debug(log).Log("from", from, "through", through, "matchers", len(allMatchers))
 
 	// Validate the query is within reasonable bounds.
-	metricName, matchers, shortcut, err := c.validateQuery(ctx, from, &through, allMatchers)
+	metricName, matchers, shortcut, err := c.validateQuery(ctx, &from, &through, allMatchers)
 	if err != nil {
 		return nil, err
 	} else if shortcut {
@@ -183,6 +216,37 @@ func (c *store) Get(ctx context.Context, from, through model.Time, allMatchers .
 	return c.getMetricNameChunks(ctx, from, through, matchers, metricName)
 }
 
+// GetChunkRefs implements Store
+func (c *store) GetChunkRefs(ctx context.Context, from, through model.Time, metric model.Metric) ([]Chunk, error) {
+	matchers := make([]*labels.Matcher, 0, len(metric))
+	for name, value := range metric {
+		if name == model.MetricNameLabel {
+			continue
+		}
+		matcher, err := labels.NewMatcher(labels.MatchEqual, string(name), string(value))
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, matcher)
+	}
+	chunks, err := c.lookupChunksByMetricName(ctx, from, through, matchers, string(metric[model.MetricNameLabel]))
+	if err != nil {
+		return nil, err
+	}
+
+	// This schema doesn't index series, and the matchers also match series
+	// with more labels, so take the chunks with the series' fingerprint.
+	fp := metric.FastFingerprint()
+	filtered, _ := filterChunksByTime(from, through, chunks)
+	refs := filtered[:0]
+	for _, chunk := range filtered {
+		if chunk.Fingerprint == fp {
+			refs = append(refs, chunk)
+		}
+	}
+	return refs, nil
+}
+
 // LabelValuesForMetricName retrieves all label values for a single label name and metric name.
 func (c *store) LabelValuesForMetricName(ctx context.Context, from, through model.Time, metricName, labelName string) ([]string, error) {
 	log, ctx := spanlogger.New(ctx, "ChunkStore.LabelValues")
@@ -194,7 +258,7 @@ func (c *store) LabelValuesForMetricName(ctx context.Context, from, through mode
 		return nil, err
 	}
 
-	shortcut, err := c.validateQueryTimeRange(ctx, from, &through)
+	shortcut, err := c.validateQueryTimeRange(ctx, &from, &through)
 	if err != nil {
 		return nil, err
 	} else if shortcut {
@@ -225,11 +289,11 @@ func (c *store) LabelValuesForMetricName(ctx context.Context, from, through mode
 	return result, nil
 }
 
-func (c *store) validateQueryTimeRange(ctx context.Context, from model.Time, through *model.Time) (bool, error) {
+func (c *store) validateQueryTimeRange(ctx context.Context, from *model.Time, through *model.Time) (bool, error) {
 	log, ctx := spanlogger.New(ctx, "store.validateQueryTimeRange")
 	defer log.Span.Finish()
 
-	if *through < from {
+	if *through < *from {
 		return false, httpgrpc.Errorf(http.StatusBadRequest, "invalid query, through < from (%s < %s)", through, from)
 	}
 
@@ -238,12 +302,25 @@ func (c *store) validateQueryTimeRange(ctx context.Context, from model.Time, thr
 		return false, err
 	}
 
-	maxQueryLength := c.limits.MaxQueryLength(userID)
-	if maxQueryLength > 0 && (*through).Sub(from) > maxQueryLength {
-		return false, httpgrpc.Errorf(http.StatusBadRequest, validation.ErrQueryTooLong, (*through).Sub(from), maxQueryLength)
+	now := model.Now()
+
+	if retention := c.limits.RetentionPeriod(userID); retention > 0 {
+		cutoff := now.Add(-retention)
+		if through.Before(cutoff) {
+			// whole timerange past the user's retention, which may not have been deleted yet
+			level.Debug(log).Log("msg", "whole timerange past retention, yield empty resultset", "through", *through, "from", *from, "cutoff", cutoff)
+			return true, nil
+		}
+		if from.Before(cutoff) {
+			level.Debug(log).Log("msg", "adjusting start timerange to retention", "old_from", *from, "new_from", cutoff)
+			*from = cutoff
+		}
 	}
 
-	now := model.Now()
+	maxQueryLength := c.limits.MaxQueryLength(userID)
+	if maxQueryLength > 0 && (*through).Sub(*from) > maxQueryLength {
+		return false, httpgrpc.Errorf(http.StatusBadRequest, validation.ErrQueryTooLong, (*through).Sub(*from), maxQueryLength)
+	}
 
 	if from.After(now) {
 		// time-span start is in future ... regard as legal
@@ -265,7 +342,7 @@ func (c *store) validateQueryTimeRange(ctx context.Context, from model.Time, thr
 	return false, nil
 }
 
-func (c *store) validateQuery(ctx context.Context, from model.Time, through *model.Time, matchers []*labels.Matcher) (string, []*labels.Matcher, bool, error) {
+func (c *store) validateQuery(ctx context.Context, from *model.Time, through *model.Time, matchers []*labels.Matcher) (string, []*labels.Matcher, bool, error) {
 	log, ctx := spanlogger.New(ctx, "store.validateQuery")
 	defer log.Span.Finish()
 
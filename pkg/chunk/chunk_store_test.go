@@ -717,3 +717,144 @@ func TestChunkStoreError(t *testing.T) {
 		}
 	}
 }
+
+func TestChunkStoreRetention(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), userID)
+	metric := model.Metric{
+		model.MetricNameLabel: "foo",
+		"bar":                 "baz",
+	}
+	now := model.Now()
+
+	var limits validation.Limits
+	flagext.DefaultValues(&limits)
+	limits.RetentionPeriod = 24 * time.Hour
+	overrides, err := validation.NewOverrides(limits)
+	require.NoError(t, err)
+
+	for _, schema := range schemas {
+		t.Run(schema.name, func(t *testing.T) {
+			var (
+				storeCfg  StoreConfig
+				tbmConfig TableManagerConfig
+				schemaCfg = DefaultSchemaConfig("", schema.name, 0)
+			)
+			flagext.DefaultValues(&storeCfg, &tbmConfig)
+			storage := NewMockStorage()
+			tableManager, err := NewTableManager(tbmConfig, schemaCfg, maxChunkAge, storage)
+			require.NoError(t, err)
+			require.NoError(t, tableManager.SyncTables(context.Background()))
+
+			store := NewCompositeStore()
+			require.NoError(t, store.AddPeriod(storeCfg, schemaCfg.Configs[0], storage, storage, overrides))
+			defer store.Stop()
+
+			expired := dummyChunkFor(now.Add(-48*time.Hour), metric)
+			retained := dummyChunkFor(now.Add(-time.Hour), metric)
+			require.NoError(t, store.Put(ctx, []Chunk{expired, retained}))
+
+			matchers, err := promql.ParseMetricSelector(`foo{bar="baz"}`)
+			require.NoError(t, err)
+
+			// Queries are clamped to the retention period.
+			chunks, err := store.Get(ctx, now.Add(-72*time.Hour), now, matchers...)
+			require.NoError(t, err)
+			require.Len(t, chunks, 1)
+			require.Equal(t, retained.ExternalKey(), chunks[0].ExternalKey())
+
+			// Queries entirely past it return nothing.
+			chunks, err = store.Get(ctx, now.Add(-72*time.Hour), now.Add(-30*time.Hour), matchers...)
+			require.NoError(t, err)
+			require.Empty(t, chunks)
+		})
+	}
+}
+
+func TestChunkStore_DeleteChunk(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), userID)
+	metric := model.Metric{
+		model.MetricNameLabel: "foo",
+		"bar":                 "baz",
+	}
+	now := model.Now()
+
+	for _, schema := range schemas {
+		t.Run(schema.name, func(t *testing.T) {
+			var (
+				storeCfg  StoreConfig
+				tbmConfig TableManagerConfig
+				schemaCfg = DefaultSchemaConfig("", schema.name, 0)
+			)
+			flagext.DefaultValues(&storeCfg, &tbmConfig)
+			storage := NewMockStorage()
+			tableManager, err := NewTableManager(tbmConfig, schemaCfg, maxChunkAge, storage)
+			require.NoError(t, err)
+			require.NoError(t, tableManager.SyncTables(context.Background()))
+
+			var limits validation.Limits
+			flagext.DefaultValues(&limits)
+			overrides, err := validation.NewOverrides(limits)
+			require.NoError(t, err)
+
+			store := NewCompositeStore()
+			require.NoError(t, store.AddPeriod(storeCfg, schemaCfg.Configs[0], storage, storage, overrides))
+			defer store.Stop()
+
+			deleted := dummyChunkFor(now.Add(-2*time.Hour), metric)
+			kept := dummyChunkFor(now.Add(-time.Hour), metric)
+			require.NoError(t, store.Put(ctx, []Chunk{deleted, kept}))
+			require.NoError(t, store.DeleteChunk(ctx, deleted.From, deleted.Through, deleted))
+
+			matchers, err := promql.ParseMetricSelector(`foo{bar="baz"}`)
+			require.NoError(t, err)
+			chunks, err := store.Get(ctx, now.Add(-3*time.Hour), now, matchers...)
+			require.NoError(t, err)
+			require.Len(t, chunks, 1)
+			require.Equal(t, kept.ExternalKey(), chunks[0].ExternalKey())
+
+			_, err = storage.GetChunks(ctx, []Chunk{deleted})
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestChunkStore_GetChunkRefs(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), userID)
+	metric := model.Metric{
+		model.MetricNameLabel: "foo",
+		"bar":                 "baz",
+	}
+	superset := model.Metric{
+		model.MetricNameLabel: "foo",
+		"bar":                 "baz",
+		"toms":                "code",
+	}
+	now := model.Now()
+
+	// Fingerprint the chunks as ingesters do.
+	chunkFor := func(through model.Time, metric model.Metric) Chunk {
+		chunk := dummyChunkFor(through, metric)
+		chunk.Fingerprint = metric.FastFingerprint()
+		return chunk
+	}
+
+	for _, schema := range schemas {
+		t.Run(schema.name, func(t *testing.T) {
+			store := newTestChunkStore(t, schema.name)
+			defer store.Stop()
+
+			old := chunkFor(now.Add(-3*time.Hour), metric)
+			recent := chunkFor(now.Add(-time.Hour), metric)
+			require.NoError(t, store.Put(ctx, []Chunk{old, recent, chunkFor(now.Add(-time.Hour), superset)}))
+
+			refs, err := store.GetChunkRefs(ctx, now.Add(-90*time.Minute), now, metric)
+			require.NoError(t, err)
+			require.Len(t, refs, 1)
+			require.Equal(t, recent.ExternalKey(), refs[0].ExternalKey())
+			require.Equal(t, recent.From, refs[0].From)
+			require.Equal(t, recent.Through, refs[0].Through)
+			// Only the index was read, not the chunk.
+			require.Nil(t, refs[0].Data)
+		})
+	}
+}
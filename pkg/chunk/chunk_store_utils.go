@@ -12,6 +12,7 @@ import (
 	"github.com/cortexproject/cortex/pkg/chunk/cache"
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/spanlogger"
+	"github.com/cortexproject/cortex/pkg/util/stats"
 )
 
 const chunkDecodeParallelism = 16
@@ -134,6 +135,17 @@ func (c *Fetcher) FetchChunks(ctx context.Context, chunks []Chunk, keys []string
 		return nil, promql.ErrStorage{Err: err}
 	}
 
+	fetchedBytes := 0
+	for _, buf := range cacheBufs {
+		fetchedBytes += len(buf)
+	}
+	for i := range fromStorage {
+		if encoded, err := fromStorage[i].Encoded(); err == nil {
+			fetchedBytes += len(encoded)
+		}
+	}
+	stats.FromContext(ctx).AddFetchedChunks(len(fromCache)+len(fromStorage), fetchedBytes, len(fromCache))
+
 	allChunks := append(fromCache, fromStorage...)
 	return allChunks, nil
 }
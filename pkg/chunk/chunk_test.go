@@ -152,6 +152,32 @@ func TestParseExternalKey(t *testing.T) {
 	}
 }
 
+func TestParseObjectKey(t *testing.T) {
+	for _, c := range []Chunk{
+		{
+			UserID:      userID,
+			Fingerprint: model.Fingerprint(2),
+			From:        model.Time(1484661279394),
+			Through:     model.Time(1484664879394),
+		},
+		{
+			UserID:      userID,
+			Fingerprint: model.Fingerprint(2),
+			From:        model.Time(655200000),
+			Through:     model.Time(655200000),
+			ChecksumSet: true,
+			Checksum:    4165752645,
+		},
+	} {
+		chunk, err := ParseObjectKey(c.ExternalKey())
+		require.NoError(t, err)
+		require.Equal(t, c, chunk)
+	}
+
+	_, err := ParseObjectKey("2:270d8f00:270d8f00:f84c5745")
+	require.Error(t, err)
+}
+
 func TestChunksToMatrix(t *testing.T) {
 	// Create 2 chunks which have the same metric
 	metric := model.Metric{
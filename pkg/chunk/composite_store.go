@@ -4,17 +4,29 @@ import (
 	"context"
 	"sort"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/pkg/labels"
 
 	"github.com/cortexproject/cortex/pkg/util/validation"
 )
 
+var dedupedChunks = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: "cortex",
+	Name:      "chunk_store_deduped_chunks_total",
+	Help:      "Total chunks found more than once by a query, and deduplicated.",
+})
+
 // Store for chunks.
 type Store interface {
 	Put(ctx context.Context, chunks []Chunk) error
 	PutOne(ctx context.Context, from, through model.Time, chunk Chunk) error
+	DeleteChunk(ctx context.Context, from, through model.Time, chunk Chunk) error
 	Get(tx context.Context, from, through model.Time, matchers ...*labels.Matcher) ([]Chunk, error)
+	// GetChunkRefs returns the chunks of the series in the index, without
+	// fetching their data: only their keys, and so time ranges, are set.
+	GetChunkRefs(ctx context.Context, from, through model.Time, metric model.Metric) ([]Chunk, error)
 	LabelValuesForMetricName(ctx context.Context, from, through model.Time, metricName string, labelName string) ([]string, error)
 	Stop()
 }
@@ -76,19 +88,69 @@ func (c compositeStore) PutOne(ctx context.Context, from, through model.Time, ch
 	})
 }
 
+// DeleteChunk deletes a chunk, and its index entries, from each store it was
+// put into.
+func (c compositeStore) DeleteChunk(ctx context.Context, from, through model.Time, chunk Chunk) error {
+	return c.forStores(from, through, func(from, through model.Time, store Store) error {
+		return store.DeleteChunk(ctx, from, through, chunk)
+	})
+}
+
 func (c compositeStore) Get(ctx context.Context, from, through model.Time, matchers ...*labels.Matcher) ([]Chunk, error) {
 	var results []Chunk
+	stores := 0
 	err := c.forStores(from, through, func(from, through model.Time, store Store) error {
 		chunks, err := store.Get(ctx, from, through, matchers...)
 		if err != nil {
 			return err
 		}
 		results = append(results, chunks...)
+		stores++
+		return nil
+	})
+	if stores > 1 {
+		results = dedupeChunks(results)
+	}
+	return results, err
+}
+
+func (c compositeStore) GetChunkRefs(ctx context.Context, from, through model.Time, metric model.Metric) ([]Chunk, error) {
+	var results []Chunk
+	stores := 0
+	err := c.forStores(from, through, func(from, through model.Time, store Store) error {
+		chunks, err := store.GetChunkRefs(ctx, from, through, metric)
+		if err != nil {
+			return err
+		}
+		results = append(results, chunks...)
+		stores++
 		return nil
 	})
+	if stores > 1 {
+		results = dedupeChunks(results)
+	}
 	return results, err
 }
 
+// dedupeChunks removes chunks with the same key, i.e. the same series, time
+// range and checksum.  The series store dedupes the chunks it finds in the
+// index before fetching them, but chunks spanning the start of a period are
+// indexed in both periods' stores, so are fetched by each.
+func dedupeChunks(chunks []Chunk) []Chunk {
+	seen := make(map[string]struct{}, len(chunks))
+	result := chunks[:0]
+	for _, chunk := range chunks {
+		key := chunk.ExternalKey()
+		if _, ok := seen[key]; ok {
+			dedupedChunks.Inc()
+			continue
+		}
+		seen[key] = struct{}{}
+		result = append(result, chunk)
+	}
+	return result
+}
+
 // LabelValuesForMetricName retrieves all label values for a single label name and metric name.
 func (c compositeStore) LabelValuesForMetricName(ctx context.Context, from, through model.Time, metricName string, labelName string) ([]string, error) {
 	var result []string
@@ -21,9 +21,18 @@ func (m mockStore) PutOne(ctx context.Context, from, through model.Time, chunk C
 	return nil
 }
 
+func (m mockStore) DeleteChunk(ctx context.Context, from, through model.Time, chunk Chunk) error {
+	return nil
+}
+
 func (m mockStore) Get(tx context.Context, from, through model.Time, matchers ...*labels.Matcher) ([]Chunk, error) {
 	return nil, nil
 }
+
+func (m mockStore) GetChunkRefs(ctx context.Context, from, through model.Time, metric model.Metric) ([]Chunk, error) {
+	return nil, nil
+}
+
 func (m mockStore) LabelValuesForMetricName(ctx context.Context, from, through model.Time, metricName string, labelName string) ([]string, error) {
 	return nil, nil
 }
@@ -172,3 +181,45 @@ func TestCompositeStore(t *testing.T) {
 		})
 	}
 }
+
+type chunksStore struct {
+	mockStore
+	chunks []Chunk
+}
+
+func (m chunksStore) Get(tx context.Context, from, through model.Time, matchers ...*labels.Matcher) ([]Chunk, error) {
+	return m.chunks, nil
+}
+
+func TestCompositeStoreDedupe(t *testing.T) {
+	newChunk := func(from, through model.Time) Chunk {
+		return Chunk{
+			UserID:      userID,
+			Fingerprint: 1,
+			From:        from,
+			Through:     through,
+			Checksum:    123,
+			ChecksumSet: true,
+		}
+	}
+	before := newChunk(model.TimeFromUnix(10), model.TimeFromUnix(20))
+	spanning := newChunk(model.TimeFromUnix(90), model.TimeFromUnix(110))
+	after := newChunk(model.TimeFromUnix(120), model.TimeFromUnix(130))
+
+	cs := compositeStore{
+		stores: []compositeStoreEntry{
+			{model.TimeFromUnix(0), chunksStore{chunks: []Chunk{before, spanning}}},
+			{model.TimeFromUnix(100), chunksStore{chunks: []Chunk{spanning, after}}},
+		},
+	}
+
+	// Chunks spanning the start of a period are only returned once.
+	chunks, err := cs.Get(context.Background(), model.TimeFromUnix(0), model.TimeFromUnix(200))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Chunk{before, spanning, after}
+	if !reflect.DeepEqual(want, chunks) {
+		t.Fatalf("wrong chunks - %s", test.Diff(want, chunks))
+	}
+}
@@ -6,7 +6,7 @@ import (
 	"strconv"
 )
 
-// Encoding defines which encoding we are using, delta, doubledelta, or varbit
+// Encoding defines which encoding we are using, delta, doubledelta, varbit, bigchunk or prometheus xor
 type Encoding byte
 
 // Config configures the behaviour of chunk encoding
@@ -40,6 +40,8 @@ const (
 	Varbit
 	// Bigchunk encoding
 	Bigchunk
+	// PrometheusXorChunk is a chunk encoding compatible with Prometheus 2.x TSDB.
+	PrometheusXorChunk
 )
 
 type encoding struct {
@@ -72,6 +74,12 @@ var encodings = map[Encoding]encoding{
 			return newBigchunk()
 		},
 	},
+	PrometheusXorChunk: {
+		Name: "PrometheusXorChunk",
+		New: func() Chunk {
+			return newPrometheusXorChunk()
+		},
+	},
 }
 
 // Set implements flag.Value.
@@ -0,0 +1,166 @@
+package encoding
+
+import (
+	"bytes"
+	"io"
+	"math"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/tsdb/chunkenc"
+)
+
+// prometheusXorChunk is a single Prometheus TSDB XOR chunk; its marshalled
+// form is byte-for-byte identical to the chunks TSDB writes.  Like bigchunk,
+// it grows over time; we only start a new chunk once the sample count no
+// longer fits in the chunk's 16 bit header.
+type prometheusXorChunk struct {
+	chunk    *chunkenc.XORChunk
+	appender chunkenc.Appender
+}
+
+func newPrometheusXorChunk() *prometheusXorChunk {
+	chunk := chunkenc.NewXORChunk()
+	appender, err := chunk.Appender()
+	if err != nil {
+		// Can't happen for an empty chunk.
+		panic(err)
+	}
+	return &prometheusXorChunk{
+		chunk:    chunk,
+		appender: appender,
+	}
+}
+
+func (p *prometheusXorChunk) Add(sample model.SamplePair) ([]Chunk, error) {
+	if p.chunk.NumSamples() >= math.MaxUint16 {
+		return addToOverflowChunk(p, sample)
+	}
+
+	// Chunks which have been unmarshalled don't have an appender yet.  TSDB
+	// can't append to a chunk read back from bytes, as it doesn't know how
+	// many bits of the last byte are used, so re-encode the samples into a
+	// fresh chunk.  This also stops us writing into the buffer the chunk was
+	// unmarshalled from.
+	if p.appender == nil {
+		chunk := chunkenc.NewXORChunk()
+		appender, err := chunk.Appender()
+		if err != nil {
+			return nil, err
+		}
+		it := p.chunk.Iterator()
+		for it.Next() {
+			appender.Append(it.At())
+		}
+		if err := it.Err(); err != nil {
+			return nil, err
+		}
+		p.chunk, p.appender = chunk, appender
+	}
+
+	p.appender.Append(int64(sample.Timestamp), float64(sample.Value))
+	return []Chunk{p}, nil
+}
+
+func (p *prometheusXorChunk) Marshal(w io.Writer) error {
+	_, err := w.Write(p.chunk.Bytes())
+	return err
+}
+
+func (p *prometheusXorChunk) MarshalToBuf(buf []byte) error {
+	writer := bytes.NewBuffer(buf)
+	return p.Marshal(writer)
+}
+
+func (p *prometheusXorChunk) UnmarshalFromBuf(buf []byte) error {
+	chunk, err := chunkenc.FromData(chunkenc.EncXOR, buf)
+	if err != nil {
+		return err
+	}
+	p.chunk = chunk.(*chunkenc.XORChunk)
+	p.appender = nil
+	return nil
+}
+
+func (p *prometheusXorChunk) Encoding() Encoding {
+	return PrometheusXorChunk
+}
+
+func (p *prometheusXorChunk) Utilization() float64 {
+	return 1.0
+}
+
+func (p *prometheusXorChunk) Len() int {
+	return p.chunk.NumSamples()
+}
+
+func (p *prometheusXorChunk) Size() int {
+	return len(p.chunk.Bytes())
+}
+
+func (p *prometheusXorChunk) NewIterator() Iterator {
+	return &prometheusXorChunkIterator{
+		chunk: p.chunk,
+		curr:  p.chunk.Iterator(),
+	}
+}
+
+func (p *prometheusXorChunk) Slice(_, _ model.Time) Chunk {
+	return p
+}
+
+type prometheusXorChunkIterator struct {
+	chunk *chunkenc.XORChunk
+	curr  chunkenc.Iterator
+
+	// Whether curr is positioned on a sample.
+	started bool
+}
+
+func (it *prometheusXorChunkIterator) FindAtOrAfter(target model.Time) bool {
+	// XOR chunks can only be iterated forwards, so restart from the beginning
+	// when seeking backwards or once we've reached the end.
+	if t, _ := it.curr.At(); !it.started || int64(target) <= t {
+		it.curr = it.chunk.Iterator()
+	}
+
+	for it.Scan() {
+		if t, _ := it.curr.At(); t >= int64(target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (it *prometheusXorChunkIterator) Scan() bool {
+	it.started = it.curr.Next()
+	return it.started
+}
+
+func (it *prometheusXorChunkIterator) Value() model.SamplePair {
+	t, v := it.curr.At()
+	return model.SamplePair{
+		Timestamp: model.Time(t),
+		Value:     model.SampleValue(v),
+	}
+}
+
+func (it *prometheusXorChunkIterator) Batch(size int) Batch {
+	var result Batch
+	j := 0
+	for j < size {
+		t, v := it.curr.At()
+		result.Timestamps[j] = t
+		result.Values[j] = v
+		j++
+
+		if j < size && !it.Scan() {
+			break
+		}
+	}
+	result.Length = j
+	return result
+}
+
+func (it *prometheusXorChunkIterator) Err() error {
+	return it.curr.Err()
+}
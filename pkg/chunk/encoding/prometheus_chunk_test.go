@@ -0,0 +1,67 @@
+package encoding
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/tsdb/chunkenc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrometheusXorChunkMatchesTSDB(t *testing.T) {
+	var c Chunk = newPrometheusXorChunk()
+	expected := chunkenc.NewXORChunk()
+	app, err := expected.Appender()
+	require.NoError(t, err)
+
+	for i := 0; i < 120; i++ {
+		cs, err := c.Add(model.SamplePair{
+			Timestamp: model.Time(i * step),
+			Value:     model.SampleValue(i),
+		})
+		require.NoError(t, err)
+		require.Len(t, cs, 1)
+		c = cs[0]
+		app.Append(int64(i*step), float64(i))
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, c.Marshal(&buf))
+	require.Equal(t, expected.Bytes(), buf.Bytes())
+}
+
+func TestPrometheusXorChunkAddAfterUnmarshal(t *testing.T) {
+	c := mkChunk(t, PrometheusXorChunk, 100)
+
+	var buf bytes.Buffer
+	require.NoError(t, c.Marshal(&buf))
+	bs := buf.Bytes()
+	original := append([]byte(nil), bs...)
+
+	c, err := NewForEncoding(PrometheusXorChunk)
+	require.NoError(t, err)
+	require.NoError(t, c.UnmarshalFromBuf(bs))
+
+	for i := 100; i < 200; i++ {
+		cs, err := c.Add(model.SamplePair{
+			Timestamp: model.Time(i * step),
+			Value:     model.SampleValue(i),
+		})
+		require.NoError(t, err)
+		require.Len(t, cs, 1)
+		c = cs[0]
+	}
+
+	// Appending must not have modified the buffer we unmarshalled from.
+	require.Equal(t, original, bs)
+
+	iter := c.NewIterator()
+	for i := 0; i < 200; i++ {
+		require.True(t, iter.Scan())
+		require.EqualValues(t, model.Time(i*step), iter.Value().Timestamp)
+		require.EqualValues(t, model.SampleValue(i), iter.Value().Value)
+	}
+	require.False(t, iter.Scan())
+	require.NoError(t, iter.Err())
+}
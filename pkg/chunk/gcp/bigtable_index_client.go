@@ -36,6 +36,8 @@ type Config struct {
 
 	GRPCClientConfig grpcclient.Config `yaml:"grpc_client_config"`
 
+	CellTimestamps bool `yaml:"cell_timestamps"`
+
 	ColumnKey      bool
 	DistributeKeys bool
 }
@@ -45,9 +47,28 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.StringVar(&cfg.Project, "bigtable.project", "", "Bigtable project ID.")
 	f.StringVar(&cfg.Instance, "bigtable.instance", "", "Bigtable instance ID.")
 
+	f.BoolVar(&cfg.CellTimestamps, "bigtable.cell-timestamps", false, "Write cells with the time they were written, rather than 0, and only read their latest version. Required to garbage collect them with -table-manager.retention-gc-enabled.")
+
 	cfg.GRPCClientConfig.RegisterFlags("bigtable", f)
 }
 
+// timestamp returns the timestamp to write cells with.
+func (cfg *Config) timestamp() bigtable.Timestamp {
+	if cfg.CellTimestamps {
+		return bigtable.Now().TruncateToMilliseconds()
+	}
+	return 0
+}
+
+// readOptions returns the options to read cells with.
+func (cfg *Config) readOptions() []bigtable.ReadOption {
+	if cfg.CellTimestamps {
+		// Rewriting a cell adds a version, rather than overwriting it.
+		return []bigtable.ReadOption{bigtable.RowFilter(bigtable.LatestNFilter(1))}
+	}
+	return nil
+}
+
 // storageClientColumnKey implements chunk.storageClient for GCP.
 type storageClientColumnKey struct {
 	cfg       Config
@@ -133,8 +154,9 @@ func (s *storageClientColumnKey) Stop() {
 
 func (s *storageClientColumnKey) NewWriteBatch() chunk.WriteBatch {
 	return bigtableWriteBatch{
-		tables: map[string]map[string]*bigtable.Mutation{},
-		keysFn: s.keysFn,
+		tables:    map[string]map[string]*bigtable.Mutation{},
+		keysFn:    s.keysFn,
+		timestamp: s.cfg.timestamp(),
 	}
 }
 
@@ -142,8 +164,9 @@ func (s *storageClientColumnKey) NewWriteBatch() chunk.WriteBatch {
 type keysFn func(hashValue string, rangeValue []byte) (rowKey, columnKey string)
 
 type bigtableWriteBatch struct {
-	tables map[string]map[string]*bigtable.Mutation
-	keysFn keysFn
+	tables    map[string]map[string]*bigtable.Mutation
+	keysFn    keysFn
+	timestamp bigtable.Timestamp
 }
 
 func (b bigtableWriteBatch) Add(tableName, hashValue string, rangeValue []byte, value []byte) {
@@ -160,7 +183,24 @@ func (b bigtableWriteBatch) Add(tableName, hashValue string, rangeValue []byte,
 		rows[rowKey] = mutation
 	}
 
-	mutation.Set(columnFamily, columnKey, 0, value)
+	mutation.Set(columnFamily, columnKey, b.timestamp, value)
+}
+
+func (b bigtableWriteBatch) Delete(tableName, hashValue string, rangeValue []byte) {
+	rows, ok := b.tables[tableName]
+	if !ok {
+		rows = map[string]*bigtable.Mutation{}
+		b.tables[tableName] = rows
+	}
+
+	rowKey, columnKey := b.keysFn(hashValue, rangeValue)
+	mutation, ok := rows[rowKey]
+	if !ok {
+		mutation = bigtable.NewMutation()
+		rows[rowKey] = mutation
+	}
+
+	mutation.DeleteCellsInColumn(columnFamily, columnKey)
 }
 
 func (s *storageClientColumnKey) BatchWrite(ctx context.Context, batch chunk.WriteBatch) error {
@@ -244,7 +284,7 @@ func (s *storageClientColumnKey) QueryPages(ctx context.Context, queries []chunk
 					return callback(query, &columnKeyBatch{
 						items: val,
 					})
-				})
+				}, s.cfg.readOptions()...)
 
 				if processingErr != nil {
 					errs <- processingErr
@@ -267,6 +307,40 @@ func (s *storageClientColumnKey) QueryPages(ctx context.Context, queries []chunk
 	return lastErr
 }
 
+// ScanTable implements chunk.IndexScanner.
+func (s *storageClientColumnKey) ScanTable(ctx context.Context, tableName string, callback func(hashValue string, rangeValue []byte) error) error {
+	return s.scanTable(ctx, tableName, func(row bigtable.Row) error {
+		hashValue := row.Key()
+		if s.cfg.DistributeKeys {
+			// Strip the hash prefix added by keysFn.
+			if i := strings.Index(hashValue, "-"); i >= 0 {
+				hashValue = hashValue[i+1:]
+			}
+		}
+		for _, item := range row[columnFamily] {
+			if err := callback(hashValue, []byte(strings.TrimPrefix(item.Column, columnPrefix))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *storageClientColumnKey) scanTable(ctx context.Context, tableName string, callback func(bigtable.Row) error) error {
+	sp, ctx := ot.StartSpanFromContext(ctx, "ScanTable", ot.Tag{Key: "tableName", Value: tableName})
+	defer sp.Finish()
+
+	var processingErr error
+	err := s.client.Open(tableName).ReadRows(ctx, bigtable.InfiniteRange(""), func(row bigtable.Row) bool {
+		processingErr = callback(row)
+		return processingErr == nil
+	}, s.cfg.readOptions()...)
+	if processingErr != nil {
+		return processingErr
+	}
+	return errors.WithStack(err)
+}
+
 // columnKeyBatch represents a batch of values read from Bigtable.
 type columnKeyBatch struct {
 	items []bigtable.ReadItem
@@ -336,7 +410,7 @@ func (s *storageClientV1) query(ctx context.Context, query chunk.IndexQuery, cal
 		}
 
 		return true
-	})
+	}, s.cfg.readOptions()...)
 	if err != nil {
 		sp.LogFields(otlog.String("error", err.Error()))
 		return errors.WithStack(err)
@@ -344,6 +418,17 @@ func (s *storageClientV1) query(ctx context.Context, query chunk.IndexQuery, cal
 	return nil
 }
 
+// ScanTable implements chunk.IndexScanner.
+func (s *storageClientV1) ScanTable(ctx context.Context, tableName string, callback func(hashValue string, rangeValue []byte) error) error {
+	return s.scanTable(ctx, tableName, func(row bigtable.Row) error {
+		parts := strings.SplitN(row.Key(), separator, 2)
+		if len(parts) != 2 {
+			return nil
+		}
+		return callback(parts[0], []byte(parts[1]))
+	})
+}
+
 // rowBatch represents a batch of rows read from Bigtable.  As the
 // bigtable interface gives us rows one-by-one, a batch always only contains
 // a single row.
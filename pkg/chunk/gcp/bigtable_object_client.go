@@ -45,6 +45,7 @@ func (s *bigtableObjectClient) Stop() {
 func (s *bigtableObjectClient) PutChunks(ctx context.Context, chunks []chunk.Chunk) error {
 	keys := map[string][]string{}
 	muts := map[string][]*bigtable.Mutation{}
+	timestamp := s.cfg.timestamp()
 
 	for i := range chunks {
 		buf, err := chunks[i].Encoded()
@@ -59,7 +60,7 @@ func (s *bigtableObjectClient) PutChunks(ctx context.Context, chunks []chunk.Chu
 		keys[tableName] = append(keys[tableName], key)
 
 		mut := bigtable.NewMutation()
-		mut.Set(columnFamily, column, 0, buf)
+		mut.Set(columnFamily, column, timestamp, buf)
 		muts[tableName] = append(muts[tableName], mut)
 	}
 
@@ -160,3 +161,18 @@ func (s *bigtableObjectClient) GetChunks(ctx context.Context, input []chunk.Chun
 
 	return output, nil
 }
+
+func (s *bigtableObjectClient) DeleteChunk(ctx context.Context, chunkID string) error {
+	c, err := chunk.ParseObjectKey(chunkID)
+	if err != nil {
+		return err
+	}
+	tableName, err := s.schemaCfg.ChunkTableFor(c.From)
+	if err != nil {
+		return err
+	}
+
+	mut := bigtable.NewMutation()
+	mut.DeleteRow()
+	return s.client.Open(tableName).Apply(ctx, chunkID, mut)
+}
@@ -8,6 +8,8 @@ import (
 	"cloud.google.com/go/bigtable/bttest"
 	"github.com/fsouza/fake-gcs-server/fakestorage"
 	"google.golang.org/api/option"
+	btapb "google.golang.org/genproto/googleapis/bigtable/admin/v2"
+	btpb "google.golang.org/genproto/googleapis/bigtable/v2"
 	"google.golang.org/grpc"
 
 	"github.com/cortexproject/cortex/pkg/chunk"
@@ -58,7 +60,10 @@ func (f *fixture) Clients() (
 
 	schemaConfig = testutils.DefaultSchemaConfig("gcp-columnkey")
 	tClient = &tableClient{
+		cfg:    Config{Project: proj, Instance: instance},
 		client: adminClient,
+		admin:  btapb.NewBigtableTableAdminClient(conn),
+		data:   btpb.NewBigtableClient(conn),
 	}
 
 	client, err := bigtable.NewClient(ctx, proj, instance, option.WithGRPCConn(conn))
@@ -7,6 +7,7 @@ import (
 
 	"cloud.google.com/go/storage"
 	"github.com/pkg/errors"
+	"google.golang.org/api/iterator"
 
 	"github.com/cortexproject/cortex/pkg/chunk"
 	"github.com/cortexproject/cortex/pkg/chunk/util"
@@ -103,3 +104,38 @@ func (s *gcsObjectClient) getChunk(ctx context.Context, decodeContext *chunk.Dec
 
 	return input, nil
 }
+
+func (s *gcsObjectClient) DeleteChunk(ctx context.Context, chunkID string) error {
+	err := s.bucket.Object(chunkID).Delete(ctx)
+	if err != nil && err != storage.ErrObjectNotExist {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func (s *gcsObjectClient) ListChunks(ctx context.Context, callback func(chunkIDs []string) error) error {
+	const batchSize = 1000
+
+	it := s.bucket.Objects(ctx, nil)
+	chunkIDs := make([]string, 0, batchSize)
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			return errors.WithStack(err)
+		}
+
+		chunkIDs = append(chunkIDs, attrs.Name)
+		if len(chunkIDs) == batchSize {
+			if err := callback(chunkIDs); err != nil {
+				return err
+			}
+			chunkIDs = make([]string, 0, batchSize)
+		}
+	}
+	if len(chunkIDs) == 0 {
+		return nil
+	}
+	return callback(chunkIDs)
+}
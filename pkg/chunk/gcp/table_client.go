@@ -2,34 +2,80 @@ package gcp
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
 
+	"github.com/go-kit/kit/log/level"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 
 	"cloud.google.com/go/bigtable"
+	"google.golang.org/api/option"
+	gtransport "google.golang.org/api/transport/grpc"
+	btapb "google.golang.org/genproto/googleapis/bigtable/admin/v2"
+	btpb "google.golang.org/genproto/googleapis/bigtable/v2"
 	"google.golang.org/grpc/status"
 
 	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/pkg/errors"
 )
 
+const (
+	adminAddr = "bigtableadmin.googleapis.com:443"
+	dataAddr  = "bigtable.googleapis.com:443"
+)
+
 type tableClient struct {
 	cfg    Config
 	client *bigtable.AdminClient
+
+	// The bigtable package doesn't expose tables' replication state or size,
+	// so these are fetched with the underlying APIs.
+	admin btapb.BigtableTableAdminClient
+	data  btpb.BigtableClient
 }
 
 // NewTableClient returns a new TableClient.
 func NewTableClient(ctx context.Context, cfg Config) (chunk.TableClient, error) {
-	opts := toOptions(cfg.GRPCClientConfig.DialOption(bigtableInstrumentation()))
-	client, err := bigtable.NewAdminClient(ctx, cfg.Project, cfg.Instance, opts...)
+	adminConn, err := dial(ctx, cfg, adminAddr, bigtable.AdminScope)
+	if err != nil {
+		return nil, err
+	}
+	client, err := bigtable.NewAdminClient(ctx, cfg.Project, cfg.Instance, option.WithGRPCConn(adminConn))
+	if err != nil {
+		return nil, err
+	}
+	dataConn, err := dial(ctx, cfg, dataAddr, bigtable.ReadonlyScope)
 	if err != nil {
 		return nil, err
 	}
 	return &tableClient{
 		cfg:    cfg,
 		client: client,
+		admin:  btapb.NewBigtableTableAdminClient(adminConn),
+		data:   btpb.NewBigtableClient(dataConn),
 	}, nil
 }
 
+// dial connects to a Bigtable API, or to the emulator as the bigtable package
+// does if BIGTABLE_EMULATOR_HOST is set.
+func dial(ctx context.Context, cfg Config, addr, scope string) (*grpc.ClientConn, error) {
+	opts := cfg.GRPCClientConfig.DialOption(bigtableInstrumentation())
+	if emulator := os.Getenv("BIGTABLE_EMULATOR_HOST"); emulator != "" {
+		return grpc.DialContext(ctx, emulator, append(opts, grpc.WithInsecure())...)
+	}
+	return gtransport.Dial(ctx, append(toOptions(opts), option.WithEndpoint(addr), option.WithScopes(scope))...)
+}
+
+func (c *tableClient) fullTableName(name string) string {
+	return fmt.Sprintf("projects/%s/instances/%s/tables/%s", c.cfg.Project, c.cfg.Instance, name)
+}
+
 func (c *tableClient) ListTables(ctx context.Context) ([]string, error) {
 	tables, err := c.client.Tables(ctx)
 	if err != nil {
@@ -62,6 +108,11 @@ func hasColumnFamily(infos []bigtable.FamilyInfo) bool {
 }
 
 func (c *tableClient) CreateTable(ctx context.Context, desc chunk.TableDesc) error {
+	policy, err := c.gcPolicy(desc)
+	if err != nil {
+		return err
+	}
+
 	if err := c.client.CreateTable(ctx, desc.Name); err != nil {
 		if !alreadyExistsError(err) {
 			return errors.Wrap(err, "client.CreateTable")
@@ -74,9 +125,34 @@ func (c *tableClient) CreateTable(ctx context.Context, desc chunk.TableDesc) err
 		}
 	}
 
+	if policy != nil {
+		if err := c.client.SetGCPolicy(ctx, desc.Name, columnFamily, policy); err != nil {
+			return errors.Wrap(err, "client.SetGCPolicy")
+		}
+	}
+
 	return nil
 }
 
+// gcPolicy returns the garbage collection policy for the table's column
+// family, or nil for none.
+func (c *tableClient) gcPolicy(desc chunk.TableDesc) (bigtable.GCPolicy, error) {
+	if !c.cfg.CellTimestamps {
+		if desc.MaxAge > 0 {
+			// Cells are written at time 0, so would all be collected immediately.
+			return nil, fmt.Errorf("table %s has a max age, which requires -bigtable.cell-timestamps", desc.Name)
+		}
+		return nil, nil
+	}
+
+	// With cell timestamps, rewriting a cell adds a version; only keep the
+	// latest.
+	if desc.MaxAge > 0 {
+		return bigtable.UnionPolicy(bigtable.MaxVersionsPolicy(1), bigtable.MaxAgePolicy(desc.MaxAge)), nil
+	}
+	return bigtable.MaxVersionsPolicy(1), nil
+}
+
 func alreadyExistsError(err error) bool {
 	serr, ok := status.FromError(err)
 	return ok && serr.Code() == codes.AlreadyExists
@@ -91,11 +167,114 @@ func (c *tableClient) DeleteTable(ctx context.Context, name string) error {
 }
 
 func (c *tableClient) DescribeTable(ctx context.Context, name string) (desc chunk.TableDesc, isActive bool, err error) {
-	return chunk.TableDesc{
-		Name: name,
-	}, true, nil
+	desc.Name = name
+
+	info, err := c.client.TableInfo(ctx, name)
+	if err != nil {
+		return desc, false, errors.Wrap(err, "client.TableInfo")
+	}
+
+	// Until its column family is created, the table can't be used.
+	for _, family := range info.FamilyInfos {
+		if family.Name == columnFamily {
+			desc.MaxAge = parseMaxAge(family.GCPolicy)
+			isActive = true
+		}
+	}
+	if !isActive {
+		return desc, false, nil
+	}
+
+	// Nor until it is ready in every cluster it is replicated to.
+	table, err := c.admin.GetTable(ctx, &btapb.GetTableRequest{
+		Name: c.fullTableName(name),
+		View: btapb.Table_REPLICATION_VIEW,
+	})
+	if err != nil {
+		return desc, false, errors.Wrap(err, "admin.GetTable")
+	}
+	for cluster, state := range table.ClusterStates {
+		if state.ReplicationState != btapb.Table_ClusterState_READY {
+			level.Debug(util.Logger).Log("msg", "table not ready", "table", name, "cluster", cluster, "state", state.ReplicationState)
+			isActive = false
+		}
+	}
+
+	desc.SizeBytes, err = c.tableSize(ctx, name)
+	return desc, isActive, err
+}
+
+// tableSize returns the approximate size of a table: the offset of the last
+// of its sampled row keys.
+func (c *tableClient) tableSize(ctx context.Context, name string) (int64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.data.SampleRowKeys(ctx, &btpb.SampleRowKeysRequest{
+		TableName: c.fullTableName(name),
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "data.SampleRowKeys")
+	}
+	var size int64
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return size, nil
+		} else if err != nil {
+			return 0, errors.Wrap(err, "data.SampleRowKeys")
+		}
+		size = resp.OffsetBytes
+	}
+}
+
+var maxAgeRegexp = regexp.MustCompile(`age\(\) > ([0-9]+)([dhm]?)`)
+
+// parseMaxAge returns the max age in a GC policy, as formatted by
+// bigtable.GCRuleToString, or 0 if it has none.
+func parseMaxAge(policy string) time.Duration {
+	match := maxAgeRegexp.FindStringSubmatch(policy)
+	if match == nil {
+		return 0
+	}
+	n, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return 0
+	}
+	switch match[2] {
+	case "d":
+		return time.Duration(n) * 24 * time.Hour
+	case "h":
+		return time.Duration(n) * time.Hour
+	case "m":
+		return time.Duration(n) * time.Minute
+	default:
+		return time.Duration(n) * time.Microsecond
+	}
+}
+
+// SupportsMaxAge implements chunk.MaxAgeTableClient: cells are only
+// collected by age when written with timestamps.
+func (c *tableClient) SupportsMaxAge() bool {
+	return c.cfg.CellTimestamps
 }
 
 func (c *tableClient) UpdateTable(ctx context.Context, current, expected chunk.TableDesc) error {
+	if current.MaxAge == expected.MaxAge {
+		return nil
+	}
+
+	policy, err := c.gcPolicy(expected)
+	if err != nil {
+		return err
+	}
+	if policy == nil {
+		policy = bigtable.NoGcPolicy()
+	}
+
+	level.Info(util.Logger).Log("msg", "updating table max age", "table", expected.Name, "old", current.MaxAge, "new", expected.MaxAge)
+	if err := c.client.SetGCPolicy(ctx, expected.Name, columnFamily, policy); err != nil {
+		return errors.Wrap(err, "client.SetGCPolicy")
+	}
 	return nil
 }
@@ -0,0 +1,128 @@
+package gcp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"cloud.google.com/go/bigtable/bttest"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+	btapb "google.golang.org/genproto/googleapis/bigtable/admin/v2"
+	btpb "google.golang.org/genproto/googleapis/bigtable/v2"
+	"google.golang.org/grpc"
+
+	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/chunk/testutils"
+)
+
+func newTestClients(t *testing.T, cfg Config) (*tableClient, chunk.IndexClient, func()) {
+	srv, err := bttest.NewServer("localhost:0")
+	require.NoError(t, err)
+
+	conn, err := grpc.Dial(srv.Addr, grpc.WithInsecure())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	adminClient, err := bigtable.NewAdminClient(ctx, proj, instance, option.WithGRPCConn(conn))
+	require.NoError(t, err)
+	client, err := bigtable.NewClient(ctx, proj, instance, option.WithGRPCConn(conn))
+	require.NoError(t, err)
+
+	cfg.Project, cfg.Instance = proj, instance
+	tClient := &tableClient{
+		cfg:    cfg,
+		client: adminClient,
+		admin:  btapb.NewBigtableTableAdminClient(conn),
+		data:   btpb.NewBigtableClient(conn),
+	}
+	iClient := newStorageClientColumnKey(cfg, testutils.DefaultSchemaConfig("gcp-columnkey"), client)
+	return tClient, iClient, func() {
+		iClient.Stop()
+		adminClient.Close()
+		srv.Close()
+	}
+}
+
+func TestTableClientMaxAge(t *testing.T) {
+	ctx := context.Background()
+
+	tClient, _, cleanup := newTestClients(t, Config{})
+	defer cleanup()
+
+	// Without cell timestamps, a max age would collect everything.
+	require.Error(t, tClient.CreateTable(ctx, chunk.TableDesc{Name: "table", MaxAge: time.Hour}))
+
+	tClient, _, cleanup = newTestClients(t, Config{CellTimestamps: true})
+	defer cleanup()
+
+	require.NoError(t, tClient.CreateTable(ctx, chunk.TableDesc{Name: "table", MaxAge: 7 * 24 * time.Hour}))
+	desc, isActive, err := tClient.DescribeTable(ctx, "table")
+	require.NoError(t, err)
+	require.True(t, isActive)
+	require.Equal(t, 7*24*time.Hour, desc.MaxAge)
+
+	expected := chunk.TableDesc{Name: "table", MaxAge: 90 * time.Minute}
+	require.NoError(t, tClient.UpdateTable(ctx, desc, expected))
+	desc, _, err = tClient.DescribeTable(ctx, "table")
+	require.NoError(t, err)
+	require.Equal(t, expected, desc)
+
+	expected.MaxAge = 0
+	require.NoError(t, tClient.UpdateTable(ctx, desc, expected))
+	desc, _, err = tClient.DescribeTable(ctx, "table")
+	require.NoError(t, err)
+	require.Equal(t, expected, desc)
+
+	_, _, err = tClient.DescribeTable(ctx, "missing")
+	require.Error(t, err)
+}
+
+func TestCellTimestampsReadLatest(t *testing.T) {
+	ctx := context.Background()
+
+	tClient, iClient, cleanup := newTestClients(t, Config{CellTimestamps: true})
+	defer cleanup()
+	require.NoError(t, tClient.CreateTable(ctx, chunk.TableDesc{Name: "table"}))
+
+	// Rewrites add versions of the cell, of which only the latest is read.
+	for _, value := range []string{"a", "b"} {
+		batch := iClient.NewWriteBatch()
+		batch.Add("table", "hash", []byte("range"), []byte(value))
+		require.NoError(t, iClient.BatchWrite(ctx, batch))
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	var values []string
+	require.NoError(t, iClient.QueryPages(ctx, []chunk.IndexQuery{{TableName: "table", HashValue: "hash"}}, func(_ chunk.IndexQuery, batch chunk.ReadBatch) bool {
+		for iter := batch.Iterator(); iter.Next(); {
+			values = append(values, string(iter.Value()))
+		}
+		return true
+	}))
+	require.Equal(t, []string{"b"}, values)
+}
+
+func TestTableClientSize(t *testing.T) {
+	ctx := context.Background()
+
+	tClient, iClient, cleanup := newTestClients(t, Config{})
+	defer cleanup()
+	require.NoError(t, tClient.CreateTable(ctx, chunk.TableDesc{Name: "table"}))
+
+	desc, _, err := tClient.DescribeTable(ctx, "table")
+	require.NoError(t, err)
+	require.Zero(t, desc.SizeBytes)
+
+	batch := iClient.NewWriteBatch()
+	for _, hash := range []string{"a", "b", "c"} {
+		batch.Add("table", hash, []byte("range"), []byte("value"))
+	}
+	require.NoError(t, iClient.BatchWrite(ctx, batch))
+
+	desc, isActive, err := tClient.DescribeTable(ctx, "table")
+	require.NoError(t, err)
+	require.True(t, isActive)
+	require.NotZero(t, desc.SizeBytes)
+}
@@ -0,0 +1,375 @@
+package chunk
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"github.com/weaveworks/common/user"
+	"golang.org/x/time/rate"
+)
+
+// fetchBatchSize is the number of chunks an IndexWalker aims to fetch at once;
+// batches always hold whole series, so may be bigger.
+const fetchBatchSize = 1000
+
+// IndexWalker walks the index tables of each period of a schema, for tools
+// which process every chunk of a range of days, such as chunk migrations and
+// rollups.
+type IndexWalker struct {
+	schemaCfg     SchemaConfig
+	indexClients  map[string]IndexClient
+	objectClients map[string]ObjectClient
+	limiter       *rate.Limiter
+}
+
+// NewIndexWalker makes a new IndexWalker.  The index clients (keyed by their
+// index type) of every period must implement IndexScanner.  At most rateLimit
+// chunks are fetched per second from the object clients (keyed by their
+// object store type), or any number if it is 0.
+func NewIndexWalker(schemaCfg SchemaConfig, indexClients map[string]IndexClient, objectClients map[string]ObjectClient, rateLimit float64) (*IndexWalker, error) {
+	for _, periodCfg := range schemaCfg.Configs {
+		if _, ok := indexClients[periodCfg.IndexType].(IndexScanner); !ok {
+			return nil, fmt.Errorf("index type %s does not support scanning tables", periodCfg.IndexType)
+		}
+		if _, ok := objectClients[periodCfg.objectType()]; !ok {
+			return nil, fmt.Errorf("no object client for %s", periodCfg.objectType())
+		}
+	}
+
+	limiter := rate.NewLimiter(rate.Inf, 1)
+	if rateLimit > 0 {
+		limiter = rate.NewLimiter(rate.Limit(rateLimit), 1)
+	}
+
+	return &IndexWalker{
+		schemaCfg:     schemaCfg,
+		indexClients:  indexClients,
+		objectClients: objectClients,
+		limiter:       limiter,
+	}, nil
+}
+
+// Walk calls callback with the chunks of each index row in the buckets from
+// from to through, as the tables are scanned, rather than once a table has
+// been read: the rows of a series in a bucket, or of a metric name for schemas
+// before v9.  A row holds the chunks overlapping its bucket, so chunks
+// spanning several buckets are walked with each; callers wanting each chunk
+// once take those starting in the bucket.  The callback gets the time range of
+// the row's bucket, a day for every schema but v1, whose buckets are hours.
+// If users are given, only their rows are walked.  Chunks are parsed from their
+// keys, so have no metric or data: use FetchSeries to fetch them.
+//
+// Rows of days progress has recorded as done are skipped.  A day's rows can be
+// scanned in any order, so the days of a table are only recorded once it has
+// been scanned.  Progress can be nil.
+func (w *IndexWalker) Walk(ctx context.Context, from, through model.Time, users []string, progress *Progress, callback func(ctx context.Context, userID string, from, through model.Time, chunks []Chunk) error) error {
+	wanted := map[string]struct{}{}
+	for _, userID := range users {
+		wanted[userID] = struct{}{}
+	}
+
+	for i, periodCfg := range w.schemaCfg.Configs {
+		start, end := from, through
+		if periodCfg.From > start {
+			start = periodCfg.From
+		}
+		if i+1 < len(w.schemaCfg.Configs) && w.schemaCfg.Configs[i+1].From <= end {
+			end = w.schemaCfg.Configs[i+1].From - 1
+		}
+		if start > end {
+			continue
+		}
+
+		scanner := w.indexClients[periodCfg.IndexType].(IndexScanner)
+		for _, tableName := range periodCfg.IndexTables.tableNames(start, end+1) {
+			var (
+				walked = map[string]map[model.Time]struct{}{}
+
+				// The row being scanned, if it is walked.
+				row                 string
+				walking             bool
+				rowUser             string
+				rowFrom, rowThrough model.Time
+				rowChunks           []Chunk
+				rowChunkIDs         map[string]struct{}
+			)
+			flush := func() error {
+				if len(rowChunks) == 0 {
+					return nil
+				}
+				err := callback(user.InjectOrgID(ctx, rowUser), rowUser, rowFrom, rowThrough, rowChunks)
+				rowChunks = nil
+				return err
+			}
+
+			err := scanner.ScanTable(ctx, tableName, func(hashValue string, rangeValue []byte) error {
+				if hashValue != row {
+					if err := flush(); err != nil {
+						return err
+					}
+					row, walking = hashValue, false
+
+					userID, bucketStart, bucketEnd, ok := parseIndexHashValue(hashValue)
+					if !ok || bucketEnd <= start || bucketStart > end {
+						return nil
+					}
+					if _, ok := wanted[userID]; len(wanted) > 0 && !ok {
+						return nil
+					}
+					day := model.TimeFromUnix(bucketStart.Unix() / secondsInDay * secondsInDay)
+					if progress != nil && progress.Done(userID, day) {
+						return nil
+					}
+					if walked[userID] == nil {
+						walked[userID] = map[model.Time]struct{}{}
+					}
+					walked[userID][day] = struct{}{}
+					walking, rowUser, rowFrom, rowThrough = true, userID, bucketStart, bucketEnd-1
+					rowChunkIDs = map[string]struct{}{}
+				}
+				if !walking {
+					return nil
+				}
+
+				chunkID, ok := rowChunkID(rangeValue)
+				if !ok {
+					return nil
+				}
+				// Schemas before v4 index chunks under each of their labels, in
+				// their metric name's row.
+				if _, ok := rowChunkIDs[chunkID]; ok {
+					return nil
+				}
+				rowChunkIDs[chunkID] = struct{}{}
+
+				c, err := ParseExternalKey(rowUser, chunkID)
+				if err != nil {
+					return nil
+				}
+				rowChunks = append(rowChunks, c)
+				return nil
+			})
+			if err == nil {
+				err = flush()
+			}
+			if err != nil {
+				return err
+			}
+
+			if progress == nil {
+				continue
+			}
+			for _, userID := range sortedKeys(walked) {
+				for _, day := range sortedDays(walked[userID]) {
+					if err := progress.Record(userID, day); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// rowChunkID returns the chunk ID of an index entry, if it is one of those
+// indexing each chunk once per bucket: those of a series' row from v9 on, and
+// of a metric name's row before, the only ones with chunk IDs in schemas
+// before v4.
+func rowChunkID(rangeValue []byte) (string, bool) {
+	components := decodeRangeKey(rangeValue)
+	switch {
+	case len(components) < 3:
+		return "", false
+
+	// v1 and v2 label entries, in the metric name's row.
+	case len(components) == 3:
+		return string(components[2]), true
+
+	// v3 label entries are in the metric name's row too, but v4's, which have
+	// no label name, are in rows of their own.
+	case bytes.Equal(components[3], chunkTimeRangeKeyV1):
+		return string(components[2]), len(components[0]) > 0
+
+	// v4 metric name entries, and v5 on metric name or series entries.
+	case bytes.Equal(components[3], chunkTimeRangeKeyV2), bytes.Equal(components[3], chunkTimeRangeKeyV3):
+		return string(components[2]), true
+
+	default:
+		return "", false
+	}
+}
+
+// FetchSeries fetches the given chunks, as passed to a Walk callback, and
+// calls callback with them in batches of whole series, each sorted by start
+// time.  It waits on the rate limit before fetching each batch.
+func (w *IndexWalker) FetchSeries(ctx context.Context, chunks []Chunk, callback func(series [][]Chunk) error) error {
+	bySeries := map[model.Fingerprint][]Chunk{}
+	var fingerprints []model.Fingerprint
+	for _, c := range chunks {
+		if _, ok := bySeries[c.Fingerprint]; !ok {
+			fingerprints = append(fingerprints, c.Fingerprint)
+		}
+		bySeries[c.Fingerprint] = append(bySeries[c.Fingerprint], c)
+	}
+	sort.Slice(fingerprints, func(i, j int) bool { return fingerprints[i] < fingerprints[j] })
+
+	var batch []Chunk
+	fetch := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		for range batch {
+			if err := w.limiter.Wait(ctx); err != nil {
+				return err
+			}
+		}
+
+		byClient := map[string][]Chunk{}
+		for _, c := range batch {
+			objectType := w.schemaCfg.periodFor(c.From).objectType()
+			byClient[objectType] = append(byClient[objectType], c)
+		}
+		fetched := map[model.Fingerprint][]Chunk{}
+		for objectType, cs := range byClient {
+			cs, err := w.objectClients[objectType].GetChunks(ctx, cs)
+			if err != nil {
+				return err
+			}
+			for _, c := range cs {
+				fetched[c.Fingerprint] = append(fetched[c.Fingerprint], c)
+			}
+		}
+
+		series := make([][]Chunk, 0, len(fetched))
+		for _, fp := range fingerprints {
+			cs, ok := fetched[fp]
+			if !ok {
+				continue
+			}
+			sort.Slice(cs, func(i, j int) bool { return cs[i].From < cs[j].From })
+			series = append(series, cs)
+		}
+		batch = batch[:0]
+		return callback(series)
+	}
+
+	for _, fp := range fingerprints {
+		batch = append(batch, bySeries[fp]...)
+		if len(batch) >= fetchBatchSize {
+			if err := fetch(); err != nil {
+				return err
+			}
+		}
+	}
+	return fetch()
+}
+
+// objectType returns the type of object store the period's chunks are in.
+func (cfg PeriodConfig) objectType() string {
+	if cfg.ObjectType != "" {
+		return cfg.ObjectType
+	}
+	return cfg.IndexType
+}
+
+// periodFor returns the config of the period t is in.
+func (cfg SchemaConfig) periodFor(t model.Time) PeriodConfig {
+	i := sort.Search(len(cfg.Configs), func(i int) bool {
+		return cfg.Configs[i].From > t
+	})
+	if i > 0 {
+		i--
+	}
+	return cfg.Configs[i]
+}
+
+func sortedKeys(m map[string]map[model.Time]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedDays(m map[model.Time]struct{}) []model.Time {
+	days := make([]model.Time, 0, len(m))
+	for day := range m {
+		days = append(days, day)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i] < days[j] })
+	return days
+}
+
+// Progress records the days of each user an IndexWalker-based job has
+// completed in a file, so an interrupted job can be resumed.
+type Progress struct {
+	filename string
+	done     map[string]struct{}
+}
+
+// LoadProgress loads the progress recorded in filename.  No progress is kept
+// between runs if it is empty.
+func LoadProgress(filename string) (*Progress, error) {
+	p := &Progress{
+		filename: filename,
+		done:     map[string]struct{}{},
+	}
+	if filename == "" {
+		return p, nil
+	}
+
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return p, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		p.done[scanner.Text()] = struct{}{}
+	}
+	return p, scanner.Err()
+}
+
+// Done returns whether the user's day has been completed.
+func (p *Progress) Done(userID string, day model.Time) bool {
+	_, ok := p.done[progressKey(userID, day)]
+	return ok
+}
+
+// Len returns the number of days completed.
+func (p *Progress) Len() int {
+	return len(p.done)
+}
+
+// Record the user's day as completed.
+func (p *Progress) Record(userID string, day model.Time) error {
+	key := progressKey(userID, day)
+	p.done[key] = struct{}{}
+	if p.filename == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(p.filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, key); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func progressKey(userID string, day model.Time) string {
+	return strings.Join([]string{userID, day.Time().UTC().Format("2006-01-02")}, "\t")
+}
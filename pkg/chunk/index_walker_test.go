@@ -0,0 +1,105 @@
+package chunk
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+func TestIndexWalkerWalk(t *testing.T) {
+	day := model.TimeFromUnix(18000 * secondsInDay)
+	metric := model.Metric{
+		model.MetricNameLabel: "foo",
+		"bar":                 "baz",
+		"toms":                "code",
+	}
+	other := model.Metric{
+		model.MetricNameLabel: "foo",
+		"bar":                 "qux",
+	}
+
+	for _, schema := range schemas {
+		t.Run(schema.name, func(t *testing.T) {
+			var (
+				storeCfg  StoreConfig
+				tbmConfig TableManagerConfig
+				schemaCfg = DefaultSchemaConfig("inmemory", schema.name, 0)
+			)
+			flagext.DefaultValues(&storeCfg, &tbmConfig)
+			storage := NewMockStorage()
+			tableManager, err := NewTableManager(tbmConfig, schemaCfg, maxChunkAge, storage)
+			require.NoError(t, err)
+			require.NoError(t, tableManager.SyncTables(context.Background()))
+
+			var limits validation.Limits
+			flagext.DefaultValues(&limits)
+			overrides, err := validation.NewOverrides(limits)
+			require.NoError(t, err)
+
+			store := NewCompositeStore()
+			require.NoError(t, store.AddPeriod(storeCfg, schemaCfg.Configs[0], storage, storage, overrides))
+			defer store.Stop()
+
+			spanning := dummyChunkFor(day.Add(24*time.Hour+30*time.Minute), metric)
+			chunks := []Chunk{
+				dummyChunkFor(day.Add(2*time.Hour), metric),
+				spanning,
+				dummyChunkFor(day.Add(29*time.Hour), other),
+			}
+			ctx := user.InjectOrgID(context.Background(), userID)
+			require.NoError(t, store.Put(ctx, chunks))
+
+			otherUser := NewChunk("other", metric.Fingerprint(), metric, chunks[0].Data, chunks[0].From, chunks[0].Through)
+			require.NoError(t, otherUser.Encode())
+			require.NoError(t, store.Put(user.InjectOrgID(context.Background(), "other"), []Chunk{otherUser}))
+
+			walker, err := NewIndexWalker(schemaCfg,
+				map[string]IndexClient{"inmemory": storage},
+				map[string]ObjectClient{"inmemory": storage}, 0)
+			require.NoError(t, err)
+			progress, err := LoadProgress("")
+			require.NoError(t, err)
+
+			starting := map[string]int{}
+			overlapping := map[string]int{}
+			err = walker.Walk(context.Background(), day, day.Add(48*time.Hour-1), []string{userID}, progress, func(ctx context.Context, userID string, from, through model.Time, walked []Chunk) error {
+				require.Equal(t, "userID", userID)
+				for _, c := range walked {
+					require.False(t, c.Through.Before(from) || c.From.After(through), "chunk outside its row's bucket")
+					overlapping[c.ExternalKey()]++
+					if !c.From.Before(from) {
+						starting[c.ExternalKey()]++
+					}
+				}
+				return nil
+			})
+			require.NoError(t, err)
+
+			// Every chunk is walked once with the bucket it starts in, and the
+			// chunk spanning midnight with the next day's too.
+			for _, c := range chunks {
+				require.Equal(t, 1, starting[c.ExternalKey()], c.ExternalKey())
+			}
+			require.Len(t, starting, len(chunks))
+			require.Equal(t, 2, overlapping[spanning.ExternalKey()])
+
+			require.True(t, progress.Done(userID, day))
+			require.True(t, progress.Done(userID, day.Add(24*time.Hour)))
+			require.False(t, progress.Done("other", day))
+
+			// Days already done aren't walked again.
+			err = walker.Walk(context.Background(), day, day.Add(48*time.Hour-1), nil, progress, func(ctx context.Context, userID string, from, through model.Time, walked []Chunk) error {
+				require.Equal(t, "other", userID)
+				return nil
+			})
+			require.NoError(t, err)
+		})
+	}
+}
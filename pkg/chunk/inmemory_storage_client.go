@@ -142,6 +142,22 @@ func (m *MockStorage) BatchWrite(ctx context.Context, batch WriteBatch) error {
 			return fmt.Errorf("table not found")
 		}
 
+		if req.delete {
+			items := table.items[req.hashValue]
+			i := sort.Search(len(items), func(i int) bool {
+				return bytes.Compare(items[i].rangeValue, req.rangeValue) >= 0
+			})
+			if i < len(items) && bytes.Equal(items[i].rangeValue, req.rangeValue) {
+				items = append(items[:i], items[i+1:]...)
+			}
+			if len(items) == 0 {
+				delete(table.items, req.hashValue)
+			} else {
+				table.items[req.hashValue] = items
+			}
+			continue
+		}
+
 		// Check for duplicate writes by RangeKey in same batch
 		key := fmt.Sprintf("%s:%s:%x", req.tableName, req.hashValue, req.rangeValue)
 		if _, ok := seenWrites[key]; ok {
@@ -179,6 +195,59 @@ func (m *MockStorage) BatchWrite(ctx context.Context, batch WriteBatch) error {
 	return nil
 }
 
+// PurgeEntries implements IndexPurger.
+func (m *MockStorage) PurgeEntries(ctx context.Context, tableName string, purge func(hashValue string, rangeValue []byte) bool) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	table, ok := m.tables[tableName]
+	if !ok {
+		return nil
+	}
+
+	for hashValue, items := range table.items {
+		kept := items[:0]
+		for _, item := range items {
+			if !purge(hashValue, item.rangeValue) {
+				kept = append(kept, item)
+			}
+		}
+		if len(kept) == 0 {
+			delete(table.items, hashValue)
+		} else {
+			table.items[hashValue] = kept
+		}
+	}
+	return nil
+}
+
+// ScanTable implements IndexScanner.
+func (m *MockStorage) ScanTable(ctx context.Context, tableName string, callback func(hashValue string, rangeValue []byte) error) error {
+	type entry struct {
+		hashValue  string
+		rangeValue []byte
+	}
+	var entries []entry
+
+	// Like the real stores, callers can write to the table while scanning it.
+	m.mtx.RLock()
+	if table, ok := m.tables[tableName]; ok {
+		for hashValue, items := range table.items {
+			for _, item := range items {
+				entries = append(entries, entry{hashValue, item.rangeValue})
+			}
+		}
+	}
+	m.mtx.RUnlock()
+
+	for _, e := range entries {
+		if err := callback(e.hashValue, e.rangeValue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // QueryPages implements StorageClient.
 func (m *MockStorage) QueryPages(ctx context.Context, queries []IndexQuery, callback func(IndexQuery, ReadBatch) (shouldContinue bool)) error {
 	m.mtx.RLock()
@@ -310,18 +379,43 @@ func (m *MockStorage) GetChunks(ctx context.Context, chunkSet []Chunk) ([]Chunk,
 	return result, nil
 }
 
-type mockWriteBatch []struct {
+// DeleteChunk implements StorageClient.
+func (m *MockStorage) DeleteChunk(_ context.Context, chunkID string) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	delete(m.objects, chunkID)
+	return nil
+}
+
+// ListChunks implements ChunkLister.
+func (m *MockStorage) ListChunks(_ context.Context, callback func(chunkIDs []string) error) error {
+	m.mtx.RLock()
+	chunkIDs := make([]string, 0, len(m.objects))
+	for key := range m.objects {
+		chunkIDs = append(chunkIDs, key)
+	}
+	m.mtx.RUnlock()
+
+	sort.Strings(chunkIDs)
+	return callback(chunkIDs)
+}
+
+type mockWriteBatch []mockWriteRequest
+
+type mockWriteRequest struct {
 	tableName, hashValue string
 	rangeValue           []byte
 	value                []byte
+	delete               bool
 }
 
 func (b *mockWriteBatch) Add(tableName, hashValue string, rangeValue []byte, value []byte) {
-	*b = append(*b, struct {
-		tableName, hashValue string
-		rangeValue           []byte
-		value                []byte
-	}{tableName, hashValue, rangeValue, value})
+	*b = append(*b, mockWriteRequest{tableName, hashValue, rangeValue, value, false})
+}
+
+func (b *mockWriteBatch) Delete(tableName, hashValue string, rangeValue []byte) {
+	*b = append(*b, mockWriteRequest{tableName, hashValue, rangeValue, nil, true})
 }
 
 type mockReadBatch struct {
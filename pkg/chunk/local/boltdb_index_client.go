@@ -20,6 +20,9 @@ var bucketName = []byte("index")
 const (
 	separator = "\000"
 	null      = string('\xff')
+
+	// scanBatchSize is the number of keys ScanTable reads per transaction.
+	scanBatchSize = 10000
 )
 
 // BoltDBConfig for a BoltDB index client.
@@ -61,7 +64,8 @@ func (b *boltIndexClient) Stop() {
 
 func (b *boltIndexClient) NewWriteBatch() chunk.WriteBatch {
 	return &boltWriteBatch{
-		tables: map[string]map[string][]byte{},
+		puts:    map[string]map[string][]byte{},
+		deletes: map[string]map[string]struct{}{},
 	}
 }
 
@@ -91,7 +95,16 @@ func (b *boltIndexClient) getDB(name string) (*bbolt.DB, error) {
 }
 
 func (b *boltIndexClient) BatchWrite(ctx context.Context, batch chunk.WriteBatch) error {
-	for table, kvps := range batch.(*boltWriteBatch).tables {
+	boltBatch := batch.(*boltWriteBatch)
+	tables := map[string]struct{}{}
+	for table := range boltBatch.puts {
+		tables[table] = struct{}{}
+	}
+	for table := range boltBatch.deletes {
+		tables[table] = struct{}{}
+	}
+
+	for table := range tables {
 		db, err := b.getDB(table)
 		if err != nil {
 			return err
@@ -103,12 +116,18 @@ func (b *boltIndexClient) BatchWrite(ctx context.Context, batch chunk.WriteBatch
 				return err
 			}
 
-			for key, value := range kvps {
+			for key, value := range boltBatch.puts[table] {
 				if err := b.Put([]byte(key), value); err != nil {
 					return err
 				}
 			}
 
+			for key := range boltBatch.deletes[table] {
+				if err := b.Delete([]byte(key)); err != nil {
+					return err
+				}
+			}
+
 			return nil
 		}); err != nil {
 			return err
@@ -170,21 +189,119 @@ func (b *boltIndexClient) query(ctx context.Context, query chunk.IndexQuery, cal
 	})
 }
 
+// PurgeEntries implements chunk.IndexPurger.
+func (b *boltIndexClient) PurgeEntries(ctx context.Context, tableName string, purge func(hashValue string, rangeValue []byte) bool) error {
+	if _, err := os.Stat(path.Join(b.cfg.Directory, tableName)); os.IsNotExist(err) {
+		return nil
+	}
+
+	db, err := b.getDB(tableName)
+	if err != nil {
+		return err
+	}
+
+	return db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketName)
+		if b == nil {
+			return nil
+		}
+
+		var keys [][]byte
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			parts := bytes.SplitN(k, []byte(separator), 2)
+			if len(parts) == 2 && purge(string(parts[0]), parts[1]) {
+				keys = append(keys, append([]byte{}, k...))
+			}
+		}
+
+		for _, key := range keys {
+			if err := b.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ScanTable implements chunk.IndexScanner.
+func (b *boltIndexClient) ScanTable(ctx context.Context, tableName string, callback func(hashValue string, rangeValue []byte) error) error {
+	if _, err := os.Stat(path.Join(b.cfg.Directory, tableName)); os.IsNotExist(err) {
+		return nil
+	}
+
+	db, err := b.getDB(tableName)
+	if err != nil {
+		return err
+	}
+
+	// Keys are read in batches, each in its own transaction, so the callback can
+	// write to the table: bolt can't grow a file while it is being read.
+	var last []byte
+	for {
+		var keys [][]byte
+		err := db.View(func(tx *bbolt.Tx) error {
+			b := tx.Bucket(bucketName)
+			if b == nil {
+				return nil
+			}
+
+			c := b.Cursor()
+			k, _ := c.First()
+			if last != nil {
+				if k, _ = c.Seek(last); bytes.Equal(k, last) {
+					k, _ = c.Next()
+				}
+			}
+			for ; k != nil && len(keys) < scanBatchSize; k, _ = c.Next() {
+				keys = append(keys, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if err != nil || len(keys) == 0 {
+			return err
+		}
+
+		for _, k := range keys {
+			parts := bytes.SplitN(k, []byte(separator), 2)
+			if len(parts) != 2 {
+				continue
+			}
+			if err := callback(string(parts[0]), parts[1]); err != nil {
+				return err
+			}
+		}
+		last = keys[len(keys)-1]
+	}
+}
+
 type boltWriteBatch struct {
-	tables map[string]map[string][]byte
+	puts    map[string]map[string][]byte
+	deletes map[string]map[string]struct{}
 }
 
 func (b *boltWriteBatch) Add(tableName, hashValue string, rangeValue []byte, value []byte) {
-	table, ok := b.tables[tableName]
+	table, ok := b.puts[tableName]
 	if !ok {
 		table = map[string][]byte{}
-		b.tables[tableName] = table
+		b.puts[tableName] = table
 	}
 
 	key := hashValue + separator + string(rangeValue)
 	table[key] = value
 }
 
+func (b *boltWriteBatch) Delete(tableName, hashValue string, rangeValue []byte) {
+	table, ok := b.deletes[tableName]
+	if !ok {
+		table = map[string]struct{}{}
+		b.deletes[tableName] = table
+	}
+
+	key := hashValue + separator + string(rangeValue)
+	table[key] = struct{}{}
+}
+
 type boltReadBatch struct {
 	rangeValue []byte
 	value      []byte
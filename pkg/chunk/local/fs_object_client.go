@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"flag"
 	"io/ioutil"
+	"os"
 	"path"
 
 	"github.com/cortexproject/cortex/pkg/chunk"
@@ -70,3 +71,32 @@ func (f *fsObjectClient) getChunk(_ context.Context, decodeContext *chunk.Decode
 
 	return c, nil
 }
+
+func (f *fsObjectClient) DeleteChunk(_ context.Context, chunkID string) error {
+	filename := base64.StdEncoding.EncodeToString([]byte(chunkID))
+	err := os.Remove(path.Join(f.cfg.Directory, filename))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (f *fsObjectClient) ListChunks(_ context.Context, callback func(chunkIDs []string) error) error {
+	files, err := ioutil.ReadDir(f.cfg.Directory)
+	if err != nil {
+		return err
+	}
+
+	chunkIDs := make([]string, 0, len(files))
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		chunkID, err := base64.StdEncoding.DecodeString(file.Name())
+		if err != nil {
+			continue // Not a chunk.
+		}
+		chunkIDs = append(chunkIDs, string(chunkID))
+	}
+	return callback(chunkIDs)
+}
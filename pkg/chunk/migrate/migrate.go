@@ -0,0 +1,268 @@
+package migrate
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+
+	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/chunk/encoding"
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/flagext"
+)
+
+var (
+	chunksRead = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "cortex",
+		Name:      "migrate_chunks_read_total",
+		Help:      "Number of chunks read by the chunk migration.",
+	})
+	chunksWritten = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "cortex",
+		Name:      "migrate_chunks_written_total",
+		Help:      "Number of re-encoded chunks written by the chunk migration.",
+	})
+	chunksDeleted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "cortex",
+		Name:      "migrate_chunks_deleted_total",
+		Help:      "Number of original chunks deleted by the chunk migration.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(chunksRead, chunksWritten, chunksDeleted)
+}
+
+// Config for a chunk migration.
+type Config struct {
+	Users   flagext.Strings
+	From    flagext.DayValue
+	Through flagext.DayValue
+
+	Encoding     encoding.Encoding
+	MaxChunkAge  time.Duration
+	RateLimit    float64
+	DryRun       bool
+	ProgressFile string
+}
+
+// RegisterFlags adds the flags required to config this to the given FlagSet.
+func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
+	cfg.Encoding = encoding.Bigchunk
+
+	f.Var(&cfg.Users, "migrate.user", "Only migrate the chunks of this user. May be repeated; by default every user's chunks are migrated.")
+	f.Var(&cfg.From, "migrate.from", "First day to migrate (inclusive), in YYYY-MM-DD format.")
+	f.Var(&cfg.Through, "migrate.through", "Last day to migrate (inclusive), in YYYY-MM-DD format.")
+	f.Var(&cfg.Encoding, "migrate.encoding", "Encoding to re-encode chunks into.")
+	f.DurationVar(&cfg.MaxChunkAge, "migrate.max-chunk-age", 12*time.Hour, "Maximum time range covered by a merged chunk.")
+	f.Float64Var(&cfg.RateLimit, "migrate.rate-limit", 0, "Maximum number of chunks to read per second, 0 for no limit.")
+	f.BoolVar(&cfg.DryRun, "migrate.dry-run", false, "Report what would be migrated without writing or deleting anything.")
+	f.StringVar(&cfg.ProgressFile, "migrate.progress-file", "", "File recording the days already migrated, so an interrupted migration can be resumed.")
+}
+
+// Validate the config.
+func (cfg *Config) Validate() error {
+	if !cfg.From.IsSet() || !cfg.Through.IsSet() || cfg.Through.Before(cfg.From.Time) {
+		return fmt.Errorf("a valid day range must be given")
+	}
+	return nil
+}
+
+// Migrator re-encodes the chunks of a range of days into a new encoding,
+// merging adjacent chunks of the same series, and deletes the originals.
+type Migrator struct {
+	cfg      Config
+	walker   *chunk.IndexWalker
+	store    chunk.Store
+	progress *chunk.Progress
+}
+
+// New makes a new Migrator, which finds chunks with the walker and writes
+// and deletes them via the store.
+func New(cfg Config, walker *chunk.IndexWalker, store chunk.Store) (*Migrator, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	progress, err := chunk.LoadProgress(cfg.ProgressFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		cfg:      cfg,
+		walker:   walker,
+		store:    store,
+		progress: progress,
+	}, nil
+}
+
+// Run the migration.  The chunks of each index row are migrated as the index
+// is walked, and each user's days recorded in the progress file once complete.
+func (m *Migrator) Run(ctx context.Context) error {
+	progress := m.progress
+	if m.cfg.DryRun {
+		progress = nil
+	}
+
+	through := m.cfg.Through.Time.Add(24*time.Hour - 1)
+	return m.walker.Walk(ctx, m.cfg.From.Time, through, m.cfg.Users, progress, func(ctx context.Context, userID string, from, through model.Time, chunks []chunk.Chunk) error {
+		// Chunks are in the rows of every bucket they span; migrate them with
+		// the one they start in.
+		starting := chunks[:0]
+		for _, c := range chunks {
+			if !c.From.Before(from) && !c.From.After(through) {
+				starting = append(starting, c)
+			}
+		}
+		if len(starting) == 0 {
+			return nil
+		}
+
+		if err := m.migrate(ctx, userID, from, starting); err != nil {
+			return fmt.Errorf("error migrating %s on %s: %v", userID, from.Time().UTC().Format("2006-01-02"), err)
+		}
+		return nil
+	})
+}
+
+// migrate one user's chunks starting in the bucket starting at from.
+func (m *Migrator) migrate(ctx context.Context, userID string, from model.Time, chunks []chunk.Chunk) error {
+	var numSeries, numOriginals, numMigrated int
+	err := m.walker.FetchSeries(ctx, chunks, func(series [][]chunk.Chunk) error {
+		for _, cs := range series {
+			chunksRead.Add(float64(len(cs)))
+
+			// Chunks already in the target encoding have been migrated before.
+			var originals []chunk.Chunk
+			for _, c := range cs {
+				if c.Encoding != m.cfg.Encoding {
+					originals = append(originals, c)
+				}
+			}
+			if len(originals) == 0 {
+				continue
+			}
+
+			migrated, err := m.merge(userID, originals)
+			if err != nil {
+				return err
+			}
+			numSeries++
+			numOriginals += len(originals)
+			numMigrated += len(migrated)
+			if m.cfg.DryRun {
+				continue
+			}
+
+			if err := m.store.Put(ctx, migrated); err != nil {
+				return err
+			}
+			chunksWritten.Add(float64(len(migrated)))
+
+			// Only delete the originals once all their replacements are written.
+			written := make(map[string]struct{}, len(migrated))
+			for _, c := range migrated {
+				written[c.ExternalKey()] = struct{}{}
+			}
+			for _, c := range originals {
+				if _, ok := written[c.ExternalKey()]; ok {
+					continue
+				}
+				if err := m.store.DeleteChunk(ctx, c.From, c.Through, c); err != nil {
+					return err
+				}
+				chunksDeleted.Inc()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	level.Debug(util.Logger).Log("msg", "migrated chunks", "user", userID, "from", from.Time().UTC().Format(time.RFC3339),
+		"series", numSeries, "original_chunks", numOriginals, "new_chunks", numMigrated, "dry_run", m.cfg.DryRun)
+	return nil
+}
+
+// merge the samples of a series' chunks, sorted by start time, into as few
+// chunks of the target encoding as possible.
+func (m *Migrator) merge(userID string, originals []chunk.Chunk) ([]chunk.Chunk, error) {
+	var (
+		result   []chunk.Chunk
+		current  encoding.Chunk
+		first    model.Time
+		last     model.Time
+		hasFirst bool
+		metric   = originals[0].Metric
+		fp       = originals[0].Fingerprint
+	)
+
+	flush := func() error {
+		if current == nil {
+			return nil
+		}
+		c := chunk.NewChunk(userID, fp, metric, current, first, last)
+		if err := c.Encode(); err != nil {
+			return err
+		}
+		result = append(result, c)
+		current = nil
+		return nil
+	}
+
+	for _, original := range originals {
+		it := original.Data.NewIterator()
+		for it.Scan() {
+			sample := it.Value()
+			// Chunks of a series can overlap; skip samples we already have.
+			if hasFirst && !sample.Timestamp.After(last) {
+				continue
+			}
+
+			if current != nil && sample.Timestamp.Sub(first) > m.cfg.MaxChunkAge {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+			}
+			if current == nil {
+				var err error
+				current, err = encoding.NewForEncoding(m.cfg.Encoding)
+				if err != nil {
+					return nil, err
+				}
+				first = sample.Timestamp
+			}
+
+			overflow, err := current.Add(sample)
+			if err != nil {
+				return nil, err
+			}
+			// The chunk is full; everything but the last chunk is complete.
+			for _, c := range overflow[:len(overflow)-1] {
+				current = c
+				if err := flush(); err != nil {
+					return nil, err
+				}
+				first = sample.Timestamp
+			}
+			current = overflow[len(overflow)-1]
+			last = sample.Timestamp
+			hasFirst = true
+		}
+		if err := it.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,141 @@
+package migrate
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/chunk/encoding"
+	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+func newTestStore(t *testing.T) (chunk.Store, *chunk.IndexWalker, *chunk.MockStorage) {
+	var (
+		storeCfg  chunk.StoreConfig
+		tbmConfig chunk.TableManagerConfig
+		schemaCfg = chunk.DefaultSchemaConfig("", "v9", 0)
+	)
+	flagext.DefaultValues(&storeCfg, &tbmConfig)
+	storage := chunk.NewMockStorage()
+	tableManager, err := chunk.NewTableManager(tbmConfig, schemaCfg, 12*time.Hour, storage)
+	require.NoError(t, err)
+	require.NoError(t, tableManager.SyncTables(context.Background()))
+
+	var limits validation.Limits
+	flagext.DefaultValues(&limits)
+	overrides, err := validation.NewOverrides(limits)
+	require.NoError(t, err)
+
+	store := chunk.NewCompositeStore()
+	require.NoError(t, store.AddPeriod(storeCfg, schemaCfg.Configs[0], storage, storage, overrides))
+
+	periodCfg := schemaCfg.Configs[0]
+	walker, err := chunk.NewIndexWalker(schemaCfg,
+		map[string]chunk.IndexClient{periodCfg.IndexType: storage},
+		map[string]chunk.ObjectClient{periodCfg.IndexType: storage}, 0)
+	require.NoError(t, err)
+	return store, walker, storage
+}
+
+// mkChunks makes DoubleDelta chunks of 60 samples each, one every 15s.
+func mkChunks(t *testing.T, userID string, metric model.Metric, from model.Time, numChunks int) []chunk.Chunk {
+	var chunks []chunk.Chunk
+	ts := from
+	for i := 0; i < numChunks; i++ {
+		pc, err := encoding.NewForEncoding(encoding.DoubleDelta)
+		require.NoError(t, err)
+		start := ts
+		for j := 0; j < 60; j++ {
+			pcs, err := pc.Add(model.SamplePair{Timestamp: ts, Value: model.SampleValue(ts)})
+			require.NoError(t, err)
+			require.Len(t, pcs, 1)
+			pc = pcs[0]
+			ts = ts.Add(15 * time.Second)
+		}
+		c := chunk.NewChunk(userID, metric.Fingerprint(), metric, pc, start, ts.Add(-15*time.Second))
+		require.NoError(t, c.Encode())
+		chunks = append(chunks, c)
+	}
+	return chunks
+}
+
+func TestMigrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, walker, storage := newTestStore(t)
+	metric := model.Metric{model.MetricNameLabel: "foo", "bar": "baz"}
+	day := model.TimeFromUnix(2 * 24 * 3600)
+	users := []string{"user1", "user2"}
+	originals := map[string][]chunk.Chunk{}
+	for _, userID := range users {
+		originals[userID] = mkChunks(t, userID, metric, day.Add(time.Hour), 10)
+		require.NoError(t, store.Put(user.InjectOrgID(context.Background(), userID), originals[userID]))
+	}
+
+	cfg := Config{
+		From:         flagext.NewDayValue(day),
+		Through:      flagext.NewDayValue(day),
+		Encoding:     encoding.Bigchunk,
+		MaxChunkAge:  12 * time.Hour,
+		ProgressFile: filepath.Join(dir, "progress"),
+	}
+	matcher, err := labels.NewMatcher(labels.MatchEqual, model.MetricNameLabel, "foo")
+	require.NoError(t, err)
+
+	// A dry run writes nothing.
+	cfg.DryRun = true
+	migrator, err := New(cfg, walker, store)
+	require.NoError(t, err)
+	require.NoError(t, migrator.Run(context.Background()))
+	for _, userID := range users {
+		chunks, err := store.Get(user.InjectOrgID(context.Background(), userID), day, day.Add(24*time.Hour), matcher)
+		require.NoError(t, err)
+		require.Len(t, chunks, len(originals[userID]))
+	}
+
+	// Every user's chunks are migrated, and the originals deleted.
+	cfg.DryRun = false
+	migrator, err = New(cfg, walker, store)
+	require.NoError(t, err)
+	require.NoError(t, migrator.Run(context.Background()))
+
+	for _, userID := range users {
+		ctx := user.InjectOrgID(context.Background(), userID)
+		chunks, err := store.Get(ctx, day, day.Add(24*time.Hour), matcher)
+		require.NoError(t, err)
+		require.Len(t, chunks, 1)
+		migrated := chunks[0]
+		require.Equal(t, encoding.Bigchunk, migrated.Encoding)
+		require.Equal(t, originals[userID][0].From, migrated.From)
+		require.Equal(t, originals[userID][len(originals[userID])-1].Through, migrated.Through)
+
+		samples, err := migrated.Samples(migrated.From, migrated.Through)
+		require.NoError(t, err)
+		require.Len(t, samples, 60*len(originals[userID]))
+		for _, s := range samples {
+			require.Equal(t, model.SampleValue(s.Timestamp), s.Value)
+		}
+
+		for _, c := range originals[userID] {
+			_, err := storage.GetChunks(ctx, []chunk.Chunk{c})
+			require.Error(t, err)
+		}
+	}
+
+	// The progress file stops the days being migrated again.
+	migrator, err = New(cfg, walker, store)
+	require.NoError(t, err)
+	require.Equal(t, len(users), migrator.progress.Len())
+}
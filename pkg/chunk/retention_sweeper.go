@@ -0,0 +1,402 @@
+package chunk
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+	"github.com/weaveworks/common/instrument"
+	"github.com/weaveworks/common/mtime"
+)
+
+var (
+	sweepDuration = instrument.NewHistogramCollector(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "cortex",
+		Name:      "retention_sweep_seconds",
+		Help:      "Time spent sweeping object stores for chunks past their retention.",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 8),
+	}, []string{"operation", "status_code"}))
+	sweptChunks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cortex",
+		Name:      "retention_swept_chunks_total",
+		Help:      "Total number of chunks deleted from object stores for being past their retention.",
+	}, []string{"store"})
+	purgedEntries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cortex",
+		Name:      "retention_purged_index_entries_total",
+		Help:      "Total number of index entries deleted for being past their tenant's retention.",
+	}, []string{"store"})
+)
+
+func init() {
+	prometheus.MustRegister(sweptChunks, purgedEntries)
+	sweepDuration.Register()
+}
+
+// RetentionSweeper deletes chunks past their retention from the object
+// stores which, unlike chunk tables, aren't dropped by the TableManager.  It
+// also purges the index entries, and the chunks they point to, of tenants
+// whose retention is shorter than the TableManager's, from the index tables
+// which haven't been dropped yet.
+type RetentionSweeper struct {
+	cfg           TableManagerConfig
+	schemaCfg     SchemaConfig
+	objectClients map[string]ObjectClient
+	indexClients  map[string]IndexClient
+	limits        *validation.Overrides
+	done          chan struct{}
+	wait          sync.WaitGroup
+}
+
+// NewRetentionSweeper makes a new RetentionSweeper.  Each of the given object
+// clients (keyed by their object store type) which implements ChunkLister is
+// swept, and each of the index clients (keyed by their index type) which
+// implements IndexPurger or IndexScanner is purged.
+func NewRetentionSweeper(cfg TableManagerConfig, schemaCfg SchemaConfig, objectClients map[string]ObjectClient, indexClients map[string]IndexClient, limits *validation.Overrides) *RetentionSweeper {
+	purgers := map[string]IndexClient{}
+	for name, client := range indexClients {
+		if canPurge(client) {
+			purgers[name] = client
+		} else {
+			level.Warn(util.Logger).Log("msg", "index store doesn't support purging index entries, tenants' index entries will only be deleted with their tables", "store", name)
+		}
+	}
+	return &RetentionSweeper{
+		cfg:           cfg,
+		schemaCfg:     schemaCfg,
+		objectClients: objectClients,
+		indexClients:  purgers,
+		limits:        limits,
+		done:          make(chan struct{}),
+	}
+}
+
+// Start the RetentionSweeper
+func (s *RetentionSweeper) Start() {
+	s.wait.Add(1)
+	go s.loop()
+}
+
+// Stop the RetentionSweeper
+func (s *RetentionSweeper) Stop() {
+	close(s.done)
+	s.wait.Wait()
+}
+
+func (s *RetentionSweeper) loop() {
+	defer s.wait.Done()
+
+	ticker := time.NewTicker(s.cfg.ChunkSweepPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := instrument.CollectedRequest(context.Background(), "RetentionSweeper.Sweep", sweepDuration, instrument.ErrorCode, func(ctx context.Context) error {
+				return s.Sweep(ctx)
+			}); err != nil {
+				level.Error(util.Logger).Log("msg", "error sweeping chunks", "err", err)
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Sweep purges index entries past their tenant's retention, then deletes
+// every chunk past its retention.  It is exposed for testing.
+func (s *RetentionSweeper) Sweep(ctx context.Context) error {
+	// The overrides may have been reloaded since we started.
+	if err := ValidateRetentionPeriods(s.cfg, s.limits); err != nil {
+		return err
+	}
+
+	now := model.TimeFromUnixNano(mtime.Now().UnixNano())
+	if err := s.purgeIndex(ctx, now); err != nil {
+		return err
+	}
+
+	cutoffs := map[string]model.Time{}
+	for name, client := range s.objectClients {
+		lister, ok := client.(ChunkLister)
+		if !ok {
+			continue
+		}
+
+		level.Info(util.Logger).Log("msg", "sweeping chunks past retention", "store", name)
+		deleted := 0
+		err := lister.ListChunks(ctx, func(chunkIDs []string) error {
+			for _, chunkID := range chunkIDs {
+				c, err := ParseObjectKey(chunkID)
+				if err != nil {
+					level.Debug(util.Logger).Log("msg", "skipping object which isn't a chunk", "key", chunkID, "err", err)
+					continue
+				}
+
+				cutoff, ok := cutoffs[c.UserID]
+				if !ok {
+					cutoff = s.cutoff(now, c.UserID)
+					cutoffs[c.UserID] = cutoff
+				}
+				if c.Through >= cutoff || s.objectStoreFor(c.From) != name {
+					continue
+				}
+
+				if err := client.DeleteChunk(ctx, chunkID); err != nil {
+					return err
+				}
+				sweptChunks.WithLabelValues(name).Inc()
+				deleted++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		level.Info(util.Logger).Log("msg", "swept chunks past retention", "store", name, "deleted", deleted)
+	}
+	return nil
+}
+
+// ValidateRetentionPeriods checks no user's retention period is longer than
+// the TableManager's, as their data would be deleted along with its tables
+// before their retention is up.
+func ValidateRetentionPeriods(cfg TableManagerConfig, limits *validation.Overrides) error {
+	if !cfg.RetentionDeletesEnabled || cfg.RetentionPeriod <= 0 {
+		return nil
+	}
+	if max := limits.MaxRetentionPeriod(); max > cfg.RetentionPeriod {
+		return fmt.Errorf("retention period of %v is longer than the table retention period of %v", max, cfg.RetentionPeriod)
+	}
+	return nil
+}
+
+// purgeIndex deletes the index entries of buckets which ended before their
+// tenant's retention, from the tables the TableManager hasn't dropped yet,
+// along with the chunks they point to which ended before it.
+func (s *RetentionSweeper) purgeIndex(ctx context.Context, now model.Time) error {
+	minRetention := s.limits.MinRetentionPeriod()
+	if len(s.indexClients) == 0 || minRetention <= 0 {
+		return nil
+	}
+
+	for i, periodCfg := range s.schemaCfg.Configs {
+		client, ok := s.indexClients[periodCfg.IndexType]
+		if !ok {
+			continue
+		}
+
+		// Only tables with entries older than the shortest retention, which
+		// are still within the TableManager's retention, have anything to
+		// purge.
+		from, through := periodCfg.From, now.Add(-minRetention)
+		if i+1 < len(s.schemaCfg.Configs) && s.schemaCfg.Configs[i+1].From < through {
+			through = s.schemaCfg.Configs[i+1].From
+		}
+		if periodSecs := int64(periodCfg.IndexTables.Period / time.Second); s.cfg.RetentionPeriod > 0 && periodSecs > 0 {
+			// As TableManager.calculateExpectedTables does.
+			tablesToKeep := int64(s.cfg.RetentionPeriod/time.Second) / periodSecs
+			if firstKept := model.TimeFromUnix((now.Unix()/periodSecs - tablesToKeep) * periodSecs); firstKept > from {
+				from = firstKept
+			}
+		}
+		if from >= through {
+			continue
+		}
+
+		for _, tableName := range periodCfg.IndexTables.tableNames(from, through) {
+			if err := s.purgeTable(ctx, now, periodCfg, client, tableName); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// purgeBatchSize is the number of index entries PurgeEntries deletes at once
+// from index clients without their own IndexPurger.
+const purgeBatchSize = 100
+
+func canPurge(client IndexClient) bool {
+	switch client.(type) {
+	case IndexPurger, IndexScanner:
+		return true
+	default:
+		return false
+	}
+}
+
+// PurgeEntries deletes the entries in tableName for which purge returns true.
+// Clients which implement IndexPurger purge them themselves; the entries of
+// clients which implement IndexScanner are deleted in batches as the table is
+// scanned.
+func PurgeEntries(ctx context.Context, client IndexClient, tableName string, purge func(hashValue string, rangeValue []byte) bool) error {
+	if purger, ok := client.(IndexPurger); ok {
+		return purger.PurgeEntries(ctx, tableName, purge)
+	}
+	scanner, ok := client.(IndexScanner)
+	if !ok {
+		return fmt.Errorf("index client can't purge entries from %s", tableName)
+	}
+
+	batch, size := client.NewWriteBatch(), 0
+	err := scanner.ScanTable(ctx, tableName, func(hashValue string, rangeValue []byte) error {
+		if !purge(hashValue, rangeValue) {
+			return nil
+		}
+		batch.Delete(tableName, hashValue, append([]byte{}, rangeValue...))
+		size++
+		if size < purgeBatchSize {
+			return nil
+		}
+		err := client.BatchWrite(ctx, batch)
+		batch, size = client.NewWriteBatch(), 0
+		return err
+	})
+	if err != nil || size == 0 {
+		return err
+	}
+	return client.BatchWrite(ctx, batch)
+}
+
+func (s *RetentionSweeper) purgeTable(ctx context.Context, now model.Time, periodCfg PeriodConfig, client IndexClient, tableName string) error {
+	level.Info(util.Logger).Log("msg", "purging index entries past retention", "table", tableName)
+
+	cutoffs := map[string]model.Time{}
+	chunks := map[string]string{}
+	purged := 0
+	err := PurgeEntries(ctx, client, tableName, func(hashValue string, rangeValue []byte) bool {
+		userID, _, bucketEnd, ok := parseIndexHashValue(hashValue)
+		if !ok {
+			return false
+		}
+
+		cutoff, ok := cutoffs[userID]
+		if !ok {
+			cutoff = 0
+			if retention := s.limits.RetentionPeriod(userID); retention > 0 {
+				// Buckets are at most a day long, so aligning the cutoff to a day
+				// means a chunk's entries are all purged if it ends before it.
+				cutoff = model.TimeFromUnix(now.Add(-retention).Unix() / secondsInDay * secondsInDay)
+			}
+			cutoffs[userID] = cutoff
+		}
+		if bucketEnd > cutoff {
+			return false
+		}
+
+		if chunkID, _, _, isSeriesID, err := parseChunkTimeRangeValue(rangeValue, nil); err == nil && !isSeriesID {
+			chunks[chunkID] = userID
+		}
+		purged++
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	purgedEntries.WithLabelValues(periodCfg.IndexType).Add(float64(purged))
+
+	deleted := 0
+	for chunkID, userID := range chunks {
+		c, err := ParseExternalKey(userID, chunkID)
+		if err != nil || c.Through >= cutoffs[userID] {
+			continue
+		}
+		name := s.objectStoreFor(c.From)
+		client, ok := s.objectClients[name]
+		if !ok {
+			continue
+		}
+		if err := client.DeleteChunk(ctx, c.ExternalKey()); err != nil {
+			return err
+		}
+		sweptChunks.WithLabelValues(name).Inc()
+		deleted++
+	}
+
+	level.Info(util.Logger).Log("msg", "purged index entries past retention", "table", tableName, "entries", purged, "chunks", deleted)
+	return nil
+}
+
+// parseIndexHashValue returns the user and time range of the bucket of an
+// index entry's hash value, which start "<user>:d<day>" or "<user>:<hour>",
+// with a "<shard>:" prefix for the sharded rows of the v10 schema.  The end of
+// the range is exclusive.
+func parseIndexHashValue(hashValue string) (string, model.Time, model.Time, bool) {
+	parts := strings.SplitN(hashValue, ":", 4)
+	if len(parts) >= 2 {
+		if start, end, ok := parseBucket(parts[1]); ok {
+			return parts[0], start, end, true
+		}
+	}
+	if len(parts) >= 3 && len(parts[0]) == 2 {
+		if start, end, ok := parseBucket(parts[2]); ok {
+			return parts[1], start, end, true
+		}
+	}
+	return "", 0, 0, false
+}
+
+func parseBucket(bucket string) (model.Time, model.Time, bool) {
+	if strings.HasPrefix(bucket, "d") {
+		day, err := strconv.ParseInt(bucket[1:], 10, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+		return model.Time(day * millisecondsInDay), model.Time((day + 1) * millisecondsInDay), true
+	}
+	hour, err := strconv.ParseInt(bucket, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return model.Time(hour * millisecondsInHour), model.Time((hour + 1) * millisecondsInHour), true
+}
+
+// cutoff returns the time before which userID's chunks are past retention.
+// This is rounded down to the start of an index table, so chunks are only
+// deleted once the index entries pointing at them are: as the TableManager
+// does for the default retention, and as the index tables would be if
+// they were per-tenant.
+func (s *RetentionSweeper) cutoff(now model.Time, userID string) model.Time {
+	retention := s.limits.RetentionPeriod(userID)
+	if retention <= 0 {
+		retention = s.cfg.RetentionPeriod
+	}
+	if retention <= 0 {
+		return 0
+	}
+
+	cutoff := now.Add(-retention)
+	for i := range s.schemaCfg.Configs {
+		if cutoff >= s.schemaCfg.Configs[i].From && (i+1 == len(s.schemaCfg.Configs) || cutoff < s.schemaCfg.Configs[i+1].From) {
+			if period := int64(s.schemaCfg.Configs[i].IndexTables.Period / time.Millisecond); period > 0 {
+				cutoff = model.Time(int64(cutoff) / period * period)
+			}
+			break
+		}
+	}
+	return cutoff
+}
+
+// objectStoreFor returns the type of object store chunks from time t are
+// stored in.
+func (s *RetentionSweeper) objectStoreFor(t model.Time) string {
+	for i := range s.schemaCfg.Configs {
+		if t >= s.schemaCfg.Configs[i].From && (i+1 == len(s.schemaCfg.Configs) || t < s.schemaCfg.Configs[i+1].From) {
+			if s.schemaCfg.Configs[i].ObjectType != "" {
+				return s.schemaCfg.Configs[i].ObjectType
+			}
+			return s.schemaCfg.Configs[i].IndexType
+		}
+	}
+	return ""
+}
@@ -0,0 +1,222 @@
+package chunk
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/mtime"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/chunk/encoding"
+	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+func TestRetentionSweeper(t *testing.T) {
+	const week = 7 * 24 * time.Hour
+	now := time.Unix(0, 0).Add(100*week + 3*24*time.Hour)
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	overridesFile, err := ioutil.TempFile("", "overrides")
+	require.NoError(t, err)
+	defer os.Remove(overridesFile.Name())
+	_, err = overridesFile.WriteString("overrides:\n  short:\n    retention_period: 168h\n")
+	require.NoError(t, err)
+	require.NoError(t, overridesFile.Close())
+
+	var limits validation.Limits
+	flagext.DefaultValues(&limits)
+	limits.PerTenantOverrideConfig = overridesFile.Name()
+	overrides, err := validation.NewOverrides(limits)
+	require.NoError(t, err)
+	defer overrides.Stop()
+
+	var tbmConfig TableManagerConfig
+	flagext.DefaultValues(&tbmConfig)
+	tbmConfig.RetentionPeriod = 4 * week
+
+	storage := NewMockStorage()
+	schemaCfg := DefaultSchemaConfig("inmemory", "v9", 0)
+	sweeper := NewRetentionSweeper(tbmConfig, schemaCfg, map[string]ObjectClient{"inmemory": storage}, map[string]IndexClient{"inmemory": storage}, overrides)
+
+	// Index tables start on week boundaries, so the default retention deletes
+	// chunks before the start of week 96, and the short one before week 99.
+	nowModel := model.TimeFromUnixNano(now.UnixNano())
+	weekStart := func(n int) model.Time {
+		return model.TimeFromUnixNano(time.Unix(0, 0).Add(time.Duration(n) * week).UnixNano())
+	}
+	chunks := map[string]bool{}
+	for _, c := range []struct {
+		userID  string
+		through model.Time
+		deleted bool
+	}{
+		{"default", weekStart(96).Add(-time.Minute), true},
+		{"default", weekStart(96).Add(time.Minute), false},
+		{"default", nowModel, false},
+		{"short", weekStart(99).Add(-time.Minute), true},
+		{"short", weekStart(99).Add(time.Minute), false},
+	} {
+		chunk := retentionTestChunk(c.userID, c.through)
+		require.NoError(t, storage.PutChunks(context.Background(), []Chunk{chunk}))
+		chunks[chunk.ExternalKey()] = c.deleted
+	}
+
+	require.NoError(t, sweeper.Sweep(context.Background()))
+
+	for key, deleted := range chunks {
+		_, ok := storage.objects[key]
+		require.Equal(t, !deleted, ok, key)
+	}
+}
+
+func TestRetentionSweeperPurgesIndex(t *testing.T) {
+	const (
+		day  = 24 * time.Hour
+		week = 7 * day
+	)
+	now := time.Unix(0, 0).Add(100*week + 3*day)
+	mtime.NowForce(now)
+	defer mtime.NowReset()
+
+	overridesFile, err := ioutil.TempFile("", "overrides")
+	require.NoError(t, err)
+	defer os.Remove(overridesFile.Name())
+	_, err = overridesFile.WriteString("overrides:\n  short:\n    retention_period: 168h\n")
+	require.NoError(t, err)
+	require.NoError(t, overridesFile.Close())
+
+	var limits validation.Limits
+	flagext.DefaultValues(&limits)
+	limits.PerTenantOverrideConfig = overridesFile.Name()
+	overrides, err := validation.NewOverrides(limits)
+	require.NoError(t, err)
+	defer overrides.Stop()
+
+	var (
+		tbmConfig TableManagerConfig
+		storeCfg  StoreConfig
+	)
+	flagext.DefaultValues(&tbmConfig, &storeCfg)
+	tbmConfig.RetentionPeriod = 4 * week
+
+	storage := NewMockStorage()
+	schemaCfg := DefaultSchemaConfig("inmemory", "v9", 0)
+	for i := 97; i <= 100; i++ {
+		require.NoError(t, storage.CreateTable(context.Background(), TableDesc{Name: schemaCfg.Configs[0].IndexTables.tableForPeriod(int64(i))}))
+	}
+	store := NewCompositeStore()
+	require.NoError(t, store.AddPeriod(storeCfg, schemaCfg.Configs[0], storage, storage, overrides))
+	defer store.Stop()
+
+	// The short retention purges buckets ending before day 3 of week 99, so
+	// removes this chunk before its table is dropped.
+	weekStart := model.TimeFromUnixNano(time.Unix(0, 0).Add(99 * week).UnixNano())
+	chunks := map[string]bool{}
+	for _, c := range []struct {
+		userID  string
+		through model.Time
+		deleted bool
+	}{
+		{"short", weekStart.Add(day), true},
+		{"short", model.TimeFromUnixNano(now.UnixNano()), false},
+		{"default", weekStart.Add(day), false},
+	} {
+		chunk := retentionTestChunk(c.userID, c.through)
+		require.NoError(t, store.Put(user.InjectOrgID(context.Background(), c.userID), []Chunk{chunk}))
+		chunks[chunk.ExternalKey()] = c.deleted
+	}
+
+	sweeper := NewRetentionSweeper(tbmConfig, schemaCfg, map[string]ObjectClient{"inmemory": storage}, map[string]IndexClient{"inmemory": storage}, overrides)
+	require.NoError(t, sweeper.Sweep(context.Background()))
+
+	for key, deleted := range chunks {
+		_, ok := storage.objects[key]
+		require.Equal(t, !deleted, ok, key)
+	}
+
+	cutoff := model.TimeFromUnixNano(now.Add(-week).UnixNano())
+	entries := map[string]int{}
+	for _, table := range storage.tables {
+		for hashValue := range table.items {
+			userID, _, bucketEnd, ok := parseIndexHashValue(hashValue)
+			require.True(t, ok, hashValue)
+			require.False(t, userID == "short" && bucketEnd <= cutoff, hashValue)
+			entries[userID]++
+		}
+	}
+	require.NotZero(t, entries["short"])
+	require.NotZero(t, entries["default"])
+}
+
+func TestValidateRetentionPeriods(t *testing.T) {
+	overridesFile, err := ioutil.TempFile("", "overrides")
+	require.NoError(t, err)
+	defer os.Remove(overridesFile.Name())
+	_, err = overridesFile.WriteString("overrides:\n  long:\n    retention_period: 720h\n")
+	require.NoError(t, err)
+	require.NoError(t, overridesFile.Close())
+
+	var limits validation.Limits
+	flagext.DefaultValues(&limits)
+	limits.PerTenantOverrideConfig = overridesFile.Name()
+	overrides, err := validation.NewOverrides(limits)
+	require.NoError(t, err)
+	defer overrides.Stop()
+
+	var tbmConfig TableManagerConfig
+	flagext.DefaultValues(&tbmConfig)
+	tbmConfig.RetentionDeletesEnabled = true
+	tbmConfig.RetentionPeriod = 28 * 24 * time.Hour
+	require.Error(t, ValidateRetentionPeriods(tbmConfig, overrides))
+
+	tbmConfig.RetentionPeriod = 30 * 24 * time.Hour
+	require.NoError(t, ValidateRetentionPeriods(tbmConfig, overrides))
+
+	// Tables are never deleted without a retention period.
+	tbmConfig.RetentionPeriod = 0
+	require.NoError(t, ValidateRetentionPeriods(tbmConfig, overrides))
+}
+
+func TestParseIndexHashValue(t *testing.T) {
+	for _, tc := range []struct {
+		hashValue   string
+		userID      string
+		bucketStart model.Time
+		bucketEnd   model.Time
+	}{
+		{"user:d1:foo", "user", model.Time(millisecondsInDay), model.Time(2 * millisecondsInDay)},
+		{"user:d1:foo:bar", "user", model.Time(millisecondsInDay), model.Time(2 * millisecondsInDay)},
+		{"03:user:d1:foo", "user", model.Time(millisecondsInDay), model.Time(2 * millisecondsInDay)},
+		{"user:5:foo", "user", model.Time(5 * millisecondsInHour), model.Time(6 * millisecondsInHour)},
+	} {
+		userID, bucketStart, bucketEnd, ok := parseIndexHashValue(tc.hashValue)
+		require.True(t, ok, tc.hashValue)
+		require.Equal(t, tc.userID, userID, tc.hashValue)
+		require.Equal(t, tc.bucketStart, bucketStart, tc.hashValue)
+		require.Equal(t, tc.bucketEnd, bucketEnd, tc.hashValue)
+	}
+
+	_, _, _, ok := parseIndexHashValue("foo")
+	require.False(t, ok)
+}
+
+func retentionTestChunk(userID string, through model.Time) Chunk {
+	metric := model.Metric{model.MetricNameLabel: "foo"}
+	c, _ := encoding.NewForEncoding(encoding.Varbit)
+	cs, err := c.Add(model.SamplePair{Timestamp: through, Value: 0})
+	if err != nil {
+		panic(err)
+	}
+	chunk := NewChunk(userID, metric.Fingerprint(), metric, cs[0], through.Add(-time.Hour), through)
+	if err := chunk.Encode(); err != nil {
+		panic(err)
+	}
+	return chunk
+}
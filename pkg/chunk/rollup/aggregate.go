@@ -0,0 +1,137 @@
+package rollup
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// Labels added to a series' labels to make the labels of its rollups.
+const (
+	ResolutionLabel = "__rollup_resolution__"
+	AggregateLabel  = "__rollup_aggregate__"
+)
+
+// Aggregates stored for each window of a rolled up series.
+const (
+	Min   = "min"
+	Max   = "max"
+	Sum   = "sum"
+	Count = "count"
+	// Counter is the last sample of each window, and the last sample before
+	// each counter reset, so rate() and increase() over it give the same
+	// increase as over the raw samples.
+	Counter = "counter"
+)
+
+// Aggregates are all the aggregates, in the order they're stored.
+var Aggregates = []string{Min, Max, Sum, Count, Counter}
+
+// Resolutions are the sizes of the windows series are rolled up into.  As a
+// flag, they're comma-separated durations, e.g. 5m,1h.
+type Resolutions []time.Duration
+
+// String implements flag.Value.
+func (r Resolutions) String() string {
+	ss := make([]string, 0, len(r))
+	for _, resolution := range r {
+		ss = append(ss, model.Duration(resolution).String())
+	}
+	return strings.Join(ss, ",")
+}
+
+// Set implements flag.Value.  Resolutions must divide a day, so windows never
+// span two days, and are sorted finest first.
+func (r *Resolutions) Set(s string) error {
+	var resolutions Resolutions
+	for _, part := range strings.Split(s, ",") {
+		if part == "" {
+			continue
+		}
+		d, err := model.ParseDuration(part)
+		if err != nil {
+			return err
+		}
+		resolution := time.Duration(d)
+		if resolution <= 0 || (24*time.Hour)%resolution != 0 {
+			return fmt.Errorf("rollup resolution %s does not divide a day", part)
+		}
+		resolutions = append(resolutions, resolution)
+	}
+	sort.Slice(resolutions, func(i, j int) bool {
+		return resolutions[i] < resolutions[j]
+	})
+	*r = resolutions
+	return nil
+}
+
+// Metric returns the labels of a series' rollup into one aggregate at a
+// resolution.
+func Metric(metric model.Metric, resolution time.Duration, aggregate string) model.Metric {
+	result := make(model.Metric, len(metric)+2)
+	for k, v := range metric {
+		result[k] = v
+	}
+	result[ResolutionLabel] = model.LabelValue(model.Duration(resolution).String())
+	result[AggregateLabel] = model.LabelValue(aggregate)
+	return result
+}
+
+// Aggregate rolls up samples, sorted by time, into windows of resolution.  Each
+// aggregate has a sample for each window with samples, at the time of its last
+// sample.
+func Aggregate(samples []model.SamplePair, resolution time.Duration) map[string][]model.SamplePair {
+	result := map[string][]model.SamplePair{}
+	if len(samples) == 0 {
+		return result
+	}
+
+	var (
+		size                 = int64(resolution / time.Millisecond)
+		window               = int64(samples[0].Timestamp) / size
+		prev                 = samples[0]
+		min, max, sum, count model.SampleValue
+	)
+	flush := func() {
+		ts := prev.Timestamp
+		result[Min] = append(result[Min], model.SamplePair{Timestamp: ts, Value: min})
+		result[Max] = append(result[Max], model.SamplePair{Timestamp: ts, Value: max})
+		result[Sum] = append(result[Sum], model.SamplePair{Timestamp: ts, Value: sum})
+		result[Count] = append(result[Count], model.SamplePair{Timestamp: ts, Value: count})
+		result[Counter] = append(result[Counter], prev)
+	}
+	start := func(s model.SamplePair) {
+		min, max, sum, count = s.Value, s.Value, s.Value, 1
+	}
+
+	start(samples[0])
+	for _, s := range samples[1:] {
+		if w := int64(s.Timestamp) / size; w != window {
+			flush()
+			window = w
+			start(s)
+			prev = s
+			continue
+		}
+
+		// The last sample of a window is always kept, so only resets within
+		// a window need the sample before them keeping.
+		if s.Value < prev.Value {
+			result[Counter] = append(result[Counter], prev)
+		}
+		if s.Value < min {
+			min = s.Value
+		}
+		if s.Value > max {
+			max = s.Value
+		}
+		sum += s.Value
+		count++
+		prev = s
+	}
+	flush()
+	return result
+}
@@ -0,0 +1,323 @@
+package rollup
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+
+	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/chunk/encoding"
+	"github.com/cortexproject/cortex/pkg/chunk/storage"
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+var (
+	chunksRead = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "cortex",
+		Name:      "rollup_chunks_read_total",
+		Help:      "Number of raw chunks read by the rollup job.",
+	})
+	chunksWritten = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cortex",
+		Name:      "rollup_chunks_written_total",
+		Help:      "Number of rollup chunks written by the rollup job.",
+	}, []string{"resolution"})
+)
+
+func init() {
+	prometheus.MustRegister(chunksRead, chunksWritten)
+}
+
+// Config for a rollup job.
+type Config struct {
+	Users    flagext.Strings
+	From     flagext.DayValue
+	Through  flagext.DayValue
+	Interval time.Duration
+
+	SchemaConfigFile string
+	Resolutions      Resolutions
+	Encoding         encoding.Encoding
+	RateLimit        float64
+	DryRun           bool
+	ProgressFile     string
+}
+
+// RegisterFlags adds the flags required to config this to the given FlagSet.
+func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
+	cfg.Resolutions = Resolutions{5 * time.Minute, time.Hour}
+	cfg.Encoding = encoding.Bigchunk
+
+	f.Var(&cfg.Users, "rollup.user", "Only roll up the series of this user. May be repeated; by default every user's series are rolled up.")
+	f.Var(&cfg.From, "rollup.from", "First day to roll up (inclusive), in YYYY-MM-DD format.")
+	f.Var(&cfg.Through, "rollup.through", "Last day to roll up (inclusive), in YYYY-MM-DD format. By default, the last day which ended over a day ago, so its chunks have been flushed.")
+	f.DurationVar(&cfg.Interval, "rollup.interval", 0, "Keep running, rolling up each new day once it has ended over a day ago, checking at this interval. 0 to exit once the days given have been rolled up.")
+	f.StringVar(&cfg.SchemaConfigFile, "rollup.schema-config-yaml", "", "Schema config yaml of the store rollups are written to, which must use different tables to the raw store.")
+	f.Var(&cfg.Resolutions, "rollup.resolutions", "Comma-separated resolutions to roll series up into; each must divide a day.")
+	f.Var(&cfg.Encoding, "rollup.encoding", "Encoding of rollup chunks.")
+	f.Float64Var(&cfg.RateLimit, "rollup.rate-limit", 0, "Maximum number of raw chunks to read per second, 0 for no limit.")
+	f.BoolVar(&cfg.DryRun, "rollup.dry-run", false, "Report what would be rolled up without writing anything.")
+	f.StringVar(&cfg.ProgressFile, "rollup.progress-file", "", "File recording the days already rolled up, so an interrupted job can be resumed.")
+}
+
+// Validate the config.
+func (cfg *Config) Validate() error {
+	if !cfg.From.IsSet() || (cfg.Through.IsSet() && cfg.Through.Before(cfg.From.Time)) {
+		return fmt.Errorf("a valid day range must be given")
+	}
+	if len(cfg.Resolutions) == 0 {
+		return fmt.Errorf("at least one resolution must be given")
+	}
+	return nil
+}
+
+// NewStore makes the store rollups are kept in: the same storage as raw
+// chunks, with its own schema config.
+func NewStore(schemaConfigFile string, cfg storage.Config, storeCfg chunk.StoreConfig, limits *validation.Overrides) (chunk.Store, error) {
+	if schemaConfigFile == "" {
+		return nil, fmt.Errorf("the rollup store must have its own schema config yaml")
+	}
+	schemaCfg, err := chunk.LoadSchemaConfig(schemaConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	return storage.NewStore(cfg, storeCfg, schemaCfg, limits)
+}
+
+// Roller rolls up the raw chunks of each user on each of a range of days into
+// the aggregates of each window of each resolution, written to a separate
+// store.
+type Roller struct {
+	cfg      Config
+	walker   *chunk.IndexWalker
+	rollups  chunk.Store
+	progress *chunk.Progress
+}
+
+// New makes a new Roller, which finds raw chunks with the walker and writes
+// rollups to the rollups store.
+func New(cfg Config, walker *chunk.IndexWalker, rollups chunk.Store) (*Roller, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	progress, err := chunk.LoadProgress(cfg.ProgressFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Roller{
+		cfg:      cfg,
+		walker:   walker,
+		rollups:  rollups,
+		progress: progress,
+	}, nil
+}
+
+// Run the job.  The series of each index row are rolled up as the index is
+// walked, and each user's days recorded in the progress file once complete.  Rolling up a day
+// again writes the same chunks, so is harmless.  With an interval, it keeps
+// running until ctx is cancelled, rolling up new days as they become old
+// enough, and retrying failed ones.
+func (r *Roller) Run(ctx context.Context) error {
+	from := r.cfg.From.Time
+	for {
+		through := r.through()
+		if !through.Before(from) {
+			err := r.run(ctx, from, through)
+			if err == nil {
+				from = through.Add(24 * time.Hour)
+			} else if r.cfg.Interval <= 0 {
+				return err
+			} else {
+				level.Error(util.Logger).Log("msg", "rollup failed, will retry", "err", err)
+			}
+		}
+
+		if r.cfg.Interval <= 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(r.cfg.Interval):
+		}
+	}
+}
+
+// through returns the last day to roll up: the configured one, or the last
+// day which ended over a day ago, so ingesters have flushed its chunks.
+func (r *Roller) through() model.Time {
+	if r.cfg.Through.IsSet() {
+		return r.cfg.Through.Time
+	}
+	day := int64(24 * time.Hour / time.Millisecond)
+	return model.Time(int64(model.Now().Add(-48*time.Hour)) / day * day)
+}
+
+// run rolls up the days from from to through.
+func (r *Roller) run(ctx context.Context, from, through model.Time) error {
+	progress := r.progress
+	if r.cfg.DryRun {
+		progress = nil
+	}
+
+	// A row holds all the chunks overlapping its bucket, including those
+	// starting in earlier buckets.
+	return r.walker.Walk(ctx, from, through.Add(24*time.Hour-1), r.cfg.Users, progress, func(ctx context.Context, userID string, from, through model.Time, chunks []chunk.Chunk) error {
+		if err := r.rollup(ctx, userID, from, through, chunks); err != nil {
+			return fmt.Errorf("error rolling up %s on %s: %v", userID, from.Time().UTC().Format("2006-01-02"), err)
+		}
+		return nil
+	})
+}
+
+// rollup the samples from from to through, a bucket of the index, of one
+// user's chunks.
+func (r *Roller) rollup(ctx context.Context, userID string, from, through model.Time, chunks []chunk.Chunk) error {
+	for _, resolution := range r.cfg.Resolutions {
+		if int64(through-from+1)%int64(resolution/time.Millisecond) != 0 {
+			return fmt.Errorf("resolution %v doesn't divide the index's buckets", model.Duration(resolution))
+		}
+	}
+
+	var numSeries, numRead, numWritten int
+	err := r.walker.FetchSeries(ctx, chunks, func(series [][]chunk.Chunk) error {
+		written := map[time.Duration][]chunk.Chunk{}
+		for _, cs := range series {
+			chunksRead.Add(float64(len(cs)))
+			numRead += len(cs)
+
+			samples, err := seriesSamples(cs, from, through)
+			if err != nil {
+				return err
+			}
+			if len(samples) == 0 {
+				continue
+			}
+			numSeries++
+
+			for _, resolution := range r.cfg.Resolutions {
+				aggregated := Aggregate(samples, resolution)
+				for _, aggregate := range Aggregates {
+					if len(aggregated[aggregate]) == 0 {
+						continue
+					}
+					metric := Metric(cs[0].Metric, resolution, aggregate)
+					encoded, err := encode(userID, metric, aggregated[aggregate], r.cfg.Encoding)
+					if err != nil {
+						return err
+					}
+					written[resolution] = append(written[resolution], encoded...)
+					numWritten += len(encoded)
+				}
+			}
+		}
+		if r.cfg.DryRun {
+			return nil
+		}
+
+		for _, resolution := range r.cfg.Resolutions {
+			if err := r.rollups.Put(ctx, written[resolution]); err != nil {
+				return err
+			}
+			chunksWritten.WithLabelValues(model.Duration(resolution).String()).Add(float64(len(written[resolution])))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	level.Debug(util.Logger).Log("msg", "rolled up series", "user", userID, "from", from.Time().UTC().Format(time.RFC3339),
+		"series", numSeries, "raw_chunks", numRead, "rollup_chunks", numWritten, "dry_run", r.cfg.DryRun)
+	return nil
+}
+
+// seriesSamples returns the samples of a series' chunks between from and
+// through, in order, without the duplicates of overlapping chunks.
+func seriesSamples(chunks []chunk.Chunk, from, through model.Time) ([]model.SamplePair, error) {
+	sort.Slice(chunks, func(i, j int) bool {
+		return chunks[i].From.Before(chunks[j].From)
+	})
+
+	var result []model.SamplePair
+	for _, c := range chunks {
+		it := c.Data.NewIterator()
+		for it.Scan() {
+			sample := it.Value()
+			if sample.Timestamp.Before(from) || sample.Timestamp.After(through) {
+				continue
+			}
+			if len(result) > 0 && !sample.Timestamp.After(result[len(result)-1].Timestamp) {
+				continue
+			}
+			result = append(result, sample)
+		}
+		if err := it.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// encode samples into as few chunks of the given encoding as possible.
+func encode(userID string, metric model.Metric, samples []model.SamplePair, enc encoding.Encoding) ([]chunk.Chunk, error) {
+	var (
+		result  []chunk.Chunk
+		current encoding.Chunk
+		first   model.Time
+		last    model.Time
+		fp      = metric.Fingerprint()
+	)
+
+	flush := func() error {
+		c := chunk.NewChunk(userID, fp, metric, current, first, last)
+		if err := c.Encode(); err != nil {
+			return err
+		}
+		result = append(result, c)
+		return nil
+	}
+
+	for _, sample := range samples {
+		if current == nil {
+			var err error
+			current, err = encoding.NewForEncoding(enc)
+			if err != nil {
+				return nil, err
+			}
+			first = sample.Timestamp
+		}
+
+		overflow, err := current.Add(sample)
+		if err != nil {
+			return nil, err
+		}
+		// The chunk is full; everything but the last chunk is complete.
+		for _, c := range overflow[:len(overflow)-1] {
+			current = c
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			first = sample.Timestamp
+		}
+		current = overflow[len(overflow)-1]
+		last = sample.Timestamp
+	}
+
+	if current != nil {
+		if err := flush(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,175 @@
+package rollup
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/chunk/encoding"
+	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+func newTestStore(t *testing.T) (chunk.Store, *chunk.IndexWalker) {
+	var (
+		storeCfg  chunk.StoreConfig
+		tbmConfig chunk.TableManagerConfig
+		schemaCfg = chunk.DefaultSchemaConfig("", "v9", 0)
+	)
+	flagext.DefaultValues(&storeCfg, &tbmConfig)
+	storage := chunk.NewMockStorage()
+	tableManager, err := chunk.NewTableManager(tbmConfig, schemaCfg, 12*time.Hour, storage)
+	require.NoError(t, err)
+	require.NoError(t, tableManager.SyncTables(context.Background()))
+
+	var limits validation.Limits
+	flagext.DefaultValues(&limits)
+	overrides, err := validation.NewOverrides(limits)
+	require.NoError(t, err)
+
+	store := chunk.NewCompositeStore()
+	require.NoError(t, store.AddPeriod(storeCfg, schemaCfg.Configs[0], storage, storage, overrides))
+
+	periodCfg := schemaCfg.Configs[0]
+	walker, err := chunk.NewIndexWalker(schemaCfg,
+		map[string]chunk.IndexClient{periodCfg.IndexType: storage},
+		map[string]chunk.ObjectClient{periodCfg.IndexType: storage}, 0)
+	require.NoError(t, err)
+	return store, walker
+}
+
+func samplePairs(values ...float64) []model.SamplePair {
+	var result []model.SamplePair
+	for i, v := range values {
+		result = append(result, model.SamplePair{
+			Timestamp: model.Time(i) * model.Time(time.Minute/time.Millisecond),
+			Value:     model.SampleValue(v),
+		})
+	}
+	return result
+}
+
+func TestResolutions(t *testing.T) {
+	var r Resolutions
+	require.NoError(t, r.Set("1h,5m"))
+	require.Equal(t, Resolutions{5 * time.Minute, time.Hour}, r)
+	require.Equal(t, "5m,1h", r.String())
+	require.Error(t, r.Set("7m"))
+}
+
+func TestAggregate(t *testing.T) {
+	// Two 5m windows of a counter, with a reset in the first.
+	aggregated := Aggregate(samplePairs(1, 2, 3, 1, 2, 4, 6, 8), 5*time.Minute)
+
+	ts := func(minute int64) model.Time { return model.Time(minute * 60 * 1000) }
+	require.Equal(t, []model.SamplePair{{Timestamp: ts(4), Value: 1}, {Timestamp: ts(7), Value: 4}}, aggregated[Min])
+	require.Equal(t, []model.SamplePair{{Timestamp: ts(4), Value: 3}, {Timestamp: ts(7), Value: 8}}, aggregated[Max])
+	require.Equal(t, []model.SamplePair{{Timestamp: ts(4), Value: 9}, {Timestamp: ts(7), Value: 18}}, aggregated[Sum])
+	require.Equal(t, []model.SamplePair{{Timestamp: ts(4), Value: 5}, {Timestamp: ts(7), Value: 3}}, aggregated[Count])
+	require.Equal(t, []model.SamplePair{
+		{Timestamp: ts(2), Value: 3},
+		{Timestamp: ts(4), Value: 2},
+		{Timestamp: ts(7), Value: 8},
+	}, aggregated[Counter])
+
+	require.Empty(t, Aggregate(nil, 5*time.Minute))
+}
+
+func TestRollup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rollup")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	raw, walker := newTestStore(t)
+	rollups, _ := newTestStore(t)
+	metric := model.Metric{model.MetricNameLabel: "foo", "bar": "baz"}
+	day := model.TimeFromUnix(2 * 24 * 3600)
+	users := []string{"user1", "user2"}
+
+	// Three hours of samples, one every 15s, from an hour before the day, in
+	// two chunks; the first starts on the day before.
+	var samples []model.SamplePair
+	for ts := day.Add(-time.Hour); ts.Before(day.Add(2 * time.Hour)); ts = ts.Add(15 * time.Second) {
+		samples = append(samples, model.SamplePair{Timestamp: ts, Value: model.SampleValue(ts)})
+	}
+	half := len(samples) / 2
+	for _, userID := range users {
+		for _, part := range [][]model.SamplePair{samples[:half], samples[half:]} {
+			chunks, err := encode(userID, metric, part, encoding.DoubleDelta)
+			require.NoError(t, err)
+			require.NoError(t, raw.Put(user.InjectOrgID(context.Background(), userID), chunks))
+		}
+	}
+
+	cfg := Config{
+		From:         flagext.NewDayValue(day),
+		Through:      flagext.NewDayValue(day),
+		Resolutions:  Resolutions{5 * time.Minute, time.Hour},
+		Encoding:     encoding.Bigchunk,
+		ProgressFile: filepath.Join(dir, "progress"),
+	}
+
+	getRollup := func(userID string, from model.Time, resolution time.Duration, aggregate string) []model.SamplePair {
+		matchers := []*labels.Matcher{}
+		for name, value := range map[string]string{
+			model.MetricNameLabel: "foo",
+			ResolutionLabel:       model.Duration(resolution).String(),
+			AggregateLabel:        aggregate,
+		} {
+			matcher, err := labels.NewMatcher(labels.MatchEqual, name, value)
+			require.NoError(t, err)
+			matchers = append(matchers, matcher)
+		}
+		chunks, err := rollups.Get(user.InjectOrgID(context.Background(), userID), from, from.Add(24*time.Hour-1), matchers...)
+		require.NoError(t, err)
+		var result []model.SamplePair
+		for _, c := range chunks {
+			require.Equal(t, Metric(metric, resolution, aggregate), c.Metric)
+			s, err := c.Samples(c.From, c.Through)
+			require.NoError(t, err)
+			result = append(result, s...)
+		}
+		return result
+	}
+
+	// A dry run writes nothing.
+	cfg.DryRun = true
+	roller, err := New(cfg, walker, rollups)
+	require.NoError(t, err)
+	require.NoError(t, roller.Run(context.Background()))
+	require.Empty(t, getRollup(users[0], day, time.Hour, Count))
+
+	cfg.DryRun = false
+	roller, err = New(cfg, walker, rollups)
+	require.NoError(t, err)
+	require.NoError(t, roller.Run(context.Background()))
+
+	// Every user's series are rolled up, including the samples on the day of
+	// the chunk starting the day before, but not the day before itself.
+	daySamples := samples[len(samples)/3:]
+	for _, userID := range users {
+		require.Len(t, getRollup(userID, day, 5*time.Minute, Count), 24)
+		counts := getRollup(userID, day, time.Hour, Count)
+		require.Len(t, counts, 2)
+		require.Equal(t, model.SampleValue(240), counts[0].Value)
+		require.Equal(t, Aggregate(daySamples, time.Hour)[Max], getRollup(userID, day, time.Hour, Max))
+		require.Empty(t, getRollup(userID, day.Add(-24*time.Hour), time.Hour, Count))
+	}
+
+	// The progress file stops the days being rolled up again.
+	roller, err = New(cfg, walker, rollups)
+	require.NoError(t, err)
+	for _, userID := range users {
+		require.True(t, roller.progress.Done(userID, day))
+	}
+	require.Equal(t, len(users), roller.progress.Len())
+}
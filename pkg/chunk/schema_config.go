@@ -195,6 +195,14 @@ func (cfg PeriodConfig) createSchema() Schema {
 	return s
 }
 
+// LoadSchemaConfig loads a schema config from a yaml file, for stores other
+// than the one configured by flags.
+func LoadSchemaConfig(fileName string) (SchemaConfig, error) {
+	cfg := SchemaConfig{fileName: fileName}
+	err := cfg.Load()
+	return cfg, err
+}
+
 // Load the yaml file, or build the config from legacy command-line flags
 func (cfg *SchemaConfig) Load() error {
 	if len(cfg.Configs) > 0 {
@@ -444,3 +452,16 @@ func (cfg *PeriodicTableConfig) TableFor(t model.Time) string {
 func (cfg *PeriodicTableConfig) tableForPeriod(i int64) string {
 	return cfg.Prefix + strconv.Itoa(int(i))
 }
+
+// tableNames returns the names of the tables covering [from, through).
+func (cfg *PeriodicTableConfig) tableNames(from, through model.Time) []string {
+	if cfg.Period == 0 {
+		return []string{cfg.Prefix}
+	}
+	periodSecs := int64(cfg.Period / time.Second)
+	var result []string
+	for i := from.Unix() / periodSecs; i*periodSecs < through.Unix(); i++ {
+		result = append(result, cfg.tableForPeriod(i))
+	}
+	return result
+}
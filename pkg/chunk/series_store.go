@@ -18,6 +18,7 @@ import (
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/extract"
 	"github.com/cortexproject/cortex/pkg/util/spanlogger"
+	"github.com/cortexproject/cortex/pkg/util/stats"
 	"github.com/cortexproject/cortex/pkg/util/validation"
 )
 
@@ -112,7 +113,7 @@ func (c *seriesStore) Get(ctx context.Context, from, through model.Time, allMatc
 	}
 
 	// Validate the query is within reasonable bounds.
-	metricName, matchers, shortcut, err := c.validateQuery(ctx, from, &through, allMatchers)
+	metricName, matchers, shortcut, err := c.validateQuery(ctx, &from, &through, allMatchers)
 	if err != nil {
 		return nil, err
 	} else if shortcut {
@@ -143,6 +144,8 @@ func (c *seriesStore) Get(ctx context.Context, from, through model.Time, allMatc
 		level.Error(log).Log("err", "convertChunkIDsToChunks", "err", err)
 		return nil, err
 	}
+	// Don't fetch the same chunk twice.
+	chunks = dedupeChunks(chunks)
 	// Filter out chunks that are not in the selected time range.
 	filtered, keys := filterChunksByTime(from, through, chunks)
 	level.Debug(log).Log("chunks-post-filtering", len(chunks))
@@ -165,9 +168,29 @@ func (c *seriesStore) Get(ctx context.Context, from, through model.Time, allMatc
 
 	// Filter out chunks based on the empty matchers in the query.
 	filteredChunks := filterChunksByMatchers(allChunks, allMatchers)
+	stats.FromContext(ctx).AddStoreSeries(len(seriesIDs), len(filteredChunks))
 	return filteredChunks, nil
 }
 
+// GetChunkRefs implements Store
+func (c *seriesStore) GetChunkRefs(ctx context.Context, from, through model.Time, metric model.Metric) ([]Chunk, error) {
+	userID, err := user.ExtractOrgID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	chunkIDs, err := c.lookupChunksBySeries(ctx, from, through, []string{metricSeriesID(metric)})
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := c.convertChunkIDsToChunks(ctx, userID, chunkIDs)
+	if err != nil {
+		return nil, err
+	}
+	filtered, _ := filterChunksByTime(from, through, dedupeChunks(chunks))
+	return filtered, nil
+}
+
 func (c *seriesStore) lookupSeriesByMetricNameMatchers(ctx context.Context, from, through model.Time, metricName string, matchers []*labels.Matcher) ([]string, error) {
 	log, ctx := spanlogger.New(ctx, "SeriesStore.lookupSeriesByMetricNameMatchers", "metricName", metricName, "matchers", len(matchers))
 	defer log.Span.Finish()
@@ -349,6 +372,26 @@ func (c *seriesStore) PutOne(ctx context.Context, from, through model.Time, chun
 	return nil
 }
 
+// DeleteChunk implements Store.  It deletes the chunk's index entries between
+// from and through, then the chunk itself.  The series' label entries are
+// kept, as they are shared with its other chunks.
+func (c *seriesStore) DeleteChunk(ctx context.Context, from, through model.Time, chunk Chunk) error {
+	metricName, err := extract.MetricNameFromMetric(chunk.Metric)
+	if err != nil {
+		return err
+	}
+
+	entries, err := c.schema.GetChunkWriteEntries(from, through, chunk.UserID, metricName, chunk.Metric, chunk.ExternalKey())
+	if err != nil {
+		return err
+	}
+
+	if err := deleteIndexEntries(ctx, c.index, entries); err != nil {
+		return err
+	}
+	return c.storage.DeleteChunk(ctx, chunk.ExternalKey())
+}
+
 // calculateIndexEntries creates a set of batched WriteRequests for all the chunks it is given.
 func (c *seriesStore) calculateIndexEntries(from, through model.Time, chunk Chunk) (WriteBatch, []string, error) {
 	seenIndexEntries := map[string]struct{}{}
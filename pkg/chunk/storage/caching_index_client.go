@@ -16,6 +16,7 @@ import (
 	chunk_util "github.com/cortexproject/cortex/pkg/chunk/util"
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/spanlogger"
+	"github.com/cortexproject/cortex/pkg/util/stats"
 	"github.com/cortexproject/cortex/pkg/util/validation"
 )
 
@@ -86,6 +87,7 @@ func (s *cachingIndexClient) QueryPages(ctx context.Context, queries []chunk.Ind
 	}
 
 	batches, misses := s.cacheFetch(ctx, keys)
+	stats.FromContext(ctx).AddIndexQueries(len(queries), len(queries)-len(misses))
 	for _, batch := range batches {
 		if cardinalityLimit > 0 && batch.Cardinality > cardinalityLimit {
 			return chunk.CardinalityExceededError{
@@ -31,6 +31,8 @@ type Config struct {
 	IndexCacheValidity time.Duration
 
 	IndexQueriesCacheConfig cache.Config `yaml:"index_queries_cache_config,omitempty"`
+
+	CacheGenerations cache.GenerationsConfig `yaml:"cache_generations,omitempty"`
 }
 
 // RegisterFlags adds the flags required to configure this flag set.
@@ -44,10 +46,19 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 
 	cfg.IndexQueriesCacheConfig.RegisterFlagsWithPrefix("store.index-cache-read.", "Cache config for index entry reading. ", f)
 	f.DurationVar(&cfg.IndexCacheValidity, "store.index-cache-validity", 5*time.Minute, "Cache validity for active index entries. Should be no higher than -ingester.max-chunk-idle.")
+	cfg.CacheGenerations.RegisterFlags(f)
 }
 
 // NewStore makes the storage clients based on the configuration.
 func NewStore(cfg Config, storeCfg chunk.StoreConfig, schemaCfg chunk.SchemaConfig, limits *validation.Overrides) (chunk.Store, error) {
+	generations, err := cache.NewGenerations(cfg.CacheGenerations)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating cache generations")
+	}
+	cfg.IndexQueriesCacheConfig.Generations = generations
+	storeCfg.ChunkCacheConfig.Generations = generations
+	storeCfg.WriteDedupeCacheConfig.Generations = generations
+
 	tieredCache, err := cache.New(cfg.IndexQueriesCacheConfig)
 	if err != nil {
 		return nil, err
@@ -151,6 +162,56 @@ func NewObjectClient(name string, cfg Config, schemaCfg chunk.SchemaConfig) (chu
 	}
 }
 
+// NewRetentionSweeper makes a chunk.RetentionSweeper for the index and
+// object stores used by the schema.
+func NewRetentionSweeper(cfg Config, tbmCfg chunk.TableManagerConfig, schemaCfg chunk.SchemaConfig, limits *validation.Overrides) (*chunk.RetentionSweeper, error) {
+	indexClients, objectClients, err := NewClients(cfg, schemaCfg)
+	if err != nil {
+		return nil, err
+	}
+	return chunk.NewRetentionSweeper(tbmCfg, schemaCfg, objectClients, indexClients, limits), nil
+}
+
+// NewIndexWalker makes a chunk.IndexWalker for the index and object stores
+// used by the schema.
+func NewIndexWalker(cfg Config, schemaCfg chunk.SchemaConfig, rateLimit float64) (*chunk.IndexWalker, error) {
+	indexClients, objectClients, err := NewClients(cfg, schemaCfg)
+	if err != nil {
+		return nil, err
+	}
+	return chunk.NewIndexWalker(schemaCfg, indexClients, objectClients, rateLimit)
+}
+
+// NewClients makes an uncached client for each of the index and object store
+// types used by the schema, keyed by type.
+func NewClients(cfg Config, schemaCfg chunk.SchemaConfig) (map[string]chunk.IndexClient, map[string]chunk.ObjectClient, error) {
+	indexClients := map[string]chunk.IndexClient{}
+	objectClients := map[string]chunk.ObjectClient{}
+	for _, s := range schemaCfg.Configs {
+		if _, ok := indexClients[s.IndexType]; !ok {
+			client, err := NewIndexClient(s.IndexType, cfg, schemaCfg)
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "error creating index client")
+			}
+			indexClients[s.IndexType] = client
+		}
+
+		objectStoreType := s.ObjectType
+		if objectStoreType == "" {
+			objectStoreType = s.IndexType
+		}
+		if _, ok := objectClients[objectStoreType]; ok {
+			continue
+		}
+		client, err := NewObjectClient(objectStoreType, cfg, schemaCfg)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "error creating object client")
+		}
+		objectClients[objectStoreType] = client
+	}
+	return indexClients, objectClients, nil
+}
+
 // NewTableClient makes a new table client based on the configuration.
 func NewTableClient(name string, cfg Config) (chunk.TableClient, error) {
 	switch name {
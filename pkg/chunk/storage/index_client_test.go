@@ -2,6 +2,7 @@ package storage
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"testing"
 	"time"
@@ -48,6 +49,99 @@ func TestIndexBasic(t *testing.T) {
 	})
 }
 
+func TestIndexDeleteAndScan(t *testing.T) {
+	forAllFixtures(t, func(t *testing.T, client chunk.IndexClient, _ chunk.ObjectClient) {
+		batch := client.NewWriteBatch()
+		for i := 0; i < 10; i++ {
+			batch.Add(tableName, fmt.Sprintf("hash%d", i%2), []byte(fmt.Sprintf("range%d", i)), nil)
+		}
+		require.NoError(t, client.BatchWrite(ctx, batch))
+
+		// Delete every other entry; hash1 is left empty.
+		batch = client.NewWriteBatch()
+		for i := 1; i < 10; i += 2 {
+			batch.Delete(tableName, "hash1", []byte(fmt.Sprintf("range%d", i)))
+		}
+		require.NoError(t, client.BatchWrite(ctx, batch))
+
+		for i := 0; i < 2; i++ {
+			var have []string
+			err := client.QueryPages(ctx, []chunk.IndexQuery{{
+				TableName: tableName,
+				HashValue: fmt.Sprintf("hash%d", i),
+			}}, func(_ chunk.IndexQuery, read chunk.ReadBatch) bool {
+				iter := read.Iterator()
+				for iter.Next() {
+					have = append(have, string(iter.RangeValue()))
+				}
+				return true
+			})
+			require.NoError(t, err)
+			if i == 0 {
+				require.Equal(t, []string{"range0", "range2", "range4", "range6", "range8"}, have)
+			} else {
+				require.Empty(t, have)
+			}
+		}
+
+		scanner, ok := client.(chunk.IndexScanner)
+		if !ok {
+			return
+		}
+		var scanned []string
+		require.NoError(t, scanner.ScanTable(ctx, tableName, func(hashValue string, rangeValue []byte) error {
+			scanned = append(scanned, hashValue+":"+string(rangeValue))
+			return nil
+		}))
+		sort.Strings(scanned)
+		require.Equal(t, []string{"hash0:range0", "hash0:range2", "hash0:range4", "hash0:range6", "hash0:range8"}, scanned)
+	})
+}
+
+func TestIndexPurge(t *testing.T) {
+	forAllFixtures(t, func(t *testing.T, client chunk.IndexClient, _ chunk.ObjectClient) {
+		// Enough entries to purge them in several batches.
+		batch := client.NewWriteBatch()
+		for i := 0; i < 300; i++ {
+			batch.Add(tableName, fmt.Sprintf("hash%d", i%3), []byte(fmt.Sprintf("range%03d", i)), nil)
+		}
+		require.NoError(t, client.BatchWrite(ctx, batch))
+
+		// Purge all of hash1, and the odd entries of hash0.
+		err := chunk.PurgeEntries(ctx, client, tableName, func(hashValue string, rangeValue []byte) bool {
+			if hashValue == "hash1" {
+				return true
+			}
+			i, err := strconv.Atoi(string(rangeValue[len("range"):]))
+			require.NoError(t, err)
+			return hashValue == "hash0" && i%2 == 1
+		})
+		_, isPurger := client.(chunk.IndexPurger)
+		_, isScanner := client.(chunk.IndexScanner)
+		if !isPurger && !isScanner {
+			require.Error(t, err)
+			return
+		}
+		require.NoError(t, err)
+
+		for i, want := range []int{50, 0, 100} {
+			var have []string
+			err := client.QueryPages(ctx, []chunk.IndexQuery{{
+				TableName: tableName,
+				HashValue: fmt.Sprintf("hash%d", i),
+			}}, func(_ chunk.IndexQuery, read chunk.ReadBatch) bool {
+				iter := read.Iterator()
+				for iter.Next() {
+					have = append(have, string(iter.RangeValue()))
+				}
+				return true
+			})
+			require.NoError(t, err)
+			require.Len(t, have, want, "hash%d", i)
+		}
+	})
+}
+
 var entries = []chunk.IndexEntry{
 	{
 		TableName:  tableName,
@@ -58,3 +58,46 @@ func TestChunksBasic(t *testing.T) {
 		}
 	})
 }
+
+func TestChunksDelete(t *testing.T) {
+	forAllFixtures(t, func(t *testing.T, _ chunk.IndexClient, client chunk.ObjectClient) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+
+		keys, chunks, err := testutils.CreateChunks(0, 10, model.Now())
+		require.NoError(t, err)
+		require.NoError(t, client.PutChunks(ctx, chunks))
+
+		// Delete every other chunk, and one which doesn't exist.
+		for i := 0; i < len(keys); i += 2 {
+			require.NoError(t, client.DeleteChunk(ctx, keys[i]))
+		}
+		require.NoError(t, client.DeleteChunk(ctx, keys[0]))
+
+		for i := range chunks {
+			got, err := client.GetChunks(ctx, chunks[i:i+1])
+			if i%2 == 0 {
+				require.True(t, err != nil || len(got) == 0, keys[i])
+			} else {
+				require.NoError(t, err)
+				require.Len(t, got, 1)
+			}
+		}
+
+		lister, ok := client.(chunk.ChunkLister)
+		if !ok {
+			return
+		}
+		listed := map[string]struct{}{}
+		require.NoError(t, lister.ListChunks(ctx, func(chunkIDs []string) error {
+			for _, chunkID := range chunkIDs {
+				listed[chunkID] = struct{}{}
+			}
+			return nil
+		}))
+		for i, key := range keys {
+			_, ok := listed[key]
+			require.Equal(t, i%2 == 1, ok, key)
+		}
+	})
+}
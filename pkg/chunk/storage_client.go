@@ -14,17 +14,47 @@ type IndexClient interface {
 	QueryPages(ctx context.Context, queries []IndexQuery, callback func(IndexQuery, ReadBatch) (shouldContinue bool)) error
 }
 
+// IndexPurger is implemented by IndexClients which can scan whole tables, so
+// entries can be deleted before their table is dropped.
+type IndexPurger interface {
+	// PurgeEntries deletes the entries in tableName for which purge returns
+	// true.
+	PurgeEntries(ctx context.Context, tableName string, purge func(hashValue string, rangeValue []byte) bool) error
+}
+
+// IndexScanner is implemented by IndexClients which can read whole tables,
+// so tools can walk the index without knowing the users or metrics in it.
+type IndexScanner interface {
+	// ScanTable calls callback with every entry in tableName, until it
+	// returns an error.
+	ScanTable(ctx context.Context, tableName string, callback func(hashValue string, rangeValue []byte) error) error
+}
+
 // ObjectClient is for storing and retrieving chunks.
 type ObjectClient interface {
 	Stop()
 
 	PutChunks(ctx context.Context, chunks []Chunk) error
 	GetChunks(ctx context.Context, chunks []Chunk) ([]Chunk, error)
+
+	// DeleteChunk deletes the chunk with the given external key; deleting a
+	// chunk which doesn't exist is not an error.
+	DeleteChunk(ctx context.Context, chunkID string) error
+}
+
+// ChunkLister is implemented by ObjectClients which store chunks outside of
+// periodic tables (e.g. S3 or GCS), and so need them deleted one by one to
+// enforce retention.
+type ChunkLister interface {
+	// ListChunks calls callback with the IDs of all stored chunks, in
+	// batches, until it returns an error.
+	ListChunks(ctx context.Context, callback func(chunkIDs []string) error) error
 }
 
 // WriteBatch represents a batch of writes.
 type WriteBatch interface {
 	Add(tableName, hashValue string, rangeValue []byte, value []byte)
+	Delete(tableName, hashValue string, rangeValue []byte)
 }
 
 // ReadBatch represents the results of a QueryPages.
@@ -1,6 +1,9 @@
 package chunk
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // TableClient is a client for telling Dynamo what to do with tables.
 type TableClient interface {
@@ -20,6 +23,29 @@ type TableDesc struct {
 	Tags              Tags
 	WriteScale        AutoScalingConfig
 	ReadScale         AutoScalingConfig
+
+	// MaxAge is how long data is kept before it is garbage collected, by the
+	// stores which support it; 0 to keep it until the table is deleted.
+	MaxAge time.Duration
+
+	// SizeBytes is the approximate size of the table, as reported by
+	// DescribeTable for the stores which support it.  It is not compared by
+	// Equals.
+	SizeBytes int64
+}
+
+// TableSettingsClient is implemented by TableClients which manage settings of
+// their own, which TableDesc doesn't describe, with UpdateTable.
+type TableSettingsClient interface {
+	// NeedsUpdate returns whether the table's own settings need updating,
+	// even if its TableDesc is as expected.
+	NeedsUpdate(ctx context.Context, name string) (bool, error)
+}
+
+// MaxAgeTableClient is implemented by TableClients which can garbage collect
+// data past a table's MaxAge, and so return it from DescribeTable.
+type MaxAgeTableClient interface {
+	SupportsMaxAge() bool
 }
 
 // Equals returns true if other matches desc.
@@ -51,6 +77,11 @@ func (desc TableDesc) Equals(other TableDesc) bool {
 		return false
 	}
 
+	// Only ever set by the TableManager for MaxAgeTableClients.
+	if desc.MaxAge != other.MaxAge {
+		return false
+	}
+
 	return true
 }
 
@@ -35,10 +35,15 @@ var (
 		Name:      "dynamo_table_capacity_units",
 		Help:      "Per-table DynamoDB capacity, measured in DynamoDB capacity units.",
 	}, []string{"op", "table"})
+	tableSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "cortex",
+		Name:      "table_size_bytes",
+		Help:      "Approximate size of each table, for stores which report it.",
+	}, []string{"table"})
 )
 
 func init() {
-	prometheus.MustRegister(tableCapacity)
+	prometheus.MustRegister(tableCapacity, tableSize)
 	syncTableDuration.Register()
 }
 
@@ -53,6 +58,12 @@ type TableManagerConfig struct {
 	// How far back tables will be kept before they are deleted
 	RetentionPeriod time.Duration
 
+	// Set the retention period as the garbage collection age of tables.
+	RetentionGCEnabled bool
+
+	// Period with which chunks past retention are deleted from object stores.
+	ChunkSweepPeriod time.Duration
+
 	// Period with which the table manager will poll for tables.
 	DynamoDBPollInterval time.Duration
 
@@ -85,6 +96,8 @@ func (cfg *TableManagerConfig) RegisterFlags(f *flag.FlagSet) {
 	f.BoolVar(&cfg.ThroughputUpdatesDisabled, "table-manager.throughput-updates-disabled", false, "If true, disable all changes to DB capacity")
 	f.BoolVar(&cfg.RetentionDeletesEnabled, "table-manager.retention-deletes-enabled", false, "If true, enables retention deletes of DB tables")
 	f.DurationVar(&cfg.RetentionPeriod, "table-manager.retention-period", 0, "Tables older than this retention period are deleted. Note: This setting is destructive to data!(default: 0, which disables deletion)")
+	f.BoolVar(&cfg.RetentionGCEnabled, "table-manager.retention-gc-enabled", false, "If true, sets -table-manager.retention-period as the max age of data in each table, after which it is garbage collected by stores which support it (Bigtable, which requires -bigtable.cell-timestamps, and Cassandra, as the tables' default TTL).")
+	f.DurationVar(&cfg.ChunkSweepPeriod, "table-manager.chunk-sweep-period", 0, "How often to delete chunks past their retention period from object stores (S3, GCS, filesystem), which aren't deleted with their tables, and index entries past their tenant's retention period from tables which haven't been deleted yet. Requires -table-manager.retention-deletes-enabled. 0 to disable.")
 	f.DurationVar(&cfg.DynamoDBPollInterval, "dynamodb.poll-interval", 2*time.Minute, "How frequently to poll DynamoDB to learn our capacity.")
 	f.DurationVar(&cfg.CreationGracePeriod, "dynamodb.periodic-table.grace-period", 10*time.Minute, "DynamoDB periodic tables grace period (duration which table will be created/deleted before/after it's needed).")
 
@@ -122,6 +135,9 @@ type TableManager struct {
 
 // NewTableManager makes a new TableManager
 func NewTableManager(cfg TableManagerConfig, schemaCfg SchemaConfig, maxChunkAge time.Duration, tableClient TableClient) (*TableManager, error) {
+	if client, ok := tableClient.(MaxAgeTableClient); cfg.RetentionGCEnabled && (!ok || !client.SupportsMaxAge()) {
+		return nil, fmt.Errorf("table client doesn't support -table-manager.retention-gc-enabled")
+	}
 	return &TableManager{
 		cfg:         cfg,
 		schemaCfg:   schemaCfg,
@@ -257,6 +273,12 @@ func (m *TableManager) calculateExpectedTables() []TableDesc {
 		}
 	}
 
+	if m.cfg.RetentionGCEnabled {
+		for i := range result {
+			result[i].MaxAge = m.cfg.RetentionPeriod
+		}
+	}
+
 	sort.Sort(byName(result))
 	return result
 }
@@ -351,6 +373,9 @@ func (m *TableManager) updateTables(ctx context.Context, descriptions []TableDes
 
 		tableCapacity.WithLabelValues(readLabel, expected.Name).Set(float64(current.ProvisionedRead))
 		tableCapacity.WithLabelValues(writeLabel, expected.Name).Set(float64(current.ProvisionedWrite))
+		if current.SizeBytes > 0 {
+			tableSize.WithLabelValues(expected.Name).Set(float64(current.SizeBytes))
+		}
 
 		if m.cfg.ThroughputUpdatesDisabled {
 			continue
@@ -362,8 +387,16 @@ func (m *TableManager) updateTables(ctx context.Context, descriptions []TableDes
 		}
 
 		if expected.Equals(current) {
-			level.Info(util.Logger).Log("msg", "provisioned throughput on table, skipping", "table", current.Name, "read", current.ProvisionedRead, "write", current.ProvisionedWrite)
-			continue
+			needsUpdate := false
+			if client, ok := m.client.(TableSettingsClient); ok {
+				if needsUpdate, err = client.NeedsUpdate(ctx, expected.Name); err != nil {
+					return err
+				}
+			}
+			if !needsUpdate {
+				level.Info(util.Logger).Log("msg", "provisioned throughput on table, skipping", "table", current.Name, "read", current.ProvisionedRead, "write", current.ProvisionedWrite)
+				continue
+			}
 		}
 
 		err = m.client.UpdateTable(ctx, current, expected)
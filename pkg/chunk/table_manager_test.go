@@ -93,6 +93,10 @@ func (m *mockTableClient) UpdateTable(_ context.Context, current, expected Table
 	return nil
 }
 
+func (m *mockTableClient) SupportsMaxAge() bool {
+	return true
+}
+
 func tmTest(t *testing.T, client *mockTableClient, tableManager *TableManager, name string, tm time.Time, expected []TableDesc) {
 	t.Run(name, func(t *testing.T) {
 		ctx := context.Background()
@@ -692,3 +696,92 @@ func TestTableManagerRetentionOnly(t *testing.T) {
 		},
 	)
 }
+
+func TestTableManagerRetentionGC(t *testing.T) {
+	client := newMockTableClient()
+
+	cfg := SchemaConfig{
+		Configs: []PeriodConfig{
+			{
+				From: model.TimeFromUnix(baseTableStart.Unix()),
+				IndexTables: PeriodicTableConfig{
+					Prefix: tablePrefix,
+					Period: tablePeriod,
+				},
+			},
+		},
+	}
+	tbmConfig := TableManagerConfig{
+		RetentionPeriod:     tableRetention,
+		CreationGracePeriod: gracePeriod,
+		IndexTables: ProvisionConfig{
+			ProvisionedWriteThroughput: write,
+			ProvisionedReadThroughput:  read,
+			InactiveWriteThroughput:    inactiveWrite,
+			InactiveReadThroughput:     inactiveRead,
+		},
+	}
+	tableManager, err := NewTableManager(tbmConfig, cfg, maxChunkAge, client)
+	require.NoError(t, err)
+
+	// Clients which can't garbage collect by age are rejected.
+	tbmConfig.RetentionGCEnabled = true
+	_, err = NewTableManager(tbmConfig, cfg, maxChunkAge, NewMockStorage())
+	require.Error(t, err)
+
+	tmTest(t, client, tableManager,
+		"Without GC",
+		baseTableStart,
+		[]TableDesc{
+			{Name: tablePrefix + "0", ProvisionedRead: read, ProvisionedWrite: write},
+		},
+	)
+
+	// Existing tables are updated with the retention as their max age.
+	tableManager.cfg.RetentionGCEnabled = true
+	tmTest(t, client, tableManager,
+		"With GC",
+		baseTableStart.Add(tablePeriod),
+		[]TableDesc{
+			{Name: tablePrefix + "0", ProvisionedRead: read, ProvisionedWrite: write, MaxAge: tableRetention},
+			{Name: tablePrefix + "1", ProvisionedRead: read, ProvisionedWrite: write, MaxAge: tableRetention},
+		},
+	)
+}
+
+type mockSettingsTableClient struct {
+	*mockTableClient
+	needsUpdate bool
+	updates     int
+}
+
+func (m *mockSettingsTableClient) NeedsUpdate(_ context.Context, _ string) (bool, error) {
+	return m.needsUpdate, nil
+}
+
+func (m *mockSettingsTableClient) UpdateTable(ctx context.Context, current, expected TableDesc) error {
+	m.updates++
+	return m.mockTableClient.UpdateTable(ctx, current, expected)
+}
+
+func TestTableManagerSettingsUpdates(t *testing.T) {
+	client := &mockSettingsTableClient{mockTableClient: newMockTableClient()}
+	cfg := SchemaConfig{
+		Configs: []PeriodConfig{{
+			From:        model.TimeFromUnix(baseTableStart.Unix()),
+			IndexTables: PeriodicTableConfig{Prefix: baseTableName},
+		}},
+	}
+	tableManager, err := NewTableManager(TableManagerConfig{}, cfg, maxChunkAge, client)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, tableManager.SyncTables(ctx))
+	require.Equal(t, 0, client.updates)
+
+	// Tables whose own settings are stale are updated, even if their
+	// descriptions match.
+	client.needsUpdate = true
+	require.NoError(t, tableManager.SyncTables(ctx))
+	require.Equal(t, 1, client.updates)
+}
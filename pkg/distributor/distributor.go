@@ -3,10 +3,8 @@ package distributor
 import (
 	"context"
 	"flag"
-	"fmt"
 	"net/http"
 	"sort"
-	"strings"
 	"sync"
 	"time"
 
@@ -185,36 +183,7 @@ func (d *Distributor) Stop() {
 }
 
 func (d *Distributor) tokenForLabels(userID string, labels []client.LabelAdapter) (uint32, error) {
-	if d.cfg.ShardByAllLabels {
-		return shardByAllLabels(userID, labels)
-	}
-
-	metricName, err := extract.MetricNameFromLabelAdapters(labels)
-	if err != nil {
-		return 0, err
-	}
-	return shardByMetricName(userID, metricName), nil
-}
-
-func shardByMetricName(userID string, metricName string) uint32 {
-	h := client.HashNew32()
-	h = client.HashAdd32(h, userID)
-	h = client.HashAdd32(h, metricName)
-	return h
-}
-
-func shardByAllLabels(userID string, labels []client.LabelAdapter) (uint32, error) {
-	h := client.HashNew32()
-	h = client.HashAdd32(h, userID)
-	var lastLabelName string
-	for _, label := range labels {
-		if strings.Compare(lastLabelName, label.Name) >= 0 {
-			return 0, fmt.Errorf("Labels not sorted")
-		}
-		h = client.HashAdd32(h, label.Name)
-		h = client.HashAdd32(h, label.Value)
-	}
-	return h, nil
+	return client.TokenForLabels(userID, labels, d.cfg.ShardByAllLabels)
 }
 
 // Push implements client.IngesterServer
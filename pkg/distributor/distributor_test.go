@@ -416,7 +416,7 @@ func (i *mockIngester) Push(ctx context.Context, req *client.WriteRequest, opts
 	}
 
 	for j := range req.Timeseries {
-		hash, _ := shardByAllLabels(orgid, req.Timeseries[j].Labels)
+		hash, _ := client.ShardByAllLabels(orgid, req.Timeseries[j].Labels)
 		existing, ok := i.timeseries[hash]
 		if !ok {
 			i.timeseries[hash] = &req.Timeseries[j]
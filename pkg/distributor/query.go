@@ -13,6 +13,7 @@ import (
 	"github.com/cortexproject/cortex/pkg/ring"
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/extract"
+	"github.com/cortexproject/cortex/pkg/util/stats"
 	"github.com/weaveworks/common/instrument"
 	"github.com/weaveworks/common/user"
 )
@@ -68,7 +69,7 @@ func (d *Distributor) queryPrep(ctx context.Context, from, to model.Time, matche
 	// Get ingesters by metricName if one exists, otherwise get all ingesters
 	metricNameMatcher, _, ok := extract.MetricNameMatcherFromMatchers(matchers)
 	if !d.cfg.ShardByAllLabels && ok && metricNameMatcher.Type == labels.MatchEqual {
-		replicationSet, err = d.ring.Get(shardByMetricName(userID, metricNameMatcher.Value), ring.Read)
+		replicationSet, err = d.ring.Get(client.ShardByMetricName(userID, metricNameMatcher.Value), ring.Read)
 	} else {
 		replicationSet, err = d.ring.GetAll()
 	}
@@ -118,6 +119,14 @@ func (d *Distributor) queryIngesters(ctx context.Context, replicationSet ring.Re
 		result = append(result, ss)
 	}
 
+	series, samples := 0, 0
+	for _, r := range results {
+		for _, ss := range r.(model.Matrix) {
+			series++
+			samples += len(ss.Values)
+		}
+	}
+	stats.FromContext(ctx).AddIngesterSeries(series, samples, 0)
 	return result, nil
 }
 
@@ -155,9 +164,12 @@ func (d *Distributor) queryIngesterStream(ctx context.Context, replicationSet ri
 	}
 
 	hashToSeries := map[model.Fingerprint]ingester_client.TimeSeriesChunk{}
+	seriesCount, chunkCount := 0, 0
 	for _, result := range results {
 		for _, response := range result.([]*ingester_client.QueryStreamResponse) {
 			for _, series := range response.Timeseries {
+				seriesCount++
+				chunkCount += len(series.Chunks)
 				hash := client.FastFingerprint(series.Labels)
 				existing := hashToSeries[hash]
 				existing.Labels = series.Labels
@@ -171,5 +183,6 @@ func (d *Distributor) queryIngesterStream(ctx context.Context, replicationSet ri
 		result = append(result, series)
 	}
 
+	stats.FromContext(ctx).AddIngesterSeries(seriesCount, 0, chunkCount)
 	return result, nil
 }
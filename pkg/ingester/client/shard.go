@@ -0,0 +1,48 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// TokenForLabels returns the ring token of a series: the hash of its user and
+// metric name or, if shardByAllLabels is set, of its user and all its labels.
+// Distributors and ingesters must agree on shardByAllLabels.
+func TokenForLabels(userID string, labels []LabelAdapter, shardByAllLabels bool) (uint32, error) {
+	if shardByAllLabels {
+		return ShardByAllLabels(userID, labels)
+	}
+
+	for _, label := range labels {
+		if label.Name == model.MetricNameLabel {
+			return ShardByMetricName(userID, label.Value), nil
+		}
+	}
+	return 0, fmt.Errorf("No metric name label")
+}
+
+// ShardByMetricName returns the token for a user's metric name.
+func ShardByMetricName(userID string, metricName string) uint32 {
+	h := HashNew32()
+	h = HashAdd32(h, userID)
+	h = HashAdd32(h, metricName)
+	return h
+}
+
+// ShardByAllLabels returns the token for a user's series.  The labels must be
+// sorted.
+func ShardByAllLabels(userID string, labels []LabelAdapter) (uint32, error) {
+	h := HashNew32()
+	h = HashAdd32(h, userID)
+	var lastLabelName string
+	for _, label := range labels {
+		if strings.Compare(lastLabelName, label.Name) >= 0 {
+			return 0, fmt.Errorf("Labels not sorted")
+		}
+		h = HashAdd32(h, label.Name)
+		h = HashAdd32(h, label.Value)
+	}
+	return h, nil
+}
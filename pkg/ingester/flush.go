@@ -12,9 +12,11 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
 
 	"github.com/cortexproject/cortex/pkg/chunk"
 	"github.com/cortexproject/cortex/pkg/ingester/client"
+	"github.com/cortexproject/cortex/pkg/ring"
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/weaveworks/common/user"
 )
@@ -60,6 +62,14 @@ var (
 		Name: "cortex_ingester_memory_chunks",
 		Help: "The total number of chunks in memory.",
 	})
+	chunksNotOwned = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "cortex_ingester_chunks_not_flushed_not_owner_total",
+		Help: "Total chunks not flushed because another replica of their series flushed them.",
+	})
+	chunksOwnerNotFlushed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "cortex_ingester_chunks_flushed_owner_missing_total",
+		Help: "Total chunks flushed by a replica not owning their series, as the owner's chunks didn't cover them within the grace period.",
+	})
 	flushReasons = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "cortex_ingester_flush_reasons",
 		Help: "Total number of series scheduled for flushing, with reasons.",
@@ -267,6 +277,26 @@ func (i *Ingester) flushUserSeries(flushQueueIndex int, userID string, fp model.
 		return nil
 	}
 
+	// Only the owner of a series flushes it, unless we're leaving, as we may
+	// own the series once we've gone.  The other replicas keep their chunks
+	// until they find the owner's in the store, and flush them themselves if
+	// they still haven't after the grace period.
+	if !immediate && i.cfg.FlushOwnerOnly && !i.ownsSeries(userID, series.metric) {
+		flushed, err := i.ownerFlushed(userID, series.metric, chunks)
+		if err != nil {
+			level.Warn(util.WithUserID(userID, util.Logger)).Log("msg", "failed to check whether series owner flushed chunks", "err", err)
+		}
+		if flushed {
+			chunksNotOwned.Add(float64(len(chunks)))
+			i.markChunksFlushed(userState, fp, series, len(chunks))
+			return nil
+		}
+		if model.Now().Sub(chunks[len(chunks)-1].LastUpdate) < i.cfg.FlushOwnerGracePeriod {
+			return nil
+		}
+		chunksOwnerNotFlushed.Add(float64(len(chunks)))
+	}
+
 	// flush the chunks without locking the series, as we don't want to hold the series lock for the duration of the dynamo/s3 rpcs.
 	ctx := user.InjectOrgID(context.Background(), userID)
 	ctx, cancel := context.WithTimeout(ctx, i.cfg.FlushOpTimeout)
@@ -282,21 +312,95 @@ func (i *Ingester) flushUserSeries(flushQueueIndex int, userID string, fp model.
 		return err
 	}
 
-	userState.fpLocker.Lock(fp)
 	if immediate {
+		userState.fpLocker.Lock(fp)
 		userState.removeSeries(fp, series.metric)
 		memoryChunks.Sub(float64(len(chunks)))
+		userState.fpLocker.Unlock(fp)
 	} else {
-		for i := 0; i < len(chunks); i++ {
-			// mark the chunks as flushed, so we can remove them after the retention period
-			series.chunkDescs[i].flushed = true
-			series.chunkDescs[i].LastUpdate = model.Now()
-		}
+		i.markChunksFlushed(userState, fp, series, len(chunks))
 	}
-	userState.fpLocker.Unlock(fp)
 	return nil
 }
 
+// markChunksFlushed marks the first n chunks of a series as flushed, so they
+// are removed after the retention period.
+func (i *Ingester) markChunksFlushed(userState *userState, fp model.Fingerprint, series *memorySeries, n int) {
+	userState.fpLocker.Lock(fp)
+	defer userState.fpLocker.Unlock(fp)
+	for j := 0; j < n; j++ {
+		series.chunkDescs[j].flushed = true
+		series.chunkDescs[j].LastUpdate = model.Now()
+	}
+}
+
+// ownsSeries returns whether we're the first healthy ingester in a series'
+// replica set, which flushes it when only owners flush.  If the owner can't be
+// found, we assume it's us, so the series is flushed.
+func (i *Ingester) ownsSeries(userID string, metric labels.Labels) bool {
+	token, err := client.TokenForLabels(userID, client.FromLabelsToLabelAdapaters(metric), i.cfg.ShardByAllLabels)
+	if err != nil {
+		return true
+	}
+	rs, err := i.ring.Get(token, ring.Write)
+	if err != nil || len(rs.Ingesters) == 0 {
+		return true
+	}
+	return rs.Ingesters[0].Addr == i.lifecycler.Addr()
+}
+
+// chunkRefGetter is implemented by chunk stores which can look chunks up in
+// their index, so replicas not owning a series can check its owner has flushed
+// it.
+type chunkRefGetter interface {
+	GetChunkRefs(ctx context.Context, from, through model.Time, metric model.Metric) ([]chunk.Chunk, error)
+}
+
+// ownerFlushed returns whether every sample in chunkDescs is within the time
+// range of a chunk of the series in the store's index, i.e. whether the
+// series' owner has flushed them.  A sample the owner missed, but whose time
+// its chunks cover, can't be told apart, so is lost.  Stores which can't be
+// looked up never confirm a flush.
+func (i *Ingester) ownerFlushed(userID string, metric labels.Labels, chunkDescs []*desc) (bool, error) {
+	getter, ok := i.chunkStore.(chunkRefGetter)
+	if !ok {
+		return false, nil
+	}
+
+	ctx := user.InjectOrgID(context.Background(), userID)
+	ctx, cancel := context.WithTimeout(ctx, i.cfg.FlushOpTimeout)
+	defer cancel()
+	from, through := chunkDescs[0].FirstTime, chunkDescs[len(chunkDescs)-1].LastTime
+	m := client.FromLabelAdaptersToMetric(client.FromLabelsToLabelAdapaters(metric))
+	owned, err := getter.GetChunkRefs(ctx, from, through, m)
+	if err != nil {
+		return false, err
+	}
+
+	for _, chunkDesc := range chunkDescs {
+		it := chunkDesc.C.NewIterator()
+		for it.Scan() {
+			if !chunksContain(owned, it.Value().Timestamp) {
+				return false, nil
+			}
+		}
+		if err := it.Err(); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// chunksContain returns whether t is within the time range of any of chunks.
+func chunksContain(chunks []chunk.Chunk, t model.Time) bool {
+	for _, c := range chunks {
+		if c.From <= t && t <= c.Through {
+			return true
+		}
+	}
+	return false
+}
+
 // must be called under fpLocker lock
 func (i *Ingester) removeFlushedChunks(userState *userState, fp model.Fingerprint, series *memorySeries) {
 	now := model.Now()
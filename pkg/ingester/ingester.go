@@ -81,7 +81,13 @@ type Config struct {
 	LifecyclerConfig ring.LifecyclerConfig
 
 	// Config for transferring chunks.
-	MaxTransferRetries int
+	MaxTransferRetries  int
+	HandoverOnScaleDown bool
+	ShardByAllLabels    bool
+
+	// Config for flushing only one replica of each series.
+	FlushOwnerOnly        bool
+	FlushOwnerGracePeriod time.Duration
 
 	// Config for chunk flushing.
 	FlushCheckPeriod  time.Duration
@@ -103,6 +109,10 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	cfg.LifecyclerConfig.RegisterFlags(f)
 
 	f.IntVar(&cfg.MaxTransferRetries, "ingester.max-transfer-retries", 10, "Number of times to try and transfer chunks before falling back to flushing.")
+	f.BoolVar(&cfg.HandoverOnScaleDown, "ingester.handover-on-scale-down", false, "If no PENDING ingester takes our chunks, hand each series over to the ingesters which will own it once we have left, rather than flushing.")
+	f.BoolVar(&cfg.ShardByAllLabels, "ingester.shard-by-all-labels", false, "Whether series are sharded by all their labels. Used to find their owners when handing them over; must match -distributor.shard-by-all-labels.")
+	f.BoolVar(&cfg.FlushOwnerOnly, "ingester.flush-owner-only", false, "Only flush a series' chunks from the first healthy ingester in its replica set; the other replicas drop theirs once they find the owner's chunks in the store. Chunks are still flushed from every replica on shutdown.")
+	f.DurationVar(&cfg.FlushOwnerGracePeriod, "ingester.flush-owner-grace-period", 30*time.Minute, "With -ingester.flush-owner-only, how long after a chunk's last sample a replica not owning its series waits for the owner's chunks to show up in the store, before flushing it itself.")
 	f.DurationVar(&cfg.FlushCheckPeriod, "ingester.flush-period", 1*time.Minute, "Period with which to attempt to flush chunks.")
 	f.DurationVar(&cfg.RetainPeriod, "ingester.retain-period", 5*time.Minute, "Period chunks will remain in memory after flushing.")
 	f.DurationVar(&cfg.FlushOpTimeout, "ingester.flush-op-timeout", 1*time.Minute, "Timeout for individual flush operations.")
@@ -123,6 +133,10 @@ type Ingester struct {
 	lifecycler *ring.Lifecycler
 	limits     *validation.Overrides
 
+	// Only set if handing over series on scale down, or only flushing the
+	// series we own.
+	ring *ring.Ring
+
 	stopLock sync.RWMutex
 	stopped  bool
 	quit     chan struct{}
@@ -164,7 +178,14 @@ func New(cfg Config, clientConfig client.Config, limits *validation.Overrides, c
 	}
 
 	var err error
-	i.lifecycler, err = ring.NewLifecycler(cfg.LifecyclerConfig, i)
+	if cfg.HandoverOnScaleDown || cfg.FlushOwnerOnly {
+		i.ring, err = ring.New(cfg.LifecyclerConfig.RingConfig, ring.ConsulKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	i.lifecycler, err = ring.NewLifecycler(cfg.LifecyclerConfig, i, ring.ConsulKey)
 	if err != nil {
 		return nil, err
 	}
@@ -214,6 +235,10 @@ func (i *Ingester) Shutdown() {
 
 	// Next initiate our graceful exit from the ring.
 	i.lifecycler.Shutdown()
+
+	if i.ring != nil {
+		i.ring.Stop()
+	}
 }
 
 // StopIncomingRequests is called during the shutdown process.
@@ -72,6 +72,26 @@ func (s *testStore) Put(ctx context.Context, chunks []chunk.Chunk) error {
 	return nil
 }
 
+// GetChunkRefs returns the user's chunks of metric overlapping from and
+// through.
+func (s *testStore) GetChunkRefs(ctx context.Context, from, through model.Time, metric model.Metric) ([]chunk.Chunk, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	userID, err := user.ExtractOrgID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var result []chunk.Chunk
+	for _, c := range s.chunks[userID] {
+		if c.Through < from || c.From > through || !c.Metric.Equal(metric) {
+			continue
+		}
+		result = append(result, c)
+	}
+	return result, nil
+}
+
 func (s *testStore) Stop() {}
 
 // check that the store is holding data equivalent to what we expect
@@ -1,6 +1,7 @@
 package ingester
 
 import (
+	"fmt"
 	"io"
 	"math"
 	"testing"
@@ -167,6 +168,182 @@ func TestIngesterTransfer(t *testing.T) {
 	}, response)
 }
 
+func TestIngesterHandover(t *testing.T) {
+	limits, err := validation.NewOverrides(defaultLimitsTestConfig())
+	require.NoError(t, err)
+
+	// Start two ACTIVE ingesters, each series only being written to one.
+	cfg1 := defaultIngesterTestConfig()
+	cfg1.LifecyclerConfig.RingConfig.ReplicationFactor = 1
+	cfg1.LifecyclerConfig.ID = "ingester1"
+	cfg1.LifecyclerConfig.Addr = "ingester1"
+	cfg1.LifecyclerConfig.ClaimOnRollout = true
+	cfg1.MaxTransferRetries = 1
+	cfg1.HandoverOnScaleDown = true
+	ing1, err := New(cfg1, defaultClientTestConfig(), limits, nil)
+	require.NoError(t, err)
+
+	cfg2 := cfg1
+	cfg2.LifecyclerConfig.ID = "ingester2"
+	cfg2.LifecyclerConfig.Addr = "ingester2"
+	ing2, err := New(cfg2, defaultClientTestConfig(), limits, nil)
+	require.NoError(t, err)
+
+	test.Poll(t, time.Second, 2, func() interface{} {
+		rs, err := ing1.ring.GetAll()
+		if err != nil {
+			return 0
+		}
+		return len(rs.Ingesters)
+	})
+
+	// Pick a series owned by the first ingester.  Write a sample to it, and a
+	// later one to the second, as if the series had been written to it since
+	// the first stopped accepting samples.
+	var metricName string
+	for j := 0; metricName == ""; j++ {
+		name := fmt.Sprintf("foo%d", j)
+		rs, err := ing1.ring.Get(client.ShardByMetricName(userID, name), ring.Write)
+		require.NoError(t, err)
+		if rs.Ingesters[0].Addr == "ingester1:0" {
+			metricName = name
+		}
+	}
+	m := model.Metric{model.MetricNameLabel: model.LabelValue(metricName)}
+	ctx := user.InjectOrgID(context.Background(), userID)
+	for _, s := range []struct {
+		ingester *Ingester
+		ts       model.Time
+	}{
+		{ing1, model.TimeFromUnix(123)},
+		{ing2, model.TimeFromUnix(124)},
+	} {
+		_, err = s.ingester.Push(ctx, client.ToWriteRequest([]model.Sample{
+			{Metric: m, Timestamp: s.ts, Value: 456},
+		}, client.API))
+		require.NoError(t, err)
+	}
+
+	// With no PENDING ingester, stopping the first hands its series over to
+	// the second, rather than flushing them.
+	ing1.cfg.ingesterClientFactory = func(addr string, _ client.Config) (client.HealthAndIngesterClient, error) {
+		require.Equal(t, "ingester2:0", addr)
+		return ingesterClientAdapater{
+			ingester: ing2,
+		}, nil
+	}
+	ing1.Shutdown()
+	require.Equal(t, ring.ACTIVE, ing2.lifecycler.GetState())
+
+	matcher, err := labels.NewMatcher(labels.MatchEqual, model.MetricNameLabel, metricName)
+	require.NoError(t, err)
+	request, err := client.ToQueryRequest(model.TimeFromUnix(0), model.TimeFromUnix(200), []*labels.Matcher{matcher})
+	require.NoError(t, err)
+
+	response, err := ing2.Query(ctx, request)
+	require.NoError(t, err)
+	assert.Equal(t, &client.QueryResponse{
+		Timeseries: []client.TimeSeries{
+			{
+				Labels: client.FromMetricsToLabelAdapters(m),
+				Samples: []client.Sample{
+					{Value: 456, TimestampMs: 123000},
+					{Value: 456, TimestampMs: 124000},
+				},
+			},
+		},
+	}, response)
+}
+
+func TestIngesterFlushOwnerOnly(t *testing.T) {
+	// Start two ACTIVE ingesters sharing a store, each series being written
+	// to both.
+	cfg1 := defaultIngesterTestConfig()
+	cfg1.LifecyclerConfig.RingConfig.ReplicationFactor = 2
+	cfg1.LifecyclerConfig.ID = "ingester1"
+	cfg1.LifecyclerConfig.Addr = "ingester1"
+	cfg1.FlushCheckPeriod = 20 * time.Millisecond
+	cfg1.MaxChunkIdle = 100 * time.Millisecond
+	cfg1.FlushOwnerOnly = true
+	cfg1.FlushOwnerGracePeriod = 500 * time.Millisecond
+	store, ing1 := newTestStore(t, cfg1, defaultClientTestConfig(), defaultLimitsTestConfig())
+
+	cfg2 := cfg1
+	cfg2.LifecyclerConfig.ID = "ingester2"
+	cfg2.LifecyclerConfig.Addr = "ingester2"
+	limits, err := validation.NewOverrides(defaultLimitsTestConfig())
+	require.NoError(t, err)
+	ing2, err := New(cfg2, defaultClientTestConfig(), limits, store)
+	require.NoError(t, err)
+
+	for _, ing := range []*Ingester{ing1, ing2} {
+		test.Poll(t, time.Second, 2, func() interface{} {
+			rs, err := ing.ring.GetAll()
+			if err != nil {
+				return 0
+			}
+			return len(rs.Ingesters)
+		})
+	}
+
+	ctx := user.InjectOrgID(context.Background(), userID)
+	push := func(ing *Ingester, name string) {
+		_, err := ing.Push(ctx, client.ToWriteRequest([]model.Sample{
+			{Metric: model.Metric{model.MetricNameLabel: model.LabelValue(name)}, Timestamp: model.TimeFromUnix(123), Value: 456},
+		}, client.API))
+		require.NoError(t, err)
+	}
+	other := func(name string) *Ingester {
+		rs, err := ing1.ring.Get(client.ShardByMetricName(userID, name), ring.Write)
+		require.NoError(t, err)
+		if rs.Ingesters[0].Addr == "ingester1:0" {
+			return ing2
+		}
+		return ing1
+	}
+	stored := func(name string) int {
+		store.mtx.Lock()
+		defer store.mtx.Unlock()
+		n := 0
+		for _, c := range store.chunks[userID] {
+			if c.Metric[model.MetricNameLabel] == model.LabelValue(name) {
+				n++
+			}
+		}
+		return n
+	}
+	flushed := func(ing *Ingester, name string) bool {
+		state, ok := ing.userStates.get(userID)
+		if !ok {
+			return false
+		}
+		fp := client.FastFingerprint([]client.LabelAdapter{{Name: model.MetricNameLabel, Value: name}})
+		state.fpLocker.Lock(fp)
+		defer state.fpLocker.Unlock(fp)
+		series, ok := state.fpToSeries.get(fp)
+		return ok && series.chunkDescs[0].flushed
+	}
+
+	// Write a series to both.  The owner flushes it, and the other replica
+	// finds its chunk, so doesn't flush its own, even after the grace period.
+	push(ing1, "foo")
+	push(ing2, "foo")
+	test.Poll(t, time.Second, true, func() interface{} {
+		return flushed(other("foo"), "foo")
+	})
+	time.Sleep(cfg1.FlushOwnerGracePeriod)
+	require.Equal(t, 1, stored("foo"))
+
+	// A series only the other replica has is flushed by it after the grace
+	// period.
+	push(other("bar"), "bar")
+	time.Sleep(cfg1.FlushOwnerGracePeriod / 2)
+	require.Equal(t, 0, stored("bar"))
+	test.Poll(t, 2*time.Second, 1, func() interface{} {
+		return stored("bar")
+	})
+}
+
 func TestIngesterBadTransfer(t *testing.T) {
 	limits, err := validation.NewOverrides(defaultLimitsTestConfig())
 	require.NoError(t, err)
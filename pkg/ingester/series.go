@@ -208,6 +208,68 @@ func (s *memorySeries) setChunks(descs []*desc) error {
 	return nil
 }
 
+// prependChunks adds chunks older than the series' own, as handed over by a
+// leaving ingester.  The series may have been written to since the sender
+// stopped accepting samples, so only the samples before our first are kept.
+func (s *memorySeries) prependChunks(descs []*desc) error {
+	if len(s.chunkDescs) == 0 {
+		return s.setChunks(descs)
+	}
+
+	first := s.firstTime()
+	older := make([]*desc, 0, len(descs)+len(s.chunkDescs))
+	for _, d := range descs {
+		if d.LastTime.Before(first) {
+			older = append(older, d)
+			continue
+		}
+		if d.FirstTime.Before(first) {
+			truncated, err := truncateChunk(d.C, first)
+			if err != nil {
+				return err
+			}
+			older = append(older, truncated...)
+		}
+		break
+	}
+	s.chunkDescs = append(older, s.chunkDescs...)
+	return nil
+}
+
+// truncateChunk re-encodes the samples of c before the given time.
+func truncateChunk(c encoding.Chunk, before model.Time) ([]*desc, error) {
+	var (
+		chunks  []encoding.Chunk
+		current = encoding.New()
+		it      = c.NewIterator()
+	)
+	for it.Scan() && it.Value().Timestamp.Before(before) {
+		overflow, err := current.Add(it.Value())
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, overflow[:len(overflow)-1]...)
+		current = overflow[len(overflow)-1]
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	if current.Len() > 0 {
+		chunks = append(chunks, current)
+	}
+
+	descs := make([]*desc, 0, len(chunks))
+	for _, c := range chunks {
+		first, last, err := firstAndLastTimes(c)
+		if err != nil {
+			return nil, err
+		}
+		descs = append(descs, newDesc(c, first, last))
+		createdChunks.Inc()
+	}
+	return descs, nil
+}
+
 type desc struct {
 	C          encoding.Chunk // nil if chunk is evicted.
 	FirstTime  model.Time     // Timestamp of first sample. Populated at creation. Immutable.
@@ -36,8 +36,15 @@ func init() {
 	prometheus.MustRegister(receivedChunks)
 }
 
-// TransferChunks receives all the chunks from another ingester.
+// TransferChunks receives all the chunks from another ingester, or the series
+// it hands over to us as it leaves.
 func (i *Ingester) TransferChunks(stream client.Ingester_TransferChunksServer) error {
+	// The first series tells us which kind of transfer this is.
+	wireSeries, err := stream.Recv()
+	if err == nil && wireSeries.Handover {
+		return i.receiveHandover(stream, wireSeries)
+	}
+
 	// Enter JOINING state (only valid from PENDING)
 	if err := i.lifecycler.ChangeState(stream.Context(), ring.JOINING); err != nil {
 		return err
@@ -66,11 +73,7 @@ func (i *Ingester) TransferChunks(stream client.Ingester_TransferChunksServer) e
 	fromIngesterID := ""
 	seriesReceived := 0
 
-	for {
-		wireSeries, err := stream.Recv()
-		if err == io.EOF {
-			break
-		}
+	for ; err != io.EOF; wireSeries, err = stream.Recv() {
 		if err != nil {
 			return err
 		}
@@ -137,6 +140,57 @@ func (i *Ingester) TransferChunks(stream client.Ingester_TransferChunksServer) e
 	return nil
 }
 
+// receiveHandover adds the series handed over by a leaving ingester, which we
+// will own once it has left, to our own.
+func (i *Ingester) receiveHandover(stream client.Ingester_TransferChunksServer, wireSeries *client.TimeSeriesChunk) error {
+	if state := i.lifecycler.GetState(); state != ring.ACTIVE {
+		return fmt.Errorf("cannot receive handover in state %v", state)
+	}
+
+	fromIngesterID := wireSeries.FromIngesterId
+	level.Info(util.Logger).Log("msg", "processing handover", "from_ingester", fromIngesterID)
+
+	i.userStatesMtx.RLock()
+	defer i.userStatesMtx.RUnlock()
+
+	seriesReceived := 0
+	var err error
+	for ; err != io.EOF; wireSeries, err = stream.Recv() {
+		if err != nil {
+			return err
+		}
+
+		userCtx := user.InjectOrgID(stream.Context(), wireSeries.UserId)
+		descs, err := fromWireChunks(wireSeries.Chunks)
+		if err != nil {
+			return err
+		}
+
+		state, fp, series, err := i.userStates.getOrCreateSeries(userCtx, wireSeries.Labels)
+		if err != nil {
+			return err
+		}
+		prevNumChunks := len(series.chunkDescs)
+
+		err = series.prependChunks(descs)
+		state.fpLocker.Unlock(fp) // acquired in getOrCreateSeries
+		if err != nil {
+			return err
+		}
+
+		seriesReceived++
+		memoryChunks.Add(float64(len(series.chunkDescs) - prevNumChunks))
+		receivedChunks.Add(float64(len(descs)))
+	}
+
+	if err := stream.SendAndClose(&client.TransferChunksResponse{}); err != nil {
+		level.Error(util.Logger).Log("msg", "Error closing TransferChunks stream", "from_ingester", fromIngesterID, "err", err)
+		return err
+	}
+	level.Info(util.Logger).Log("msg", "Successfully received handover", "from_ingester", fromIngesterID, "series_received", seriesReceived)
+	return nil
+}
+
 func toWireChunks(descs []*desc) ([]client.Chunk, error) {
 	wireChunks := make([]client.Chunk, 0, len(descs))
 	for _, d := range descs {
@@ -200,6 +254,13 @@ func (i *Ingester) TransferOut(ctx context.Context) error {
 		backoff.Wait()
 	}
 
+	// Nobody is waiting to take over all our chunks, so we're probably being
+	// scaled down.
+	if i.cfg.HandoverOnScaleDown {
+		level.Info(util.Logger).Log("msg", "handing over series to their next owners")
+		return i.handover(ctx)
+	}
+
 	return backoff.Err()
 }
 
@@ -230,47 +291,146 @@ func (i *Ingester) transferOut(ctx context.Context) error {
 
 	for userID, state := range userStatesCopy {
 		for pair := range state.fpToSeries.iter() {
-			state.fpLocker.Lock(pair.fp)
-
-			if len(pair.series.chunkDescs) == 0 { // Nothing to send?
-				state.fpLocker.Unlock(pair.fp)
-				continue
+			if err := i.sendSeries(stream, userID, state, pair, false); err != nil {
+				return err
 			}
+		}
+	}
+
+	_, err = stream.CloseAndRecv()
+	if err != nil {
+		return errors.Wrap(err, "CloseAndRecv")
+	}
+
+	i.discardFlushQueues()
 
-			chunks, err := toWireChunks(pair.series.chunkDescs)
+	level.Info(util.Logger).Log("msg", "successfully sent chunks", "to_ingester", targetIngester.Addr)
+	return nil
+}
+
+// handoverSeries is a series to hand over.
+type handoverSeries struct {
+	userID string
+	state  *userState
+	pair   fingerprintSeriesPair
+}
+
+// handover sends each of our series to the ingesters which will hold a replica
+// of it once we have left the ring, but don't already.
+func (i *Ingester) handover(ctx context.Context) error {
+	var (
+		series []handoverSeries
+		tokens []uint32
+	)
+	for userID, state := range i.userStates.cp() {
+		for pair := range state.fpToSeries.iter() {
+			token, err := client.TokenForLabels(userID, client.FromLabelsToLabelAdapaters(pair.series.metric), i.cfg.ShardByAllLabels)
 			if err != nil {
-				state.fpLocker.Unlock(pair.fp)
-				return errors.Wrap(err, "toWireChunks")
+				return err
 			}
+			series = append(series, handoverSeries{userID, state, pair})
+			tokens = append(tokens, token)
+		}
+	}
+
+	targets, err := i.ring.HandoverTargets(i.lifecycler.ID, tokens)
+	if err != nil {
+		return fmt.Errorf("cannot find ingesters to hand over to: %v", err)
+	}
+	byTarget := map[string][]handoverSeries{}
+	for j, ingesters := range targets {
+		for _, ingester := range ingesters {
+			byTarget[ingester.Addr] = append(byTarget[ingester.Addr], series[j])
+		}
+	}
 
-			err = stream.Send(&client.TimeSeriesChunk{
-				FromIngesterId: i.lifecycler.ID,
-				UserId:         userID,
-				Labels:         client.FromLabelsToLabelAdapaters(pair.series.metric),
-				Chunks:         chunks,
-			})
-			state.fpLocker.Unlock(pair.fp)
+	for addr, toSend := range byTarget {
+		if err := i.handoverTo(ctx, addr, toSend); err != nil {
+			return err
+		}
+	}
+
+	i.discardFlushQueues()
+
+	level.Info(util.Logger).Log("msg", "successfully handed over series", "series", len(series), "to_ingesters", len(byTarget))
+	return nil
+}
+
+func (i *Ingester) handoverTo(ctx context.Context, addr string, series []handoverSeries) error {
+	level.Info(util.Logger).Log("msg", "handing over series", "to_ingester", addr, "series", len(series))
+	c, err := i.cfg.ingesterClientFactory(addr, i.clientConfig)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	// The stream is only opened once we have a series with chunks to send, as
+	// the receiver needs one to know this is a handover.
+	var stream client.Ingester_TransferChunksClient
+	for _, s := range series {
+		s.state.fpLocker.Lock(s.pair.fp)
+		empty := len(s.pair.series.chunkDescs) == 0
+		s.state.fpLocker.Unlock(s.pair.fp)
+		if empty {
+			continue
+		}
+
+		if stream == nil {
+			stream, err = c.TransferChunks(user.InjectOrgID(ctx, "-1"))
 			if err != nil {
-				return errors.Wrap(err, "Send")
+				return errors.Wrap(err, "TransferChunks")
 			}
-
-			sentChunks.Add(float64(len(chunks)))
+		}
+		if err := i.sendSeries(stream, s.userID, s.state, s.pair, true); err != nil {
+			return err
 		}
 	}
+	if stream == nil {
+		return nil
+	}
 
 	_, err = stream.CloseAndRecv()
+	return errors.Wrap(err, "CloseAndRecv")
+}
+
+// sendSeries sends the chunks of a series down a TransferChunks stream.
+func (i *Ingester) sendSeries(stream client.Ingester_TransferChunksClient, userID string, state *userState, pair fingerprintSeriesPair, handover bool) error {
+	state.fpLocker.Lock(pair.fp)
+
+	if len(pair.series.chunkDescs) == 0 { // Nothing to send?
+		state.fpLocker.Unlock(pair.fp)
+		return nil
+	}
+
+	chunks, err := toWireChunks(pair.series.chunkDescs)
 	if err != nil {
-		return errors.Wrap(err, "CloseAndRecv")
+		state.fpLocker.Unlock(pair.fp)
+		return errors.Wrap(err, "toWireChunks")
+	}
+
+	err = stream.Send(&client.TimeSeriesChunk{
+		FromIngesterId: i.lifecycler.ID,
+		UserId:         userID,
+		Labels:         client.FromLabelsToLabelAdapaters(pair.series.metric),
+		Chunks:         chunks,
+		Handover:       handover,
+	})
+	state.fpLocker.Unlock(pair.fp)
+	if err != nil {
+		return errors.Wrap(err, "Send")
 	}
 
-	// Close & empty all the flush queues, to unblock waiting workers.
+	sentChunks.Add(float64(len(chunks)))
+	return nil
+}
+
+// discardFlushQueues closes & empties all the flush queues, to unblock
+// waiting workers, once our chunks are safely on other ingesters.
+func (i *Ingester) discardFlushQueues() {
 	for _, flushQueue := range i.flushQueues {
 		flushQueue.DiscardAndClose()
 	}
 	i.flushQueuesDone.Wait()
-
-	level.Info(util.Logger).Log("msg", "successfully sent chunks", "to_ingester", targetIngester.Addr)
-	return nil
 }
 
 // findTargetIngester finds an ingester in PENDING state.
@@ -12,6 +12,8 @@ import (
 	"time"
 
 	"github.com/NYTimes/gziphandler"
+	"github.com/cortexproject/cortex/pkg/chunk/cache"
+	"github.com/cortexproject/cortex/pkg/util/stats"
 	"github.com/cortexproject/cortex/pkg/util/validation"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
@@ -42,6 +44,31 @@ var (
 		Name:      "query_frontend_queue_length",
 		Help:      "Number of queries in the queue.",
 	})
+	querierSeconds = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cortex",
+		Name:      "query_frontend_querier_seconds_total",
+		Help:      "Total time queriers spent running a user's queries.",
+	}, []string{"user"})
+	queryFetchedChunks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cortex",
+		Name:      "query_frontend_fetched_chunks_total",
+		Help:      "Total number of chunks fetched from the store for a user's queries.",
+	}, []string{"user"})
+	queryFetchedChunkBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cortex",
+		Name:      "query_frontend_fetched_chunk_bytes_total",
+		Help:      "Total size of the chunks fetched from the store for a user's queries.",
+	}, []string{"user"})
+	queryIndexQueries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cortex",
+		Name:      "query_frontend_index_queries_total",
+		Help:      "Total number of index lookups made for a user's queries.",
+	}, []string{"user"})
+	queryIngesterSeries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cortex",
+		Name:      "query_frontend_ingester_series_total",
+		Help:      "Total number of series ingesters returned for a user's queries.",
+	}, []string{"user"})
 
 	errServerClosing  = httpgrpc.Errorf(http.StatusTeapot, "server closing down")
 	errTooManyRequest = httpgrpc.Errorf(http.StatusTooManyRequests, "too many outstanding requests")
@@ -53,9 +80,15 @@ type Config struct {
 	MaxOutstandingPerTenant int
 	MaxRetries              int
 	SplitQueriesByDay       bool
+	SplitQueriesMaxLookback time.Duration
 	AlignQueriesWithStep    bool
 	CacheResults            bool
+	CacheMetadata           bool
 	CompressResponses       bool
+	QueryStatsEnabled       bool
+	LogQueriesLongerThan    time.Duration
+	LogQueriesSampleRatio   float64
+	CacheGenerations        cache.GenerationsConfig
 	resultsCacheConfig
 }
 
@@ -64,9 +97,15 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&cfg.MaxOutstandingPerTenant, "querier.max-outstanding-requests-per-tenant", 100, "Maximum number of outstanding requests per tenant per frontend; requests beyond this error with HTTP 429.")
 	f.IntVar(&cfg.MaxRetries, "querier.max-retries-per-request", 5, "Maximum number of retries for a single request; beyond this, the downstream error is returned.")
 	f.BoolVar(&cfg.SplitQueriesByDay, "querier.split-queries-by-day", false, "Split queries by day and execute in parallel.")
+	f.DurationVar(&cfg.SplitQueriesMaxLookback, "querier.split-queries-max-lookback", 24*time.Hour, "Don't split queries whose range selectors, offsets and subqueries look back further than this before each step, as every day would re-read that much data. 0 to split them regardless.")
 	f.BoolVar(&cfg.AlignQueriesWithStep, "querier.align-querier-with-step", false, "Mutate incoming queries to align their start and end with their step.")
 	f.BoolVar(&cfg.CacheResults, "querier.cache-results", false, "Cache query results.")
+	f.BoolVar(&cfg.CacheMetadata, "frontend.cache-metadata", false, "Cache the results of series, label names and label values queries in the results cache.")
 	f.BoolVar(&cfg.CompressResponses, "querier.compress-http-responses", false, "Compress HTTP responses.")
+	f.BoolVar(&cfg.QueryStatsEnabled, "frontend.query-stats-enabled", false, "Sum the stats queriers return for each query, and its split queries, into per-user metrics, and log every query with them. Needs -querier.query-stats-enabled on the queriers.")
+	f.DurationVar(&cfg.LogQueriesLongerThan, "frontend.log-queries-longer-than", 0, "Log queries which take longer than this, 0 to disable.")
+	f.Float64Var(&cfg.LogQueriesSampleRatio, "frontend.log-queries-sample-ratio", 0, "Fraction of the queries which aren't logged for being slow to log anyway, between 0 and 1.")
+	cfg.CacheGenerations.RegisterFlags(f)
 	cfg.resultsCacheConfig.RegisterFlags(f)
 }
 
@@ -75,11 +114,18 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 type Frontend struct {
 	cfg          Config
 	log          log.Logger
+	limits       *validation.Overrides
 	roundTripper http.RoundTripper
+	generations  *cache.Generations
 
 	mtx    sync.Mutex
 	cond   *sync.Cond
 	queues map[string]chan *request
+
+	runningMtx    sync.Mutex
+	running       map[uint64]*runningQuery
+	nextRunningID uint64
+	tenantQueries map[string]int
 }
 
 type request struct {
@@ -95,9 +141,26 @@ type request struct {
 // New creates a new frontend.
 func New(cfg Config, log log.Logger, limits *validation.Overrides) (*Frontend, error) {
 	f := &Frontend{
-		cfg:    cfg,
-		log:    log,
-		queues: map[string]chan *request{},
+		cfg:           cfg,
+		log:           log,
+		limits:        limits,
+		queues:        map[string]chan *request{},
+		running:       map[uint64]*runningQuery{},
+		tenantQueries: map[string]int{},
+	}
+
+	generations, err := cache.NewGenerations(cfg.CacheGenerations)
+	if err != nil {
+		return nil, err
+	}
+	f.generations = generations
+
+	// Query results and metadata share the same cache.
+	if cfg.CacheResults || cfg.CacheMetadata {
+		cfg.cacheConfig, err = sharedCacheConfig(cfg.cacheConfig, generations)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Stack up the pipeline of various query range middlewares.
@@ -106,7 +169,7 @@ func New(cfg Config, log log.Logger, limits *validation.Overrides) (*Frontend, e
 		queryRangeMiddleware = append(queryRangeMiddleware, stepAlignMiddleware)
 	}
 	if cfg.SplitQueriesByDay {
-		queryRangeMiddleware = append(queryRangeMiddleware, splitByDayMiddleware(limits))
+		queryRangeMiddleware = append(queryRangeMiddleware, splitByDayMiddleware(limits, cfg.SplitQueriesMaxLookback))
 	}
 	if cfg.CacheResults {
 		queryCacheMiddleware, err := newResultsCacheMiddleware(cfg.resultsCacheConfig, limits)
@@ -127,11 +190,32 @@ func New(cfg Config, log log.Logger, limits *validation.Overrides) (*Frontend, e
 			limits: limits,
 		}
 	}
+	if cfg.CacheMetadata {
+		metadataCache, err := newMetadataCache(cfg.resultsCacheConfig, limits, roundTripper)
+		if err != nil {
+			return nil, err
+		}
+		roundTripper = metadataCache
+	}
 	f.roundTripper = roundTripper
 	f.cond = sync.NewCond(&f.mtx)
 	return f, nil
 }
 
+// sharedCacheConfig makes the cache described by cfg, wrapped with the
+// generations, and returns the config the results and metadata caches make
+// their cache from.  The generations are cleared, so cache.New doesn't wrap
+// the cache with them again.
+func sharedCacheConfig(cfg cache.Config, generations *cache.Generations) (cache.Config, error) {
+	cfg.Generations = generations
+	c, err := cache.New(cfg)
+	if err != nil {
+		return cache.Config{}, err
+	}
+	cfg.Cache, cfg.Generations = c, nil
+	return cfg, nil
+}
+
 // Close stops new requests and errors out any pending requests.
 func (f *Frontend) Close() {
 	f.mtx.Lock()
@@ -139,6 +223,7 @@ func (f *Frontend) Close() {
 	for len(f.queues) > 0 {
 		f.cond.Wait()
 	}
+	f.generations.Stop()
 }
 
 // Handler for HTTP requests.
@@ -150,8 +235,37 @@ func (f *Frontend) Handler() http.Handler {
 }
 
 func (f *Frontend) handle(w http.ResponseWriter, r *http.Request) {
-	resp, err := f.roundTripper.RoundTrip(r)
+	userID, err := user.ExtractOrgID(r.Context())
+	if err == nil {
+		if err := f.startTenantQuery(userID); err != nil {
+			server.WriteError(w, err)
+			return
+		}
+		defer f.endTenantQuery(userID)
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	query := f.startQuery(r, cancel)
+	defer f.endQuery(query)
+	ctx = context.WithValue(ctx, runningQueryKey, query)
+
+	var queryStats *stats.Stats
+	if f.cfg.QueryStatsEnabled {
+		queryStats, ctx = stats.ContextWithEmptyStats(ctx)
+	}
+	r = r.WithContext(ctx)
+
+	resp, err := limitLookback(f.limits, userID, r, time.Now())
+	if err == nil && resp == nil {
+		resp, err = f.roundTripper.RoundTrip(r)
+	}
 	if err != nil {
+		status := http.StatusInternalServerError
+		if httpResp, ok := httpgrpc.HTTPResponseFromError(err); ok {
+			status = int(httpResp.Code)
+		}
+		f.reportQuery(query, queryStats, status, 0)
 		server.WriteError(w, err)
 		return
 	}
@@ -160,8 +274,14 @@ func (f *Frontend) handle(w http.ResponseWriter, r *http.Request) {
 	for h, vs := range resp.Header {
 		hs[h] = vs
 	}
+	if queryStats != nil {
+		// The response only has the stats of one of the queries it was split
+		// into, if it was.
+		hs.Set(stats.HeaderName, queryStats.Encode())
+	}
 	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+	size, _ := io.Copy(w, resp.Body)
+	f.reportQuery(query, queryStats, resp.StatusCode, size)
 }
 
 // RoundTrip implement http.Transport.
@@ -207,6 +327,10 @@ func (f *Frontend) RoundTripGRPC(ctx context.Context, req *ProcessRequest) (*Pro
 		tracer.Inject(span.Context(), opentracing.HTTPHeaders, carrier)
 	}
 
+	if query, ok := ctx.Value(runningQueryKey).(*runningQuery); ok {
+		query.addSubQuery()
+	}
+
 	request := &request{
 		request:     req,
 		originalCtx: ctx,
@@ -249,6 +373,7 @@ func (f *Frontend) RoundTripGRPC(ctx context.Context, req *ProcessRequest) (*Pro
 		}
 
 		retries.Observe(float64(tries))
+		f.mergeQueryStats(ctx, resp.HttpResponse)
 
 		return resp, nil
 	}
@@ -260,6 +385,26 @@ func (f *Frontend) RoundTripGRPC(ctx context.Context, req *ProcessRequest) (*Pro
 	return nil, httpgrpc.Errorf(http.StatusInternalServerError, "Query failed after %d retries.", f.cfg.MaxRetries)
 }
 
+// mergeQueryStats adds the stats a querier returned with a response to those
+// of the query, if they're being collected.
+func (f *Frontend) mergeQueryStats(ctx context.Context, resp *httpgrpc.HTTPResponse) {
+	queryStats := stats.FromContext(ctx)
+	if queryStats == nil {
+		return
+	}
+	for _, h := range resp.Headers {
+		if http.CanonicalHeaderKey(h.Key) != stats.HeaderName || len(h.Values) == 0 {
+			continue
+		}
+		s, err := stats.Decode(h.Values[0])
+		if err != nil {
+			level.Warn(f.log).Log("msg", "error decoding query stats", "err", err)
+			continue
+		}
+		queryStats.Merge(s)
+	}
+}
+
 // Process allows backends to pull requests from the frontend.
 func (f *Frontend) Process(server Frontend_ProcessServer) error {
 	var (
@@ -397,7 +542,11 @@ func (f *Frontend) getNextRequest(ctx context.Context) (*request, error) {
 		// Tell close() we've processed a request.
 		f.cond.Broadcast()
 
-		queueDuration.Observe(time.Now().Sub(request.enqueueTime).Seconds())
+		queued := time.Now().Sub(request.enqueueTime)
+		queueDuration.Observe(queued.Seconds())
+		if query, ok := request.originalCtx.Value(runningQueryKey).(*runningQuery); ok {
+			query.addQueueTime(queued)
+		}
 		queueLength.Add(-1)
 		request.queueSpan.Finish()
 
@@ -10,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/stats"
 	"github.com/go-kit/kit/log"
 	otgrpc "github.com/opentracing-contrib/go-grpc"
 	"github.com/opentracing-contrib/go-stdlib/nethttp"
@@ -18,6 +19,7 @@ import (
 	"github.com/stretchr/testify/require"
 	jaeger "github.com/uber/jaeger-client-go"
 	"github.com/uber/jaeger-client-go/config"
+	"github.com/weaveworks/common/httpgrpc"
 	httpgrpc_server "github.com/weaveworks/common/httpgrpc/server"
 	"github.com/weaveworks/common/middleware"
 	"google.golang.org/grpc"
@@ -170,3 +172,21 @@ func testFrontend(t *testing.T, handler http.Handler, test func(addr string)) {
 
 	test(httpListen.Addr().String())
 }
+
+func TestFrontendMergeQueryStats(t *testing.T) {
+	f := &Frontend{log: log.NewNopLogger()}
+	queryStats, ctx := stats.ContextWithEmptyStats(context.Background())
+
+	for _, s := range []*stats.Stats{{FetchedChunks: 1, IndexQueries: 2}, {FetchedChunks: 3}} {
+		f.mergeQueryStats(ctx, &httpgrpc.HTTPResponse{
+			Headers: []*httpgrpc.Header{{Key: stats.HeaderName, Values: []string{s.Encode()}}},
+		})
+	}
+	// Responses without stats, or with invalid ones, are ignored.
+	f.mergeQueryStats(ctx, &httpgrpc.HTTPResponse{})
+	f.mergeQueryStats(ctx, &httpgrpc.HTTPResponse{
+		Headers: []*httpgrpc.Header{{Key: stats.HeaderName, Values: []string{"{"}}},
+	})
+
+	require.Equal(t, &stats.Stats{FetchedChunks: 4, IndexQueries: 2}, queryStats.Snapshot())
+}
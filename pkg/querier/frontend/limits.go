@@ -0,0 +1,193 @@
+package frontend
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/weaveworks/common/httpgrpc"
+
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+// Prometheus API error types.
+const (
+	errorBadData     = "bad_data"
+	errorUnavailable = "unavailable"
+)
+
+// apiError returns an error the frontend responds to with code, and a body in
+// the Prometheus API's error format.
+func apiError(code int, errorType, format string, args ...interface{}) error {
+	body, err := json.Marshal(struct {
+		Status    string `json:"status"`
+		ErrorType string `json:"errorType"`
+		Error     string `json:"error"`
+	}{
+		Status:    "error",
+		ErrorType: errorType,
+		Error:     fmt.Sprintf(format, args...),
+	})
+	if err != nil {
+		return httpgrpc.Errorf(code, format, args...)
+	}
+	return httpgrpc.ErrorFromHTTPResponse(&httpgrpc.HTTPResponse{
+		Code: int32(code),
+		Headers: []*httpgrpc.Header{
+			{Key: "Content-Type", Values: []string{"application/json"}},
+		},
+		Body: body,
+	})
+}
+
+// limitQueryRange applies a user's limits to a range query, before it's
+// queued: its start is moved forward to the max lookback, and it's rejected
+// if it's too long, or its step too small.  A nil request is returned if none
+// of it is within the lookback.
+func limitQueryRange(limits *validation.Overrides, userID string, r *QueryRangeRequest, now time.Time) (*QueryRangeRequest, error) {
+	if maxLookback := maxQueryLookback(limits, userID); maxLookback > 0 {
+		minStart := timestamp.FromTime(now.Add(-maxLookback))
+		if r.End < minStart {
+			return nil, nil
+		}
+		if r.Start < minStart {
+			// Keep the start on the same steps.
+			steps := (minStart - r.Start + r.Step - 1) / r.Step
+			limited := r.copy()
+			limited.Start += steps * r.Step
+			if limited.Start > limited.End {
+				return nil, nil
+			}
+			r = &limited
+		}
+	}
+
+	maxQueryLen := limits.MaxQueryLength(userID)
+	queryLen := timestamp.Time(r.End).Sub(timestamp.Time(r.Start))
+	if maxQueryLen != 0 && queryLen > maxQueryLen {
+		return nil, apiError(http.StatusBadRequest, errorBadData, validation.ErrQueryTooLong, queryLen, maxQueryLen)
+	}
+
+	step := time.Duration(r.Step) * time.Millisecond
+	if minStep := limits.MinQueryStep(userID); step < minStep {
+		return nil, apiError(http.StatusBadRequest, errorBadData, "query step %s is smaller than the limit of %s, try increasing the step", step, minStep)
+	}
+
+	if maxPoints := limits.MaxPointsPerSeries(userID); maxPoints > 0 && (r.End-r.Start)/r.Step > int64(maxPoints) {
+		return nil, apiError(http.StatusBadRequest, errorBadData, "query would return more than %d points per series, try increasing the step", maxPoints)
+	}
+	return r, nil
+}
+
+// maxQueryLookback returns how long ago a user's queries can read data from:
+// their max query lookback or retention period, whichever is shorter, or 0
+// for no limit.
+func maxQueryLookback(limits *validation.Overrides, userID string) time.Duration {
+	lookback, retention := limits.MaxQueryLookback(userID), limits.RetentionPeriod(userID)
+	if lookback <= 0 || (retention > 0 && retention < lookback) {
+		return retention
+	}
+	return lookback
+}
+
+// limitLookback applies a user's max lookback to instant, series and label
+// queries; range queries are limited by limitQueryRange once parsed.  The
+// start of series and label queries is moved forward to the max lookback.
+// A response with no data is returned for instant queries before it, and
+// series and label queries which end before it.
+func limitLookback(limits *validation.Overrides, userID string, r *http.Request, now time.Time) (*http.Response, error) {
+	maxLookback := maxQueryLookback(limits, userID)
+	if maxLookback <= 0 || strings.HasSuffix(r.URL.Path, "/query_range") {
+		return nil, nil
+	}
+	minStart := timestamp.FromTime(now.Add(-maxLookback))
+
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/query"):
+		if r.FormValue("time") == "" {
+			return nil, nil
+		}
+		t, err := ParseTime(r.FormValue("time"))
+		if err != nil || t >= minStart {
+			return nil, nil
+		}
+		return metadataResponse(struct {
+			ResultType string        `json:"resultType"`
+			Result     []interface{} `json:"result"`
+		}{model.ValVector.String(), []interface{}{}})
+
+	case strings.HasSuffix(r.URL.Path, "/series"), strings.HasSuffix(r.URL.Path, "/labels"), labelValuesPath.MatchString(r.URL.Path):
+		if end := r.FormValue("end"); end != "" {
+			if t, err := ParseTime(end); err == nil && t < minStart {
+				return metadataResponse([]interface{}{})
+			}
+		}
+		if start, err := ParseTime(r.FormValue("start")); r.FormValue("start") == "" || (err == nil && start < minStart) {
+			if err := setFormValue(r, "start", encodeTime(minStart)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, nil
+}
+
+// setFormValue sets a parameter of a request, in its form-encoded body if it
+// has one, as that takes precedence, as well as its URL.
+func setFormValue(r *http.Request, key, value string) error {
+	if err := r.ParseForm(); err != nil {
+		return httpgrpc.Errorf(http.StatusBadRequest, err.Error())
+	}
+	if len(r.PostForm) > 0 {
+		r.PostForm.Set(key, value)
+		body := r.PostForm.Encode()
+		r.Body = ioutil.NopCloser(strings.NewReader(body))
+		r.ContentLength = int64(len(body))
+		r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	params := r.URL.Query()
+	params.Set(key, value)
+	r.URL.RawQuery = params.Encode()
+	r.Form.Set(key, value)
+	return nil
+}
+
+// emptyMatrixResponse is the response to range queries which are limited to
+// nothing.
+func emptyMatrixResponse() *APIResponse {
+	return &APIResponse{
+		Status: statusSuccess,
+		Data: QueryRangeResponse{
+			ResultType: matrix,
+			Result:     []SampleStream{},
+		},
+	}
+}
+
+// startTenantQuery counts a query the user is running, and rejects it if
+// they're already running as many as they can.  endTenantQuery must be called
+// when an accepted query finishes.
+func (f *Frontend) startTenantQuery(userID string) error {
+	f.runningMtx.Lock()
+	defer f.runningMtx.Unlock()
+
+	if max := f.limits.MaxConcurrentQueries(userID); max > 0 && f.tenantQueries[userID] >= max {
+		return apiError(http.StatusTooManyRequests, errorUnavailable, "too many concurrent queries, the limit is %d", max)
+	}
+	f.tenantQueries[userID]++
+	return nil
+}
+
+func (f *Frontend) endTenantQuery(userID string) {
+	f.runningMtx.Lock()
+	defer f.runningMtx.Unlock()
+
+	f.tenantQueries[userID]--
+	if f.tenantQueries[userID] <= 0 {
+		delete(f.tenantQueries, userID)
+	}
+}
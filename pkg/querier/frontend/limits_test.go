@@ -0,0 +1,213 @@
+package frontend
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/httpgrpc"
+
+	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+func overrides(t *testing.T, f func(*validation.Limits)) *validation.Overrides {
+	var limits validation.Limits
+	flagext.DefaultValues(&limits)
+	f(&limits)
+	overrides, err := validation.NewOverrides(limits)
+	require.NoError(t, err)
+	return overrides
+}
+
+func TestLimitQueryRange(t *testing.T) {
+	now := time.Unix(100000, 0)
+	for _, tc := range []struct {
+		name     string
+		limits   func(*validation.Limits)
+		req      QueryRangeRequest
+		expected *QueryRangeRequest
+		err      string
+	}{
+		{
+			name:     "no limits",
+			limits:   func(*validation.Limits) {},
+			req:      QueryRangeRequest{Start: 0, End: 100000 * 1e3, Step: 60 * 1e3},
+			expected: &QueryRangeRequest{Start: 0, End: 100000 * 1e3, Step: 60 * 1e3},
+		},
+		{
+			name:     "start clamped to lookback",
+			limits:   func(l *validation.Limits) { l.MaxQueryLookback = time.Hour },
+			req:      QueryRangeRequest{Start: 0, End: 100000 * 1e3, Step: 60 * 1e3},
+			expected: &QueryRangeRequest{Start: 96420 * 1e3, End: 100000 * 1e3, Step: 60 * 1e3},
+		},
+		{
+			name:     "start clamped to retention",
+			limits:   func(l *validation.Limits) { l.RetentionPeriod = time.Hour },
+			req:      QueryRangeRequest{Start: 0, End: 100000 * 1e3, Step: 60 * 1e3},
+			expected: &QueryRangeRequest{Start: 96420 * 1e3, End: 100000 * 1e3, Step: 60 * 1e3},
+		},
+		{
+			name:     "start clamped to shorter of lookback and retention",
+			limits:   func(l *validation.Limits) { l.MaxQueryLookback = time.Hour; l.RetentionPeriod = 24 * time.Hour },
+			req:      QueryRangeRequest{Start: 0, End: 100000 * 1e3, Step: 60 * 1e3},
+			expected: &QueryRangeRequest{Start: 96420 * 1e3, End: 100000 * 1e3, Step: 60 * 1e3},
+		},
+		{
+			name:   "all before lookback",
+			limits: func(l *validation.Limits) { l.MaxQueryLookback = time.Hour },
+			req:    QueryRangeRequest{Start: 0, End: 3600 * 1e3, Step: 60 * 1e3},
+		},
+		{
+			name:     "length after lookback",
+			limits:   func(l *validation.Limits) { l.MaxQueryLookback = time.Hour; l.MaxQueryLength = 2 * time.Hour },
+			req:      QueryRangeRequest{Start: 0, End: 100000 * 1e3, Step: 60 * 1e3},
+			expected: &QueryRangeRequest{Start: 96420 * 1e3, End: 100000 * 1e3, Step: 60 * 1e3},
+		},
+		{
+			name:   "too long",
+			limits: func(l *validation.Limits) { l.MaxQueryLength = time.Hour },
+			req:    QueryRangeRequest{Start: 0, End: 7200 * 1e3, Step: 60 * 1e3},
+			err:    "invalid query, length > limit (2h0m0s > 1h0m0s)",
+		},
+		{
+			name:   "step too small",
+			limits: func(l *validation.Limits) { l.MinQueryStep = time.Minute },
+			req:    QueryRangeRequest{Start: 0, End: 3600 * 1e3, Step: 15 * 1e3},
+			err:    "query step 15s is smaller than the limit of 1m0s, try increasing the step",
+		},
+		{
+			name:   "too many points",
+			limits: func(l *validation.Limits) { l.MaxPointsPerSeries = 100 },
+			req:    QueryRangeRequest{Start: 0, End: 3600 * 1e3, Step: 15 * 1e3},
+			err:    "query would return more than 100 points per series, try increasing the step",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := tc.req
+			limited, err := limitQueryRange(overrides(t, tc.limits), "1", &req, now)
+			if tc.err != "" {
+				resp, ok := httpgrpc.HTTPResponseFromError(err)
+				require.True(t, ok)
+				assert.Equal(t, int32(http.StatusBadRequest), resp.Code)
+				assert.JSONEq(t, `{"status": "error", "errorType": "bad_data", "error": "`+tc.err+`"}`, string(resp.Body))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, limited)
+		})
+	}
+}
+
+func TestLimitLookback(t *testing.T) {
+	now := time.Unix(100000, 0)
+	limits := overrides(t, func(l *validation.Limits) { l.MaxQueryLookback = time.Hour })
+	for _, tc := range []struct {
+		name          string
+		method, url   string
+		body          string
+		expectedBody  string
+		expectedStart string
+	}{
+		{
+			name:   "range query",
+			method: "GET",
+			url:    "/api/prom/api/v1/query_range?query=up&start=0&end=100000&step=60",
+		},
+		{
+			name:   "instant query",
+			method: "GET",
+			url:    "/api/prom/api/v1/query?query=up&time=99000",
+		},
+		{
+			name:         "instant query before lookback",
+			method:       "GET",
+			url:          "/api/prom/api/v1/query?query=up&time=1000",
+			expectedBody: `{"status":"success","data":{"resultType":"vector","result":[]}}`,
+		},
+		{
+			name:          "series",
+			method:        "GET",
+			url:           "/api/prom/api/v1/series?match[]=up&start=0&end=100000",
+			expectedStart: "96400",
+		},
+		{
+			name:          "series without start",
+			method:        "GET",
+			url:           "/api/prom/api/v1/series?match[]=up",
+			expectedStart: "96400",
+		},
+		{
+			name:          "series in body",
+			method:        "POST",
+			url:           "/api/prom/api/v1/series",
+			body:          "match[]=up&start=0",
+			expectedStart: "96400",
+		},
+		{
+			name:         "series before lookback",
+			method:       "GET",
+			url:          "/api/prom/api/v1/series?match[]=up&start=0&end=1000",
+			expectedBody: `{"status":"success","data":[]}`,
+		},
+		{
+			name:          "label values",
+			method:        "GET",
+			url:           "/api/prom/api/v1/label/job/values?start=0",
+			expectedStart: "96400",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+			if tc.body != "" {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			resp, err := limitLookback(limits, "1", req, now)
+			require.NoError(t, err)
+
+			if tc.expectedBody != "" {
+				require.NotNil(t, resp)
+				body, err := ioutil.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.JSONEq(t, tc.expectedBody, string(body))
+				return
+			}
+			require.Nil(t, resp)
+			if tc.expectedStart != "" {
+				assert.Equal(t, tc.expectedStart, req.URL.Query().Get("start"))
+				if tc.body != "" {
+					body, err := ioutil.ReadAll(req.Body)
+					require.NoError(t, err)
+					params, err := url.ParseQuery(string(body))
+					require.NoError(t, err)
+					assert.Equal(t, tc.expectedStart, params.Get("start"))
+				}
+			}
+		})
+	}
+}
+
+func TestMaxConcurrentQueries(t *testing.T) {
+	f := &Frontend{
+		limits:        overrides(t, func(l *validation.Limits) { l.MaxConcurrentQueries = 2 }),
+		tenantQueries: map[string]int{},
+	}
+
+	require.NoError(t, f.startTenantQuery("1"))
+	require.NoError(t, f.startTenantQuery("1"))
+	require.NoError(t, f.startTenantQuery("2"))
+
+	err := f.startTenantQuery("1")
+	resp, ok := httpgrpc.HTTPResponseFromError(err)
+	require.True(t, ok)
+	assert.Equal(t, int32(http.StatusTooManyRequests), resp.Code)
+
+	f.endTenantQuery("1")
+	require.NoError(t, f.startTenantQuery("1"))
+}
@@ -0,0 +1,403 @@
+package frontend
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/gogo/protobuf/proto"
+	opentracing "github.com/opentracing/opentracing-go"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/weaveworks/common/httpgrpc"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/chunk/cache"
+	"github.com/cortexproject/cortex/pkg/ingester/client"
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+var labelValuesPath = regexp.MustCompile("/label/[^/]+/values$")
+
+// metadataCache caches the responses to series, label names and label values
+// queries.  Series queries are split by day, and the series found over each
+// range of each day are cached as extents, like resultsCache's; extents
+// which meet are merged by taking the union of their series.  Label names
+// and values aren't limited by time, so are cached whole, for
+// MaxCacheFreshness.
+type metadataCache struct {
+	cfg    resultsCacheConfig
+	next   http.RoundTripper
+	cache  cache.Cache
+	limits *validation.Overrides
+}
+
+func newMetadataCache(cfg resultsCacheConfig, limits *validation.Overrides, next http.RoundTripper) (http.RoundTripper, error) {
+	c, err := cache.New(cfg.cacheConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return metadataCache{
+		cfg:    cfg,
+		next:   next,
+		cache:  cache.NewSnappy(c),
+		limits: limits,
+	}, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (m metadataCache) RoundTrip(r *http.Request) (*http.Response, error) {
+	userID, err := user.ExtractOrgID(r.Context())
+	if err != nil || r.Method != "GET" {
+		return m.next.RoundTrip(r)
+	}
+
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/series"):
+		return m.series(r, userID)
+	case strings.HasSuffix(r.URL.Path, "/labels"), labelValuesPath.MatchString(r.URL.Path):
+		return m.labels(r, userID)
+	default:
+		return m.next.RoundTrip(r)
+	}
+}
+
+// labels answers label names and values queries from the cache, if they were
+// cached in the last MaxCacheFreshness.  The extent cached only has its
+// start, which is when it was cached.
+func (m metadataCache) labels(r *http.Request, userID string) (*http.Response, error) {
+	if m.cfg.MaxCacheFreshness <= 0 {
+		return m.next.RoundTrip(r)
+	}
+
+	ctx := r.Context()
+	key := fmt.Sprintf("%s:%s", userID, r.URL.Path)
+	now := time.Now()
+	extents, ok := m.get(ctx, key)
+	if ok && len(extents) == 1 && now.Sub(timestamp.Time(extents[0].Start)) < m.cfg.MaxCacheFreshness {
+		addCacheHits(ctx, 1)
+		return metadataResponse(extents[0].Values)
+	}
+
+	var values []string
+	if err := m.fetch(r, &values); err != nil {
+		return nil, err
+	}
+	m.put(ctx, key, []MetadataExtent{{
+		Start:  timestamp.FromTime(now),
+		End:    timestamp.FromTime(now),
+		Values: values,
+	}})
+	return metadataResponse(values)
+}
+
+// series answers a series query from the days it covers, in parallel.
+// Queries without a start and end aren't cached.
+func (m metadataCache) series(r *http.Request, userID string) (*http.Response, error) {
+	params := r.URL.Query()
+	matchers := append([]string(nil), params["match[]"]...)
+	if len(matchers) == 0 || params.Get("start") == "" || params.Get("end") == "" {
+		return m.next.RoundTrip(r)
+	}
+	start, err := ParseTime(params.Get("start"))
+	if err != nil {
+		return m.next.RoundTrip(r)
+	}
+	end, err := ParseTime(params.Get("end"))
+	if err != nil || end < start {
+		return m.next.RoundTrip(r)
+	}
+	sort.Strings(matchers)
+
+	days := []MetadataExtent{}
+	for dayStart := (start / millisecondPerDay) * millisecondPerDay; dayStart <= end; dayStart += millisecondPerDay {
+		from, through := dayStart, dayStart+millisecondPerDay-1
+		if from < start {
+			from = start
+		}
+		if through > end {
+			through = end
+		}
+		days = append(days, MetadataExtent{Start: from, End: through})
+	}
+
+	// Feed the days to at most MaxQueryParallelism workers.
+	parallelism := m.limits.MaxQueryParallelism(userID)
+	if parallelism > len(days) || parallelism <= 0 {
+		parallelism = len(days)
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	r = r.WithContext(ctx)
+	intermediate := make(chan int)
+	go func() {
+		defer close(intermediate)
+		for i := range days {
+			select {
+			case intermediate <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var (
+		wg       sync.WaitGroup
+		mtx      sync.Mutex
+		firstErr error
+	)
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range intermediate {
+				key := fmt.Sprintf("%s:series:%q:%d", userID, matchers, days[i].Start/millisecondPerDay)
+				series, err := m.seriesForDay(r, key, days[i].Start, days[i].End)
+
+				mtx.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				days[i].Series = series
+				mtx.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	result := []client.Metric{}
+	for _, day := range days {
+		result = unionSeries(result, day.Series)
+	}
+	series := make([]labels.Labels, 0, len(result))
+	for _, s := range result {
+		series = append(series, client.FromLabelAdaptersToLabels(s.Labels))
+	}
+	return metadataResponse(series)
+}
+
+// seriesForDay returns the series found from through, within one day,
+// querying for the ranges not in the cache.
+func (m metadataCache) seriesForDay(r *http.Request, key string, from, through int64) ([]client.Metric, error) {
+	ctx := r.Context()
+	extents, _ := m.get(ctx, key)
+	missing, cached := partitionMetadata(from, through, extents)
+	addCacheHits(ctx, len(cached))
+
+	// Ranges which end before the most recent cacheable time are queried
+	// separately from the rest, so they can be cached.
+	maxCacheTime := timestamp.FromTime(time.Now().Add(-m.cfg.MaxCacheFreshness))
+	fetched := []MetadataExtent{}
+	for i := 0; i < len(missing); i++ {
+		extent := missing[i]
+		if extent.Start <= maxCacheTime && maxCacheTime < extent.End {
+			missing = append(missing, MetadataExtent{Start: maxCacheTime + 1, End: extent.End})
+			extent.End = maxCacheTime
+		}
+
+		var series []labels.Labels
+		if err := m.fetch(seriesRequest(r, extent.Start, extent.End), &series); err != nil {
+			return nil, err
+		}
+		extent.Series = make([]client.Metric, 0, len(series))
+		for _, s := range series {
+			extent.Series = append(extent.Series, client.Metric{Labels: client.FromLabelsToLabelAdapaters(s)})
+		}
+		fetched = append(fetched, extent)
+	}
+
+	result := []client.Metric{}
+	for _, extent := range append(cached, fetched...) {
+		result = unionSeries(result, extent.Series)
+	}
+
+	cacheable := []MetadataExtent{}
+	for _, extent := range fetched {
+		// Never cache data for the latest freshness period.
+		if extent.End <= maxCacheTime {
+			cacheable = append(cacheable, extent)
+		}
+	}
+	if len(cacheable) > 0 {
+		m.put(ctx, key, mergeMetadataExtents(append(extents, cacheable...)))
+	}
+	return result, nil
+}
+
+// partitionMetadata returns the ranges from through which aren't cached, and
+// the cached extents within it.  Extents which reach outside it may have
+// series which aren't in it, so can't be used.
+func partitionMetadata(from, through int64, extents []MetadataExtent) ([]MetadataExtent, []MetadataExtent) {
+	var missing, cached []MetadataExtent
+	start := from
+	for _, extent := range extents {
+		if extent.Start < start || extent.End > through {
+			continue
+		}
+		if start < extent.Start {
+			missing = append(missing, MetadataExtent{Start: start, End: extent.Start - 1})
+		}
+		cached = append(cached, extent)
+		start = extent.End + 1
+	}
+	if start <= through {
+		missing = append(missing, MetadataExtent{Start: start, End: through})
+	}
+	return missing, cached
+}
+
+// mergeMetadataExtents merges extents which overlap or meet, taking the union
+// of their series.
+func mergeMetadataExtents(extents []MetadataExtent) []MetadataExtent {
+	if len(extents) == 0 {
+		return extents
+	}
+	sort.Slice(extents, func(i, j int) bool {
+		return extents[i].Start < extents[j].Start
+	})
+
+	accumulator, merged := extents[0], make([]MetadataExtent, 0, len(extents))
+	for _, extent := range extents[1:] {
+		if accumulator.End+1 < extent.Start {
+			merged = append(merged, accumulator)
+			accumulator = extent
+			continue
+		}
+
+		if extent.End > accumulator.End {
+			accumulator.End = extent.End
+		}
+		accumulator.Series = unionSeries(accumulator.Series, extent.Series)
+	}
+	return append(merged, accumulator)
+}
+
+// unionSeries returns the distinct series in a and b, sorted by their labels.
+func unionSeries(a, b []client.Metric) []client.Metric {
+	seen := make(map[string]struct{}, len(a)+len(b))
+	result := make([]client.Metric, 0, len(a)+len(b))
+	for _, series := range [][]client.Metric{a, b} {
+		for _, s := range series {
+			key := client.FromLabelAdaptersToLabels(s.Labels).String()
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			result = append(result, s)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return client.FromLabelAdaptersToLabels(result[i].Labels).String() < client.FromLabelAdaptersToLabels(result[j].Labels).String()
+	})
+	return result
+}
+
+// seriesRequest returns a copy of the series query r, over from through.
+func seriesRequest(r *http.Request, from, through int64) *http.Request {
+	u := *r.URL
+	params := u.Query()
+	params.Set("start", encodeTime(from))
+	params.Set("end", encodeTime(through))
+	u.RawQuery = params.Encode()
+
+	req := r.WithContext(r.Context())
+	req.URL = &u
+	return req
+}
+
+// fetch sends r downstream, and decodes the data of its response into data.
+func (m metadataCache) fetch(r *http.Request, data interface{}) error {
+	resp, err := m.next.RoundTrip(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return httpgrpc.Errorf(http.StatusInternalServerError, "error reading response: %v", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return httpgrpc.Errorf(resp.StatusCode, string(body))
+	}
+
+	apiResp := struct {
+		Data interface{} `json:"data"`
+	}{data}
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return httpgrpc.Errorf(http.StatusInternalServerError, "error decoding response: %v", err)
+	}
+	return nil
+}
+
+// metadataResponse returns a successful Prometheus API response with data.
+func metadataResponse(data interface{}) (*http.Response, error) {
+	body, err := json.Marshal(struct {
+		Status string      `json:"status"`
+		Data   interface{} `json:"data"`
+	}{statusSuccess, data})
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		Header: http.Header{
+			"Content-Type": []string{"application/json"},
+		},
+		Body:       ioutil.NopCloser(bytes.NewBuffer(body)),
+		StatusCode: http.StatusOK,
+	}, nil
+}
+
+func (m metadataCache) get(ctx context.Context, key string) ([]MetadataExtent, bool) {
+	found, bufs, _ := m.cache.Fetch(ctx, []string{cache.HashKey(key)})
+	if len(found) != 1 {
+		return nil, false
+	}
+
+	var resp CachedMetadata
+	sp, _ := opentracing.StartSpanFromContext(ctx, "unmarshal-metadata-extent")
+	defer sp.Finish()
+
+	sp.LogFields(otlog.Int("bytes", len(bufs[0])))
+
+	if err := proto.Unmarshal(bufs[0], &resp); err != nil {
+		level.Error(util.Logger).Log("msg", "error unmarshalling cached value", "err", err)
+		sp.LogFields(otlog.Error(err))
+		return nil, false
+	}
+
+	if resp.Key != key {
+		return nil, false
+	}
+
+	return resp.Extents, true
+}
+
+func (m metadataCache) put(ctx context.Context, key string, extents []MetadataExtent) {
+	buf, err := proto.Marshal(&CachedMetadata{
+		Key:     key,
+		Extents: extents,
+	})
+	if err != nil {
+		level.Error(util.Logger).Log("msg", "error marshalling cached value", "err", err)
+		return
+	}
+
+	m.cache.Store(ctx, []string{cache.HashKey(key)}, [][]byte{buf})
+}
@@ -0,0 +1,184 @@
+package frontend
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/chunk/cache"
+	"github.com/cortexproject/cortex/pkg/ingester/client"
+)
+
+// mockMetadataDownstream answers series queries with the series which have a
+// sample in their range, and label queries with the names of all series.
+type mockMetadataDownstream struct {
+	samples map[string]int64
+	calls   []url.Values
+}
+
+func (m *mockMetadataDownstream) RoundTrip(r *http.Request) (*http.Response, error) {
+	params := r.URL.Query()
+	m.calls = append(m.calls, params)
+
+	data := []string{}
+	if strings.HasSuffix(r.URL.Path, "/series") {
+		start, err := ParseTime(params.Get("start"))
+		if err != nil {
+			return nil, err
+		}
+		end, err := ParseTime(params.Get("end"))
+		if err != nil {
+			return nil, err
+		}
+		for name, ts := range m.samples {
+			if start <= ts && ts <= end {
+				data = append(data, `{"__name__":"`+name+`"}`)
+			}
+		}
+		return metadataTestResponse("[" + strings.Join(data, ",") + "]"), nil
+	}
+
+	for name := range m.samples {
+		data = append(data, `"`+name+`"`)
+	}
+	return metadataTestResponse("[" + strings.Join(data, ",") + "]"), nil
+}
+
+func metadataTestResponse(data string) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader(`{"status":"success","data":` + data + `}`)),
+	}
+}
+
+func metadataTestRequest(t *testing.T, m http.RoundTripper, path string) string {
+	req := httptest.NewRequest("GET", path, nil)
+	req = req.WithContext(user.InjectOrgID(context.Background(), "1"))
+	resp, err := m.RoundTrip(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestMetadataCacheSeries(t *testing.T) {
+	day := 24 * time.Hour
+	midnight := time.Now().Truncate(day).Add(-2 * day)
+	downstream := &mockMetadataDownstream{
+		samples: map[string]int64{
+			"a": timestamp.FromTime(midnight.Add(-time.Hour)),
+			"b": timestamp.FromTime(midnight.Add(time.Hour)),
+			"c": timestamp.FromTime(midnight.Add(3 * time.Hour)),
+		},
+	}
+	m, err := newMetadataCache(resultsCacheConfig{
+		cacheConfig:       cache.Config{Cache: cache.NewMockCache()},
+		MaxCacheFreshness: time.Minute,
+	}, defaultOverrides(t), downstream)
+	require.NoError(t, err)
+
+	query := func(from, through time.Time) string {
+		return metadataTestRequest(t, m, "/api/prom/api/v1/series?match[]=up&start="+encodeTime(timestamp.FromTime(from))+"&end="+encodeTime(timestamp.FromTime(through)))
+	}
+
+	// The first query is split by day.
+	body := query(midnight.Add(-2*time.Hour), midnight.Add(2*time.Hour))
+	assert.JSONEq(t, `{"status":"success","data":[{"__name__":"a"},{"__name__":"b"}]}`, body)
+	assert.Len(t, downstream.calls, 2)
+
+	// The same query is answered from the cache.
+	downstream.calls = nil
+	body = query(midnight.Add(-2*time.Hour), midnight.Add(2*time.Hour))
+	assert.JSONEq(t, `{"status":"success","data":[{"__name__":"a"},{"__name__":"b"}]}`, body)
+	assert.Len(t, downstream.calls, 0)
+
+	// A longer query only queries the range which isn't cached, and the
+	// extents are merged.
+	body = query(midnight.Add(-2*time.Hour), midnight.Add(4*time.Hour))
+	assert.JSONEq(t, `{"status":"success","data":[{"__name__":"a"},{"__name__":"b"},{"__name__":"c"}]}`, body)
+	require.Len(t, downstream.calls, 1)
+	assert.Equal(t, encodeTime(timestamp.FromTime(midnight.Add(2*time.Hour))+1), downstream.calls[0].Get("start"))
+
+	// A shorter query can't use the extent, as it may have more series.
+	downstream.calls = nil
+	body = query(midnight, midnight.Add(2*time.Hour))
+	assert.JSONEq(t, `{"status":"success","data":[{"__name__":"b"}]}`, body)
+	assert.Len(t, downstream.calls, 1)
+}
+
+func TestMetadataCacheRecentSeries(t *testing.T) {
+	now := time.Now()
+	downstream := &mockMetadataDownstream{
+		samples: map[string]int64{"a": timestamp.FromTime(now.Add(-time.Minute))},
+	}
+	m, err := newMetadataCache(resultsCacheConfig{
+		cacheConfig:       cache.Config{Cache: cache.NewMockCache()},
+		MaxCacheFreshness: 10 * time.Minute,
+	}, defaultOverrides(t), downstream)
+	require.NoError(t, err)
+
+	path := "/api/prom/api/v1/series?match[]=up&start=" + encodeTime(timestamp.FromTime(now.Add(-time.Hour))) + "&end=" + encodeTime(timestamp.FromTime(now))
+	body := metadataTestRequest(t, m, path)
+	assert.JSONEq(t, `{"status":"success","data":[{"__name__":"a"}]}`, body)
+
+	// Once the older range is cached, only the recent range is queried.
+	downstream.calls = nil
+	body = metadataTestRequest(t, m, path)
+	assert.JSONEq(t, `{"status":"success","data":[{"__name__":"a"}]}`, body)
+	require.NotEmpty(t, downstream.calls)
+	for _, call := range downstream.calls {
+		start, err := ParseTime(call.Get("start"))
+		require.NoError(t, err)
+		assert.True(t, start > timestamp.FromTime(now.Add(-11*time.Minute)))
+	}
+}
+
+func TestMetadataCacheLabels(t *testing.T) {
+	downstream := &mockMetadataDownstream{
+		samples: map[string]int64{"a": 0},
+	}
+	m, err := newMetadataCache(resultsCacheConfig{
+		cacheConfig:       cache.Config{Cache: cache.NewMockCache()},
+		MaxCacheFreshness: time.Minute,
+	}, defaultOverrides(t), downstream)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		body := metadataTestRequest(t, m, "/api/prom/api/v1/label/__name__/values")
+		assert.JSONEq(t, `{"status":"success","data":["a"]}`, body)
+	}
+	assert.Len(t, downstream.calls, 1)
+
+	// Other label queries are cached separately.
+	metadataTestRequest(t, m, "/api/prom/api/v1/labels")
+	assert.Len(t, downstream.calls, 2)
+}
+
+func TestMergeMetadataExtents(t *testing.T) {
+	a := []client.Metric{{Labels: []client.LabelAdapter{{Name: "__name__", Value: "a"}}}}
+	b := []client.Metric{{Labels: []client.LabelAdapter{{Name: "__name__", Value: "b"}}}}
+	merged := mergeMetadataExtents([]MetadataExtent{
+		{Start: 20, End: 29, Series: b},
+		{Start: 0, End: 9, Series: a},
+		{Start: 10, End: 15, Series: b},
+	})
+	assert.Equal(t, []MetadataExtent{
+		{Start: 0, End: 15, Series: append(a, b...)},
+		{Start: 20, End: 29, Series: b},
+	}, merged)
+
+	missing, cached := partitionMetadata(0, 30, merged)
+	assert.Equal(t, []MetadataExtent{{Start: 16, End: 19}, {Start: 30, End: 30}}, missing)
+	assert.Equal(t, merged, cached)
+}
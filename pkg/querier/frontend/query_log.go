@@ -0,0 +1,261 @@
+package frontend
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/gorilla/mux"
+	"github.com/weaveworks/common/middleware"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/stats"
+)
+
+type contextKey int
+
+// runningQueryKey is the context key of the runningQuery a request belongs
+// to, so the parts of the pipeline it goes through can add to it.
+const runningQueryKey contextKey = 0
+
+// runningQuery is a query the frontend is handling.
+type runningQuery struct {
+	ID     uint64
+	User   string
+	Path   string
+	Params url.Values
+	Start  time.Time
+	cancel context.CancelFunc
+
+	mtx        sync.Mutex
+	queueTime  time.Duration
+	subQueries int
+	cacheHits  int
+}
+
+func (q *runningQuery) addQueueTime(d time.Duration) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	q.queueTime += d
+}
+
+func (q *runningQuery) addSubQuery() {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	q.subQueries++
+}
+
+func (q *runningQuery) addCacheHits(n int) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	q.cacheHits += n
+}
+
+// addCacheHits adds to the results cache hits of the query ctx belongs to,
+// if any.
+func addCacheHits(ctx context.Context, n int) {
+	if query, ok := ctx.Value(runningQueryKey).(*runningQuery); ok {
+		query.addCacheHits(n)
+	}
+}
+
+// startQuery records r as running until endQuery is called, so it can be
+// listed and cancelled.
+func (f *Frontend) startQuery(r *http.Request, cancel context.CancelFunc) *runningQuery {
+	userID, _ := user.ExtractOrgID(r.Context())
+	query := &runningQuery{
+		User:   userID,
+		Path:   r.URL.Path,
+		Params: requestParams(r),
+		Start:  time.Now(),
+		cancel: cancel,
+	}
+
+	f.runningMtx.Lock()
+	defer f.runningMtx.Unlock()
+	f.nextRunningID++
+	query.ID = f.nextRunningID
+	f.running[query.ID] = query
+	return query
+}
+
+func (f *Frontend) endQuery(query *runningQuery) {
+	f.runningMtx.Lock()
+	defer f.runningMtx.Unlock()
+	delete(f.running, query.ID)
+}
+
+// requestParams returns the query parameters of r, including those in a form
+// body, leaving the body to be read again.
+func requestParams(r *http.Request) url.Values {
+	params := r.URL.Query()
+	if r.Method != "POST" || r.Body == nil || r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		return params
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return params
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return params
+	}
+	for k, vs := range form {
+		params[k] = append(params[k], vs...)
+	}
+	return params
+}
+
+// reportQuery records the stats of a finished query in the per-user metrics,
+// and logs it, with its stats, if it was slow or sampled.
+func (f *Frontend) reportQuery(query *runningQuery, queryStats *stats.Stats, status int, size int64) {
+	duration := time.Since(query.Start)
+	if queryStats != nil && query.User != "" {
+		s := queryStats.Snapshot()
+		querierSeconds.WithLabelValues(query.User).Add(s.WallTime.Seconds())
+		queryFetchedChunks.WithLabelValues(query.User).Add(float64(s.FetchedChunks))
+		queryFetchedChunkBytes.WithLabelValues(query.User).Add(float64(s.FetchedChunkBytes))
+		queryIndexQueries.WithLabelValues(query.User).Add(float64(s.IndexQueries))
+		queryIngesterSeries.WithLabelValues(query.User).Add(float64(s.IngesterSeries))
+	}
+
+	if !f.shouldLogQuery(duration) {
+		return
+	}
+
+	query.mtx.Lock()
+	queueTime, subQueries, cacheHits := query.queueTime, query.subQueries, query.cacheHits
+	query.mtx.Unlock()
+
+	fields := []interface{}{
+		"msg", "query",
+		"user", query.User,
+		"path", query.Path,
+		"query", query.Params.Get("query"),
+		"start", query.Params.Get("start"),
+		"end", query.Params.Get("end"),
+		"step", query.Params.Get("step"),
+		"time", query.Params.Get("time"),
+		"duration", duration,
+		"queue_time", queueTime,
+		"split_queries", subQueries,
+		"results_cache_hits", cacheHits,
+		"response_bytes", size,
+		"status", status,
+	}
+	if queryStats != nil {
+		fields = append(fields, queryStats.KeyValues()...)
+	}
+	level.Info(f.log).Log(fields...)
+}
+
+// shouldLogQuery decides whether to log a query which took duration.  Slow
+// queries are always logged; other queries are sampled.
+func (f *Frontend) shouldLogQuery(duration time.Duration) bool {
+	switch {
+	case f.cfg.LogQueriesLongerThan > 0 && duration > f.cfg.LogQueriesLongerThan:
+		return true
+	case f.cfg.LogQueriesSampleRatio > 0:
+		return rand.Float64() < f.cfg.LogQueriesSampleRatio
+	default:
+		return false
+	}
+}
+
+// RegisterRoutes registers the frontend's API for the queries it's running:
+// GET /frontend/queries lists them, and DELETE /frontend/queries/{id} cancels
+// one.  Both need an org ID, and only see the caller's own queries.  The
+// cache generations API is registered too, if they're enabled.
+func (f *Frontend) RegisterRoutes(router *mux.Router) {
+	router.Path("/frontend/queries").Methods("GET").Handler(middleware.AuthenticateUser.Wrap(http.HandlerFunc(f.listQueries)))
+	router.Path("/frontend/queries/{id}").Methods("DELETE").Handler(middleware.AuthenticateUser.Wrap(http.HandlerFunc(f.cancelQuery)))
+	if f.generations != nil {
+		f.generations.RegisterRoutes(router)
+	}
+}
+
+type runningQueryDesc struct {
+	ID              uint64     `json:"id"`
+	User            string     `json:"user"`
+	Path            string     `json:"path"`
+	Params          url.Values `json:"params"`
+	Start           time.Time  `json:"start"`
+	DurationSeconds float64    `json:"duration_seconds"`
+	SplitQueries    int        `json:"split_queries"`
+}
+
+// listQueries lists the caller's running queries, oldest first.
+func (f *Frontend) listQueries(w http.ResponseWriter, r *http.Request) {
+	userID, err := user.ExtractOrgID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	f.runningMtx.Lock()
+	queries := make([]runningQueryDesc, 0, len(f.running))
+	now := time.Now()
+	for _, query := range f.running {
+		if query.User != userID {
+			continue
+		}
+		query.mtx.Lock()
+		queries = append(queries, runningQueryDesc{
+			ID:              query.ID,
+			User:            query.User,
+			Path:            query.Path,
+			Params:          query.Params,
+			Start:           query.Start,
+			DurationSeconds: now.Sub(query.Start).Seconds(),
+			SplitQueries:    query.subQueries,
+		})
+		query.mtx.Unlock()
+	}
+	f.runningMtx.Unlock()
+
+	sort.Slice(queries, func(i, j int) bool {
+		return queries[i].ID < queries[j].ID
+	})
+	util.WriteJSONResponse(w, struct {
+		Queries []runningQueryDesc `json:"queries"`
+	}{queries})
+}
+
+// cancelQuery cancels one of the caller's running queries.  Other tenants'
+// queries are reported as not found.
+func (f *Frontend) cancelQuery(w http.ResponseWriter, r *http.Request) {
+	userID, err := user.ExtractOrgID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid query ID", http.StatusBadRequest)
+		return
+	}
+
+	f.runningMtx.Lock()
+	query, ok := f.running[id]
+	f.runningMtx.Unlock()
+	if !ok || query.User != userID {
+		http.Error(w, "query not found", http.StatusNotFound)
+		return
+	}
+
+	level.Info(f.log).Log("msg", "cancelling query", "id", id, "user", query.User)
+	query.cancel()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,104 @@
+package frontend
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+)
+
+func TestRunningQueries(t *testing.T) {
+	f := &Frontend{
+		log:     log.NewNopLogger(),
+		running: map[uint64]*runningQuery{},
+	}
+	router := mux.NewRouter()
+	f.RegisterRoutes(router)
+
+	req := httptest.NewRequest("GET", "/api/prom/api/v1/query_range?query=up&start=0&end=3600&step=15", nil)
+	req = req.WithContext(user.InjectOrgID(context.Background(), "1"))
+	ctx, cancel := context.WithCancel(req.Context())
+	query := f.startQuery(req, cancel)
+	query.addSubQuery()
+
+	serve := func(method, path, orgID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if orgID != "" {
+			req.Header.Set(user.OrgIDHeaderName, orgID)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	list := func(orgID string) []runningQueryDesc {
+		rec := serve("GET", "/frontend/queries", orgID)
+		require.Equal(t, http.StatusOK, rec.Code)
+		var list struct {
+			Queries []runningQueryDesc `json:"queries"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+		return list.Queries
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serve("GET", "/frontend/queries", "").Code)
+	assert.Empty(t, list("2"))
+
+	queries := list("1")
+	require.Len(t, queries, 1)
+	assert.Equal(t, query.ID, queries[0].ID)
+	assert.Equal(t, "1", queries[0].User)
+	assert.Equal(t, "up", queries[0].Params.Get("query"))
+	assert.Equal(t, 1, queries[0].SplitQueries)
+
+	// Other tenants can't cancel the query.
+	assert.Equal(t, http.StatusUnauthorized, serve("DELETE", "/frontend/queries/1", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve("DELETE", "/frontend/queries/1", "2").Code)
+	assert.NoError(t, ctx.Err())
+
+	require.Equal(t, http.StatusNoContent, serve("DELETE", "/frontend/queries/1", "1").Code)
+	assert.Equal(t, context.Canceled, ctx.Err())
+
+	f.endQuery(query)
+	assert.Equal(t, http.StatusNotFound, serve("DELETE", "/frontend/queries/1", "1").Code)
+}
+
+func TestRequestParams(t *testing.T) {
+	req := httptest.NewRequest("POST", "/api/prom/api/v1/query?time=10", strings.NewReader("query=up"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	params := requestParams(req)
+	assert.Equal(t, "up", params.Get("query"))
+	assert.Equal(t, "10", params.Get("time"))
+
+	body, err := ioutil.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "query=up", string(body))
+}
+
+func TestShouldLogQuery(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		cfg      Config
+		duration time.Duration
+		expected bool
+	}{
+		{"disabled", Config{}, time.Minute, false},
+		{"fast", Config{LogQueriesLongerThan: time.Second}, time.Millisecond, false},
+		{"slow", Config{LogQueriesLongerThan: time.Second}, time.Minute, true},
+		{"sampled", Config{LogQueriesSampleRatio: 1}, time.Millisecond, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &Frontend{cfg: tc.cfg}
+			assert.Equal(t, tc.expected, f.shouldLogQuery(tc.duration))
+		})
+	}
+}
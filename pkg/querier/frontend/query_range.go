@@ -295,7 +295,14 @@ func matrixMerge(resps []*APIResponse) []SampleStream {
 					Labels: stream.Labels,
 				}
 			}
-			existing.Samples = append(existing.Samples, stream.Samples...)
+			// Responses are sorted, but may overlap where a split query's
+			// parts or cached extents meet; keep the first of each sample.
+			for _, sample := range stream.Samples {
+				if n := len(existing.Samples); n > 0 && sample.TimestampMs <= existing.Samples[n-1].TimestampMs {
+					continue
+				}
+				existing.Samples = append(existing.Samples, sample)
+			}
 			output[metric] = existing
 		}
 	}
@@ -247,6 +247,30 @@ func TestMergeAPIResponses(t *testing.T) {
 			},
 		},
 
+		// Merging of responses which overlap.
+		{
+			input: []*APIResponse{
+				mustParse(t, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"a":"b"},"values":[[0,"0"],[1,"1"]]}]}}`),
+				mustParse(t, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"a":"b"},"values":[[1,"1"],[2,"2"]]}]}}`),
+			},
+			expected: &APIResponse{
+				Status: statusSuccess,
+				Data: QueryRangeResponse{
+					ResultType: matrix,
+					Result: []SampleStream{
+						{
+							Labels: []client.LabelAdapter{{Name: "a", Value: "b"}},
+							Samples: []client.Sample{
+								{Value: 0, TimestampMs: 0},
+								{Value: 1, TimestampMs: 1000},
+								{Value: 2, TimestampMs: 2000},
+							},
+						},
+					},
+				},
+			},
+		},
+
 		// Merging of responses when labels are in different order.
 		{
 			input: []*APIResponse{
@@ -58,8 +58,7 @@ func (s resultsCache) Do(ctx context.Context, r *QueryRangeRequest) (*APIRespons
 	}
 
 	var (
-		day      = r.Start / millisecondPerDay
-		key      = fmt.Sprintf("%s:%s:%d:%d", userID, r.Query, r.Step, day)
+		key      = generateKey(userID, r)
 		extents  []Extent
 		response *APIResponse
 	)
@@ -84,6 +83,17 @@ func (s resultsCache) Do(ctx context.Context, r *QueryRangeRequest) (*APIRespons
 	return response, err
 }
 
+// generateKey returns the cache key for r.  Queries whose start isn't aligned
+// with their step get a key of their own for each offset, as their samples
+// are at different times to aligned queries'.
+func generateKey(userID string, r *QueryRangeRequest) string {
+	day := r.Start / millisecondPerDay
+	if offset := r.Start % r.Step; offset != 0 {
+		return fmt.Sprintf("%s:%s:%d:%d:%d", userID, r.Query, r.Step, day, offset)
+	}
+	return fmt.Sprintf("%s:%s:%d:%d", userID, r.Query, r.Step, day)
+}
+
 func (s resultsCache) handleMiss(ctx context.Context, r *QueryRangeRequest) (*APIResponse, []Extent, error) {
 	response, err := s.next.Do(ctx, r)
 	if err != nil {
@@ -107,6 +117,7 @@ func (s resultsCache) handleHit(ctx context.Context, r *QueryRangeRequest, exten
 	)
 
 	requests, responses := partition(r, extents)
+	addCacheHits(ctx, len(responses))
 	if len(requests) == 0 {
 		response, err := mergeAPIResponses(responses)
 		// No downstream requests so no need to write back to the cache.
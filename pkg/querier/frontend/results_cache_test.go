@@ -231,3 +231,58 @@ func TestResultsCacheRecent(t *testing.T) {
 	require.Equal(t, 2, calls)
 	require.Equal(t, parsedResponse, resp)
 }
+
+// storedKeys is a cache recording the keys stored in it.
+type storedKeys struct {
+	cache.Cache
+	keys []string
+}
+
+func (s *storedKeys) Store(ctx context.Context, keys []string, bufs [][]byte) {
+	s.keys = append(s.keys, keys...)
+	s.Cache.Store(ctx, keys, bufs)
+}
+
+func TestResultsCacheGenerations(t *testing.T) {
+	generations, err := cache.NewGenerations(cache.GenerationsConfig{Store: "inmemory"})
+	require.NoError(t, err)
+	defer generations.Stop()
+	ctx := user.InjectOrgID(context.Background(), "1")
+	_, err = generations.Bump(ctx, "1")
+	require.NoError(t, err)
+
+	var cfg resultsCacheConfig
+	flagext.DefaultValues(&cfg)
+	stored := &storedKeys{Cache: cache.NewMockCache()}
+	cfg.cacheConfig, err = sharedCacheConfig(cache.Config{Cache: stored}, generations)
+	require.NoError(t, err)
+	rcm, err := newResultsCacheMiddleware(cfg, defaultOverrides(t))
+	require.NoError(t, err)
+
+	rc := rcm.Wrap(queryRangeHandlerFunc(func(_ context.Context, r *QueryRangeRequest) (*APIResponse, error) {
+		return parsedResponse, nil
+	}))
+	_, err = rc.Do(ctx, parsedRequest)
+	require.NoError(t, err)
+
+	// The generation is only mixed into the key once.
+	require.Len(t, stored.keys, 1)
+	require.Equal(t, "1:"+cache.HashKey(generateKey("1", parsedRequest)), stored.keys[0])
+}
+
+func TestGenerateKey(t *testing.T) {
+	for i, tc := range []struct {
+		start, step int64
+		expected    string
+	}{
+		{start: 0, step: 10, expected: "1:foo:10:0"},
+		{start: 100, step: 10, expected: "1:foo:10:0"},
+		{start: 105, step: 10, expected: "1:foo:10:0:5"},
+		{start: millisecondPerDay + 3, step: 10, expected: "1:foo:10:1:3"},
+	} {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			key := generateKey("1", &QueryRangeRequest{Query: "foo", Start: tc.start, End: tc.start + 1000, Step: tc.step})
+			require.Equal(t, tc.expected, key)
+		})
+	}
+}
@@ -19,9 +19,9 @@ import (
 	"context"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/cortexproject/cortex/pkg/util/validation"
-	"github.com/prometheus/prometheus/pkg/timestamp"
 
 	"github.com/weaveworks/common/httpgrpc"
 	"github.com/weaveworks/common/user"
@@ -96,10 +96,12 @@ func (q queryRangeRoundTripper) RoundTrip(r *http.Request) (*http.Response, erro
 		return nil, err
 	}
 
-	maxQueryLen := q.limits.MaxQueryLength(userid)
-	queryLen := timestamp.Time(request.End).Sub(timestamp.Time(request.Start))
-	if maxQueryLen != 0 && queryLen > maxQueryLen {
-		return nil, httpgrpc.Errorf(http.StatusBadRequest, validation.ErrQueryTooLong, queryLen, maxQueryLen)
+	request, err = limitQueryRange(q.limits, userid, request, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if request == nil {
+		return emptyMatrixResponse().toHTTPResponse(r.Context())
 	}
 
 	response, err := q.queryRangeMiddleware.Do(r.Context(), request)
@@ -4,24 +4,38 @@ import (
 	"context"
 	"time"
 
-	"github.com/cortexproject/cortex/pkg/util/validation"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/promql"
 	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/validation"
 )
 
 const millisecondPerDay = int64(24 * time.Hour / time.Millisecond)
 
-func splitByDayMiddleware(limits *validation.Overrides) queryRangeMiddleware {
+var unsplitQueries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "cortex",
+	Name:      "frontend_unsplit_queries_total",
+	Help:      "Number of range queries not split by day, by reason.",
+}, []string{"reason"})
+
+func splitByDayMiddleware(limits *validation.Overrides, maxLookback time.Duration) queryRangeMiddleware {
 	return queryRangeMiddlewareFunc(func(next queryRangeHandler) queryRangeHandler {
 		return instrument("split_by_day").Wrap(splitByDay{
-			next:   next,
-			limits: limits,
+			next:        next,
+			limits:      limits,
+			maxLookback: maxLookback,
 		})
 	})
 }
 
 type splitByDay struct {
-	next   queryRangeHandler
-	limits *validation.Overrides
+	next        queryRangeHandler
+	limits      *validation.Overrides
+	maxLookback time.Duration
 }
 
 type response struct {
@@ -31,6 +45,10 @@ type response struct {
 }
 
 func (s splitByDay) Do(ctx context.Context, r *QueryRangeRequest) (*APIResponse, error) {
+	if !s.splittable(r) {
+		return s.next.Do(ctx, r)
+	}
+
 	// First we're going to build new requests, one for each day, taking care
 	// to line up the boundaries with step.
 	reqs := splitQuery(r)
@@ -48,6 +66,59 @@ func (s splitByDay) Do(ctx context.Context, r *QueryRangeRequest) (*APIResponse,
 	return mergeAPIResponses(resps)
 }
 
+// splittable returns whether a query is worth splitting.  Each step of a range
+// query is evaluated independently, and subqueries' steps are aligned to
+// multiples of their step rather than the query's start, so splitting never
+// changes the results; but every day re-reads the data its selectors look back
+// over before it.  Queries which can't be parsed are passed on for the querier
+// to reject.
+func (s splitByDay) splittable(r *QueryRangeRequest) bool {
+	lookback, err := queryLookback(r.Query)
+	if err != nil {
+		unsplitQueries.WithLabelValues("unparseable").Inc()
+		return false
+	}
+	if s.maxLookback > 0 && lookback > s.maxLookback {
+		level.Debug(util.Logger).Log("msg", "not splitting query", "query", r.Query, "lookback", lookback)
+		unsplitQueries.WithLabelValues("lookback").Inc()
+		return false
+	}
+	return true
+}
+
+// queryLookback returns how far before each step a query reads samples: the
+// furthest its range selectors, offsets, subqueries and the lookback delta
+// reach, as the engine works it out.
+func queryLookback(query string) (time.Duration, error) {
+	expr, err := promql.ParseExpr(query)
+	if err != nil {
+		return 0, err
+	}
+
+	var lookback time.Duration
+	promql.Inspect(expr, func(node promql.Node, path []promql.Node) error {
+		var subqueries time.Duration
+		for _, parent := range path {
+			if sq, ok := parent.(*promql.SubqueryExpr); ok {
+				subqueries += sq.Range + sq.Offset
+			}
+		}
+
+		var l time.Duration
+		switch n := node.(type) {
+		case *promql.VectorSelector:
+			l = n.Offset + promql.LookbackDelta + subqueries
+		case *promql.MatrixSelector:
+			l = n.Offset + n.Range + subqueries
+		}
+		if l > lookback {
+			lookback = l
+		}
+		return nil
+	})
+	return lookback, nil
+}
+
 func splitQuery(r *QueryRangeRequest) []*QueryRangeRequest {
 	reqs := []*QueryRangeRequest{}
 	for start := r.Start; start < r.End; start = nextDayBoundary(start, r.Step) + r.Step {
@@ -7,7 +7,9 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"github.com/weaveworks/common/middleware"
@@ -199,3 +201,70 @@ func TestSplitByDay(t *testing.T) {
 		})
 	}
 }
+
+func TestQueryLookback(t *testing.T) {
+	for _, tc := range []struct {
+		query    string
+		lookback time.Duration
+	}{
+		{"foo", 5 * time.Minute},
+		{"foo offset 2h", 2*time.Hour + 5*time.Minute},
+		{"rate(foo[1h])", time.Hour},
+		{"rate(foo[5m] offset 1h)", time.Hour + 5*time.Minute},
+		{"sum(foo) + rate(bar[10m])", 10 * time.Minute},
+		{"max_over_time(rate(x[5m])[1d:1m])", 24*time.Hour + 5*time.Minute},
+		{"max_over_time(rate(x[5m] offset 1h)[1d:1m] offset 1d)", 49*time.Hour + 5*time.Minute},
+		{"max_over_time(max_over_time(x[1h:])[1h:])", 2*time.Hour + 5*time.Minute},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			lookback, err := queryLookback(tc.query)
+			require.NoError(t, err)
+			require.Equal(t, tc.lookback, lookback)
+		})
+	}
+
+	// Modifiers this version of PromQL doesn't know, like @, can't be parsed.
+	_, err := queryLookback("foo @ 1609746000")
+	require.Error(t, err)
+}
+
+func TestSplitByDayLookback(t *testing.T) {
+	var (
+		mtx  sync.Mutex
+		reqs []*QueryRangeRequest
+	)
+	s := splitByDay{
+		next: queryRangeHandlerFunc(func(_ context.Context, r *QueryRangeRequest) (*APIResponse, error) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			reqs = append(reqs, r)
+			return emptyMatrixResponse(), nil
+		}),
+		limits:      defaultOverrides(t),
+		maxLookback: 24 * time.Hour,
+	}
+	ctx := user.InjectOrgID(context.Background(), "1")
+
+	for _, tc := range []struct {
+		query string
+		parts int
+	}{
+		{"rate(foo[5m] offset 1h)", 3},
+		{"max_over_time(rate(x[5m])[12h:1m])", 3},
+		{"max_over_time(rate(x[5m])[1d:1m])", 1},
+		{"foo offset 2d", 1},
+		{"foo @ 1609746000", 1},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			reqs = nil
+			_, err := s.Do(ctx, &QueryRangeRequest{
+				Start: 0,
+				End:   3 * 24 * 3600 * seconds,
+				Step:  60 * seconds,
+				Query: tc.query,
+			})
+			require.NoError(t, err)
+			require.Len(t, reqs, tc.parts)
+		})
+	}
+}
@@ -12,9 +12,11 @@ import (
 	"github.com/prometheus/prometheus/storage"
 
 	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/chunk/rollup"
 	"github.com/cortexproject/cortex/pkg/querier/batch"
 	"github.com/cortexproject/cortex/pkg/querier/iterators"
 	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/stats"
 )
 
 // Config contains the configuration require to create a querier
@@ -26,6 +28,14 @@ type Config struct {
 	IngesterStreaming        bool
 	MaxSamples               int
 	IngesterMaxQueryLookback time.Duration
+	TenantFederation         bool
+	QueryStatsEnabled        bool
+	LogQueriesLongerThan     time.Duration
+	LogQueriesSampleRatio    float64
+	RollupSchemaConfigFile   string
+	RollupResolutions        rollup.Resolutions
+	RollupsAfter             time.Duration
+	MaxStreamedReadBytes     int
 
 	// The default evaluation interval for the promql engine.
 	// Needs to be configured for subqueries to work as it is the default
@@ -48,6 +58,15 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.BoolVar(&cfg.IngesterStreaming, "querier.ingester-streaming", false, "Use streaming RPCs to query ingester.")
 	f.IntVar(&cfg.MaxSamples, "querier.max-samples", 50e6, "Maximum number of samples a single query can load into memory.")
 	f.DurationVar(&cfg.IngesterMaxQueryLookback, "querier.query-ingesters-within", 0, "Maximum lookback beyond which queries are not sent to ingester. 0 means all queries are sent to ingester.")
+	f.BoolVar(&cfg.TenantFederation, "querier.tenant-federation", false, "Allow queries across several users, whose IDs are separated by '|' in the org ID, e.g. X-Scope-OrgID: a|b. Each user must have allow_federation set.")
+	f.BoolVar(&cfg.QueryStatsEnabled, "querier.query-stats-enabled", false, "Return the chunks, index lookups, bytes and ingester series each query used in an "+stats.HeaderName+" response header.")
+	f.DurationVar(&cfg.LogQueriesLongerThan, "querier.log-queries-longer-than", 0, "Log queries which take longer than this, 0 to disable.")
+	f.Float64Var(&cfg.LogQueriesSampleRatio, "querier.log-queries-sample-ratio", 0, "Fraction of the queries which aren't logged for being slow to log anyway, between 0 and 1.")
+	cfg.RollupResolutions = rollup.Resolutions{5 * time.Minute, time.Hour}
+	f.StringVar(&cfg.RollupSchemaConfigFile, "querier.rollup-schema-config-yaml", "", "Schema config yaml of the store rollups are read from, as written by the rollup job. Empty disables rollups.")
+	f.Var(&cfg.RollupResolutions, "querier.rollup-resolutions", "Comma-separated resolutions of the rollups to read, as written by the rollup job.")
+	f.DurationVar(&cfg.RollupsAfter, "querier.rollups-after", 72*time.Hour, "Read rollups, rather than raw samples, for data older than this, if the query's step is large enough. Must allow time for the rollup job to run.")
+	f.IntVar(&cfg.MaxStreamedReadBytes, "querier.max-streamed-remote-read-bytes", 1<<30, "Maximum bytes of chunks a query of a streamed remote read can send, 0 for no limit.")
 	f.DurationVar(&cfg.DefaultEvaluationInterval, "querier.default-evaluation-interval", time.Minute, "The default evaluation interval or step size for subqueries.")
 	cfg.metricsRegisterer = prometheus.DefaultRegisterer
 }
@@ -59,6 +59,7 @@ var (
 		{"DoubleDelta", promchunk.DoubleDelta},
 		{"Varbit", promchunk.Varbit},
 		{"Bigchunk", promchunk.Bigchunk},
+		{"PrometheusXorChunk", promchunk.PrometheusXorChunk},
 	}
 
 	queries = []query{
@@ -0,0 +1,81 @@
+package querier
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/weaveworks/common/middleware"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/util/stats"
+)
+
+// QueryLogMiddleware logs the queries which take longer than
+// cfg.LogQueriesLongerThan, and a cfg.LogQueriesSampleRatio sample of the
+// rest.
+func QueryLogMiddleware(cfg Config, logger log.Logger) middleware.Interface {
+	return middleware.Func(func(next http.Handler) http.Handler {
+		if cfg.LogQueriesLongerThan <= 0 && cfg.LogQueriesSampleRatio <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			// Parsed here so the parameters are still available once the
+			// body has been read.
+			r.ParseForm()
+			qw := &queryLogResponseWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(qw, r)
+
+			duration := time.Since(start)
+			if !shouldLogQuery(cfg, duration) {
+				return
+			}
+			userID, _ := user.ExtractOrgID(r.Context())
+			fields := []interface{}{
+				"msg", "query",
+				"user", userID,
+				"path", r.URL.Path,
+				"query", r.Form.Get("query"),
+				"start", r.Form.Get("start"),
+				"end", r.Form.Get("end"),
+				"step", r.Form.Get("step"),
+				"time", r.Form.Get("time"),
+				"duration", duration,
+				"status", qw.status,
+				"response_bytes", qw.size,
+			}
+			if queryStats := stats.FromContext(r.Context()); queryStats != nil {
+				fields = append(fields, queryStats.KeyValues()...)
+			}
+			level.Info(logger).Log(fields...)
+		})
+	})
+}
+
+func shouldLogQuery(cfg Config, duration time.Duration) bool {
+	if cfg.LogQueriesLongerThan > 0 && duration > cfg.LogQueriesLongerThan {
+		return true
+	}
+	return cfg.LogQueriesSampleRatio > 0 && rand.Float64() < cfg.LogQueriesSampleRatio
+}
+
+// queryLogResponseWriter records the status and size of a response.
+type queryLogResponseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (w *queryLogResponseWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *queryLogResponseWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
@@ -0,0 +1,57 @@
+package querier
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/weaveworks/common/user"
+)
+
+func TestQueryLogMiddleware(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Read the body, as the Prometheus API does.
+		r.ParseForm()
+		time.Sleep(10 * time.Millisecond)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("bad query"))
+	})
+
+	for _, tc := range []struct {
+		name   string
+		cfg    Config
+		logged bool
+	}{
+		{"disabled", Config{}, false},
+		{"fast", Config{LogQueriesLongerThan: time.Hour}, false},
+		{"slow", Config{LogQueriesLongerThan: time.Millisecond}, true},
+		{"sampled", Config{LogQueriesSampleRatio: 1}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := log.NewLogfmtLogger(&buf)
+
+			req := httptest.NewRequest("POST", "/api/prom/api/v1/query", strings.NewReader("query=up&time=10"))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req = req.WithContext(user.InjectOrgID(context.Background(), "1"))
+			rec := httptest.NewRecorder()
+			QueryLogMiddleware(tc.cfg, logger).Wrap(handler).ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			if !tc.logged {
+				assert.Empty(t, buf.String())
+				return
+			}
+			line := buf.String()
+			for _, field := range []string{"user=1", "query=up", "time=10", "status=400", "response_bytes=9"} {
+				assert.Contains(t, line, field)
+			}
+		})
+	}
+}
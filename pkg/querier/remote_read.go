@@ -1,17 +1,40 @@
 package querier
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
 	"net/http"
+	"sort"
 
+	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/chunk/encoding"
 	"github.com/cortexproject/cortex/pkg/ingester/client"
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/go-kit/kit/log/level"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/tsdb/chunkenc"
 )
 
-// RemoteReadHandler handles Prometheus remote read requests.
-func RemoteReadHandler(q storage.Queryable) http.Handler {
+const (
+	// As Prometheus does, re-encoded chunks are cut every 120 samples, and a
+	// series' chunks are split across frames of about 1MB.
+	samplesPerStreamedChunk = 120
+	maxBytesInFrame         = 1024 * 1024
+
+	streamedContentType = "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse"
+)
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// RemoteReadHandler handles Prometheus remote read requests.  Streamed
+// responses fail once a query has sent more than maxStreamedBytes of chunks, 0
+// for no limit.
+func RemoteReadHandler(q storage.Queryable, maxStreamedBytes int) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		compressionType := util.CompressionTypeFor(r.Header.Get("X-Prometheus-Remote-Read-Version"))
 
@@ -24,6 +47,11 @@ func RemoteReadHandler(q storage.Queryable) http.Handler {
 			return
 		}
 
+		if negotiateResponseType(req.AcceptedResponseTypes) == client.STREAMED_XOR_CHUNKS {
+			streamRemoteRead(ctx, q, &req, w, maxStreamedBytes)
+			return
+		}
+
 		// Fetch samples for all queries in parallel.
 		resp := client.ReadResponse{
 			Results: make([]*client.QueryResponse, len(req.Queries)),
@@ -82,6 +110,250 @@ func RemoteReadHandler(q storage.Queryable) http.Handler {
 	})
 }
 
+// negotiateResponseType returns the first of the response types the client
+// accepts which we support; clients which don't send any only accept
+// SAMPLES.
+func negotiateResponseType(accepted []client.ReadRequest_ResponseType) client.ReadRequest_ResponseType {
+	for _, t := range accepted {
+		switch t {
+		case client.SAMPLES, client.STREAMED_XOR_CHUNKS:
+			return t
+		}
+	}
+	return client.SAMPLES
+}
+
+// streamRemoteRead answers the queries one after another, writing each series
+// as it goes.  The querier still fetches all the chunks a query selects before
+// its first series is written, so streaming bounds the size of the response's
+// frames, not the querier's memory use; maxBytes only stops a query sending
+// more than that many bytes of chunks.
+func streamRemoteRead(ctx context.Context, q storage.Queryable, req *client.ReadRequest, w http.ResponseWriter, maxBytes int) {
+	logger := util.WithContext(ctx, util.Logger)
+	w.Header().Set("Content-Type", streamedContentType)
+	writer := &chunkedWriter{writer: w, maxBytes: maxBytes}
+	writer.flusher, _ = w.(http.Flusher)
+
+	for i, qr := range req.Queries {
+		writer.bytes = 0
+		if err := streamQuery(ctx, q, int64(i), qr, writer); err != nil {
+			level.Error(logger).Log("msg", "error streaming remote read response", "err", err)
+			// Once a frame has been written, the client can only tell there was
+			// an error by the response being cut short.
+			if !writer.written {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			}
+			return
+		}
+	}
+}
+
+func streamQuery(ctx context.Context, q storage.Queryable, queryIndex int64, qr *client.QueryRequest, writer *chunkedWriter) error {
+	from, to, matchers, err := client.FromQueryRequest(qr)
+	if err != nil {
+		return err
+	}
+
+	querier, err := q.Querier(ctx, int64(from), int64(to))
+	if err != nil {
+		return err
+	}
+	defer querier.Close()
+
+	params := &storage.SelectParams{
+		Start: int64(from),
+		End:   int64(to),
+	}
+	seriesSet, _, err := querier.Select(params, matchers...)
+	if err != nil {
+		return err
+	}
+
+	for seriesSet.Next() {
+		if err := streamSeries(queryIndex, seriesSet.At(), writer); err != nil {
+			return err
+		}
+	}
+	return seriesSet.Err()
+}
+
+// streamSeries writes a series' chunks, in as many frames as they need.
+// Series with no samples aren't written.
+func streamSeries(queryIndex int64, series storage.Series, writer *chunkedWriter) error {
+	frame := client.ChunkedSeries{
+		Labels: client.FromLabelsToLabelAdapaters(series.Labels()),
+	}
+	frameBytes := 0
+	add := func(chunk client.StreamChunk) error {
+		frame.Chunks = append(frame.Chunks, chunk)
+		frameBytes += len(chunk.Data)
+		if frameBytes < maxBytesInFrame {
+			return nil
+		}
+		err := writer.write(queryIndex, &frame)
+		frame.Chunks, frameBytes = frame.Chunks[:0], 0
+		return err
+	}
+
+	var err error
+	if chunks, ok := xorChunks(series); ok {
+		for _, c := range chunks {
+			if err = add(c); err != nil {
+				break
+			}
+		}
+	} else {
+		err = encodeXORChunks(series.Iterator(), add)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(frame.Chunks) == 0 {
+		return nil
+	}
+	return writer.write(queryIndex, &frame)
+}
+
+// xorChunks returns the chunks of a series, sorted by time, if they can be
+// sent as they are: they must all be Prometheus XOR chunks, and not overlap,
+// other than replicas of the same chunk, which are only sent once.
+//
+// Only series read as chunks are sent as they are: those of a single tenant,
+// and read from the store, and from the ingesters with
+// -querier.ingester-streaming.  Series merged with samples, e.g. from the
+// ingesters without streaming, are re-encoded.
+func xorChunks(series storage.Series) ([]client.StreamChunk, bool) {
+	cs, ok := series.(*chunkSeries)
+	if !ok || len(cs.chunks) == 0 {
+		return nil, false
+	}
+
+	chunks := make([]chunk.Chunk, len(cs.chunks))
+	copy(chunks, cs.chunks)
+	sort.Slice(chunks, func(i, j int) bool {
+		if chunks[i].From != chunks[j].From {
+			return chunks[i].From < chunks[j].From
+		}
+		return chunks[i].Through < chunks[j].Through
+	})
+
+	result := make([]client.StreamChunk, 0, len(chunks))
+	for i, c := range chunks {
+		if c.Data == nil || c.Data.Encoding() != encoding.PrometheusXorChunk {
+			return nil, false
+		}
+		var buf bytes.Buffer
+		if err := c.Data.Marshal(&buf); err != nil {
+			return nil, false
+		}
+		if i > 0 && c.From <= chunks[i-1].Through {
+			if last := result[len(result)-1]; c.From == chunks[i-1].From && c.Through == chunks[i-1].Through && bytes.Equal(buf.Bytes(), last.Data) {
+				continue
+			}
+			return nil, false
+		}
+		result = append(result, client.StreamChunk{
+			MinTimeMs: int64(c.From),
+			MaxTimeMs: int64(c.Through),
+			Type:      client.XOR,
+			Data:      buf.Bytes(),
+		})
+	}
+	return result, true
+}
+
+// encodeXORChunks re-encodes the samples of a series into XOR chunks.
+func encodeXORChunks(it storage.SeriesIterator, add func(client.StreamChunk) error) error {
+	var (
+		chk        *chunkenc.XORChunk
+		app        chunkenc.Appender
+		mint, maxt int64
+		err        error
+	)
+	cut := func() error {
+		if chk == nil {
+			return nil
+		}
+		err := add(client.StreamChunk{
+			MinTimeMs: mint,
+			MaxTimeMs: maxt,
+			Type:      client.XOR,
+			Data:      chk.Bytes(),
+		})
+		chk = nil
+		return err
+	}
+
+	for it.Next() {
+		t, v := it.At()
+		if chk == nil {
+			chk = chunkenc.NewXORChunk()
+			if app, err = chk.Appender(); err != nil {
+				return err
+			}
+			mint = t
+		}
+		app.Append(t, v)
+		maxt = t
+
+		if chk.NumSamples() >= samplesPerStreamedChunk {
+			if err := cut(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	return cut()
+}
+
+// chunkedWriter writes ChunkedReadResponses framed as Prometheus expects:
+// the length of each message as a uvarint, then its big-endian CRC32
+// (Castagnoli) checksum, then the message itself.  It fails once the query
+// being written has sent more than maxBytes of chunks, if maxBytes is set.
+type chunkedWriter struct {
+	writer  io.Writer
+	flusher http.Flusher
+	written bool
+
+	maxBytes int
+	bytes    int
+}
+
+func (c *chunkedWriter) write(queryIndex int64, series *client.ChunkedSeries) error {
+	for _, chunk := range series.Chunks {
+		c.bytes += len(chunk.Data)
+	}
+	if c.maxBytes > 0 && c.bytes > c.maxBytes {
+		return fmt.Errorf("query %d sent more than the limit of %d bytes of chunks", queryIndex, c.maxBytes)
+	}
+
+	msg, err := (&client.ChunkedReadResponse{
+		ChunkedSeries: []*client.ChunkedSeries{series},
+		QueryIndex:    queryIndex,
+	}).Marshal()
+	if err != nil {
+		return err
+	}
+
+	var header [binary.MaxVarintLen64 + 4]byte
+	n := binary.PutUvarint(header[:], uint64(len(msg)))
+	binary.BigEndian.PutUint32(header[n:], crc32.Checksum(msg, castagnoliTable))
+	c.written = true
+	if _, err := c.writer.Write(header[:n+4]); err != nil {
+		return err
+	}
+	if _, err := c.writer.Write(msg); err != nil {
+		return err
+	}
+	if c.flusher != nil {
+		c.flusher.Flush()
+	}
+	return nil
+}
+
 func seriesSetToMatrix(s storage.SeriesSet) (model.Matrix, error) {
 	result := model.Matrix{}
 
@@ -1,21 +1,31 @@
 package querier
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/binary"
 	"fmt"
+	"hash/crc32"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/chunk/encoding"
 	"github.com/cortexproject/cortex/pkg/ingester/client"
+	"github.com/cortexproject/cortex/pkg/util/flagext"
 	"github.com/gogo/protobuf/proto"
 	"github.com/golang/snappy"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/tsdb/chunkenc"
 	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
 )
 
 func TestRemoteReadHandler(t *testing.T) {
@@ -34,7 +44,7 @@ func TestRemoteReadHandler(t *testing.T) {
 			},
 		}, nil
 	})
-	handler := RemoteReadHandler(q)
+	handler := RemoteReadHandler(q, 0)
 
 	requestBody, err := proto.Marshal(&client.ReadRequest{
 		Queries: []*client.QueryRequest{
@@ -81,6 +91,235 @@ func TestRemoteReadHandler(t *testing.T) {
 	require.Equal(t, expected, response)
 }
 
+func TestStreamedRemoteReadHandler(t *testing.T) {
+	values := make([]model.SamplePair, 250)
+	for i := range values {
+		values[i] = model.SamplePair{Timestamp: model.Time(i), Value: model.SampleValue(i)}
+	}
+	q := storage.QueryableFunc(func(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+		return mockQuerier{
+			matrix: model.Matrix{
+				{Metric: model.Metric{"foo": "bar"}, Values: values},
+				{Metric: model.Metric{"foo": "baz"}},
+			},
+		}, nil
+	})
+
+	frames := streamedRemoteRead(t, q, 2)
+
+	// Samples are re-encoded into chunks of 120 samples, and the series
+	// without any aren't sent.
+	require.Len(t, frames, 2)
+	for i, frame := range frames {
+		require.Equal(t, int64(i), frame.QueryIndex)
+		require.Len(t, frame.ChunkedSeries, 1)
+		series := frame.ChunkedSeries[0]
+		require.Equal(t, []client.LabelAdapter{{Name: "foo", Value: "bar"}}, series.Labels)
+		require.Len(t, series.Chunks, 3)
+		require.Equal(t, int64(120), series.Chunks[1].MinTimeMs)
+		require.Equal(t, int64(239), series.Chunks[1].MaxTimeMs)
+		require.Equal(t, values, streamedSamples(t, series.Chunks))
+	}
+}
+
+func TestStreamedRemoteReadLimit(t *testing.T) {
+	values := make([]model.SamplePair, 250)
+	for i := range values {
+		values[i] = model.SamplePair{Timestamp: model.Time(i), Value: model.SampleValue(i)}
+	}
+	q := storage.QueryableFunc(func(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+		return mockQuerier{
+			matrix: model.Matrix{{Metric: model.Metric{"foo": "bar"}, Values: values}},
+		}, nil
+	})
+
+	recorder := httptest.NewRecorder()
+	RemoteReadHandler(q, 100).ServeHTTP(recorder, streamedRemoteReadRequest(t, 1, 0, 1000))
+	require.Equal(t, 400, recorder.Result().StatusCode)
+	require.Contains(t, recorder.Body.String(), "query 0 sent more than the limit of 100 bytes of chunks")
+}
+
+func TestStreamedRemoteReadReusesChunks(t *testing.T) {
+	metric := model.Metric{"foo": "bar"}
+	newChunk := func(enc encoding.Encoding, from, through model.Time) chunk.Chunk {
+		c, err := encoding.NewForEncoding(enc)
+		require.NoError(t, err)
+		for ts := from; ts <= through; ts++ {
+			cs, err := c.Add(model.SamplePair{Timestamp: ts, Value: model.SampleValue(ts)})
+			require.NoError(t, err)
+			require.Len(t, cs, 1)
+			c = cs[0]
+		}
+		return chunk.NewChunk("user", metric.Fingerprint(), metric, c, from, through)
+	}
+	query := func(chunks ...chunk.Chunk) []client.ChunkedSeries {
+		q := storage.QueryableFunc(func(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+			return mockChunkQuerier{
+				series: &chunkSeries{
+					labels:            metricToLabels(metric),
+					chunks:            chunks,
+					chunkIteratorFunc: mergeChunks,
+					mint:              mint,
+					maxt:              maxt,
+				},
+			}, nil
+		})
+		frames := streamedRemoteRead(t, q, 1)
+		require.Len(t, frames, 1)
+		require.Len(t, frames[0].ChunkedSeries, 1)
+		return []client.ChunkedSeries{*frames[0].ChunkedSeries[0]}
+	}
+
+	// XOR chunks are sent as they are, sorted.
+	first := newChunk(encoding.PrometheusXorChunk, 0, 199)
+	second := newChunk(encoding.PrometheusXorChunk, 200, 299)
+	series := query(second, first)[0]
+	require.Len(t, series.Chunks, 2)
+	for i, c := range []chunk.Chunk{first, second} {
+		var buf bytes.Buffer
+		require.NoError(t, c.Data.Marshal(&buf))
+		require.Equal(t, client.StreamChunk{
+			MinTimeMs: int64(c.From),
+			MaxTimeMs: int64(c.Through),
+			Type:      client.XOR,
+			Data:      buf.Bytes(),
+		}, series.Chunks[i])
+	}
+
+	// Overlapping chunks, and chunks of other encodings, are re-encoded.
+	for _, chunks := range [][]chunk.Chunk{
+		{first, newChunk(encoding.PrometheusXorChunk, 100, 299)},
+		{first, newChunk(encoding.Varbit, 200, 299)},
+	} {
+		series := query(chunks...)[0]
+		require.Len(t, series.Chunks, 3)
+		samples := streamedSamples(t, series.Chunks)
+		require.Len(t, samples, 300)
+		require.Equal(t, model.Time(299), samples[299].Timestamp)
+	}
+}
+
+func TestStreamedRemoteReadThroughQuerier(t *testing.T) {
+	var cfg Config
+	flagext.DefaultValues(&cfg)
+	cfg.metricsRegisterer = nil
+
+	chunkStore := mockChunkStore{[]chunk.Chunk{
+		mkChunk(t, 0, model.Time(0).Add(time.Hour), sampleRate, encoding.PrometheusXorChunk),
+		mkChunk(t, model.Time(0).Add(time.Hour+sampleRate), model.Time(0).Add(2*time.Hour), sampleRate, encoding.PrometheusXorChunk),
+	}}
+	through := model.Time(0).Add(2 * time.Hour)
+	// The ingesters return replicas of the same chunks.
+	distributor := mockDistibutorFor(t, chunkStore, through)
+
+	for _, streaming := range []bool{true, false} {
+		t.Run(fmt.Sprintf("streaming=%t", streaming), func(t *testing.T) {
+			cfg.IngesterStreaming = streaming
+			queryable, _ := New(cfg, distributor, chunkStore)
+			frames := streamedRemoteReadRange(t, queryable, 1, 0, int64(through))
+			require.Len(t, frames, 1)
+			require.Len(t, frames[0].ChunkedSeries, 1)
+			series := frames[0].ChunkedSeries[0]
+
+			samples := streamedSamples(t, series.Chunks)
+			require.Len(t, samples, 2*int(time.Hour/sampleRate)-1)
+			if !streaming {
+				// Chunks merged with the ingesters' samples are re-encoded.
+				require.Len(t, series.Chunks, (len(samples)+samplesPerStreamedChunk-1)/samplesPerStreamedChunk)
+				return
+			}
+
+			// Chunks read from the store and the ingesters are sent as they are,
+			// once.
+			require.Len(t, series.Chunks, 2)
+			for i, c := range chunkStore.chunks {
+				var buf bytes.Buffer
+				require.NoError(t, c.Data.Marshal(&buf))
+				require.Equal(t, buf.Bytes(), series.Chunks[i].Data)
+			}
+		})
+	}
+}
+
+// streamedRemoteRead makes a remote read of n queries which accepts
+// streamed responses, and returns the frames of the response.
+func streamedRemoteRead(t *testing.T, q storage.Queryable, n int) []client.ChunkedReadResponse {
+	return streamedRemoteReadRange(t, q, n, 0, 1000)
+}
+
+// streamedRemoteReadRequest makes a request for a streamed remote read of n
+// queries from through, in milliseconds.
+func streamedRemoteReadRequest(t *testing.T, n int, from, through int64) *http.Request {
+	req := client.ReadRequest{
+		AcceptedResponseTypes: []client.ReadRequest_ResponseType{client.STREAMED_XOR_CHUNKS, client.SAMPLES},
+	}
+	for i := 0; i < n; i++ {
+		req.Queries = append(req.Queries, &client.QueryRequest{StartTimestampMs: from, EndTimestampMs: through})
+	}
+	requestBody, err := proto.Marshal(&req)
+	require.NoError(t, err)
+	request, err := http.NewRequest("GET", "/query", bytes.NewReader(snappy.Encode(nil, requestBody)))
+	require.NoError(t, err)
+	request = request.WithContext(user.InjectOrgID(request.Context(), "0"))
+	request.Header.Set("X-Prometheus-Remote-Read-Version", "0.1.0")
+	return request
+}
+
+// streamedRemoteReadRange makes a streamed remote read of n queries from
+// through, in milliseconds.
+func streamedRemoteReadRange(t *testing.T, q storage.Queryable, n int, from, through int64) []client.ChunkedReadResponse {
+	recorder := httptest.NewRecorder()
+	RemoteReadHandler(q, 0).ServeHTTP(recorder, streamedRemoteReadRequest(t, n, from, through))
+	require.Equal(t, 200, recorder.Result().StatusCode)
+	require.Equal(t, streamedContentType, recorder.Result().Header.Get("Content-Type"))
+
+	var frames []client.ChunkedReadResponse
+	reader := bufio.NewReader(recorder.Result().Body)
+	for {
+		size, err := binary.ReadUvarint(reader)
+		if err == io.EOF {
+			return frames
+		}
+		require.NoError(t, err)
+		var checksum uint32
+		require.NoError(t, binary.Read(reader, binary.BigEndian, &checksum))
+		msg := make([]byte, size)
+		_, err = io.ReadFull(reader, msg)
+		require.NoError(t, err)
+		require.Equal(t, crc32.Checksum(msg, castagnoliTable), checksum)
+
+		var frame client.ChunkedReadResponse
+		require.NoError(t, proto.Unmarshal(msg, &frame))
+		frames = append(frames, frame)
+	}
+}
+
+func streamedSamples(t *testing.T, chunks []client.StreamChunk) []model.SamplePair {
+	var result []model.SamplePair
+	for _, c := range chunks {
+		require.Equal(t, client.XOR, c.Type)
+		chk, err := chunkenc.FromData(chunkenc.EncXOR, c.Data)
+		require.NoError(t, err)
+		it := chk.Iterator()
+		for it.Next() {
+			ts, v := it.At()
+			require.True(t, ts >= c.MinTimeMs && ts <= c.MaxTimeMs)
+			result = append(result, model.SamplePair{Timestamp: model.Time(ts), Value: model.SampleValue(v)})
+		}
+		require.NoError(t, it.Err())
+	}
+	return result
+}
+
+type mockChunkQuerier struct {
+	mockQuerier
+	series storage.Series
+}
+
+func (m mockChunkQuerier) Select(sp *storage.SelectParams, matchers ...*labels.Matcher) (storage.SeriesSet, storage.Warnings, error) {
+	return newConcreteSeriesSet([]storage.Series{m.series}), nil, nil
+}
+
 type mockQuerier struct {
 	matrix model.Matrix
 }
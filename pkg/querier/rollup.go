@@ -0,0 +1,333 @@
+package querier
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/weaveworks/common/middleware"
+
+	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/chunk/rollup"
+)
+
+const (
+	// average is read from the sum and count rollups, for selects which
+	// want the value of a series at each step.
+	average = "avg"
+
+	// A resolution is only used for selects whose step is at least this many
+	// windows, so range functions see several samples.
+	rollupStepFactor = 5
+
+	// A resolution is only used for range vector selects whose range is at
+	// least this many windows, so they see more than one sample.
+	rollupRangeFactor = 2
+)
+
+// rollupFunc is the rollup read for selects made for a function, and whether
+// the function takes a range vector.
+type rollupFunc struct {
+	aggregate string
+	matrix    bool
+}
+
+// rollupFuncs are the rollups read for the functions selects can be made
+// for.  Selects for other functions always read raw samples.
+var rollupFuncs = map[string]rollupFunc{
+	"rate":          {rollup.Counter, true},
+	"increase":      {rollup.Counter, true},
+	"irate":         {rollup.Counter, true},
+	"resets":        {rollup.Counter, true},
+	"min_over_time": {rollup.Min, true},
+	"max_over_time": {rollup.Max, true},
+	"avg_over_time": {average, true},
+
+	// Instant vectors, and aggregations of them.
+	"":         {average, false},
+	"sum":      {average, false},
+	"avg":      {average, false},
+	"min":      {average, false},
+	"max":      {average, false},
+	"count":    {average, false},
+	"stddev":   {average, false},
+	"stdvar":   {average, false},
+	"topk":     {average, false},
+	"bottomk":  {average, false},
+	"quantile": {average, false},
+}
+
+type contextKey int
+
+// querySelectorsKey is the context key of the querySelectors of the query
+// being run.
+const querySelectorsKey contextKey = 0
+
+// querySelectors describes a query's selectors, as selects aren't told which
+// selector they're for.
+type querySelectors struct {
+	// The shortest range of the query's range vector selectors.
+	minRange time.Duration
+	// Whether the query has subqueries, whose selects have their own steps
+	// but are given the query's.
+	subquery bool
+}
+
+// RollupMiddleware parses the query of each request, so selects for it can
+// tell whether rollups cover their selectors' ranges.  Queries it can't
+// parse, and queries run without it, e.g. by the ruler, read raw samples.
+var RollupMiddleware = middleware.Func(func(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expr, err := promql.ParseExpr(r.FormValue("query"))
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), querySelectorsKey, selectorsOf(expr))))
+	})
+})
+
+// selectorsOf returns the querySelectors of a query.
+func selectorsOf(expr promql.Expr) *querySelectors {
+	selectors := &querySelectors{}
+	promql.Inspect(expr, func(node promql.Node, _ []promql.Node) error {
+		switch n := node.(type) {
+		case *promql.SubqueryExpr:
+			selectors.subquery = true
+		case *promql.MatrixSelector:
+			if selectors.minRange == 0 || n.Range < selectors.minRange {
+				selectors.minRange = n.Range
+			}
+		}
+		return nil
+	})
+	return selectors
+}
+
+// NewRollupQueryable returns a queryable which reads selects with a large
+// enough step, for the parts older than cfg.RollupsAfter, from the rollups in
+// store, and everything else from next.
+func NewRollupQueryable(cfg Config, store ChunkStore, next storage.Queryable) storage.Queryable {
+	return storage.QueryableFunc(func(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+		querier, err := next.Querier(ctx, mint, maxt)
+		if err != nil {
+			return nil, err
+		}
+		return &rollupQuerier{
+			Querier:     querier,
+			ctx:         ctx,
+			store:       store,
+			resolutions: cfg.RollupResolutions,
+			after:       cfg.RollupsAfter,
+		}, nil
+	})
+}
+
+type rollupQuerier struct {
+	storage.Querier
+	ctx         context.Context
+	store       ChunkStore
+	resolutions rollup.Resolutions
+	after       time.Duration
+}
+
+// chooseRollup returns the coarsest resolution of the rollups suitable for a
+// select, and the aggregate to read.  Without selectors, the select's range
+// isn't known, so no rollup is suitable.
+func chooseRollup(resolutions rollup.Resolutions, sp *storage.SelectParams, selectors *querySelectors) (time.Duration, string, bool) {
+	fn, ok := rollupFuncs[sp.Func]
+	if !ok || selectors == nil || selectors.subquery {
+		return 0, "", false
+	}
+
+	step := time.Duration(sp.Step) * time.Millisecond
+	for i := len(resolutions) - 1; i >= 0; i-- {
+		resolution := resolutions[i]
+		if resolution*rollupStepFactor > step {
+			continue
+		}
+		// Range vectors need several windows within the shortest range, as
+		// the select could be for any of the query's selectors.
+		if fn.matrix && resolution*rollupRangeFactor > selectors.minRange {
+			continue
+		}
+		// Instant vectors only see samples within the lookback delta.
+		if !fn.matrix && resolution > promql.LookbackDelta {
+			continue
+		}
+		return resolution, fn.aggregate, true
+	}
+	return 0, "", false
+}
+
+// Select implements storage.Querier.
+func (q *rollupQuerier) Select(sp *storage.SelectParams, matchers ...*labels.Matcher) (storage.SeriesSet, storage.Warnings, error) {
+	if sp == nil {
+		return q.Querier.Select(sp, matchers...)
+	}
+	selectors, _ := q.ctx.Value(querySelectorsKey).(*querySelectors)
+	resolution, aggregate, ok := chooseRollup(q.resolutions, sp, selectors)
+	if !ok {
+		return q.Querier.Select(sp, matchers...)
+	}
+
+	// Rollups are read up to the start of the window the boundary is in.
+	size := int64(resolution / time.Millisecond)
+	boundary := (time.Now().Add(-q.after).UnixNano() / int64(time.Millisecond)) / size * size
+	if sp.Start >= boundary {
+		return q.Querier.Select(sp, matchers...)
+	}
+
+	through := sp.End
+	if through >= boundary {
+		through = boundary - 1
+	}
+	rollups, err := q.selectRollups(model.Time(sp.Start), model.Time(through), resolution, aggregate, matchers)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sp.End < boundary {
+		return rollups, nil, nil
+	}
+
+	recent := *sp
+	recent.Start = boundary
+	raw, warnings, err := q.Querier.Select(&recent, matchers...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return storage.NewMergeSeriesSet([]storage.SeriesSet{rollups, trimSeriesSet(raw, boundary)}, nil), warnings, nil
+}
+
+// selectRollups returns the series matching matchers, with the samples of an
+// aggregate's rollup at a resolution.
+func (q *rollupQuerier) selectRollups(from, through model.Time, resolution time.Duration, aggregate string, matchers []*labels.Matcher) (storage.SeriesSet, error) {
+	if aggregate != average {
+		matrix, err := q.getRollups(from, through, resolution, aggregate, matchers)
+		if err != nil {
+			return nil, err
+		}
+		return matrixToSeriesSet(matrix), nil
+	}
+
+	sums, err := q.getRollups(from, through, resolution, rollup.Sum, matchers)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := q.getRollups(from, through, resolution, rollup.Count, matchers)
+	if err != nil {
+		return nil, err
+	}
+	return matrixToSeriesSet(averages(sums, counts)), nil
+}
+
+// getRollups returns the series of an aggregate's rollup at a resolution,
+// without the rollup labels.
+func (q *rollupQuerier) getRollups(from, through model.Time, resolution time.Duration, aggregate string, matchers []*labels.Matcher) (model.Matrix, error) {
+	resolutionMatcher, err := labels.NewMatcher(labels.MatchEqual, rollup.ResolutionLabel, model.Duration(resolution).String())
+	if err != nil {
+		return nil, err
+	}
+	aggregateMatcher, err := labels.NewMatcher(labels.MatchEqual, rollup.AggregateLabel, aggregate)
+	if err != nil {
+		return nil, err
+	}
+	rollupMatchers := append([]*labels.Matcher{resolutionMatcher, aggregateMatcher}, matchers...)
+	chunks, err := q.store.Get(q.ctx, from, through, rollupMatchers...)
+	if err != nil {
+		return nil, promql.ErrStorage{Err: err}
+	}
+
+	matrix, err := chunk.ChunksToMatrix(q.ctx, chunks, from, through)
+	if err != nil {
+		return nil, promql.ErrStorage{Err: err}
+	}
+	for _, ss := range matrix {
+		delete(ss.Metric, rollup.ResolutionLabel)
+		delete(ss.Metric, rollup.AggregateLabel)
+	}
+	return matrix, nil
+}
+
+// averages divides each window's sum by its count.
+func averages(sums, counts model.Matrix) model.Matrix {
+	countsBySeries := make(map[model.Fingerprint][]model.SamplePair, len(counts))
+	for _, ss := range counts {
+		countsBySeries[ss.Metric.Fingerprint()] = ss.Values
+	}
+
+	result := make(model.Matrix, 0, len(sums))
+	for _, ss := range sums {
+		counts := countsBySeries[ss.Metric.Fingerprint()]
+		values := make([]model.SamplePair, 0, len(ss.Values))
+		for i, j := 0, 0; i < len(ss.Values) && j < len(counts); {
+			switch {
+			case ss.Values[i].Timestamp < counts[j].Timestamp:
+				i++
+			case ss.Values[i].Timestamp > counts[j].Timestamp:
+				j++
+			default:
+				if counts[j].Value > 0 {
+					values = append(values, model.SamplePair{
+						Timestamp: ss.Values[i].Timestamp,
+						Value:     ss.Values[i].Value / counts[j].Value,
+					})
+				}
+				i++
+				j++
+			}
+		}
+		if len(values) > 0 {
+			result = append(result, &model.SampleStream{Metric: ss.Metric, Values: values})
+		}
+	}
+	return result
+}
+
+// trimSeriesSet drops the samples of a set's series before from.
+func trimSeriesSet(set storage.SeriesSet, from int64) storage.SeriesSet {
+	return trimmedSeriesSet{SeriesSet: set, from: from}
+}
+
+type trimmedSeriesSet struct {
+	storage.SeriesSet
+	from int64
+}
+
+func (s trimmedSeriesSet) At() storage.Series {
+	return trimmedSeries{Series: s.SeriesSet.At(), from: s.from}
+}
+
+type trimmedSeries struct {
+	storage.Series
+	from int64
+}
+
+func (s trimmedSeries) Iterator() storage.SeriesIterator {
+	return &trimmedIterator{SeriesIterator: s.Series.Iterator(), from: s.from}
+}
+
+type trimmedIterator struct {
+	storage.SeriesIterator
+	from int64
+}
+
+func (it *trimmedIterator) Seek(t int64) bool {
+	if t < it.from {
+		t = it.from
+	}
+	return it.SeriesIterator.Seek(t)
+}
+
+func (it *trimmedIterator) Next() bool {
+	for it.SeriesIterator.Next() {
+		if t, _ := it.SeriesIterator.At(); t >= it.from {
+			return true
+		}
+	}
+	return false
+}
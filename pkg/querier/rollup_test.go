@@ -0,0 +1,152 @@
+package querier
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/chunk/rollup"
+	"github.com/cortexproject/cortex/pkg/util"
+)
+
+func TestChooseRollup(t *testing.T) {
+	resolutions := rollup.Resolutions{5 * time.Minute, time.Hour}
+	for _, tc := range []struct {
+		query      string
+		fn         string
+		step       time.Duration
+		ok         bool
+		resolution time.Duration
+		aggregate  string
+	}{
+		{query: "rate(foo[1d])", fn: "rate", step: time.Minute},
+		{query: "rate(foo[1d])", fn: "rate", step: 30 * time.Minute, ok: true, resolution: 5 * time.Minute, aggregate: rollup.Counter},
+		{query: "rate(foo[1d])", fn: "rate", step: 6 * time.Hour, ok: true, resolution: time.Hour, aggregate: rollup.Counter},
+		{query: "max_over_time(foo[1d])", fn: "max_over_time", step: 6 * time.Hour, ok: true, resolution: time.Hour, aggregate: rollup.Max},
+		// Ranges must cover several windows.
+		{query: "rate(foo[5m])", fn: "rate", step: time.Hour},
+		{query: "rate(foo[15m])", fn: "rate", step: 6 * time.Hour, ok: true, resolution: 5 * time.Minute, aggregate: rollup.Counter},
+		{query: "rate(foo[1d]) / rate(bar[5m])", fn: "rate", step: 6 * time.Hour},
+		// Instant vectors can't use resolutions beyond the lookback delta.
+		{query: "foo", fn: "", step: 6 * time.Hour, ok: true, resolution: 5 * time.Minute, aggregate: average},
+		{query: "histogram_quantile(0.9, foo)", fn: "histogram_quantile", step: 6 * time.Hour},
+		// Selects in subqueries are given the query's step, not theirs.
+		{query: "max_over_time(rate(foo[1d])[7d:1m])", fn: "rate", step: 6 * time.Hour},
+		// Without the query, the range isn't known.
+		{fn: "rate", step: 6 * time.Hour},
+	} {
+		var selectors *querySelectors
+		if tc.query != "" {
+			expr, err := promql.ParseExpr(tc.query)
+			require.NoError(t, err)
+			selectors = selectorsOf(expr)
+		}
+		resolution, aggregate, ok := chooseRollup(resolutions, &storage.SelectParams{
+			Func: tc.fn,
+			Step: int64(tc.step / time.Millisecond),
+		}, selectors)
+		require.Equal(t, tc.ok, ok, tc.query)
+		require.Equal(t, tc.resolution, resolution, tc.query)
+		require.Equal(t, tc.aggregate, aggregate, tc.query)
+	}
+}
+
+func TestRollupMiddleware(t *testing.T) {
+	var selectors *querySelectors
+	handler := RollupMiddleware.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		selectors, _ = r.Context().Value(querySelectorsKey).(*querySelectors)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/v1/query_range?query=rate(foo[5m])&step=3600", nil))
+	require.Equal(t, &querySelectors{minRange: 5 * time.Minute}, selectors)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/v1/query_range?query=rate(foo[5m]", nil))
+	require.Nil(t, selectors)
+}
+
+func TestRollupQueryableRange(t *testing.T) {
+	// A counter increasing by one every 15s, older than RollupsAfter, with no
+	// rollups in the store.
+	through := time.Now().Add(-7 * 24 * time.Hour).Truncate(time.Hour)
+	from := through.Add(-6 * time.Hour)
+	var values []model.SamplePair
+	for ts := from.Add(-time.Hour); !ts.After(through); ts = ts.Add(15 * time.Second) {
+		values = append(values, model.SamplePair{Timestamp: model.TimeFromUnixNano(ts.UnixNano()), Value: model.SampleValue(len(values))})
+	}
+	next := storage.QueryableFunc(func(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+		return mockQuerier{
+			matrix: model.Matrix{{Metric: model.Metric{model.MetricNameLabel: "foo"}, Values: values}},
+		}, nil
+	})
+	queryable := NewRollupQueryable(Config{
+		RollupResolutions: rollup.Resolutions{5 * time.Minute, time.Hour},
+		RollupsAfter:      72 * time.Hour,
+	}, mockChunkStore{}, next)
+	engine := promql.NewEngine(promql.EngineOpts{
+		Logger:        util.Logger,
+		MaxConcurrent: 1,
+		MaxSamples:    1e6,
+		Timeout:       1 * time.Minute,
+	})
+
+	query := func(q string) promql.Matrix {
+		expr, err := promql.ParseExpr(q)
+		require.NoError(t, err)
+		ctx := user.InjectOrgID(context.Background(), "0")
+		ctx = context.WithValue(ctx, querySelectorsKey, selectorsOf(expr))
+		rangeQuery, err := engine.NewRangeQuery(queryable, q, from, through, time.Hour)
+		require.NoError(t, err)
+		matrix, err := rangeQuery.Exec(ctx).Matrix()
+		require.NoError(t, err)
+		return matrix
+	}
+
+	// A 5m range only covers one 5m window, so raw samples are read.
+	matrix := query("rate(foo[5m])")
+	require.Len(t, matrix, 1)
+	require.Len(t, matrix[0].Points, 7)
+	for _, p := range matrix[0].Points {
+		require.InDelta(t, 1.0/15, p.V, 1e-9)
+	}
+
+	// A 1h range covers twelve, so the (missing) rollups are read.
+	require.Empty(t, query("rate(foo[1h])"))
+}
+
+func TestAverages(t *testing.T) {
+	metric := model.Metric{model.MetricNameLabel: "foo"}
+	sums := model.Matrix{{Metric: metric, Values: []model.SamplePair{{Timestamp: 1, Value: 10}, {Timestamp: 2, Value: 9}, {Timestamp: 3, Value: 8}}}}
+	counts := model.Matrix{{Metric: metric, Values: []model.SamplePair{{Timestamp: 1, Value: 2}, {Timestamp: 3, Value: 4}}}}
+	require.Equal(t, model.Matrix{{Metric: metric, Values: []model.SamplePair{{Timestamp: 1, Value: 5}, {Timestamp: 3, Value: 2}}}}, averages(sums, counts))
+}
+
+func TestTrimSeriesSet(t *testing.T) {
+	set := trimSeriesSet(matrixToSeriesSet(model.Matrix{{
+		Metric: model.Metric{model.MetricNameLabel: "foo"},
+		Values: []model.SamplePair{{Timestamp: 1, Value: 1}, {Timestamp: 2, Value: 2}, {Timestamp: 3, Value: 3}},
+	}}), 2)
+
+	require.True(t, set.Next())
+	series := set.At()
+	it := series.Iterator()
+	var ts []int64
+	for it.Next() {
+		t, _ := it.At()
+		ts = append(ts, t)
+	}
+	require.Equal(t, []int64{2, 3}, ts)
+	require.False(t, set.Next())
+
+	it = series.Iterator()
+	require.True(t, it.Seek(0))
+	seeked, _ := it.At()
+	require.Equal(t, int64(2), seeked)
+}
@@ -0,0 +1,223 @@
+package querier
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+const (
+	// TenantLabel is the label federated queries add to every series, with
+	// the ID of the user it belongs to.
+	TenantLabel = "__tenant_id__"
+
+	// Series which already have a TenantLabel keep its value as this.
+	originalTenantLabel = "original_" + TenantLabel
+
+	tenantSeparator = "|"
+)
+
+// NewFederatedQueryable wraps a Queryable so queries whose org ID is several
+// user IDs separated by '|' are answered from each of those users' data, as
+// if it were one user's, with a TenantLabel added to each series.  Each
+// user's data is read with their own org ID, so their limits apply as they
+// would to their own queries.  Users must have opted in with
+// allow_federation.
+func NewFederatedQueryable(next storage.Queryable, limits *validation.Overrides) storage.Queryable {
+	return storage.QueryableFunc(func(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+		orgID, err := user.ExtractOrgID(ctx)
+		if err != nil || !strings.Contains(orgID, tenantSeparator) {
+			return next.Querier(ctx, mint, maxt)
+		}
+
+		userIDs, err := federatedUserIDs(orgID, limits)
+		if err != nil {
+			return nil, err
+		}
+
+		q := federatedQuerier{
+			userIDs:  userIDs,
+			queriers: make([]storage.Querier, 0, len(userIDs)),
+		}
+		for _, userID := range userIDs {
+			querier, err := next.Querier(user.InjectOrgID(ctx, userID), mint, maxt)
+			if err != nil {
+				q.Close()
+				return nil, err
+			}
+			q.queriers = append(q.queriers, querier)
+		}
+		return q, nil
+	})
+}
+
+// federatedUserIDs returns the sorted, distinct user IDs of a federated org
+// ID, checking each user allows federation.
+func federatedUserIDs(orgID string, limits *validation.Overrides) ([]string, error) {
+	seen := map[string]struct{}{}
+	userIDs := []string{}
+	for _, userID := range strings.Split(orgID, tenantSeparator) {
+		if userID == "" {
+			return nil, fmt.Errorf("empty user ID in org ID %q", orgID)
+		}
+		if _, ok := seen[userID]; ok {
+			continue
+		}
+		if !limits.AllowFederation(userID) {
+			return nil, fmt.Errorf("user %q does not allow federated queries", userID)
+		}
+		seen[userID] = struct{}{}
+		userIDs = append(userIDs, userID)
+	}
+	sort.Strings(userIDs)
+	return userIDs, nil
+}
+
+type federatedQuerier struct {
+	userIDs  []string
+	queriers []storage.Querier
+}
+
+// Select implements storage.Querier.  Matchers on the TenantLabel select which
+// users are queried, and aren't passed on.
+func (q federatedQuerier) Select(sp *storage.SelectParams, matchers ...*labels.Matcher) (storage.SeriesSet, storage.Warnings, error) {
+	var tenantMatchers, otherMatchers []*labels.Matcher
+	for _, m := range matchers {
+		if m.Name == TenantLabel {
+			tenantMatchers = append(tenantMatchers, m)
+		} else {
+			otherMatchers = append(otherMatchers, m)
+		}
+	}
+
+	// Selects are started for every user before any is read from, as the
+	// queriers may select in the background.
+	sets := make([]storage.SeriesSet, len(q.queriers))
+	var warnings storage.Warnings
+outer:
+	for i, querier := range q.queriers {
+		for _, m := range tenantMatchers {
+			if !m.Matches(q.userIDs[i]) {
+				continue outer
+			}
+		}
+		set, ws, err := querier.Select(sp, otherMatchers...)
+		if err != nil {
+			return nil, nil, err
+		}
+		sets[i] = set
+		warnings = append(warnings, ws...)
+	}
+
+	// Adding the TenantLabel changes the order of series, so they're
+	// collected and sorted again.
+	series := []storage.Series{}
+	for i, set := range sets {
+		if set == nil {
+			continue
+		}
+		for set.Next() {
+			series = append(series, tenantSeries{
+				Series: set.At(),
+				labels: withTenantLabel(set.At().Labels(), q.userIDs[i]),
+			})
+		}
+		if err := set.Err(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return newConcreteSeriesSet(series), warnings, nil
+}
+
+// LabelValues implements storage.Querier.
+func (q federatedQuerier) LabelValues(name string) ([]string, error) {
+	if name == TenantLabel {
+		return q.userIDs, nil
+	}
+	return q.union(func(querier storage.Querier) ([]string, error) {
+		return querier.LabelValues(name)
+	})
+}
+
+// LabelNames implements storage.Querier.
+func (q federatedQuerier) LabelNames() ([]string, error) {
+	names, err := q.union(func(querier storage.Querier) ([]string, error) {
+		return querier.LabelNames()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mergeStrings(names, []string{TenantLabel}), nil
+}
+
+func (q federatedQuerier) union(f func(storage.Querier) ([]string, error)) ([]string, error) {
+	result := []string{}
+	for _, querier := range q.queriers {
+		values, err := f(querier)
+		if err != nil {
+			return nil, err
+		}
+		sorted := append([]string(nil), values...)
+		sort.Strings(sorted)
+		result = mergeStrings(result, sorted)
+	}
+	return result, nil
+}
+
+// Close implements storage.Querier.
+func (q federatedQuerier) Close() error {
+	var lastErr error
+	for _, querier := range q.queriers {
+		if err := querier.Close(); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func withTenantLabel(ls labels.Labels, userID string) labels.Labels {
+	b := labels.NewBuilder(ls)
+	if existing := ls.Get(TenantLabel); existing != "" {
+		b.Set(originalTenantLabel, existing)
+	}
+	b.Set(TenantLabel, userID)
+	return b.Labels()
+}
+
+type tenantSeries struct {
+	storage.Series
+	labels labels.Labels
+}
+
+func (s tenantSeries) Labels() labels.Labels {
+	return s.labels
+}
+
+// mergeStrings merges two sorted slices of strings, dropping duplicates.
+func mergeStrings(a, b []string) []string {
+	result := make([]string, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			result = append(result, a[i])
+			i++
+		case a[i] > b[j]:
+			result = append(result, b[j])
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	result = append(result, a[i:]...)
+	return append(result, b[j:]...)
+}
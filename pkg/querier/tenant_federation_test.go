@@ -0,0 +1,97 @@
+package querier
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+func TestFederatedQueryable(t *testing.T) {
+	overridesFile, err := ioutil.TempFile("", "overrides")
+	require.NoError(t, err)
+	defer os.Remove(overridesFile.Name())
+	_, err = overridesFile.WriteString("overrides:\n  a:\n    allow_federation: true\n  b:\n    allow_federation: true\n")
+	require.NoError(t, err)
+	require.NoError(t, overridesFile.Close())
+
+	var limits validation.Limits
+	flagext.DefaultValues(&limits)
+	limits.PerTenantOverrideConfig = overridesFile.Name()
+	overrides, err := validation.NewOverrides(limits)
+	require.NoError(t, err)
+	defer overrides.Stop()
+
+	// Each user has a series labelled with their ID; b's also has a
+	// TenantLabel of its own.
+	next := storage.QueryableFunc(func(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+		userID, err := user.ExtractOrgID(ctx)
+		require.NoError(t, err)
+		metric := model.Metric{model.MetricNameLabel: "foo", "user": model.LabelValue(userID)}
+		if userID == "b" {
+			metric[TenantLabel] = "other"
+		}
+		return mockQuerier{
+			matrix: model.Matrix{{Metric: metric, Values: []model.SamplePair{{Timestamp: 1, Value: 1}}}},
+		}, nil
+	})
+	queryable := NewFederatedQueryable(next, overrides)
+
+	selectLabels := func(orgID string, matchers ...*labels.Matcher) []labels.Labels {
+		q, err := queryable.Querier(user.InjectOrgID(context.Background(), orgID), 0, 10)
+		require.NoError(t, err)
+		set, _, err := q.Select(&storage.SelectParams{Start: 0, End: 10}, matchers...)
+		require.NoError(t, err)
+		result := []labels.Labels{}
+		for set.Next() {
+			result = append(result, set.At().Labels())
+		}
+		require.NoError(t, set.Err())
+		return result
+	}
+
+	// A single user isn't federated, even if they don't allow it.
+	require.Equal(t, []labels.Labels{
+		labels.FromStrings(model.MetricNameLabel, "foo", "user", "c"),
+	}, selectLabels("c"))
+
+	require.Equal(t, []labels.Labels{
+		labels.FromStrings(model.MetricNameLabel, "foo", TenantLabel, "a", "user", "a"),
+		labels.FromStrings(model.MetricNameLabel, "foo", TenantLabel, "b", originalTenantLabel, "other", "user", "b"),
+	}, selectLabels("b|a|b"))
+
+	notB, err := labels.NewMatcher(labels.MatchNotEqual, TenantLabel, "b")
+	require.NoError(t, err)
+	require.Equal(t, []labels.Labels{
+		labels.FromStrings(model.MetricNameLabel, "foo", TenantLabel, "a", "user", "a"),
+	}, selectLabels("a|b", notB))
+
+	// Every user must allow federation.
+	for _, orgID := range []string{"a|c", "a||b"} {
+		_, err := queryable.Querier(user.InjectOrgID(context.Background(), orgID), 0, 10)
+		require.Error(t, err, orgID)
+	}
+
+	q, err := queryable.Querier(user.InjectOrgID(context.Background(), "a|b"), 0, 10)
+	require.NoError(t, err)
+	values, err := q.LabelValues(TenantLabel)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, values)
+	names, err := q.LabelNames()
+	require.NoError(t, err)
+	require.Equal(t, []string{TenantLabel}, names)
+}
+
+func TestMergeStrings(t *testing.T) {
+	require.Equal(t, []string{"a", "b", "c", "d"}, mergeStrings([]string{"a", "c"}, []string{"b", "c", "d"}))
+	require.Equal(t, []string{"a"}, mergeStrings(nil, []string{"a"}))
+}
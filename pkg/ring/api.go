@@ -0,0 +1,231 @@
+package ring
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/gorilla/mux"
+
+	"github.com/cortexproject/cortex/pkg/util"
+)
+
+// RegisterRoutes registers the ring's status page at prefix, and its JSON
+// API under prefix + "/api/v1".
+func (r *Ring) RegisterRoutes(router *mux.Router, prefix string) {
+	router.Handle(prefix, r)
+
+	api := router.PathPrefix(prefix + "/api/v1").Subrouter()
+	api.Path("/instances").Methods("GET").HandlerFunc(r.listInstances)
+	api.Path("/instances/{id}/state").Methods("PUT").HandlerFunc(r.setInstanceState)
+	api.Path("/forget").Methods("POST").HandlerFunc(r.forgetInstances)
+	api.Path("/desc").Methods("GET").HandlerFunc(r.exportDesc)
+	api.Path("/desc").Methods("PUT").HandlerFunc(r.importDesc)
+}
+
+type instanceDesc struct {
+	ID                  string    `json:"id"`
+	Address             string    `json:"address"`
+	Zone                string    `json:"zone,omitempty"`
+	State               string    `json:"state"`
+	Healthy             bool      `json:"healthy"`
+	HeartbeatTimestamp  time.Time `json:"heartbeat_timestamp"`
+	HeartbeatAgeSeconds float64   `json:"heartbeat_age_seconds"`
+	Tokens              uint32    `json:"tokens"`
+	OwnershipPercent    float64   `json:"ownership_percent"`
+}
+
+// listInstances lists the instances in the ring, sorted by ID.
+func (r *Ring) listInstances(w http.ResponseWriter, req *http.Request) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	now := time.Now()
+	tokens, owned := countTokens(r.ringDesc)
+	instances := make([]instanceDesc, 0, len(r.ringDesc.Ingesters))
+	for id, ing := range r.ringDesc.Ingesters {
+		heartbeat := time.Unix(ing.Timestamp, 0)
+		instances = append(instances, instanceDesc{
+			ID:                  id,
+			Address:             ing.Addr,
+			Zone:                ing.Zone,
+			State:               ing.State.String(),
+			Healthy:             r.IsHealthy(&ing, Reporting),
+			HeartbeatTimestamp:  heartbeat,
+			HeartbeatAgeSeconds: now.Sub(heartbeat).Seconds(),
+			Tokens:              tokens[id],
+			OwnershipPercent:    (float64(owned[id]) / float64(math.MaxUint32)) * 100,
+		})
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].ID < instances[j].ID
+	})
+
+	util.WriteJSONResponse(w, struct {
+		Instances []instanceDesc `json:"instances"`
+	}{instances})
+}
+
+// requestError is returned from CAS callbacks for errors caused by the
+// request, rather than the ring.
+type requestError struct {
+	code int
+	msg  string
+}
+
+func (e requestError) Error() string {
+	return e.msg
+}
+
+func writeCASError(w http.ResponseWriter, req *http.Request, err error) {
+	if reqErr, ok := err.(requestError); ok {
+		http.Error(w, reqErr.msg, reqErr.code)
+		return
+	}
+	level.Error(util.WithContext(req.Context(), util.Logger)).Log("msg", "error updating ring", "err", err)
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// setInstanceState moves an instance between the ACTIVE, READONLY and LEAVING
+// states.  The instance's lifecycler adopts the new state on its next
+// heartbeat.
+func (r *Ring) setInstanceState(w http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["id"]
+
+	var body struct {
+		State string `json:"state"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	value, ok := IngesterState_value[body.State]
+	if !ok || !operatorState(IngesterState(value)) {
+		http.Error(w, fmt.Sprintf("invalid state %q", body.State), http.StatusBadRequest)
+		return
+	}
+	state := IngesterState(value)
+
+	err := r.KVClient.CAS(req.Context(), r.key, func(in interface{}) (out interface{}, retry bool, err error) {
+		if in == nil {
+			return nil, false, requestError{http.StatusNotFound, "ring is empty"}
+		}
+		ringDesc := in.(*Desc)
+		ing, ok := ringDesc.Ingesters[id]
+		if !ok {
+			return nil, false, requestError{http.StatusNotFound, fmt.Sprintf("instance %q not found", id)}
+		}
+		if !operatorState(ing.State) {
+			return nil, false, requestError{http.StatusConflict, fmt.Sprintf("instance %q is %v", id, ing.State)}
+		}
+		ing.State = state
+		ringDesc.Ingesters[id] = ing
+		return ringDesc, true, nil
+	})
+	if err != nil {
+		writeCASError(w, req, err)
+		return
+	}
+
+	level.Info(util.WithContext(req.Context(), util.Logger)).Log("msg", "changed instance state", "instance", id, "state", state)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// forgetInstances removes instances from the ring, along with their tokens.
+// With no instances given, every unhealthy instance is forgotten; healthy
+// instances are only forgotten if forced.
+func (r *Ring) forgetInstances(w http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Instances []string `json:"instances"`
+		Force     bool     `json:"force"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var forgotten []string
+	err := r.KVClient.CAS(req.Context(), r.key, func(in interface{}) (out interface{}, retry bool, err error) {
+		if in == nil {
+			return nil, false, requestError{http.StatusNotFound, "ring is empty"}
+		}
+		ringDesc := in.(*Desc)
+
+		forgotten = nil
+		ids := body.Instances
+		if len(ids) == 0 {
+			for id, ing := range ringDesc.Ingesters {
+				if !r.IsHealthy(&ing, Reporting) {
+					ids = append(ids, id)
+				}
+			}
+		}
+		for _, id := range ids {
+			ing, ok := ringDesc.Ingesters[id]
+			if !ok {
+				continue
+			}
+			if !body.Force && r.IsHealthy(&ing, Reporting) {
+				return nil, false, requestError{http.StatusConflict, fmt.Sprintf("instance %q is healthy", id)}
+			}
+			ringDesc.RemoveIngester(id)
+			forgotten = append(forgotten, id)
+		}
+		return ringDesc, true, nil
+	})
+	if err != nil {
+		writeCASError(w, req, err)
+		return
+	}
+
+	sort.Strings(forgotten)
+	level.Info(util.WithContext(req.Context(), util.Logger)).Log("msg", "forgot instances", "instances", fmt.Sprintf("%v", forgotten))
+	util.WriteJSONResponse(w, struct {
+		Forgotten []string `json:"forgotten"`
+	}{forgotten})
+}
+
+// exportDesc returns the ring as stored in the KV store, as JSON.
+func (r *Ring) exportDesc(w http.ResponseWriter, req *http.Request) {
+	desc, err := r.KVClient.Get(req.Context(), r.key)
+	if err != nil {
+		writeCASError(w, req, err)
+		return
+	}
+	if desc == nil {
+		http.Error(w, "ring is empty", http.StatusNotFound)
+		return
+	}
+	util.WriteJSONResponse(w, desc)
+}
+
+// importDesc replaces the ring stored in the KV store with one previously
+// exported, e.g. to recover from losing the KV store.
+func (r *Ring) importDesc(w http.ResponseWriter, req *http.Request) {
+	var desc Desc
+	if err := json.NewDecoder(req.Body).Decode(&desc); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for id, ing := range desc.Ingesters {
+		if ing.Addr == "" {
+			http.Error(w, fmt.Sprintf("instance %q has no address", id), http.StatusBadRequest)
+			return
+		}
+	}
+
+	err := r.KVClient.CAS(req.Context(), r.key, func(in interface{}) (out interface{}, retry bool, err error) {
+		return &desc, true, nil
+	})
+	if err != nil {
+		writeCASError(w, req, err)
+		return
+	}
+
+	level.Info(util.WithContext(req.Context(), util.Logger)).Log("msg", "imported ring", "instances", len(desc.Ingesters))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,110 @@
+package ring
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cortexproject/cortex/pkg/util/test"
+)
+
+func TestRingAPI(t *testing.T) {
+	r, err := New(Config{
+		Mock:              NewInMemoryKVClient(),
+		HeartbeatTimeout:  time.Minute,
+		ReplicationFactor: 1,
+	}, ConsulKey)
+	require.NoError(t, err)
+	defer r.Stop()
+
+	router := mux.NewRouter()
+	r.RegisterRoutes(router, "/ring")
+	do := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			require.NoError(t, json.NewEncoder(&buf).Encode(body))
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(method, path, &buf))
+		return recorder
+	}
+
+	// Importing a ring without addresses is rejected.
+	bad := NewDesc()
+	bad.AddIngester("ing0", "", "", []uint32{1}, ACTIVE, false)
+	assert.Equal(t, http.StatusBadRequest, do("PUT", "/ring/api/v1/desc", bad).Code)
+
+	desc := NewDesc()
+	desc.AddIngester("ing0", "ingester0", "", GenerateTokens(128, nil), ACTIVE, false)
+	desc.AddIngester("ing1", "ingester1", "", GenerateTokens(128, nil), ACTIVE, false)
+	desc.AddIngester("ing2", "ingester2", "", GenerateTokens(128, nil), ACTIVE, false)
+	desc.AddIngester("ing3", "ingester3", "", GenerateTokens(128, nil), LEAVING, false)
+	ing2 := desc.Ingesters["ing2"]
+	ing2.Timestamp = time.Now().Add(-time.Hour).Unix()
+	desc.Ingesters["ing2"] = ing2
+	require.Equal(t, http.StatusNoContent, do("PUT", "/ring/api/v1/desc", desc).Code)
+
+	type instances struct {
+		Instances []instanceDesc `json:"instances"`
+	}
+	list := func() instances {
+		var result instances
+		recorder := do("GET", "/ring/api/v1/instances", nil)
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.NoError(t, json.NewDecoder(recorder.Body).Decode(&result))
+		return result
+	}
+	test.Poll(t, time.Second, 4, func() interface{} {
+		return len(list().Instances)
+	})
+
+	result := list()
+	assert.Equal(t, "ing0", result.Instances[0].ID)
+	assert.Equal(t, uint32(128), result.Instances[0].Tokens)
+	assert.True(t, result.Instances[0].Healthy)
+	assert.False(t, result.Instances[2].Healthy)
+	assert.True(t, result.Instances[2].HeartbeatAgeSeconds >= 3600)
+	total := 0.0
+	for _, instance := range result.Instances {
+		total += instance.OwnershipPercent
+	}
+	assert.InDelta(t, 100, total, 0.01)
+
+	// State changes.
+	assert.Equal(t, http.StatusBadRequest, do("PUT", "/ring/api/v1/instances/ing0/state", map[string]string{"state": "JOINING"}).Code)
+	assert.Equal(t, http.StatusBadRequest, do("PUT", "/ring/api/v1/instances/ing0/state", map[string]string{"state": "LEAVING"}).Code)
+	assert.Equal(t, http.StatusNotFound, do("PUT", "/ring/api/v1/instances/unknown/state", map[string]string{"state": "READONLY"}).Code)
+	assert.Equal(t, http.StatusNoContent, do("PUT", "/ring/api/v1/instances/ing0/state", map[string]string{"state": "READONLY"}).Code)
+	test.Poll(t, time.Second, READONLY.String(), func() interface{} {
+		return list().Instances[0].State
+	})
+	// Leaving instances can't be moved back.
+	assert.Equal(t, http.StatusConflict, do("PUT", "/ring/api/v1/instances/ing3/state", map[string]string{"state": "ACTIVE"}).Code)
+
+	// Forgetting a healthy instance needs force.
+	assert.Equal(t, http.StatusConflict, do("POST", "/ring/api/v1/forget", map[string]interface{}{"instances": []string{"ing1"}}).Code)
+
+	// Forgetting with no instances forgets the unhealthy ones.
+	recorder := do("POST", "/ring/api/v1/forget", map[string]interface{}{})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var forgotten struct {
+		Forgotten []string `json:"forgotten"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&forgotten))
+	assert.Equal(t, []string{"ing2"}, forgotten.Forgotten)
+
+	// Export round trips.
+	recorder = do("GET", "/ring/api/v1/desc", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var exported Desc
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&exported))
+	assert.Len(t, exported.Ingesters, 3)
+	assert.Equal(t, READONLY, exported.Ingesters["ing0"].State)
+}
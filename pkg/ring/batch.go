@@ -2,6 +2,7 @@ package ring
 
 import (
 	"context"
+	"sync"
 	"sync/atomic"
 )
 
@@ -23,6 +24,10 @@ type itemTracker struct {
 	maxFailures int
 	succeeded   int32
 	failed      int32
+
+	// Set instead of the above for items replicated across zones.
+	zonesMtx sync.Mutex
+	zones    *zoneTracker
 }
 
 // DoBatch request against a set of keys in the ring, handling replication and
@@ -44,8 +49,12 @@ func DoBatch(ctx context.Context, r ReadRing, keys []uint32, callback func(Inges
 	itemTrackers := make([]itemTracker, len(keys))
 	ingesters := map[string]ingester{}
 	for i, replicationSet := range replicationSets {
-		itemTrackers[i].minSuccess = len(replicationSet.Ingesters) - replicationSet.MaxErrors
-		itemTrackers[i].maxFailures = replicationSet.MaxErrors
+		if replicationSet.MaxUnavailableZones > 0 {
+			itemTrackers[i].zones = newZoneTracker(replicationSet.Ingesters, replicationSet.MaxUnavailableZones)
+		} else {
+			itemTrackers[i].minSuccess = len(replicationSet.Ingesters) - replicationSet.MaxErrors
+			itemTrackers[i].maxFailures = replicationSet.MaxErrors
+		}
 
 		for _, desc := range replicationSet.Ingesters {
 			curr := ingesters[desc.Addr]
@@ -66,7 +75,7 @@ func DoBatch(ctx context.Context, r ReadRing, keys []uint32, callback func(Inges
 	for _, i := range ingesters {
 		go func(i ingester) {
 			err := callback(i.desc, i.indexes)
-			tracker.record(i.itemTrackers, err)
+			tracker.record(&i.desc, i.itemTrackers, err)
 		}(i)
 	}
 
@@ -80,7 +89,7 @@ func DoBatch(ctx context.Context, r ReadRing, keys []uint32, callback func(Inges
 	}
 }
 
-func (b *batchTracker) record(sampleTrackers []*itemTracker, err error) {
+func (b *batchTracker) record(desc *IngesterDesc, sampleTrackers []*itemTracker, err error) {
 	// If we succeed, decrement each sample's pending count by one.  If we reach
 	// the required number of successful puts on this sample, then decrement the
 	// number of pending samples by one.  If we successfully push all samples to
@@ -91,6 +100,11 @@ func (b *batchTracker) record(sampleTrackers []*itemTracker, err error) {
 	// The use of atomic increments here guarantees only a single sendSamples
 	// goroutine will write to either channel.
 	for i := range sampleTrackers {
+		if sampleTrackers[i].zones != nil {
+			b.recordZone(desc, sampleTrackers[i], err)
+			continue
+		}
+
 		if err != nil {
 			if atomic.AddInt32(&sampleTrackers[i].failed, 1) <= int32(sampleTrackers[i].maxFailures) {
 				continue
@@ -108,3 +122,16 @@ func (b *batchTracker) record(sampleTrackers []*itemTracker, err error) {
 		}
 	}
 }
+
+// recordZone is record for an item replicated across zones.
+func (b *batchTracker) recordZone(desc *IngesterDesc, sampleTracker *itemTracker, err error) {
+	sampleTracker.zonesMtx.Lock()
+	succeeded, failed := sampleTracker.zones.record(desc, err)
+	sampleTracker.zonesMtx.Unlock()
+
+	if failed && atomic.AddInt32(&b.rpcsFailed, 1) == 1 {
+		b.err <- err
+	} else if succeeded && atomic.AddInt32(&b.rpcsPending, -1) == 0 {
+		b.done <- struct{}{}
+	}
+}
@@ -19,6 +19,12 @@ type mockKV struct {
 
 // NewInMemoryKVClient makes a new mock consul client.
 func NewInMemoryKVClient() KVClient {
+	return NewInMemoryKVClientWithCodec(ProtoCodec{Factory: ProtoDescFactory})
+}
+
+// NewInMemoryKVClientWithCodec makes a new mock consul client, for values
+// serialised with codec.
+func NewInMemoryKVClientWithCodec(codec Codec) KVClient {
 	m := mockKV{
 		kvps: map[string]*consul.KVPair{},
 	}
@@ -26,7 +32,7 @@ func NewInMemoryKVClient() KVClient {
 	go m.loop()
 	return &consulClient{
 		kv:    &m,
-		codec: ProtoCodec{Factory: ProtoDescFactory},
+		codec: codec,
 	}
 }
 
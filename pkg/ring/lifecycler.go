@@ -35,6 +35,10 @@ var (
 		Help:    "Duration (in seconds) of cortex shutdown procedure (ie transfer or flush).",
 		Buckets: prometheus.ExponentialBuckets(10, 2, 8), // Biggest bucket is 10*2^(9-1) = 2560, or 42 mins.
 	}, []string{"op", "status"})
+	autoForgottenInstances = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cortex_ring_auto_forgotten_instances_total",
+		Help: "The total number of unhealthy instances automatically removed from the ring.",
+	}, []string{"ring"})
 )
 
 // LifecyclerConfig is the config to build a Lifecycler.
@@ -51,6 +55,9 @@ type LifecyclerConfig struct {
 	NormaliseTokens  bool          `yaml:"normalise_tokens,omitempty"`
 	InfNames         []string      `yaml:"interface_names"`
 	FinalSleep       time.Duration `yaml:"final_sleep"`
+	Zone             string        `yaml:"availability_zone,omitempty"`
+	TokensFilePath   string        `yaml:"tokens_file_path,omitempty"`
+	AutoForgetAfter  int           `yaml:"auto_forget_after_heartbeat_timeouts,omitempty"`
 
 	// For testing, you can override the address and ID of this ingester
 	Addr           string `yaml:"address"`
@@ -62,14 +69,25 @@ type LifecyclerConfig struct {
 // RegisterFlags adds the flags required to config this to the given FlagSet
 func (cfg *LifecyclerConfig) RegisterFlags(f *flag.FlagSet) {
 	cfg.RingConfig.RegisterFlags(f)
+	cfg.registerLifecyclerFlags("ingester.", f)
+}
+
+// RegisterFlagsWithPrefix adds the flags required to config this to the given
+// FlagSet, prefixing every flag name (including those of the ring). Used by
+// components other than the ingesters which join their own ring.
+func (cfg *LifecyclerConfig) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
+	cfg.RingConfig.RegisterFlagsWithPrefix(prefix, f)
+	cfg.registerLifecyclerFlags(prefix, f)
+}
 
-	f.IntVar(&cfg.NumTokens, "ingester.num-tokens", 128, "Number of tokens for each ingester.")
-	f.DurationVar(&cfg.HeartbeatPeriod, "ingester.heartbeat-period", 5*time.Second, "Period at which to heartbeat to consul.")
-	f.DurationVar(&cfg.JoinAfter, "ingester.join-after", 0*time.Second, "Period to wait for a claim from another ingester; will join automatically after this.")
-	f.DurationVar(&cfg.MinReadyDuration, "ingester.min-ready-duration", 1*time.Minute, "Minimum duration to wait before becoming ready. This is to work around race conditions with ingesters exiting and updating the ring.")
-	f.BoolVar(&cfg.ClaimOnRollout, "ingester.claim-on-rollout", false, "Send chunks to PENDING ingesters on exit.")
-	f.BoolVar(&cfg.NormaliseTokens, "ingester.normalise-tokens", false, "Store tokens in a normalised fashion to reduce allocations.")
-	f.DurationVar(&cfg.FinalSleep, "ingester.final-sleep", 30*time.Second, "Duration to sleep for before exiting, to ensure metrics are scraped.")
+func (cfg *LifecyclerConfig) registerLifecyclerFlags(prefix string, f *flag.FlagSet) {
+	f.IntVar(&cfg.NumTokens, prefix+"num-tokens", 128, "Number of tokens for each ingester.")
+	f.DurationVar(&cfg.HeartbeatPeriod, prefix+"heartbeat-period", 5*time.Second, "Period at which to heartbeat to consul.")
+	f.DurationVar(&cfg.JoinAfter, prefix+"join-after", 0*time.Second, "Period to wait for a claim from another ingester; will join automatically after this.")
+	f.DurationVar(&cfg.MinReadyDuration, prefix+"min-ready-duration", 1*time.Minute, "Minimum duration to wait before becoming ready. This is to work around race conditions with ingesters exiting and updating the ring.")
+	f.BoolVar(&cfg.ClaimOnRollout, prefix+"claim-on-rollout", false, "Send chunks to PENDING ingesters on exit.")
+	f.BoolVar(&cfg.NormaliseTokens, prefix+"normalise-tokens", false, "Store tokens in a normalised fashion to reduce allocations.")
+	f.DurationVar(&cfg.FinalSleep, prefix+"final-sleep", 30*time.Second, "Duration to sleep for before exiting, to ensure metrics are scraped.")
 
 	hostname, err := os.Hostname()
 	if err != nil {
@@ -78,10 +96,13 @@ func (cfg *LifecyclerConfig) RegisterFlags(f *flag.FlagSet) {
 	}
 
 	cfg.InfNames = []string{"eth0", "en0"}
-	f.Var((*flagext.Strings)(&cfg.InfNames), "ingester.interface", "Name of network interface to read address from.")
-	f.StringVar(&cfg.Addr, "ingester.addr", "", "IP address to advertise in consul.")
-	f.IntVar(&cfg.Port, "ingester.port", 0, "port to advertise in consul (defaults to server.grpc-listen-port).")
-	f.StringVar(&cfg.ID, "ingester.ID", hostname, "ID to register into consul.")
+	f.Var((*flagext.Strings)(&cfg.InfNames), prefix+"interface", "Name of network interface to read address from.")
+	f.StringVar(&cfg.Addr, prefix+"addr", "", "IP address to advertise in consul.")
+	f.IntVar(&cfg.Port, prefix+"port", 0, "port to advertise in consul (defaults to server.grpc-listen-port).")
+	f.StringVar(&cfg.ID, prefix+"ID", hostname, "ID to register into consul.")
+	f.StringVar(&cfg.Zone, prefix+"availability-zone", "", "The availability zone of this instance, used to spread replicas across zones.")
+	f.StringVar(&cfg.TokensFilePath, prefix+"tokens-file-path", "", "File in which to store this instance's tokens, so they are reused after a restart. Disabled if empty.")
+	f.IntVar(&cfg.AutoForgetAfter, prefix+"auto-forget-after-heartbeat-timeouts", 0, "Remove instances from the ring once they haven't heartbeated for this many heartbeat timeouts. Disabled if 0.")
 }
 
 // FlushTransferer controls the shutdown of an ingester.
@@ -96,6 +117,7 @@ type Lifecycler struct {
 	cfg             LifecyclerConfig
 	flushTransferer FlushTransferer
 	KVStore         KVClient
+	ringKey         string
 
 	// Controls the lifecycle of the ingester
 	quit      chan struct{}
@@ -118,8 +140,9 @@ type Lifecycler struct {
 	ready     bool
 }
 
-// NewLifecycler makes and starts a new Lifecycler.
-func NewLifecycler(cfg LifecyclerConfig, flushTransferer FlushTransferer) (*Lifecycler, error) {
+// NewLifecycler makes and starts a new Lifecycler, registering in the ring
+// stored under ringKey.
+func NewLifecycler(cfg LifecyclerConfig, flushTransferer FlushTransferer, ringKey string) (*Lifecycler, error) {
 	addr := cfg.Addr
 	if addr == "" {
 		var err error
@@ -142,6 +165,7 @@ func NewLifecycler(cfg LifecyclerConfig, flushTransferer FlushTransferer) (*Life
 		cfg:             cfg,
 		flushTransferer: flushTransferer,
 		KVStore:         store,
+		ringKey:         ringKey,
 
 		addr: fmt.Sprintf("%s:%d", addr, port),
 		ID:   cfg.ID,
@@ -177,7 +201,7 @@ func (i *Lifecycler) CheckReady(ctx context.Context) error {
 		return fmt.Errorf("waiting for %v after startup", i.cfg.MinReadyDuration)
 	}
 
-	ringDesc, err := i.KVStore.Get(ctx, ConsulKey)
+	ringDesc, err := i.KVStore.Get(ctx, i.ringKey)
 	if err != nil {
 		level.Error(util.Logger).Log("msg", "error talking to consul", "err", err)
 		return fmt.Errorf("error talking to consul: %s", err)
@@ -194,6 +218,11 @@ func (i *Lifecycler) CheckReady(ctx context.Context) error {
 	return nil
 }
 
+// Addr returns the address this ingester advertises in the ring.
+func (i *Lifecycler) Addr() string {
+	return i.addr
+}
+
 // GetState returns the state of this ingester.
 func (i *Lifecycler) GetState() IngesterState {
 	i.stateMtx.Lock()
@@ -247,11 +276,12 @@ func (i *Lifecycler) ClaimTokensFor(ctx context.Context, ingesterID string) erro
 			return ringDesc, true, nil
 		}
 
-		if err := i.KVStore.CAS(ctx, ConsulKey, claimTokens); err != nil {
+		if err := i.KVStore.CAS(ctx, i.ringKey, claimTokens); err != nil {
 			level.Error(util.Logger).Log("msg", "Failed to write to consul", "err", err)
 		}
 
 		i.setTokens(tokens)
+		i.storeTokens()
 		err <- nil
 	}
 
@@ -309,7 +339,7 @@ loop:
 
 		case <-heartbeatTicker.C:
 			consulHeartbeats.Inc()
-			if err := i.updateConsul(context.Background()); err != nil {
+			if err := i.heartbeat(context.Background()); err != nil {
 				level.Error(util.Logger).Log("msg", "failed to write to consul, sleeping", "err", err)
 			}
 
@@ -359,7 +389,7 @@ heartbeatLoop:
 // - add an ingester entry to the ring
 // - copies out our state and tokens if they exist
 func (i *Lifecycler) initRing(ctx context.Context) error {
-	return i.KVStore.CAS(ctx, ConsulKey, func(in interface{}) (out interface{}, retry bool, err error) {
+	return i.KVStore.CAS(ctx, i.ringKey, func(in interface{}) (out interface{}, retry bool, err error) {
 		var ringDesc *Desc
 		if in == nil {
 			ringDesc = NewDesc()
@@ -371,7 +401,7 @@ func (i *Lifecycler) initRing(ctx context.Context) error {
 		if !ok {
 			// Either we are a new ingester, or consul must have restarted
 			level.Info(util.Logger).Log("msg", "entry not found in ring, adding with no tokens")
-			ringDesc.AddIngester(i.ID, i.addr, []uint32{}, i.GetState(), i.cfg.NormaliseTokens)
+			ringDesc.AddIngester(i.ID, i.addr, i.cfg.Zone, []uint32{}, i.GetState(), i.cfg.NormaliseTokens)
 			return ringDesc, true, nil
 		}
 
@@ -385,9 +415,19 @@ func (i *Lifecycler) initRing(ctx context.Context) error {
 	})
 }
 
-// autoJoin selects random tokens & moves state to ACTIVE
+// autoJoin selects random tokens & moves state to ACTIVE.  If we stored our
+// tokens before restarting, those not taken since are reused.
 func (i *Lifecycler) autoJoin(ctx context.Context) error {
-	return i.KVStore.CAS(ctx, ConsulKey, func(in interface{}) (out interface{}, retry bool, err error) {
+	var storedTokens []uint32
+	if i.cfg.TokensFilePath != "" {
+		var err error
+		storedTokens, err = loadTokensFromFile(i.cfg.TokensFilePath)
+		if err != nil && !os.IsNotExist(err) {
+			level.Warn(util.Logger).Log("msg", "error loading tokens from file, generating new ones", "path", i.cfg.TokensFilePath, "err", err)
+		}
+	}
+
+	err := i.KVStore.CAS(ctx, i.ringKey, func(in interface{}) (out interface{}, retry bool, err error) {
 		var ringDesc *Desc
 		if in == nil {
 			ringDesc = NewDesc()
@@ -401,9 +441,16 @@ func (i *Lifecycler) autoJoin(ctx context.Context) error {
 			level.Error(util.Logger).Log("msg", "tokens already exist for this ingester - wasn't expecting any!", "num_tokens", len(myTokens))
 		}
 
-		newTokens := GenerateTokens(i.cfg.NumTokens-len(myTokens), takenTokens)
+		newTokens := ringDesc.unclaimedTokens(storedTokens, i.cfg.NumTokens-len(myTokens))
+		if len(storedTokens) > 0 {
+			level.Info(util.Logger).Log("msg", "reusing tokens from file", "num_tokens", len(newTokens))
+		}
+		takenTokens = append(takenTokens, newTokens...)
+		sort.Sort(sortableUint32(takenTokens))
+		newTokens = append(newTokens, GenerateTokens(i.cfg.NumTokens-len(myTokens)-len(newTokens), takenTokens)...)
+
 		i.setState(ACTIVE)
-		ringDesc.AddIngester(i.ID, i.addr, newTokens, i.GetState(), i.cfg.NormaliseTokens)
+		ringDesc.AddIngester(i.ID, i.addr, i.cfg.Zone, newTokens, i.GetState(), i.cfg.NormaliseTokens)
 
 		tokens := append(myTokens, newTokens...)
 		sort.Sort(sortableUint32(tokens))
@@ -411,12 +458,40 @@ func (i *Lifecycler) autoJoin(ctx context.Context) error {
 
 		return ringDesc, true, nil
 	})
+	if err != nil {
+		return err
+	}
+
+	i.storeTokens()
+	return nil
+}
+
+// storeTokens persists our tokens, if configured to.
+func (i *Lifecycler) storeTokens() {
+	tokens := i.getTokens()
+	if i.cfg.TokensFilePath == "" || len(tokens) == 0 {
+		return
+	}
+	if err := storeTokensToFile(i.cfg.TokensFilePath, tokens); err != nil {
+		level.Error(util.Logger).Log("msg", "error storing tokens to file", "path", i.cfg.TokensFilePath, "err", err)
+	}
 }
 
 // updateConsul updates our entries in consul, heartbeating and dealing with
 // consul restarts.
 func (i *Lifecycler) updateConsul(ctx context.Context) error {
-	return i.KVStore.CAS(ctx, ConsulKey, func(in interface{}) (out interface{}, retry bool, err error) {
+	return i.updateRing(ctx, false)
+}
+
+// heartbeat is updateConsul, also adopting any state operators have set for
+// us via the ring's API, and forgetting long-unhealthy instances.
+func (i *Lifecycler) heartbeat(ctx context.Context) error {
+	return i.updateRing(ctx, true)
+}
+
+func (i *Lifecycler) updateRing(ctx context.Context, active bool) error {
+	var forgotten map[string]IngesterDesc
+	err := i.KVStore.CAS(ctx, i.ringKey, func(in interface{}) (out interface{}, retry bool, err error) {
 		var ringDesc *Desc
 		if in == nil {
 			ringDesc = NewDesc()
@@ -428,16 +503,68 @@ func (i *Lifecycler) updateConsul(ctx context.Context) error {
 		if !ok {
 			// consul must have restarted
 			level.Info(util.Logger).Log("msg", "found empty ring, inserting tokens")
-			ringDesc.AddIngester(i.ID, i.addr, i.getTokens(), i.GetState(), i.cfg.NormaliseTokens)
+			ringDesc.AddIngester(i.ID, i.addr, i.cfg.Zone, i.getTokens(), i.GetState(), i.cfg.NormaliseTokens)
 		} else {
+			if state := i.GetState(); active && ingesterDesc.State != state && operatorState(ingesterDesc.State) && operatorState(state) {
+				level.Info(util.Logger).Log("msg", "adopting state set in the ring", "old_state", state, "new_state", ingesterDesc.State)
+				i.setState(ingesterDesc.State)
+			}
 			ingesterDesc.Timestamp = time.Now().Unix()
 			ingesterDesc.State = i.GetState()
 			ingesterDesc.Addr = i.addr
+			ingesterDesc.Zone = i.cfg.Zone
 			ringDesc.Ingesters[i.ID] = ingesterDesc
 		}
 
+		forgotten = nil
+		if active && i.cfg.AutoForgetAfter > 0 {
+			forgotten = i.forgetUnhealthy(ringDesc)
+		}
 		return ringDesc, true, nil
 	})
+	if err != nil {
+		return err
+	}
+
+	for id, ing := range forgotten {
+		autoForgottenInstances.WithLabelValues(i.ringKey).Inc()
+		level.Warn(util.Logger).Log("msg", "forgot unhealthy instance", "ring", i.ringKey, "instance", id, "addr", ing.Addr,
+			"state", ing.State, "last_heartbeat", time.Unix(ing.Timestamp, 0))
+	}
+	return nil
+}
+
+// forgetUnhealthy removes the instances which haven't heartbeated for
+// AutoForgetAfter heartbeat timeouts from ringDesc, if we are the instance
+// elected to do so: the healthy, ACTIVE instance with the lowest ID.
+func (i *Lifecycler) forgetUnhealthy(ringDesc *Desc) map[string]IngesterDesc {
+	if i.GetState() != ACTIVE {
+		return nil
+	}
+
+	now := time.Now()
+	heartbeatTimeout := i.cfg.RingConfig.HeartbeatTimeout
+	for id, ing := range ringDesc.Ingesters {
+		if id < i.ID && ing.State == ACTIVE && now.Sub(time.Unix(ing.Timestamp, 0)) <= heartbeatTimeout {
+			return nil
+		}
+	}
+
+	forgotten := map[string]IngesterDesc{}
+	for id, ing := range ringDesc.Ingesters {
+		if id != i.ID && now.Sub(time.Unix(ing.Timestamp, 0)) > time.Duration(i.cfg.AutoForgetAfter)*heartbeatTimeout {
+			forgotten[id] = ing
+			ringDesc.RemoveIngester(id)
+		}
+	}
+	return forgotten
+}
+
+// operatorState returns whether operators may move an instance into, and out
+// of, the given state.  LEAVING is excluded: once an instance starts leaving
+// it is transferring or flushing its chunks, and must not be moved back.
+func operatorState(state IngesterState) bool {
+	return state == ACTIVE || state == READONLY
 }
 
 // changeState updates consul with state transitions for us.  NB this must be
@@ -449,7 +576,8 @@ func (i *Lifecycler) changeState(ctx context.Context, state IngesterState) error
 		(currState == JOINING && state == PENDING) || // triggered by TransferChunks on failure
 		(currState == JOINING && state == ACTIVE) || // triggered by TransferChunks on success
 		(currState == PENDING && state == ACTIVE) || // triggered by autoJoin
-		(currState == ACTIVE && state == LEAVING)) { // triggered by shutdown
+		(currState == ACTIVE && state == LEAVING) || // triggered by shutdown
+		(currState == READONLY && state == LEAVING)) { // triggered by shutdown of a read-only ingester
 		return fmt.Errorf("Changing ingester state from %v -> %v is disallowed", currState, state)
 	}
 
@@ -483,7 +611,7 @@ func (i *Lifecycler) processShutdown(ctx context.Context) {
 
 // unregister removes our entry from consul.
 func (i *Lifecycler) unregister(ctx context.Context) error {
-	return i.KVStore.CAS(ctx, ConsulKey, func(in interface{}) (out interface{}, retry bool, err error) {
+	return i.KVStore.CAS(ctx, i.ringKey, func(in interface{}) (out interface{}, retry bool, err error) {
 		if in == nil {
 			return nil, false, fmt.Errorf("found empty ring when trying to unregister")
 		}
@@ -2,6 +2,10 @@ package ring
 
 import (
 	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
 	"testing"
 	"time"
 
@@ -29,7 +33,7 @@ func TestRingNormaliseMigration(t *testing.T) {
 	flagext.DefaultValues(&ringConfig)
 	ringConfig.Mock = NewInMemoryKVClient()
 
-	r, err := New(ringConfig)
+	r, err := New(ringConfig, ConsulKey)
 	require.NoError(t, err)
 	defer r.Stop()
 
@@ -45,7 +49,7 @@ func TestRingNormaliseMigration(t *testing.T) {
 	lifecyclerConfig1.FinalSleep = 0
 
 	ft := &flushTransferer{}
-	l1, err := NewLifecycler(lifecyclerConfig1, ft)
+	l1, err := NewLifecycler(lifecyclerConfig1, ft, ConsulKey)
 	require.NoError(t, err)
 
 	// Check this ingester joined, is active, and has one token.
@@ -70,7 +74,7 @@ func TestRingNormaliseMigration(t *testing.T) {
 	lifecyclerConfig2.ID = "ing2"
 	lifecyclerConfig1.FinalSleep = 0
 
-	l2, err := NewLifecycler(lifecyclerConfig2, &flushTransferer{})
+	l2, err := NewLifecycler(lifecyclerConfig2, &flushTransferer{}, ConsulKey)
 	require.NoError(t, err)
 
 	// This will block until l1 has successfully left the ring.
@@ -91,3 +95,144 @@ func TestRingNormaliseMigration(t *testing.T) {
 			len(desc.Tokens) == 0
 	})
 }
+
+func TestTokensOnDisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tokens")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var ringConfig Config
+	flagext.DefaultValues(&ringConfig)
+	ringConfig.Mock = NewInMemoryKVClient()
+
+	r, err := New(ringConfig, ConsulKey)
+	require.NoError(t, err)
+	defer r.Stop()
+
+	var lifecyclerConfig LifecyclerConfig
+	flagext.DefaultValues(&lifecyclerConfig)
+	lifecyclerConfig.Addr = "0.0.0.0"
+	lifecyclerConfig.Port = 1
+	lifecyclerConfig.RingConfig = ringConfig
+	lifecyclerConfig.NumTokens = 64
+	lifecyclerConfig.ID = "ing1"
+	lifecyclerConfig.FinalSleep = 0
+	lifecyclerConfig.TokensFilePath = filepath.Join(dir, "tokens")
+
+	// The first lifecycler generates tokens and stores them.
+	l1, err := NewLifecycler(lifecyclerConfig, &flushTransferer{}, ConsulKey)
+	require.NoError(t, err)
+	test.Poll(t, 1000*time.Millisecond, 64, func() interface{} {
+		return len(l1.getTokens())
+	})
+	tokens := l1.getTokens()
+	stored, err := loadTokensFromFile(lifecyclerConfig.TokensFilePath)
+	require.NoError(t, err)
+	require.Equal(t, tokens, stored)
+	l1.Shutdown()
+
+	// Once it has left the ring, a restarted lifecycler picks the same tokens.
+	l2, err := NewLifecycler(lifecyclerConfig, &flushTransferer{}, ConsulKey)
+	require.NoError(t, err)
+	defer l2.Shutdown()
+	test.Poll(t, 1000*time.Millisecond, tokens, func() interface{} {
+		return l2.getTokens()
+	})
+}
+
+func TestLifecyclerAdoptsOperatorState(t *testing.T) {
+	var ringConfig Config
+	flagext.DefaultValues(&ringConfig)
+	ringConfig.Mock = NewInMemoryKVClient()
+
+	r, err := New(ringConfig, ConsulKey)
+	require.NoError(t, err)
+	defer r.Stop()
+
+	var lifecyclerConfig LifecyclerConfig
+	flagext.DefaultValues(&lifecyclerConfig)
+	lifecyclerConfig.Addr = "0.0.0.0"
+	lifecyclerConfig.Port = 1
+	lifecyclerConfig.RingConfig = ringConfig
+	lifecyclerConfig.NumTokens = 64
+	lifecyclerConfig.ID = "ing1"
+	lifecyclerConfig.FinalSleep = 0
+	lifecyclerConfig.HeartbeatPeriod = 100 * time.Millisecond
+
+	l, err := NewLifecycler(lifecyclerConfig, &flushTransferer{}, ConsulKey)
+	require.NoError(t, err)
+	defer l.Shutdown()
+	test.Poll(t, 1000*time.Millisecond, ACTIVE, func() interface{} {
+		return l.GetState()
+	})
+
+	// An operator marks the ingester READONLY in the ring; it adopts the state
+	// on its next heartbeat, rather than overwriting it.
+	err = r.KVClient.CAS(context.Background(), ConsulKey, func(in interface{}) (out interface{}, retry bool, err error) {
+		desc := in.(*Desc)
+		ing := desc.Ingesters["ing1"]
+		ing.State = READONLY
+		desc.Ingesters["ing1"] = ing
+		return desc, true, nil
+	})
+	require.NoError(t, err)
+	test.Poll(t, 1000*time.Millisecond, READONLY, func() interface{} {
+		return l.GetState()
+	})
+}
+
+func TestLifecyclerAutoForget(t *testing.T) {
+	var ringConfig Config
+	flagext.DefaultValues(&ringConfig)
+	ringConfig.Mock = NewInMemoryKVClient()
+	ringConfig.HeartbeatTimeout = time.Minute
+
+	r, err := New(ringConfig, ConsulKey)
+	require.NoError(t, err)
+	defer r.Stop()
+
+	// ing0 died long ago, ing3 only recently, and ing2 is healthy.
+	now := time.Now()
+	err = r.KVClient.CAS(context.Background(), ConsulKey, func(in interface{}) (out interface{}, retry bool, err error) {
+		desc := NewDesc()
+		for id, lastHeartbeat := range map[string]time.Time{
+			"ing0": now.Add(-3 * time.Minute),
+			"ing2": now,
+			"ing3": now.Add(-90 * time.Second),
+		} {
+			desc.AddIngester(id, id, "", GenerateTokens(64, nil), ACTIVE, false)
+			ing := desc.Ingesters[id]
+			ing.Timestamp = lastHeartbeat.Unix()
+			desc.Ingesters[id] = ing
+		}
+		return desc, true, nil
+	})
+	require.NoError(t, err)
+
+	var lifecyclerConfig LifecyclerConfig
+	flagext.DefaultValues(&lifecyclerConfig)
+	lifecyclerConfig.Addr = "0.0.0.0"
+	lifecyclerConfig.Port = 1
+	lifecyclerConfig.RingConfig = ringConfig
+	lifecyclerConfig.NumTokens = 64
+	lifecyclerConfig.ID = "ing1"
+	lifecyclerConfig.FinalSleep = 0
+	lifecyclerConfig.HeartbeatPeriod = 100 * time.Millisecond
+	lifecyclerConfig.AutoForgetAfter = 2
+
+	l, err := NewLifecycler(lifecyclerConfig, &flushTransferer{}, ConsulKey)
+	require.NoError(t, err)
+	defer l.Shutdown()
+
+	// As the healthy instance with the lowest ID, ing1 forgets ing0 only.
+	test.Poll(t, 1000*time.Millisecond, []string{"ing1", "ing2", "ing3"}, func() interface{} {
+		desc, err := r.KVClient.Get(context.Background(), ConsulKey)
+		require.NoError(t, err)
+		ids := []string{}
+		for id := range desc.(*Desc).Ingesters {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		return ids
+	})
+}
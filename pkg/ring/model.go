@@ -28,7 +28,7 @@ func NewDesc() *Desc {
 }
 
 // AddIngester adds the given ingester to the ring.
-func (d *Desc) AddIngester(id, addr string, tokens []uint32, state IngesterState, normaliseTokens bool) {
+func (d *Desc) AddIngester(id, addr, zone string, tokens []uint32, state IngesterState, normaliseTokens bool) {
 	if d.Ingesters == nil {
 		d.Ingesters = map[string]IngesterDesc{}
 	}
@@ -37,6 +37,7 @@ func (d *Desc) AddIngester(id, addr string, tokens []uint32, state IngesterState
 		Addr:      addr,
 		Timestamp: time.Now().Unix(),
 		State:     state,
+		Zone:      zone,
 	}
 
 	if normaliseTokens {
@@ -54,6 +55,15 @@ func (d *Desc) AddIngester(id, addr string, tokens []uint32, state IngesterState
 	d.Ingesters[id] = ingester
 }
 
+// failureDomain returns the zone of the ingester, or its address if it has no
+// zone, so that ingesters without a zone fail independently.
+func (i *IngesterDesc) failureDomain() string {
+	if i.Zone != "" {
+		return i.Zone
+	}
+	return i.Addr
+}
+
 // RemoveIngester removes the given ingester and all its tokens.
 func (d *Desc) RemoveIngester(id string) {
 	delete(d.Ingesters, id)
@@ -122,13 +132,14 @@ func (d *Desc) FindIngestersByState(state IngesterState) []IngesterDesc {
 	return result
 }
 
-// Ready returns no error when all ingesters are active and healthy.
+// Ready returns no error when all ingesters are active (or read-only) and
+// healthy.
 func (d *Desc) Ready(heartbeatTimeout time.Duration) error {
 	numTokens := len(d.Tokens)
 	for id, ingester := range d.Ingesters {
 		if time.Now().Sub(time.Unix(ingester.Timestamp, 0)) > heartbeatTimeout {
 			return fmt.Errorf("ingester %s past heartbeat timeout", id)
-		} else if ingester.State != ACTIVE {
+		} else if ingester.State != ACTIVE && ingester.State != READONLY {
 			return fmt.Errorf("ingester %s in state %v", id, ingester.State)
 		}
 		numTokens += len(ingester.Tokens)
@@ -10,11 +10,20 @@ import (
 type ReplicationSet struct {
 	Ingesters []IngesterDesc
 	MaxErrors int
+
+	// If non-zero, errors are tolerated by zone rather than by ingester: the
+	// ingesters of up to MaxUnavailableZones zones may fail, and MaxErrors is
+	// ignored.
+	MaxUnavailableZones int
 }
 
 // Do function f in parallel for all replicas in the set, erroring is we exceed
 // MaxErrors and returning early otherwise.
 func (r ReplicationSet) Do(ctx context.Context, delay time.Duration, f func(*IngesterDesc) (interface{}, error)) ([]interface{}, error) {
+	if r.MaxUnavailableZones > 0 {
+		return r.doZoneAware(ctx, f)
+	}
+
 	var (
 		errs        = make(chan error, len(r.Ingesters))
 		resultsChan = make(chan interface{}, len(r.Ingesters))
@@ -74,3 +83,86 @@ func (r ReplicationSet) Do(ctx context.Context, delay time.Duration, f func(*Ing
 
 	return results, nil
 }
+
+// doZoneAware is Do for sets tolerating errors by zone.  Extra requests are
+// never delayed, as we need all the ingesters of a zone to succeed.
+func (r ReplicationSet) doZoneAware(ctx context.Context, f func(*IngesterDesc) (interface{}, error)) ([]interface{}, error) {
+	type result struct {
+		ingester *IngesterDesc
+		value    interface{}
+		err      error
+	}
+	resultsChan := make(chan result, len(r.Ingesters))
+	for i := range r.Ingesters {
+		go func(ing *IngesterDesc) {
+			value, err := f(ing)
+			resultsChan <- result{ing, value, err}
+		}(&r.Ingesters[i])
+	}
+
+	tracker := newZoneTracker(r.Ingesters, r.MaxUnavailableZones)
+	results := make([]interface{}, 0, len(r.Ingesters))
+	for {
+		select {
+		case res := <-resultsChan:
+			if res.err == nil {
+				results = append(results, res.value)
+			}
+			succeeded, failed := tracker.record(res.ingester, res.err)
+			if failed {
+				return nil, res.err
+			} else if succeeded {
+				return results, nil
+			}
+
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// zoneTracker tracks the results of requests to a set of ingesters, which
+// succeed once all the ingesters of enough zones have succeeded, and fail once
+// too many zones have an ingester which failed.  It is not safe for concurrent
+// use.
+type zoneTracker struct {
+	pending        map[string]int
+	failed         map[string]struct{}
+	succeeded      int
+	minSuccess     int
+	maxUnavailable int
+}
+
+func newZoneTracker(ingesters []IngesterDesc, maxUnavailableZones int) *zoneTracker {
+	pending := map[string]int{}
+	for i := range ingesters {
+		pending[ingesters[i].failureDomain()]++
+	}
+	return &zoneTracker{
+		pending:        pending,
+		failed:         map[string]struct{}{},
+		minSuccess:     len(pending) - maxUnavailableZones,
+		maxUnavailable: maxUnavailableZones,
+	}
+}
+
+// record the result of a request to ingester, returning whether the set has
+// now succeeded or failed.  Each is only returned once.
+func (t *zoneTracker) record(ingester *IngesterDesc, err error) (succeeded, failed bool) {
+	zone := ingester.failureDomain()
+	if _, ok := t.failed[zone]; ok {
+		return false, false
+	}
+
+	if err != nil {
+		t.failed[zone] = struct{}{}
+		return false, len(t.failed) == t.maxUnavailable+1
+	}
+
+	t.pending[zone]--
+	if t.pending[zone] > 0 {
+		return false, false
+	}
+	t.succeeded++
+	return t.succeeded == t.minSuccess, false
+}
@@ -46,6 +46,53 @@ func (r *Ring) replicationStrategy(ingesters []IngesterDesc, op Operation) (
 	return
 }
 
+// zoneAwareReplicationStrategy is replicationStrategy for rings placing
+// replicas in distinct zones: it needs a quorum of the replication factor's
+// zones rather than of ingesters, so a whole zone can be unavailable.  Replica
+// sets spanning fewer zones than the replication factor fall back to
+// replicationStrategy.
+func (r *Ring) zoneAwareReplicationStrategy(ingesters []IngesterDesc, op Operation) (ReplicationSet, error) {
+	// Only the zones of the intended replicas count: the extra replicas added
+	// for non-ACTIVE ingesters can be in a zone of their own.
+	zones := map[string]struct{}{}
+	for _, ingester := range ingesters {
+		if isReplica(&ingester, op) {
+			zones[ingester.failureDomain()] = struct{}{}
+		}
+	}
+	if len(zones) < r.cfg.ReplicationFactor {
+		liveIngesters, maxFailure, err := r.replicationStrategy(ingesters, op)
+		if err != nil {
+			return ReplicationSet{}, err
+		}
+		return ReplicationSet{
+			Ingesters: liveIngesters,
+			MaxErrors: maxFailure,
+		}, nil
+	}
+
+	// A zone is live as long as one of its ingesters is.
+	minSuccess := (r.cfg.ReplicationFactor / 2) + 1
+	liveIngesters := make([]IngesterDesc, 0, len(ingesters))
+	liveZones := map[string]struct{}{}
+	for _, ingester := range ingesters {
+		if r.IsHealthy(&ingester, op) {
+			liveIngesters = append(liveIngesters, ingester)
+			liveZones[ingester.failureDomain()] = struct{}{}
+		}
+	}
+
+	if len(liveZones) < minSuccess {
+		return ReplicationSet{}, fmt.Errorf("at least %d live zones required, could only find %d",
+			minSuccess, len(liveZones))
+	}
+
+	return ReplicationSet{
+		Ingesters:           liveIngesters,
+		MaxUnavailableZones: len(liveZones) - minSuccess,
+	}, nil
+}
+
 // IsHealthy checks whether an ingester appears to be alive and heartbeating
 func (r *Ring) IsHealthy(ingester *IngesterDesc, op Operation) bool {
 	if op == Write && ingester.State != ACTIVE {
@@ -56,6 +103,20 @@ func (r *Ring) IsHealthy(ingester *IngesterDesc, op Operation) bool {
 	return time.Now().Sub(time.Unix(ingester.Timestamp, 0)) <= r.cfg.HeartbeatTimeout
 }
 
+// isReplica returns whether the ingester can hold one of a key's replicas for
+// the operation.  We do not want to write to ingesters that are not ACTIVE,
+// but we can read from LEAVING and READONLY ones.
+func isReplica(ingester *IngesterDesc, op Operation) bool {
+	switch op {
+	case Write:
+		return ingester.State == ACTIVE
+	case Read:
+		return ingester.State == ACTIVE || ingester.State == LEAVING || ingester.State == READONLY
+	default:
+		return true
+	}
+}
+
 // ReplicationFactor of the ring.
 func (r *Ring) ReplicationFactor() int {
 	return r.cfg.ReplicationFactor
@@ -21,7 +21,7 @@ import (
 const (
 	unhealthy = "Unhealthy"
 
-	// ConsulKey is the key under which we store the ring in consul.
+	// ConsulKey is the key under which we store the ingesters ring in consul.
 	ConsulKey = "ring"
 )
 
@@ -60,6 +60,7 @@ type Config struct {
 	Store             string        `yaml:"store,omitempty"`
 	HeartbeatTimeout  time.Duration `yaml:"heartbeat_timeout,omitempty"`
 	ReplicationFactor int           `yaml:"replication_factor,omitempty"`
+	ZoneAwareness     bool          `yaml:"zone_awareness_enabled,omitempty"`
 
 	Mock KVClient
 }
@@ -71,11 +72,25 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.StringVar(&cfg.Store, "ring.store", "consul", "Backend storage to use for the ring (consul, inmemory).")
 	f.DurationVar(&cfg.HeartbeatTimeout, "ring.heartbeat-timeout", time.Minute, "The heartbeat timeout after which ingesters are skipped for reads/writes.")
 	f.IntVar(&cfg.ReplicationFactor, "distributor.replication-factor", 3, "The number of ingesters to write to and read from.")
+	f.BoolVar(&cfg.ZoneAwareness, "distributor.zone-awareness-enabled", false, "Place the replicas of each key in distinct availability zones, and tolerate a whole zone being unavailable.")
+}
+
+// RegisterFlagsWithPrefix adds the flags required to config this to the given
+// FlagSet, prefixing every flag name. Used by components other than the
+// ingesters which keep their own ring.
+func (cfg *Config) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
+	cfg.Consul.RegisterFlagsWithPrefix(prefix, f)
+
+	f.StringVar(&cfg.Store, prefix+"ring.store", "consul", "Backend storage to use for the ring (consul, inmemory).")
+	f.DurationVar(&cfg.HeartbeatTimeout, prefix+"ring.heartbeat-timeout", time.Minute, "The heartbeat timeout after which instances are skipped.")
+	f.IntVar(&cfg.ReplicationFactor, prefix+"ring.replication-factor", 3, "The number of instances each key is replicated to.")
+	f.BoolVar(&cfg.ZoneAwareness, prefix+"ring.zone-awareness-enabled", false, "Place the replicas of each key in distinct availability zones, and tolerate a whole zone being unavailable.")
 }
 
 // Ring holds the information about the members of the consistent hash ring.
 type Ring struct {
 	cfg      Config
+	key      string
 	KVClient KVClient
 	done     chan struct{}
 	quit     context.CancelFunc
@@ -89,8 +104,8 @@ type Ring struct {
 	numTokensDesc         *prometheus.Desc
 }
 
-// New creates a new Ring
-func New(cfg Config) (*Ring, error) {
+// New creates a new Ring, watching the ring stored under key in the KV store.
+func New(cfg Config, key string) (*Ring, error) {
 	if cfg.ReplicationFactor <= 0 {
 		return nil, fmt.Errorf("ReplicationFactor must be greater than zero: %d", cfg.ReplicationFactor)
 	}
@@ -102,6 +117,7 @@ func New(cfg Config) (*Ring, error) {
 
 	r := &Ring{
 		cfg:      cfg,
+		key:      key,
 		KVClient: store,
 		done:     make(chan struct{}),
 		ringDesc: &Desc{},
@@ -140,7 +156,7 @@ func (r *Ring) Stop() {
 
 func (r *Ring) loop(ctx context.Context) {
 	defer close(r.done)
-	r.KVClient.WatchKey(ctx, ConsulKey, func(value interface{}) bool {
+	r.KVClient.WatchKey(ctx, r.key, func(value interface{}) bool {
 		if value == nil {
 			level.Info(util.Logger).Log("msg", "ring doesn't exist in consul yet")
 			return true
@@ -209,10 +225,29 @@ func (r *Ring) getInternal(key uint32, op Operation) (ReplicationSet, error) {
 		n             = r.cfg.ReplicationFactor
 		ingesters     = make([]IngesterDesc, 0, n)
 		distinctHosts = map[string]struct{}{}
+		distinctZones = map[string]struct{}{}
+		sameZone      []IngesterDesc
 		start         = r.search(key)
 		iterations    = 0
 	)
-	for i := start; len(distinctHosts) < n && iterations < len(r.ringDesc.Tokens); i++ {
+	add := func(ingester IngesterDesc) {
+		// We do not want to Write to Ingesters that are not ACTIVE, but we do want
+		// to write the extra replica somewhere.  So we increase the size of the set
+		// of replicas for the key. This means we have to also increase the
+		// size of the replica set for read, but we can read from Leaving ingesters,
+		// so don't skip it in this case.
+		// NB dead ingester will be filtered later (by replication_strategy.go).
+		if !isReplica(&ingester, op) {
+			n++
+		} else if ingester.Zone != "" {
+			// Only zones holding a usable replica are taken, so the extra replica
+			// can go in the same zone as the one it replaces.
+			distinctZones[ingester.Zone] = struct{}{}
+		}
+		ingesters = append(ingesters, ingester)
+	}
+
+	for i := start; len(ingesters) < n && iterations < len(r.ringDesc.Tokens); i++ {
 		iterations++
 		// Wrap i around in the ring.
 		i %= len(r.ringDesc.Tokens)
@@ -225,19 +260,23 @@ func (r *Ring) getInternal(key uint32, op Operation) (ReplicationSet, error) {
 		distinctHosts[token.Ingester] = struct{}{}
 		ingester := r.ringDesc.Ingesters[token.Ingester]
 
-		// We do not want to Write to Ingesters that are not ACTIVE, but we do want
-		// to write the extra replica somewhere.  So we increase the size of the set
-		// of replicas for the key. This means we have to also increase the
-		// size of the replica set for read, but we can read from Leaving ingesters,
-		// so don't skip it in this case.
-		// NB dead ingester will be filtered later (by replication_strategy.go).
-		if op == Write && ingester.State != ACTIVE {
-			n++
-		} else if op == Read && (ingester.State != ACTIVE && ingester.State != LEAVING) {
-			n++
+		// And, if zone aware, in distinct zones.  Ingesters in zones we already
+		// have are only used if there aren't enough zones.
+		if _, ok := distinctZones[ingester.Zone]; ok && r.cfg.ZoneAwareness {
+			sameZone = append(sameZone, ingester)
+			continue
+		}
+		add(ingester)
+	}
+	for _, ingester := range sameZone {
+		if len(ingesters) >= n {
+			break
 		}
+		add(ingester)
+	}
 
-		ingesters = append(ingesters, ingester)
+	if r.cfg.ZoneAwareness {
+		return r.zoneAwareReplicationStrategy(ingesters, op)
 	}
 
 	liveIngesters, maxFailure, err := r.replicationStrategy(ingesters, op)
@@ -262,15 +301,32 @@ func (r *Ring) GetAll() (ReplicationSet, error) {
 
 	ingesters := make([]IngesterDesc, 0, len(r.ringDesc.Ingesters))
 	maxErrors := r.cfg.ReplicationFactor / 2
+	zones := map[string]struct{}{}
+	unhealthyZones := map[string]struct{}{}
 
 	for _, ingester := range r.ringDesc.Ingesters {
+		zones[ingester.failureDomain()] = struct{}{}
 		if !r.IsHealthy(&ingester, Read) {
 			maxErrors--
+			unhealthyZones[ingester.failureDomain()] = struct{}{}
 			continue
 		}
 		ingesters = append(ingesters, ingester)
 	}
 
+	// With replicas spread across zones, we can lose whole zones rather than
+	// individual ingesters.
+	if r.cfg.ZoneAwareness && len(zones) >= r.cfg.ReplicationFactor {
+		maxUnavailableZones := r.cfg.ReplicationFactor/2 - len(unhealthyZones)
+		if maxUnavailableZones < 0 {
+			return ReplicationSet{}, fmt.Errorf("too many unavailable zones")
+		}
+		return ReplicationSet{
+			Ingesters:           ingesters,
+			MaxUnavailableZones: maxUnavailableZones,
+		}, nil
+	}
+
 	if maxErrors < 0 {
 		return ReplicationSet{}, fmt.Errorf("too many failed ingesters")
 	}
@@ -281,6 +337,60 @@ func (r *Ring) GetAll() (ReplicationSet, error) {
 	}, nil
 }
 
+// HandoverTargets returns, for each of keys, the ingesters which will hold a
+// replica of it once the ingester with the given ID has left the ring, but
+// don't hold one now.
+func (r *Ring) HandoverTargets(id string, keys []uint32) ([][]IngesterDesc, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	if r.ringDesc == nil || len(r.ringDesc.Tokens) == 0 {
+		return nil, ErrEmptyRing
+	}
+
+	after := &Ring{
+		cfg: r.cfg,
+		ringDesc: &Desc{
+			Ingesters: make(map[string]IngesterDesc, len(r.ringDesc.Ingesters)),
+			Tokens:    make([]TokenDesc, 0, len(r.ringDesc.Tokens)),
+		},
+	}
+	for ingesterID, ingester := range r.ringDesc.Ingesters {
+		if ingesterID != id {
+			after.ringDesc.Ingesters[ingesterID] = ingester
+		}
+	}
+	for _, token := range r.ringDesc.Tokens {
+		if token.Ingester != id {
+			after.ringDesc.Tokens = append(after.ringDesc.Tokens, token)
+		}
+	}
+
+	result := make([][]IngesterDesc, len(keys))
+	for k, key := range keys {
+		// Reads are sent to leaving ingesters, so this includes the one leaving.
+		current, err := r.getInternal(key, Read)
+		if err != nil {
+			return nil, err
+		}
+		future, err := after.getInternal(key, Write)
+		if err != nil {
+			return nil, err
+		}
+
+	outer:
+		for _, ingester := range future.Ingesters {
+			for _, c := range current.Ingesters {
+				if c.Addr == ingester.Addr {
+					continue outer
+				}
+			}
+			result[k] = append(result[k], ingester)
+		}
+	}
+	return result, nil
+}
+
 func (r *Ring) search(key uint32) int {
 	i := sort.Search(len(r.ringDesc.Tokens), func(x int) bool {
 		return r.ringDesc.Tokens[x].Token > key
@@ -348,11 +458,12 @@ func (r *Ring) Collect(ch chan<- prometheus.Metric) {
 
 	// Initialised to zero so we emit zero-metrics (instead of not emitting anything)
 	byState := map[string]int{
-		unhealthy:        0,
-		ACTIVE.String():  0,
-		LEAVING.String(): 0,
-		PENDING.String(): 0,
-		JOINING.String(): 0,
+		unhealthy:         0,
+		ACTIVE.String():   0,
+		LEAVING.String():  0,
+		PENDING.String():  0,
+		JOINING.String():  0,
+		READONLY.String(): 0,
 	}
 	for _, ingester := range r.ringDesc.Ingesters {
 		if !r.IsHealthy(&ingester, Reporting) {
@@ -2,8 +2,13 @@ package ring
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const (
@@ -18,7 +23,7 @@ func BenchmarkRing(b *testing.B) {
 	for i := 0; i < numIngester; i++ {
 		tokens := GenerateTokens(numTokens, takenTokens)
 		takenTokens = append(takenTokens, tokens...)
-		desc.AddIngester(fmt.Sprintf("%d", i), fmt.Sprintf("ingester%d", i), tokens, ACTIVE, false)
+		desc.AddIngester(fmt.Sprintf("%d", i), fmt.Sprintf("ingester%d", i), "", tokens, ACTIVE, false)
 	}
 
 	consul := NewInMemoryKVClient()
@@ -31,7 +36,7 @@ func BenchmarkRing(b *testing.B) {
 	r, err := New(Config{
 		Mock:              consul,
 		ReplicationFactor: 3,
-	})
+	}, ConsulKey)
 	if err != nil {
 		b.Fatal(err)
 	}
@@ -43,3 +48,220 @@ func BenchmarkRing(b *testing.B) {
 		r.BatchGet(keys, Write)
 	}
 }
+
+// newZoneAwareRing makes a zone aware ring with an ingester in each of the
+// given zones, named ingN.
+func newZoneAwareRing(t *testing.T, zones ...string) *Ring {
+	desc := NewDesc()
+	takenTokens := []uint32{}
+	for i, zone := range zones {
+		tokens := GenerateTokens(16, takenTokens)
+		takenTokens = append(takenTokens, tokens...)
+		desc.AddIngester(fmt.Sprintf("ing%d", i), fmt.Sprintf("ingester%d", i), zone, tokens, ACTIVE, true)
+	}
+
+	r, err := New(Config{
+		Mock:              NewInMemoryKVClient(),
+		HeartbeatTimeout:  time.Minute,
+		ReplicationFactor: 3,
+		ZoneAwareness:     true,
+	}, ConsulKey)
+	require.NoError(t, err)
+	r.ringDesc = r.migrateRing(desc)
+	return r
+}
+
+func setIngesters(r *Ring, zone string, f func(*IngesterDesc)) {
+	for id, ingester := range r.ringDesc.Ingesters {
+		if ingester.Zone == zone {
+			f(&ingester)
+			r.ringDesc.Ingesters[id] = ingester
+		}
+	}
+}
+
+func zonesOf(ingesters []IngesterDesc) map[string]int {
+	zones := map[string]int{}
+	for _, ingester := range ingesters {
+		zones[ingester.Zone]++
+	}
+	return zones
+}
+
+func TestRingGetZoneAware(t *testing.T) {
+	keys := GenerateTokens(100, nil)
+
+	t.Run("replicas in distinct zones", func(t *testing.T) {
+		r := newZoneAwareRing(t, "a", "a", "a", "b", "b", "b", "c", "c", "c")
+		defer r.Stop()
+		for _, key := range keys {
+			rs, err := r.Get(key, Write)
+			require.NoError(t, err)
+			assert.Equal(t, map[string]int{"a": 1, "b": 1, "c": 1}, zonesOf(rs.Ingesters))
+			assert.Equal(t, 1, rs.MaxUnavailableZones)
+		}
+	})
+
+	t.Run("fewer zones than replicas", func(t *testing.T) {
+		r := newZoneAwareRing(t, "a", "a", "a", "b", "b", "b")
+		defer r.Stop()
+		for _, key := range keys {
+			rs, err := r.Get(key, Write)
+			require.NoError(t, err)
+			assert.Len(t, rs.Ingesters, 3)
+			assert.Len(t, zonesOf(rs.Ingesters), 2)
+			assert.Equal(t, 1, rs.MaxErrors)
+			assert.Equal(t, 0, rs.MaxUnavailableZones)
+		}
+	})
+
+	t.Run("replacement replica in the same zone", func(t *testing.T) {
+		r := newZoneAwareRing(t, "a", "a", "a", "b", "b", "b", "c", "c", "c")
+		defer r.Stop()
+		leaving := r.ringDesc.Ingesters["ing0"]
+		leaving.State = LEAVING
+		r.ringDesc.Ingesters["ing0"] = leaving
+
+		for _, key := range keys {
+			rs, err := r.Get(key, Write)
+			require.NoError(t, err)
+			assert.Equal(t, map[string]int{"a": 1, "b": 1, "c": 1}, zonesOf(rs.Ingesters))
+			for _, ingester := range rs.Ingesters {
+				assert.Equal(t, ACTIVE, ingester.State)
+			}
+		}
+	})
+
+	t.Run("one zone unavailable", func(t *testing.T) {
+		r := newZoneAwareRing(t, "a", "a", "a", "b", "b", "b", "c", "c", "c")
+		defer r.Stop()
+		setIngesters(r, "c", func(ingester *IngesterDesc) { ingester.Timestamp = 0 })
+
+		for _, key := range keys {
+			for _, op := range []Operation{Read, Write} {
+				rs, err := r.Get(key, op)
+				require.NoError(t, err)
+				assert.Equal(t, map[string]int{"a": 1, "b": 1}, zonesOf(rs.Ingesters))
+				assert.Equal(t, 0, rs.MaxUnavailableZones)
+				assert.Equal(t, 0, rs.MaxErrors)
+			}
+		}
+	})
+
+	t.Run("joining ingester in another zone", func(t *testing.T) {
+		r := newZoneAwareRing(t, "a", "a", "a", "b", "b", "b", "c", "c", "c", "d")
+		defer r.Stop()
+		setIngesters(r, "d", func(ingester *IngesterDesc) { ingester.State = JOINING })
+		setIngesters(r, "c", func(ingester *IngesterDesc) { ingester.Timestamp = 0 })
+
+		// The JOINING ingester's zone doesn't count towards the quorum, so
+		// losing zone c still leaves a quorum of the 3 replicas' zones.
+		for _, key := range keys {
+			rs, err := r.Get(key, Write)
+			require.NoError(t, err)
+			assert.Equal(t, map[string]int{"a": 1, "b": 1}, zonesOf(rs.Ingesters))
+			assert.Equal(t, 0, rs.MaxUnavailableZones)
+		}
+	})
+
+	t.Run("two zones unavailable", func(t *testing.T) {
+		r := newZoneAwareRing(t, "a", "a", "a", "b", "b", "b", "c", "c", "c")
+		defer r.Stop()
+		setIngesters(r, "b", func(ingester *IngesterDesc) { ingester.Timestamp = 0 })
+		setIngesters(r, "c", func(ingester *IngesterDesc) { ingester.Timestamp = 0 })
+
+		_, err := r.Get(keys[0], Write)
+		assert.EqualError(t, err, "at least 2 live zones required, could only find 1")
+	})
+}
+
+func TestRingGetAllZoneAware(t *testing.T) {
+	r := newZoneAwareRing(t, "a", "a", "a", "b", "b", "b", "c", "c", "c")
+	defer r.Stop()
+
+	rs, err := r.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, rs.Ingesters, 9)
+	assert.Equal(t, 1, rs.MaxUnavailableZones)
+
+	// A whole zone being down is tolerated, but not a second.
+	setIngesters(r, "c", func(ingester *IngesterDesc) { ingester.Timestamp = 0 })
+	rs, err = r.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, rs.Ingesters, 6)
+	assert.Equal(t, 0, rs.MaxUnavailableZones)
+	assert.Equal(t, 0, rs.MaxErrors)
+
+	setIngesters(r, "b", func(ingester *IngesterDesc) { ingester.Timestamp = 0 })
+	_, err = r.GetAll()
+	assert.Error(t, err)
+}
+
+func TestZoneAwareRequests(t *testing.T) {
+	r := newZoneAwareRing(t, "a", "a", "a", "b", "b", "b", "c", "c", "c")
+	defer r.Stop()
+	errFailed := errors.New("failed")
+
+	failZones := func(zones ...string) func(*IngesterDesc) (interface{}, error) {
+		return func(ingester *IngesterDesc) (interface{}, error) {
+			for _, zone := range zones {
+				if ingester.Zone == zone {
+					return nil, errFailed
+				}
+			}
+			return ingester.Addr, nil
+		}
+	}
+
+	rs, err := r.GetAll()
+	require.NoError(t, err)
+
+	results, err := rs.Do(context.Background(), 0, failZones("c"))
+	require.NoError(t, err)
+	assert.Len(t, results, 6)
+
+	_, err = rs.Do(context.Background(), 0, failZones("b", "c"))
+	assert.Equal(t, errFailed, err)
+
+	keys := GenerateTokens(100, nil)
+	err = DoBatch(context.Background(), r, keys, func(ingester IngesterDesc, _ []int) error {
+		_, err := failZones("a")(&ingester)
+		return err
+	})
+	require.NoError(t, err)
+
+	err = DoBatch(context.Background(), r, keys, func(ingester IngesterDesc, _ []int) error {
+		_, err := failZones("a", "b")(&ingester)
+		return err
+	})
+	assert.Equal(t, errFailed, err)
+}
+
+func TestHandoverTargets(t *testing.T) {
+	r := newZoneAwareRing(t, "", "", "", "", "")
+	defer r.Stop()
+	r.cfg.ZoneAwareness = false
+
+	keys := GenerateTokens(100, nil)
+	targets, err := r.HandoverTargets("ing0", keys)
+	require.NoError(t, err)
+
+	for k, key := range keys {
+		rs, err := r.Get(key, Read)
+		require.NoError(t, err)
+		owned := false
+		for _, ingester := range rs.Ingesters {
+			owned = owned || ingester.Addr == "ingester0"
+		}
+
+		// Only keys replicated by the leaving ingester get a new replica.
+		if !owned {
+			assert.Empty(t, targets[k])
+			continue
+		}
+		require.Len(t, targets[k], 1)
+		for _, ingester := range rs.Ingesters {
+			assert.NotEqual(t, ingester.Addr, targets[k][0].Addr)
+		}
+	}
+}
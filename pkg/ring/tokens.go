@@ -0,0 +1,81 @@
+package ring
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// tokensFile is the format tokens are persisted in.
+type tokensFile struct {
+	Tokens []uint32 `json:"tokens"`
+}
+
+// loadTokensFromFile reads the tokens stored in filename.
+func loadTokensFromFile(filename string) ([]uint32, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var f tokensFile
+	if err := json.Unmarshal(buf, &f); err != nil {
+		return nil, err
+	}
+	return f.Tokens, nil
+}
+
+// storeTokensToFile writes tokens to filename, replacing it atomically so a
+// crash never leaves a partial file behind.
+func storeTokensToFile(filename string, tokens []uint32) error {
+	buf, err := json.Marshal(tokensFile{Tokens: tokens})
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// unclaimedTokens returns at most numTokens of tokens which no ingester in
+// the ring owns.
+func (d *Desc) unclaimedTokens(tokens []uint32, numTokens int) []uint32 {
+	taken := map[uint32]struct{}{}
+	for _, token := range d.Tokens {
+		taken[token.Token] = struct{}{}
+	}
+	for _, ingester := range d.Ingesters {
+		for _, token := range ingester.Tokens {
+			taken[token] = struct{}{}
+		}
+	}
+
+	result := []uint32{}
+	for _, token := range tokens {
+		if len(result) >= numTokens {
+			break
+		}
+		if _, ok := taken[token]; !ok {
+			result = append(result, token)
+		}
+	}
+	return result
+}
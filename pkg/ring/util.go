@@ -1,6 +1,7 @@
 package ring
 
 import (
+	"hash/fnv"
 	"math/rand"
 	"sort"
 	"time"
@@ -25,6 +26,14 @@ func GenerateTokens(numTokens int, takenTokens []uint32) []uint32 {
 	return tokens
 }
 
+// ShardByUser returns the token for the given user, for rings which place
+// whole tenants rather than individual series.
+func ShardByUser(userID string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(userID))
+	return h.Sum32()
+}
+
 type sortableUint32 []uint32
 
 func (ts sortableUint32) Len() int           { return len(ts) }
@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"reflect"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -32,6 +34,7 @@ import (
 	"golang.org/x/net/context/ctxhttp"
 
 	"github.com/cortexproject/cortex/pkg/distributor"
+	"github.com/cortexproject/cortex/pkg/ring"
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/flagext"
 	"github.com/weaveworks/common/instrument"
@@ -92,6 +95,10 @@ type Config struct {
 	// How long to wait between refreshing the list of alertmanagers based on
 	// DNS service discovery.
 	AlertmanagerRefreshInterval time.Duration
+	// Whether to send each user's notifications to the Alertmanager replicas
+	// owning that user in the alertmanager ring.
+	AlertmanagerUseRing bool
+	AlertmanagerRing    ring.Config
 
 	// Capacity of the queue for notifications to be sent to the Alertmanager.
 	NotificationQueueCapacity int
@@ -110,6 +117,8 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.Var(&cfg.AlertmanagerURL, "ruler.alertmanager-url", "URL of the Alertmanager to send notifications to.")
 	f.BoolVar(&cfg.AlertmanagerDiscovery, "ruler.alertmanager-discovery", false, "Use DNS SRV records to discover alertmanager hosts.")
 	f.DurationVar(&cfg.AlertmanagerRefreshInterval, "ruler.alertmanager-refresh-interval", 1*time.Minute, "How long to wait between refreshing alertmanager hosts.")
+	f.BoolVar(&cfg.AlertmanagerUseRing, "ruler.alertmanager-use-ring", false, "Use the alertmanager ring to send notifications to the alertmanagers owning each user. The scheme and path of -ruler.alertmanager-url are still used.")
+	cfg.AlertmanagerRing.RegisterFlagsWithPrefix("alertmanager.", f)
 	f.IntVar(&cfg.NotificationQueueCapacity, "ruler.notification-queue-capacity", 10000, "Capacity of the queue for notifications to be sent to the Alertmanager.")
 	f.DurationVar(&cfg.NotificationTimeout, "ruler.notification-timeout", 10*time.Second, "HTTP timeout duration when sending notifications to the Alertmanager.")
 	f.DurationVar(&cfg.GroupTimeout, "ruler.group-timeout", 10*time.Second, "Timeout for rule group evaluation, including sending result to ingester")
@@ -129,6 +138,12 @@ type Ruler struct {
 	groupTimeout  time.Duration
 	metrics       *rules.Metrics
 
+	// Only set when notifications are routed via the alertmanager ring.
+	alertmanagerRing            *ring.Ring
+	alertmanagerRefreshInterval time.Duration
+	quit                        chan struct{}
+	done                        chan struct{}
+
 	// Per-user notifiers with separate queues.
 	notifiersMtx sync.Mutex
 	notifiers    map[string]*rulerNotifier
@@ -143,6 +158,9 @@ type rulerNotifier struct {
 	sdManager *discovery.Manager
 	wg        sync.WaitGroup
 	logger    gklog.Logger
+
+	// Alertmanager addresses taken from the ring, if any.
+	alertmanagers []string
 }
 
 func newRulerNotifier(o *notifier.Options, l gklog.Logger) *rulerNotifier {
@@ -201,7 +219,7 @@ func NewRuler(cfg Config, engine *promql.Engine, queryable storage.Queryable, d
 	if err != nil {
 		return nil, err
 	}
-	return &Ruler{
+	r := &Ruler{
 		engine:        engine,
 		queryable:     queryable,
 		pusher:        d,
@@ -211,7 +229,110 @@ func NewRuler(cfg Config, engine *promql.Engine, queryable storage.Queryable, d
 		notifiers:     map[string]*rulerNotifier{},
 		groupTimeout:  cfg.GroupTimeout,
 		metrics:       rules.NewGroupMetrics(prometheus.DefaultRegisterer),
-	}, nil
+	}
+
+	if cfg.AlertmanagerUseRing {
+		if cfg.AlertmanagerURL.URL == nil {
+			return nil, fmt.Errorf("-ruler.alertmanager-url must be set when using the alertmanager ring")
+		}
+		r.alertmanagerRing, err = ring.New(cfg.AlertmanagerRing, alertmanagerRingKey)
+		if err != nil {
+			return nil, err
+		}
+		r.alertmanagerRefreshInterval = cfg.AlertmanagerRefreshInterval
+		r.quit = make(chan struct{})
+		r.done = make(chan struct{})
+		go r.syncAlertmanagersLoop()
+	}
+	return r, nil
+}
+
+// alertmanagerRingKey must match alertmanager.RingKey; it is duplicated to
+// avoid depending on the alertmanager package.
+const alertmanagerRingKey = "alertmanager"
+
+// syncAlertmanagersLoop periodically updates the notifiers of every user to
+// send to the alertmanagers the ring currently says own that user.
+func (r *Ruler) syncAlertmanagersLoop() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.alertmanagerRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.notifiersMtx.Lock()
+			for userID, n := range r.notifiers {
+				if err := r.applyNotifierConfig(userID, n); err != nil {
+					level.Error(util.Logger).Log("msg", "error updating alertmanagers for user", "user_id", userID, "err", err)
+				}
+			}
+			r.notifiersMtx.Unlock()
+		case <-r.quit:
+			return
+		}
+	}
+}
+
+// applyNotifierConfig applies the notifier config for userID to n. When using
+// the alertmanager ring this targets the replicas owning userID, falling back
+// to -ruler.alertmanager-url if the ring can't tell which those are.
+func (r *Ruler) applyNotifierConfig(userID string, n *rulerNotifier) error {
+	if r.alertmanagerRing == nil {
+		return n.applyConfig(r.notifierCfg)
+	}
+
+	addrs := []string{}
+	rs, err := r.alertmanagerRing.Get(ring.ShardByUser(userID), ring.Write)
+	if err != nil {
+		level.Warn(util.Logger).Log("msg", "unable to find alertmanagers for user, using -ruler.alertmanager-url", "user_id", userID, "err", err)
+	} else {
+		for _, ing := range rs.Ingesters {
+			addrs = append(addrs, ing.Addr)
+		}
+		sort.Strings(addrs)
+	}
+
+	if n.alertmanagers != nil && reflect.DeepEqual(addrs, n.alertmanagers) {
+		return nil
+	}
+
+	cfg := r.notifierCfg
+	if len(addrs) > 0 {
+		cfg = withStaticAlertmanagers(r.notifierCfg, addrs)
+	}
+	if err := n.applyConfig(cfg); err != nil {
+		return err
+	}
+	n.alertmanagers = addrs
+	return nil
+}
+
+// withStaticAlertmanagers returns a copy of cfg sending to the given
+// alertmanager addresses instead of the configured ones.
+func withStaticAlertmanagers(cfg *config.Config, addrs []string) *config.Config {
+	targets := make([]model.LabelSet, 0, len(addrs))
+	for _, addr := range addrs {
+		targets = append(targets, model.LabelSet{
+			model.AddressLabel: model.LabelValue(addr),
+		})
+	}
+
+	amConfigs := make([]*config.AlertmanagerConfig, 0, len(cfg.AlertingConfig.AlertmanagerConfigs))
+	for _, amConfig := range cfg.AlertingConfig.AlertmanagerConfigs {
+		c := *amConfig
+		c.ServiceDiscoveryConfig = sd_config.ServiceDiscoveryConfig{
+			StaticConfigs: []*targetgroup.Group{{Targets: targets}},
+		}
+		amConfigs = append(amConfigs, &c)
+	}
+
+	return &config.Config{
+		AlertingConfig: config.AlertingConfig{
+			AlertmanagerConfigs: amConfigs,
+		},
+	}
 }
 
 // Builds a Prometheus config.Config from a ruler.Config with just the required
@@ -352,7 +473,7 @@ func (r *Ruler) getOrCreateNotifier(userID string) (*notifier.Manager, error) {
 	go n.run()
 
 	// This should never fail, unless there's a programming mistake.
-	if err := n.applyConfig(r.notifierCfg); err != nil {
+	if err := r.applyNotifierConfig(userID, n); err != nil {
 		return nil, err
 	}
 
@@ -386,6 +507,12 @@ func (r *Ruler) Evaluate(userID string, item *workItem) {
 
 // Stop stops the Ruler.
 func (r *Ruler) Stop() {
+	if r.alertmanagerRing != nil {
+		close(r.quit)
+		<-r.done
+		r.alertmanagerRing.Stop()
+	}
+
 	r.notifiersMtx.Lock()
 	defer r.notifiersMtx.Unlock()
 
@@ -1,9 +1,11 @@
 package ruler
 
 import (
+	"context"
 	"flag"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"sync"
 	"testing"
 	"time"
@@ -12,18 +14,26 @@ import (
 	"github.com/prometheus/prometheus/promql"
 
 	"github.com/cortexproject/cortex/pkg/querier"
+	"github.com/cortexproject/cortex/pkg/ring"
+	"github.com/cortexproject/cortex/pkg/util/test"
 	"github.com/prometheus/prometheus/notifier"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/weaveworks/common/user"
 )
 
-func newTestRuler(t *testing.T, alertmanagerURL string) *Ruler {
+func defaultRulerConfig(alertmanagerURL string) Config {
 	var cfg Config
 	fs := flag.NewFlagSet("test", flag.PanicOnError)
 	cfg.RegisterFlags(fs)
 	fs.Parse(nil)
 	cfg.AlertmanagerURL.Set(alertmanagerURL)
 	cfg.AlertmanagerDiscovery = false
+	return cfg
+}
+
+func newTestRuler(t *testing.T, alertmanagerURL string) *Ruler {
+	cfg := defaultRulerConfig(alertmanagerURL)
 
 	// TODO: Populate distributor and chunk store arguments to enable
 	// other kinds of tests.
@@ -70,3 +80,63 @@ func TestNotifierSendsUserIDHeader(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestNotifierUsesAlertmanagerRing(t *testing.T) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _, err := user.ExtractOrgIDFromHTTPRequest(r)
+		assert.NoError(t, err)
+		assert.Equal(t, userID, "1")
+		wg.Done()
+	}))
+	defer ts.Close()
+	tsURL, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+
+	// The ring knows of a single alertmanager, the test server.
+	kvClient := ring.NewInMemoryKVClient()
+	desc := ring.NewDesc()
+	desc.AddIngester("am1", tsURL.Host, "", []uint32{0}, ring.ACTIVE, false)
+	require.NoError(t, kvClient.CAS(context.Background(), alertmanagerRingKey, func(interface{}) (interface{}, bool, error) {
+		return desc, false, nil
+	}))
+
+	amRing, err := ring.New(ring.Config{
+		Mock:              kvClient,
+		HeartbeatTimeout:  time.Minute,
+		ReplicationFactor: 1,
+	}, alertmanagerRingKey)
+	require.NoError(t, err)
+	defer amRing.Stop()
+	test.Poll(t, time.Second, nil, func() interface{} {
+		_, err := amRing.Get(ring.ShardByUser("1"), ring.Write)
+		return err
+	})
+
+	// The host part of the URL is ignored, only its scheme and path are used.
+	cfg := defaultRulerConfig("http://alertmanager.invalid")
+	ncfg, err := buildNotifierConfig(&cfg)
+	require.NoError(t, err)
+	r := &Ruler{
+		notifierCfg:      ncfg,
+		alertmanagerRing: amRing,
+		notifiers:        map[string]*rulerNotifier{},
+	}
+	n, err := r.getOrCreateNotifier("1")
+	require.NoError(t, err)
+	for _, not := range r.notifiers {
+		defer not.stop()
+	}
+
+	// Loop until notifier discovery syncs up
+	for len(n.Alertmanagers()) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Equal(t, tsURL.Host, n.Alertmanagers()[0].Host)
+	n.Send(&notifier.Alert{
+		Labels: labels.Labels{labels.Label{Name: "alertname", Value: "testalert"}},
+	})
+
+	wg.Wait()
+}
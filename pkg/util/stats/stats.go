@@ -0,0 +1,210 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/weaveworks/common/middleware"
+)
+
+// HeaderName is the response header queriers return a query's Stats in.
+const HeaderName = "X-Cortex-Query-Stats"
+
+type contextKey int
+
+const ctxKey = contextKey(0)
+
+// Stats are the costs of a query, accumulated while it runs.  All methods are
+// safe to call concurrently, and on a nil *Stats, so code filling them in
+// needn't check whether stats are being collected.
+type Stats struct {
+	// Time spent by queriers running the query.
+	WallTime time.Duration `json:"wall_time_ns"`
+
+	// Series, and their samples or chunks, returned by ingesters, before
+	// replicas are deduplicated.
+	IngesterSeries  uint64 `json:"ingester_series"`
+	IngesterSamples uint64 `json:"ingester_samples"`
+	IngesterChunks  uint64 `json:"ingester_chunks"`
+
+	// Index lookups made, and how many of them were answered by the index
+	// cache.
+	IndexQueries   uint64 `json:"index_queries"`
+	IndexCacheHits uint64 `json:"index_cache_hits"`
+
+	// Series and chunks the store found for the query.
+	StoreSeries uint64 `json:"store_series"`
+	StoreChunks uint64 `json:"store_chunks"`
+
+	// Chunks fetched, their encoded size, and how many of them were in the
+	// chunk cache.
+	FetchedChunks     uint64 `json:"fetched_chunks"`
+	FetchedChunkBytes uint64 `json:"fetched_chunk_bytes"`
+	ChunkCacheHits    uint64 `json:"chunk_cache_hits"`
+}
+
+// ContextWithEmptyStats returns a context carrying new, empty Stats.
+func ContextWithEmptyStats(ctx context.Context) (*Stats, context.Context) {
+	stats := &Stats{}
+	return stats, context.WithValue(ctx, ctxKey, stats)
+}
+
+// FromContext returns the Stats in the context, or nil if there are none.
+func FromContext(ctx context.Context) *Stats {
+	stats, _ := ctx.Value(ctxKey).(*Stats)
+	return stats
+}
+
+// AddWallTime adds to the time spent running the query.
+func (s *Stats) AddWallTime(d time.Duration) {
+	if s != nil {
+		atomic.AddInt64((*int64)(&s.WallTime), int64(d))
+	}
+}
+
+// AddIngesterSeries adds series, and their samples and chunks, returned by
+// ingesters.
+func (s *Stats) AddIngesterSeries(series, samples, chunks int) {
+	if s != nil {
+		atomic.AddUint64(&s.IngesterSeries, uint64(series))
+		atomic.AddUint64(&s.IngesterSamples, uint64(samples))
+		atomic.AddUint64(&s.IngesterChunks, uint64(chunks))
+	}
+}
+
+// AddIndexQueries adds index lookups, and those answered by the cache.
+func (s *Stats) AddIndexQueries(queries, cacheHits int) {
+	if s != nil {
+		atomic.AddUint64(&s.IndexQueries, uint64(queries))
+		atomic.AddUint64(&s.IndexCacheHits, uint64(cacheHits))
+	}
+}
+
+// AddStoreSeries adds series, and their chunks, found by the store.
+func (s *Stats) AddStoreSeries(series, chunks int) {
+	if s != nil {
+		atomic.AddUint64(&s.StoreSeries, uint64(series))
+		atomic.AddUint64(&s.StoreChunks, uint64(chunks))
+	}
+}
+
+// AddFetchedChunks adds fetched chunks, their size, and those which were
+// cached.
+func (s *Stats) AddFetchedChunks(chunks, bytes, cacheHits int) {
+	if s != nil {
+		atomic.AddUint64(&s.FetchedChunks, uint64(chunks))
+		atomic.AddUint64(&s.FetchedChunkBytes, uint64(bytes))
+		atomic.AddUint64(&s.ChunkCacheHits, uint64(cacheHits))
+	}
+}
+
+// Merge adds other to s.
+func (s *Stats) Merge(other *Stats) {
+	if s == nil || other == nil {
+		return
+	}
+	other = other.Snapshot()
+	s.AddWallTime(other.WallTime)
+	s.AddIngesterSeries(int(other.IngesterSeries), int(other.IngesterSamples), int(other.IngesterChunks))
+	s.AddIndexQueries(int(other.IndexQueries), int(other.IndexCacheHits))
+	s.AddStoreSeries(int(other.StoreSeries), int(other.StoreChunks))
+	s.AddFetchedChunks(int(other.FetchedChunks), int(other.FetchedChunkBytes), int(other.ChunkCacheHits))
+}
+
+// Snapshot returns a copy of s, consistent per field.
+func (s *Stats) Snapshot() *Stats {
+	if s == nil {
+		return &Stats{}
+	}
+	return &Stats{
+		WallTime:          time.Duration(atomic.LoadInt64((*int64)(&s.WallTime))),
+		IngesterSeries:    atomic.LoadUint64(&s.IngesterSeries),
+		IngesterSamples:   atomic.LoadUint64(&s.IngesterSamples),
+		IngesterChunks:    atomic.LoadUint64(&s.IngesterChunks),
+		IndexQueries:      atomic.LoadUint64(&s.IndexQueries),
+		IndexCacheHits:    atomic.LoadUint64(&s.IndexCacheHits),
+		StoreSeries:       atomic.LoadUint64(&s.StoreSeries),
+		StoreChunks:       atomic.LoadUint64(&s.StoreChunks),
+		FetchedChunks:     atomic.LoadUint64(&s.FetchedChunks),
+		FetchedChunkBytes: atomic.LoadUint64(&s.FetchedChunkBytes),
+		ChunkCacheHits:    atomic.LoadUint64(&s.ChunkCacheHits),
+	}
+}
+
+// KeyValues returns s as key/value pairs to log.
+func (s *Stats) KeyValues() []interface{} {
+	snapshot := s.Snapshot()
+	return []interface{}{
+		"querier_wall_time", snapshot.WallTime,
+		"ingester_series", snapshot.IngesterSeries,
+		"ingester_samples", snapshot.IngesterSamples,
+		"ingester_chunks", snapshot.IngesterChunks,
+		"index_queries", snapshot.IndexQueries,
+		"index_cache_hits", snapshot.IndexCacheHits,
+		"store_series", snapshot.StoreSeries,
+		"store_chunks", snapshot.StoreChunks,
+		"fetched_chunks", snapshot.FetchedChunks,
+		"fetched_chunk_bytes", snapshot.FetchedChunkBytes,
+		"chunk_cache_hits", snapshot.ChunkCacheHits,
+	}
+}
+
+// Encode returns s as the value of a HeaderName header.
+func (s *Stats) Encode() string {
+	buf, err := json.Marshal(s.Snapshot())
+	if err != nil {
+		// Can't happen for a struct of numbers.
+		panic(err)
+	}
+	return string(buf)
+}
+
+// Decode parses the value of a HeaderName header.
+func Decode(value string) (*Stats, error) {
+	var stats Stats
+	if err := json.Unmarshal([]byte(value), &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// Middleware collects the Stats of each request, and returns them in a
+// HeaderName response header.
+var Middleware = middleware.Func(func(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats, ctx := ContextWithEmptyStats(r.Context())
+		next.ServeHTTP(&statsResponseWriter{
+			ResponseWriter: w,
+			stats:          stats,
+			start:          time.Now(),
+		}, r.WithContext(ctx))
+	})
+})
+
+// statsResponseWriter sets the HeaderName header when the response is
+// written, by when the handler has finished querying.
+type statsResponseWriter struct {
+	http.ResponseWriter
+	stats       *Stats
+	start       time.Time
+	wroteHeader bool
+}
+
+func (w *statsResponseWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.stats.AddWallTime(time.Since(w.start))
+		w.Header().Set(HeaderName, w.stats.Encode())
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statsResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
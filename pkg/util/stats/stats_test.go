@@ -0,0 +1,59 @@
+package stats
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsNil(t *testing.T) {
+	var stats *Stats
+	stats.AddIndexQueries(1, 1)
+	stats.Merge(&Stats{IndexQueries: 1})
+	require.Equal(t, &Stats{}, stats.Snapshot())
+	require.Nil(t, FromContext(context.Background()))
+}
+
+func TestMiddleware(t *testing.T) {
+	handler := Middleware.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats := FromContext(r.Context())
+		stats.AddIngesterSeries(1, 10, 0)
+		stats.AddIndexQueries(3, 2)
+		stats.AddStoreSeries(2, 4)
+		stats.AddFetchedChunks(4, 1024, 1)
+		w.Write([]byte("OK"))
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "OK", recorder.Body.String())
+
+	stats, err := Decode(recorder.Header().Get(HeaderName))
+	require.NoError(t, err)
+	require.True(t, stats.WallTime > 0)
+	stats.WallTime = 0
+	require.Equal(t, &Stats{
+		IngesterSeries:    1,
+		IngesterSamples:   10,
+		IndexQueries:      3,
+		IndexCacheHits:    2,
+		StoreSeries:       2,
+		StoreChunks:       4,
+		FetchedChunks:     4,
+		FetchedChunkBytes: 1024,
+		ChunkCacheHits:    1,
+	}, stats)
+
+	// Merging sums every field.
+	total, _ := ContextWithEmptyStats(context.Background())
+	total.Merge(stats)
+	total.Merge(&Stats{WallTime: time.Second, IndexQueries: 1})
+	require.Equal(t, time.Second, total.WallTime)
+	require.Equal(t, uint64(4), total.IndexQueries)
+	require.Equal(t, uint64(1024), total.FetchedChunkBytes)
+}
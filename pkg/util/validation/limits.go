@@ -3,6 +3,8 @@ package validation
 import (
 	"flag"
 	"time"
+
+	"github.com/cortexproject/cortex/pkg/util/flagext"
 )
 
 // Limits describe all the limits for users; can be used to describe global default
@@ -30,6 +32,22 @@ type Limits struct {
 	MaxQueryLength      time.Duration `yaml:"max_query_length"`
 	MaxQueryParallelism int           `yaml:"max_query_parallelism"`
 	CardinalityLimit    int           `yaml:"cardinality_limit"`
+	AllowFederation     bool          `yaml:"allow_federation"`
+
+	// Frontend enforced limits.
+	MaxQueryLookback     time.Duration `yaml:"max_query_lookback"`
+	MinQueryStep         time.Duration `yaml:"min_query_step"`
+	MaxPointsPerSeries   int           `yaml:"max_points_per_series"`
+	MaxConcurrentQueries int           `yaml:"max_concurrent_queries"`
+
+	// Store enforced limits.
+	RetentionPeriod time.Duration `yaml:"retention_period"`
+
+	// Alertmanager enforced limits.
+	NotificationRateLimit int             `yaml:"alertmanager_notification_rate_limit"`
+	AllowedIntegrations   flagext.Strings `yaml:"alertmanager_allowed_integrations"`
+	DeniedIntegrations    flagext.Strings `yaml:"alertmanager_denied_integrations"`
+	AllowedWebhookHosts   flagext.Strings `yaml:"alertmanager_allowed_webhook_hosts"`
 
 	// Config for overrides, convenient if it goes here.
 	PerTenantOverrideConfig string
@@ -57,6 +75,19 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.DurationVar(&l.MaxQueryLength, "store.max-query-length", 0, "Limit to length of chunk store queries, 0 to disable.")
 	f.IntVar(&l.MaxQueryParallelism, "querier.max-query-parallelism", 14, "Maximum number of queries will be scheduled in parallel by the frontend.")
 	f.IntVar(&l.CardinalityLimit, "store.cardinality-limit", 1e5, "Cardinality limit for index queries.")
+	f.BoolVar(&l.AllowFederation, "querier.allow-federation", false, "Allow a user's data to be read by queries across several users, with -querier.tenant-federation.")
+
+	f.DurationVar(&l.MaxQueryLookback, "frontend.max-query-lookback", 0, "Limit how long ago queries can read data from; the start of range, series and label queries is moved forward to it. Defaults to -store.retention-period if that is set and shorter, 0 to disable.")
+	f.DurationVar(&l.MinQueryStep, "frontend.min-query-step", 0, "Reject range queries with a smaller step than this, 0 to disable.")
+	f.IntVar(&l.MaxPointsPerSeries, "frontend.max-points-per-series", 11000, "Reject range queries which would return more points than this per series. Can't be raised above 11000.")
+	f.IntVar(&l.MaxConcurrentQueries, "frontend.max-concurrent-queries", 0, "Maximum number of queries a user can run at once per frontend; more are rejected with HTTP 429, 0 to disable.")
+
+	f.DurationVar(&l.RetentionPeriod, "store.retention-period", 0, "Hide a user's data from queries, and delete their chunks and index entries, once they are older than this, 0 to use -table-manager.retention-period. May not be longer than -table-manager.retention-period, after which tables are deleted.")
+
+	f.IntVar(&l.NotificationRateLimit, "alertmanager.notification-rate-limit", 0, "Per-user limit on notifications sent per integration type per minute, 0 to disable.")
+	f.Var(&l.AllowedIntegrations, "alertmanager.allowed-integrations", "Integration type (e.g. webhook, slack) users' receivers may use. May be repeated; if not set, all integrations not denied are allowed.")
+	f.Var(&l.DeniedIntegrations, "alertmanager.denied-integrations", "Integration type (e.g. email) users' receivers may not use. May be repeated.")
+	f.Var(&l.AllowedWebhookHosts, "alertmanager.allowed-webhook-hosts", "Host users' webhooks may send notifications to. May be repeated; if not set, webhooks may send to any host.")
 
 	f.StringVar(&l.PerTenantOverrideConfig, "limits.per-user-override-config", "", "File name of per-user overrides.")
 	f.DurationVar(&l.PerTenantOverridePeriod, "limits.per-user-override-period", 10*time.Second, "Period with this to reload the overrides.")
@@ -156,6 +156,16 @@ func (o *Overrides) getDuration(userID string, f func(*Limits) time.Duration) ti
 	return f(override)
 }
 
+func (o *Overrides) getStrings(userID string, f func(*Limits) []string) []string {
+	o.overridesMtx.RLock()
+	defer o.overridesMtx.RUnlock()
+	override, ok := o.overrides[userID]
+	if !ok {
+		return f(&o.Defaults)
+	}
+	return f(override)
+}
+
 // IngestionRate returns the limit on ingester rate (samples per second).
 func (o *Overrides) IngestionRate(userID string) float64 {
 	return o.getFloat(userID, func(l *Limits) float64 {
@@ -278,3 +288,110 @@ func (o *Overrides) CardinalityLimit(userID string) int {
 		return l.CardinalityLimit
 	})
 }
+
+// AllowFederation returns whether a user's data may be read by queries
+// across several users.
+func (o *Overrides) AllowFederation(userID string) bool {
+	return o.getBool(userID, func(l *Limits) bool {
+		return l.AllowFederation
+	})
+}
+
+// MaxQueryLookback returns how long ago queries can read data from, 0 for no
+// limit.
+func (o *Overrides) MaxQueryLookback(userID string) time.Duration {
+	return o.getDuration(userID, func(l *Limits) time.Duration {
+		return l.MaxQueryLookback
+	})
+}
+
+// MinQueryStep returns the smallest step of range queries.
+func (o *Overrides) MinQueryStep(userID string) time.Duration {
+	return o.getDuration(userID, func(l *Limits) time.Duration {
+		return l.MinQueryStep
+	})
+}
+
+// MaxPointsPerSeries returns the most points range queries can return per
+// series.
+func (o *Overrides) MaxPointsPerSeries(userID string) int {
+	return o.getInt(userID, func(l *Limits) int {
+		return l.MaxPointsPerSeries
+	})
+}
+
+// MaxConcurrentQueries returns how many queries a user can run at once per
+// frontend, 0 for no limit.
+func (o *Overrides) MaxConcurrentQueries(userID string) int {
+	return o.getInt(userID, func(l *Limits) int {
+		return l.MaxConcurrentQueries
+	})
+}
+
+// RetentionPeriod returns how long a user's chunks are kept for, 0 for the
+// default retention.
+func (o *Overrides) RetentionPeriod(userID string) time.Duration {
+	return o.getDuration(userID, func(l *Limits) time.Duration {
+		return l.RetentionPeriod
+	})
+}
+
+// MinRetentionPeriod returns the shortest retention period of any user, 0 if
+// none have one.
+func (o *Overrides) MinRetentionPeriod() time.Duration {
+	o.overridesMtx.RLock()
+	defer o.overridesMtx.RUnlock()
+	result := o.Defaults.RetentionPeriod
+	for _, override := range o.overrides {
+		if override.RetentionPeriod > 0 && (result <= 0 || override.RetentionPeriod < result) {
+			result = override.RetentionPeriod
+		}
+	}
+	return result
+}
+
+// MaxRetentionPeriod returns the longest retention period of any user, 0 if
+// none have one.
+func (o *Overrides) MaxRetentionPeriod() time.Duration {
+	o.overridesMtx.RLock()
+	defer o.overridesMtx.RUnlock()
+	result := o.Defaults.RetentionPeriod
+	for _, override := range o.overrides {
+		if override.RetentionPeriod > result {
+			result = override.RetentionPeriod
+		}
+	}
+	return result
+}
+
+// NotificationRateLimit returns the limit on notifications sent per
+// integration type per minute.
+func (o *Overrides) NotificationRateLimit(userID string) int {
+	return o.getInt(userID, func(l *Limits) int {
+		return l.NotificationRateLimit
+	})
+}
+
+// AllowedIntegrations returns the integration types a user's receivers may
+// use. An empty list allows all of them.
+func (o *Overrides) AllowedIntegrations(userID string) []string {
+	return o.getStrings(userID, func(l *Limits) []string {
+		return l.AllowedIntegrations
+	})
+}
+
+// DeniedIntegrations returns the integration types a user's receivers may
+// not use.
+func (o *Overrides) DeniedIntegrations(userID string) []string {
+	return o.getStrings(userID, func(l *Limits) []string {
+		return l.DeniedIntegrations
+	})
+}
+
+// AllowedWebhookHosts returns the hosts a user's webhooks may send to. An
+// empty list allows any host.
+func (o *Overrides) AllowedWebhookHosts(userID string) []string {
+	return o.getStrings(userID, func(l *Limits) []string {
+		return l.AllowedWebhookHosts
+	})
+}